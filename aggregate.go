@@ -0,0 +1,523 @@
+package transmogrifier
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AggregateFunc is a function that aggregates the values of a column.
+type AggregateFunc int
+
+// The aggregate functions. Empty values are ignored.
+const (
+	AggSum AggregateFunc = iota
+	// AggCount counts the values; count(*) counts the rows.
+	AggCount
+	// AggMin and AggMax are the smallest and largest value: numbers,
+	// including currency amounts, and dates are compared as such, anything
+	// else as strings.
+	AggMin
+	AggMax
+	AggMean
+	AggMedian
+	// AggDistinct counts the distinct values.
+	AggDistinct
+)
+
+var aggregateFuncNames = map[string]AggregateFunc{
+	"sum":      AggSum,
+	"count":    AggCount,
+	"min":      AggMin,
+	"max":      AggMax,
+	"mean":     AggMean,
+	"avg":      AggMean,
+	"median":   AggMedian,
+	"distinct": AggDistinct,
+}
+
+func (f AggregateFunc) String() string {
+	switch f {
+	case AggSum:
+		return "sum"
+	case AggCount:
+		return "count"
+	case AggMin:
+		return "min"
+	case AggMax:
+		return "max"
+	case AggMean:
+		return "mean"
+	case AggMedian:
+		return "median"
+	case AggDistinct:
+		return "distinct"
+	}
+	return "unknown"
+}
+
+// AggregateColumn is an aggregated column, e.g. 'sum(amount) as Total'.
+type AggregateColumn struct {
+	Func AggregateFunc
+	// Column is a column name, or a '#' position, as in a Projection. For
+	// AggCount, it can be '*', every row.
+	Column string
+	// Name is the name of the aggregated column; if it is empty, it is,
+	// e.g., 'sum(amount)'.
+	Name string
+}
+
+func (a AggregateColumn) String() string {
+	return fmt.Sprintf("%s(%s)", a.Func, a.Column)
+}
+
+// ParseAggregates parses a comma separated list of aggregated columns, e.g.
+// 'sum(amount) as Total, count(*), median(price)'.
+func ParseAggregates(s string) ([]AggregateColumn, error) {
+	items, err := splitUnquoted(s)
+	if err != nil {
+		return nil, fmt.Errorf("aggregates %q: %s", s, err)
+	}
+	return parseAggregateItems(items)
+}
+
+// parseAggregateItems parses the items of a list of aggregated columns, e.g.
+// the values of a format file's 'aggregate' directive. Empty items are
+// ignored.
+func parseAggregateItems(items []string) ([]AggregateColumn, error) {
+	var aggs []AggregateColumn
+	for _, s := range items {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		a, err := parseAggregate(s)
+		if err != nil {
+			return nil, fmt.Errorf("aggregate %q: %s", s, err)
+		}
+		aggs = append(aggs, a)
+	}
+	if len(aggs) == 0 {
+		return nil, fmt.Errorf("aggregates: no columns")
+	}
+	return aggs, nil
+}
+
+// parseAggregate parses 'func(column)', with an optional 'as name'.
+func parseAggregate(s string) (AggregateColumn, error) {
+	var a AggregateColumn
+	if i := indexUnquoted(s, " as "); i >= 0 {
+		a.Name = unquoteColumn(strings.TrimSpace(s[i+4:]))
+		s = strings.TrimSpace(s[:i])
+		if a.Name == "" {
+			return a, fmt.Errorf("no new name")
+		}
+	}
+	open := strings.Index(s, "(")
+	if open < 0 || !strings.HasSuffix(s, ")") {
+		return a, fmt.Errorf("expected func(column)")
+	}
+	name := strings.ToLower(strings.TrimSpace(s[:open]))
+	f, ok := aggregateFuncNames[name]
+	if !ok {
+		return a, fmt.Errorf("unknown function %q", name)
+	}
+	a.Func = f
+	a.Column = strings.TrimSpace(s[open+1 : len(s)-1])
+	if a.Column == "" {
+		return a, fmt.Errorf("no column")
+	}
+	if a.Column == "*" {
+		if f != AggCount {
+			return a, fmt.Errorf("only count can be of *")
+		}
+		return a, nil
+	}
+	_, err := parseColumnRef(a.Column)
+	return a, err
+}
+
+// resolve returns the column, from 0, that the aggregate is of; -1 is
+// every row.
+func (a AggregateColumn) resolve(names []string, n int) (int, error) {
+	if a.Column == "*" {
+		return -1, nil
+	}
+	ref, err := parseColumnRef(a.Column)
+	if err != nil {
+		return 0, err
+	}
+	return ref.resolve(names, n)
+}
+
+// aggregate returns the aggregate of the column's values in the rows.
+func (a AggregateColumn) aggregate(rows [][]string, col int) (string, error) {
+	if col < 0 {
+		return strconv.Itoa(len(rows)), nil
+	}
+	var vals []string
+	for _, row := range rows {
+		if col < len(row) && strings.TrimSpace(row[col]) != "" {
+			vals = append(vals, row[col])
+		}
+	}
+	switch a.Func {
+	case AggCount:
+		return strconv.Itoa(len(vals)), nil
+	case AggDistinct:
+		seen := map[string]bool{}
+		for _, v := range vals {
+			seen[v] = true
+		}
+		return strconv.Itoa(len(seen)), nil
+	case AggMin, AggMax:
+		return extreme(vals, a.Func == AggMax), nil
+	}
+	if len(vals) == 0 {
+		return "", nil
+	}
+	nums := make([]float64, len(vals))
+	var decimals int
+	for i, v := range vals {
+		v = strings.TrimSpace(v)
+		var ok bool
+		nums[i], ok = parseCurrency(v)
+		if !ok {
+			return "", fmt.Errorf("%s: %q isn't a number", a, v)
+		}
+		if j := strings.LastIndex(v, "."); j >= 0 {
+			if d := len(strings.TrimRight(v[j+1:], ")")); d > decimals {
+				decimals = d
+			}
+		}
+	}
+	var n float64
+	switch a.Func {
+	case AggSum, AggMean:
+		for _, v := range nums {
+			n += v
+		}
+		if a.Func == AggMean {
+			n /= float64(len(nums))
+		}
+	case AggMedian:
+		sort.Float64s(nums)
+		n = nums[len(nums)/2]
+		if len(nums)%2 == 0 {
+			n = (nums[len(nums)/2-1] + n) / 2
+		}
+	}
+	return formatAggregate(n, decimals), nil
+}
+
+// formatAggregate formats n with the decimals of the values it is the
+// aggregate of; a mean or median that isn't a whole number has at least two.
+func formatAggregate(n float64, decimals int) string {
+	if math.Abs(n-math.Round(n*math.Pow10(decimals))/math.Pow10(decimals)) > 1e-9 && decimals < 2 {
+		decimals = 2
+	}
+	return strconv.FormatFloat(n, 'f', decimals, 64)
+}
+
+// extreme returns the smallest, or, if max is set, the largest value.
+// Numbers and dates are compared as such if every value is one.
+func extreme(vals []string, max bool) string {
+	if len(vals) == 0 {
+		return ""
+	}
+	typ := SortString
+	for _, t := range []SortType{SortCurrency, SortDate} {
+		ok := true
+		for _, v := range vals {
+			if !parseSortValue(v, t).ok {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			typ = t
+			break
+		}
+	}
+	key := SortKey{Desc: max}
+	best := parseSortValue(vals[0], typ)
+	for _, v := range vals[1:] {
+		sv := parseSortValue(v, typ)
+		if compareSortValues(sv, best, typ, key, nil) < 0 {
+			best = sv
+		}
+	}
+	return best.s
+}
+
+// Grouping groups the rows of a table by columns, and aggregates each
+// group's rows into a row: the group's values, then its aggregates. The
+// groups are in the order they are first seen. Without columns, every row
+// is in one group.
+type Grouping struct {
+	// By are the columns, names or '#' positions, that rows are grouped
+	// by.
+	By         []string
+	Aggregates []AggregateColumn
+}
+
+// ParseGrouping parses the group by columns, a comma separated list, e.g.
+// 'region, product', and the aggregates; see ParseAggregates.
+func ParseGrouping(by, aggregates string) (*Grouping, error) {
+	g := &Grouping{}
+	var err error
+	g.By, err = parseColumnList(by)
+	if err != nil {
+		return nil, fmt.Errorf("group by %q: %s", by, err)
+	}
+	g.Aggregates, err = ParseAggregates(aggregates)
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Apply returns the grouped table's header and rows.
+func (g *Grouping) Apply(header []string, rows [][]string) ([]string, [][]string, error) {
+	h, r, _, err := g.apply(header, rows)
+	return h, r, err
+}
+
+// Group returns the grouped header and rows of the CSV.
+func (c *CSV) Group(g *Grouping) ([]string, [][]string, error) {
+	return g.Apply(c.headerRow, c.rows)
+}
+
+// apply groups the rows. cols are the columns of the table that the
+// grouped table's columns are, or are the aggregates of; -1 is count(*).
+func (g *Grouping) apply(header []string, rows [][]string) (outHeader []string, out [][]string, cols []int, err error) {
+	by, err := resolveColumns(g.By, header, rows)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	n := tableWidthOf(header, rows)
+	cols = append(cols, by...)
+	outHeader = columnNames(header, by)
+	aggCols := make([]int, len(g.Aggregates))
+	for i, a := range g.Aggregates {
+		aggCols[i], err = a.resolve(header, n)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		cols = append(cols, aggCols[i])
+		name := a.Name
+		if name == "" {
+			name = a.String()
+		}
+		outHeader = append(outHeader, name)
+	}
+	var keys []string
+	groups := map[string][][]string{}
+	for _, row := range rows {
+		k := groupKey(row, by)
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], row)
+	}
+	for _, k := range keys {
+		group := groups[k]
+		row := projectRow(group[0], by)
+		for i, a := range g.Aggregates {
+			v, err := a.aggregate(group, aggCols[i])
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			row = append(row, v)
+		}
+		out = append(out, row)
+	}
+	return outHeader, out, cols, nil
+}
+
+// parseColumnList parses a comma separated list of column names, or '#'
+// positions, e.g. 'region, #2'.
+func parseColumnList(s string) ([]string, error) {
+	items, err := splitUnquoted(s)
+	if err != nil {
+		return nil, err
+	}
+	return parseColumnItems(items)
+}
+
+// parseColumnItems validates the column references, e.g. the values of a
+// format file directive; empty items are removed.
+func parseColumnItems(items []string) ([]string, error) {
+	var cols []string
+	for _, s := range items {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if _, err := parseColumnRef(s); err != nil {
+			return nil, err
+		}
+		cols = append(cols, s)
+	}
+	return cols, nil
+}
+
+// resolveColumns resolves the column references for the table.
+func resolveColumns(refs []string, header []string, rows [][]string) ([]int, error) {
+	n := tableWidthOf(header, rows)
+	cols := make([]int, len(refs))
+	for i, s := range refs {
+		ref, err := parseColumnRef(s)
+		if err != nil {
+			return nil, err
+		}
+		cols[i], err = ref.resolve(header, n)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cols, nil
+}
+
+// groupKey returns the key of the row's group: its values of the columns.
+func groupKey(row []string, cols []int) string {
+	return strings.Join(projectRow(row, cols), "\x00")
+}
+
+// Totals adds summary rows to a table: a footer row with the aggregates of
+// every row and, if SubtotalBy is set, a subtotal row after each run of rows
+// that have the same SubtotalBy values; sort the rows by them first. Each
+// aggregate is in the column it aggregates.
+type Totals struct {
+	// Aggregates are the aggregated columns; their names aren't used.
+	// count(*) follows the label, e.g. 'Total: 12'.
+	Aggregates []AggregateColumn
+	// Label is put in the footer row's first column that isn't
+	// aggregated; if it is empty, it is "Total".
+	Label string
+	// SubtotalBy are the columns, names or '#' positions, of the groups
+	// that have subtotals. A subtotal row has its group's values in these
+	// columns.
+	SubtotalBy []string
+	// SubtotalLabel is put in a subtotal row's first column that isn't
+	// aggregated, or a SubtotalBy column; if it is empty, it is
+	// "Subtotal".
+	SubtotalLabel string
+	// Emphasis is the emphasis of each column of the summary rows, as the
+	// column emphasis is; if it is nil, the column emphasis is used.
+	Emphasis []string
+}
+
+// ParseTotals parses the aggregates, see ParseAggregates, and the subtotal
+// columns, a comma separated list, which can be empty.
+func ParseTotals(aggregates, subtotalBy string) (*Totals, error) {
+	t := &Totals{}
+	var err error
+	t.Aggregates, err = ParseAggregates(aggregates)
+	if err != nil {
+		return nil, err
+	}
+	t.SubtotalBy, err = parseColumnList(subtotalBy)
+	if err != nil {
+		return nil, fmt.Errorf("subtotals %q: %s", subtotalBy, err)
+	}
+	return t, nil
+}
+
+// Apply returns the rows with the subtotal rows and the footer row.
+func (t *Totals) Apply(header []string, rows [][]string) ([][]string, error) {
+	out, _, err := t.apply(header, rows)
+	return out, err
+}
+
+// apply returns the rows with the summary rows; summary is whether each row
+// is a summary row.
+func (t *Totals) apply(header []string, rows [][]string) (out [][]string, summary []bool, err error) {
+	n := tableWidthOf(header, rows)
+	aggCols := make([]int, len(t.Aggregates))
+	// used are the columns that have aggregates.
+	used := map[int]bool{}
+	for i, a := range t.Aggregates {
+		aggCols[i], err = a.resolve(header, n)
+		if err != nil {
+			return nil, nil, err
+		}
+		used[aggCols[i]] = true
+	}
+	by, err := resolveColumns(t.SubtotalBy, header, rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, c := range by {
+		used[c] = true
+	}
+	label, subLabel := t.Label, t.SubtotalLabel
+	if label == "" {
+		label = "Total"
+	}
+	if subLabel == "" {
+		subLabel = "Subtotal"
+	}
+	// labelCol is the first column that is free for the labels.
+	labelCol := -1
+	for i := 0; i < n; i++ {
+		if !used[i] {
+			labelCol = i
+			break
+		}
+	}
+	summaryRow := func(group [][]string, label string) ([]string, error) {
+		row := make([]string, n)
+		if labelCol >= 0 {
+			row[labelCol] = label
+		}
+		for i, a := range t.Aggregates {
+			v, err := a.aggregate(group, aggCols[i])
+			if err != nil {
+				return nil, err
+			}
+			switch c := aggCols[i]; {
+			case c >= 0:
+				row[c] = v
+			case labelCol >= 0:
+				row[labelCol] = label + ": " + v
+			}
+		}
+		return row, nil
+	}
+	if len(by) > 0 {
+		for start := 0; start < len(rows); {
+			end := start + 1
+			k := groupKey(rows[start], by)
+			for end < len(rows) && groupKey(rows[end], by) == k {
+				end++
+			}
+			for _, row := range rows[start:end] {
+				out = append(out, row)
+				summary = append(summary, false)
+			}
+			row, err := summaryRow(rows[start:end], subLabel)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, c := range by {
+				if c < len(rows[start]) {
+					row[c] = rows[start][c]
+				}
+			}
+			out = append(out, row)
+			summary = append(summary, true)
+			start = end
+		}
+	} else {
+		out = append(out, rows...)
+		summary = make([]bool, len(rows))
+	}
+	row, err := summaryRow(rows, label)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(out, row), append(summary, true), nil
+}
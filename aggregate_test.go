@@ -0,0 +1,133 @@
+package transmogrifier
+
+import (
+	"reflect"
+	"testing"
+)
+
+var salesHeader = []string{"region", "product", "amount", "date"}
+
+var salesRows = [][]string{
+	[]string{"east", "tea", "$1,200.50", "2024-03-01"},
+	[]string{"east", "coffee", "$95.25", "2024-01-15"},
+	[]string{"west", "tea", "10", "2024-02-01"},
+	[]string{"east", "tea", "", "2024-04-01"},
+	[]string{"west", "cocoa", "5", ""},
+}
+
+func TestGroupingApply(t *testing.T) {
+	tests := []struct {
+		by             string
+		aggregates     string
+		expectedHeader []string
+		expectedRows   [][]string
+		expectedErr    string
+	}{
+		{"region", "sum(amount) as Total, count(*), count(amount)", []string{"region", "Total", "count(*)", "count(amount)"}, [][]string{{"east", "1295.75", "3", "2"}, {"west", "15", "2", "2"}}, ""},
+		{"region, product", "sum(amount)", []string{"region", "product", "sum(amount)"}, [][]string{{"east", "tea", "1200.50"}, {"east", "coffee", "95.25"}, {"west", "tea", "10"}, {"west", "cocoa", "5"}}, ""},
+		{"", "min(amount), max(amount), min(date), max(product)", []string{"min(amount)", "max(amount)", "min(date)", "max(product)"}, [][]string{{"5", "$1,200.50", "2024-01-15", "tea"}}, ""},
+		{"#2", "mean(amount), median(amount), distinct(region)", []string{"product", "mean(amount)", "median(amount)", "distinct(region)"}, [][]string{{"tea", "605.25", "605.25", "2"}, {"coffee", "95.25", "95.25", "1"}, {"cocoa", "5", "5", "1"}}, ""},
+		{"", "mean(amount), median(amount)", []string{"mean(amount)", "median(amount)"}, [][]string{{"327.69", "52.62"}}, ""},
+		{"region", "sum(product)", nil, nil, `sum(product): "tea" isn't a number`},
+		{"state", "count(*)", nil, nil, `unknown column "state"`},
+		{"region", "total(amount)", nil, nil, `aggregate "total(amount)": unknown function "total"`},
+		{"region", "sum(*)", nil, nil, `aggregate "sum(*)": only count can be of *`},
+		{"region", "sum amount", nil, nil, `aggregate "sum amount": expected func(column)`},
+		{"region", "sum()", nil, nil, `aggregate "sum()": no column`},
+		{"region", "", nil, nil, "aggregates: no columns"},
+	}
+	for i, test := range tests {
+		g, err := ParseGrouping(test.by, test.aggregates)
+		var h []string
+		var r [][]string
+		if err == nil {
+			h, r, err = g.Apply(salesHeader, salesRows)
+		}
+		if err != nil {
+			if err.Error() != test.expectedErr {
+				t.Errorf("%d: expected error %q, got %q", i, test.expectedErr, err)
+			}
+			continue
+		}
+		if test.expectedErr != "" {
+			t.Errorf("%d: expected error %q, got none", i, test.expectedErr)
+			continue
+		}
+		if !reflect.DeepEqual(h, test.expectedHeader) {
+			t.Errorf("%d: expected header %q, got %q", i, test.expectedHeader, h)
+		}
+		if !reflect.DeepEqual(r, test.expectedRows) {
+			t.Errorf("%d: expected rows %q, got %q", i, test.expectedRows, r)
+		}
+	}
+}
+
+func TestTotalsApply(t *testing.T) {
+	rows := [][]string{
+		[]string{"east", "tea", "2"},
+		[]string{"east", "coffee", "3"},
+		[]string{"west", "tea", "4.5"},
+	}
+	tests := []struct {
+		totals   Totals
+		expected [][]string
+	}{
+		{
+			Totals{Aggregates: []AggregateColumn{{Func: AggSum, Column: "amount"}}},
+			append(rows[:3:3], []string{"Total", "", "9.5"}),
+		},
+		{
+			Totals{Aggregates: []AggregateColumn{{Func: AggSum, Column: "amount"}, {Func: AggCount, Column: "*"}}, SubtotalBy: []string{"region"}, Label: "All"},
+			[][]string{
+				rows[0], rows[1], []string{"east", "Subtotal: 2", "5"},
+				rows[2], []string{"west", "Subtotal: 1", "4.5"},
+				[]string{"", "All: 3", "9.5"},
+			},
+		},
+		{
+			Totals{Aggregates: []AggregateColumn{{Func: AggMax, Column: "#3"}, {Func: AggDistinct, Column: "product"}}, SubtotalLabel: "-"},
+			append(rows[:3:3], []string{"Total", "2", "4.5"}),
+		},
+	}
+	for i, test := range tests {
+		r, err := test.totals.Apply([]string{"region", "product", "amount"}, rows)
+		if err != nil {
+			t.Errorf("%d: expected no error, got %q", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(r, test.expected) {
+			t.Errorf("%d: expected %q, got %q", i, test.expected, r)
+		}
+	}
+}
+
+func TestMDTableTotals(t *testing.T) {
+	tot, err := ParseTotals("sum(amount)", "region")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tot.Emphasis = []string{"bold", "bold", "bold"}
+	p, err := ParseProjection("product, amount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := NewMDTable()
+	md.SetHasColumnNames(true)
+	md.SetUseFormat(true)
+	md.SetColumnEmphasis([]string{"", "italic", ""})
+	md.SetTotals(tot)
+	md.SetProjection(p)
+	err = md.TransmogrifyStringTable([][]string{
+		{"region", "product", "amount"},
+		{"east", "tea", "2"},
+		{"east", "coffee", "3"},
+		{"west", "tea", "4"},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	expected := "|product|amount|  \n|---|---|  \n|_tea_|2|  \n|_coffee_|3|  \n|__Subtotal__|__5__|  \n|_tea_|4|  \n|__Subtotal__|__4__|  \n|__Total__|__9__|  \n"
+	if md.String() != expected {
+		t.Errorf("expected %q, got %q", expected, md.String())
+	}
+}
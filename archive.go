@@ -0,0 +1,525 @@
+package transmogrifier
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// archiveType is the type of an archive.
+type archiveType int
+
+const (
+	noArchive archiveType = iota
+	zipArchive
+	tarArchive
+)
+
+// tarExts are the extensions of tar archives; tar archives can also have a
+// compression extension, e.g. '.tar.gz'.
+var tarExts = []string{".tar", ".tgz", ".tbz2", ".tbz", ".txz", ".tzst"}
+
+// archiveTypeFromName returns the type of archive indicated by the name's
+// extension.
+func archiveTypeFromName(name string) archiveType {
+	name = strings.ToLower(name)
+	if strings.HasSuffix(name, ".zip") {
+		return zipArchive
+	}
+	_, name = compressionFromName(name)
+	for _, ext := range tarExts {
+		if strings.HasSuffix(name, ext) {
+			return tarArchive
+		}
+	}
+	return noArchive
+}
+
+// archiveCompression returns the compression of the archive, including the
+// compression implied by the single extension forms, e.g. '.tgz'.
+func archiveCompression(name string) Compression {
+	c, _ := compressionFromName(name)
+	if c != NoCompression {
+		return c
+	}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".tgz":
+		return Gzip
+	case ".tbz2", ".tbz":
+		return Bzip2
+	case ".txz":
+		return Xz
+	case ".tzst":
+		return Zstd
+	}
+	return NoCompression
+}
+
+// splitArchivePath splits s, e.g. bundle.zip!/reports/q3.csv, into the
+// archive and the member's path. False is returned if s doesn't refer to a
+// member of an archive.
+func splitArchivePath(s string) (archive, member string, ok bool) {
+	i := strings.Index(s, "!/")
+	if i < 0 || archiveTypeFromName(s[:i]) == noArchive {
+		return "", "", false
+	}
+	member = strings.TrimPrefix(path.Clean("/"+s[i+2:]), "/")
+	if member == "" {
+		return "", "", false
+	}
+	return s[:i], member, true
+}
+
+// openMember opens the archive member that the resource refers to.
+func (r resource) openMember() (io.ReadCloser, error) {
+	ar := NewResource(r.Archive, FmtUnsupported, File)
+	ar.copyConfig(r)
+	name := path.Join(r.Path, r.Name)
+	if archiveTypeFromName(r.Archive) == zipArchive {
+		zr, closer, err := openZip(ar)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			if memberName(f.Name) != name || f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				closer.Close()
+				return nil, err
+			}
+			return readCloser{rc, func() error {
+				rc.Close()
+				return closer.Close()
+			}}, nil
+		}
+		closer.Close()
+	} else {
+		rc, err := ar.Open()
+		if err != nil {
+			return nil, err
+		}
+		tr := tar.NewReader(rc)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				rc.Close()
+				return nil, fmt.Errorf("%s: %s", r.Archive, err)
+			}
+			if hdr.Typeflag == tar.TypeReg && memberName(hdr.Name) == name {
+				return readCloser{tr, rc.Close}, nil
+			}
+		}
+		rc.Close()
+	}
+	return nil, &os.PathError{Op: "open", Path: r.String(), Err: os.ErrNotExist}
+}
+
+// openZip returns a reader for the zip archive. Zip archives need random
+// access, so anything other than an uncompressed local file is read into
+// memory.
+func openZip(ar resource) (*zip.Reader, io.Closer, error) {
+	if ar.Type == File && ar.Compression == NoCompression {
+		f, err := os.Open(ar.String())
+		if err != nil {
+			return nil, nil, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		zr, err := zip.NewReader(f, fi.Size())
+		if err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("%s: %s", ar, err)
+		}
+		return zr, f, nil
+	}
+	rc, err := ar.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", ar, err)
+	}
+	return zr, ioutil.NopCloser(nil), nil
+}
+
+// memberName returns the cleaned name of an archive member, without any
+// leading '/' or './'.
+func memberName(s string) string {
+	return strings.TrimPrefix(path.Clean("/"+s), "/")
+}
+
+// archiveMember is a file in an archive.
+type archiveMember struct {
+	name    string
+	modTime time.Time
+	data    []byte
+}
+
+// readArchive reads every regular file in the archive.
+func readArchive(ar resource) ([]archiveMember, error) {
+	var members []archiveMember
+	if archiveTypeFromName(ar.String()) == zipArchive {
+		zr, closer, err := openZip(ar)
+		if err != nil {
+			return nil, err
+		}
+		defer closer.Close()
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %s", ar, f.Name, err)
+			}
+			b, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %s", ar, f.Name, err)
+			}
+			members = append(members, archiveMember{name: memberName(f.Name), modTime: f.Modified, data: b})
+		}
+		return members, nil
+	}
+	rc, err := ar.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return members, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", ar, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %s", ar, hdr.Name, err)
+		}
+		members = append(members, archiveMember{name: memberName(hdr.Name), modTime: hdr.ModTime, data: b})
+	}
+}
+
+// ArchiveResult is the result of transmogrifying a member of an archive.
+type ArchiveResult struct {
+	// Member is the member's path within the source archive.
+	Member string
+	// Dest is where the output was written: the path within the output
+	// archive or, when the output is written to a directory, the file.
+	Dest string
+	// Err is the error, if any, that occurred transmogrifying the member.
+	Err error
+}
+
+// Archive transmogrifies every supported member of a zip or tar archive.
+type Archive struct {
+	// source is the archive.
+	source resource
+	// dest is the output archive, or the directory the outputs are written
+	// to.
+	dest resource
+	// format is the format the members are transmogrified to.
+	format FormatType
+}
+
+// NewArchive returns an Archive for the source, which can be a file path or
+// any URI supported by NewResource. The members are transmogrified to MD
+// tables, which are written to the directory the archive is in.
+func NewArchive(src string) *Archive {
+	return &Archive{source: NewResource(src, FmtUnsupported, File), format: FmtMDTable}
+}
+
+// SetFormat sets the format the members are transmogrified to.
+func (a *Archive) SetFormat(f FormatType) {
+	a.format = f
+}
+
+// SetDest sets where the output is written. If the destination has a zip or
+// tar extension, e.g. '.zip' or '.tar.gz', the outputs are written to a new
+// archive; otherwise it is the directory the outputs are written to. Either
+// way, the directory structure of the source archive is kept. If the
+// destination is an empty string, "", the outputs are written to the
+// directory the source archive is in.
+func (a *Archive) SetDest(s string) {
+	dest := a.dest
+	a.dest = NewResource(s, FmtUnsupported, File)
+	a.dest.copyConfig(dest)
+}
+
+// SetHTTPConfig sets the configuration used when the source or the dest is
+// a http(s) URL.
+func (a *Archive) SetHTTPConfig(cfg *HTTPConfig) {
+	a.source.http = cfg
+	a.dest.http = cfg
+}
+
+// SetS3Config sets the configuration used when the source or the dest is an
+// s3:// URI.
+func (a *Archive) SetS3Config(cfg *S3Config) {
+	a.source.s3 = cfg
+	a.dest.s3 = cfg
+}
+
+// SetWriteOptions sets how the outputs are written, when they are local
+// files.
+func (a *Archive) SetWriteOptions(opts *WriteOptions) {
+	a.dest.write = opts
+}
+
+// Transmogrify transmogrifies every member of the archive that is in a
+// supported format, CSV or fixed-width, into the Archive's format. A member's
+// format file, the member's path with a '.fmt' extension, is used if the
+// archive has one. The result of each member is returned in the order the
+// members appear in the archive; a member that fails doesn't stop the
+// others. Members with the same output, e.g. 'q3.csv' and 'q3.fwf', which
+// are both written to 'q3.md', fail without being transmogrified. The error
+// is non-nil if the archive couldn't be read or the output couldn't be
+// written, or if any member failed.
+func (a *Archive) Transmogrify() ([]ArchiveResult, error) {
+	if archiveTypeFromName(a.source.String()) == noArchive {
+		return nil, fmt.Errorf("%s: not a zip or tar archive", a.source)
+	}
+	members, err := readArchive(a.source)
+	if err != nil {
+		return nil, err
+	}
+	formats := map[string][]byte{}
+	for _, m := range members {
+		if strings.ToLower(path.Ext(m.name)) == ".fmt" {
+			formats[m.name] = m.data
+		}
+	}
+	out, err := a.newArchiveWriter()
+	if err != nil {
+		return nil, err
+	}
+	var results []ArchiveResult
+	var todo []archiveMember
+	var types []FormatType
+	for _, m := range members {
+		src := NewResource(m.name, FmtUnsupported, File)
+		f, _ := formatFromResource(src)
+		if !isDecodable(f) {
+			continue
+		}
+		results = append(results, ArchiveResult{Member: m.name, Dest: filenameFor(m.name, a.format)})
+		todo = append(todo, m)
+		types = append(types, f)
+	}
+	failed := checkArchiveDests(results)
+	for i, m := range todo {
+		if results[i].Err != nil {
+			continue
+		}
+		res := &results[i]
+		b, err := a.transmogrifyMember(m, types[i], formats)
+		if err == nil {
+			res.Dest, err = out.write(res.Dest, m.modTime, b)
+		}
+		if err != nil {
+			res.Err = fmt.Errorf("%s: %s", m.name, err)
+			failed++
+		}
+	}
+	err = out.Close()
+	if err != nil {
+		return results, err
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("%s: %d of %d members failed", a.source, failed, len(results))
+	}
+	return results, nil
+}
+
+// checkArchiveDests fails the members whose output has the name of the output
+// of another member, e.g. 'q3.csv' and 'q3.fwf', which are both written to
+// 'q3.md'; none of them are transmogrified. The number of members that
+// failed is returned.
+func checkArchiveDests(results []ArchiveResult) int {
+	byDest := map[string][]int{}
+	for i, res := range results {
+		byDest[res.Dest] = append(byDest[res.Dest], i)
+	}
+	var failed int
+	for i, res := range results {
+		if len(byDest[res.Dest]) < 2 {
+			continue
+		}
+		var others []string
+		for _, j := range byDest[res.Dest] {
+			if j != i {
+				others = append(others, results[j].Member)
+			}
+		}
+		results[i].Err = fmt.Errorf("%s: duplicate destination %s: also the destination of %s", res.Member, res.Dest, strings.Join(others, ", "))
+		failed++
+	}
+	return failed
+}
+
+// transmogrifyMember transmogrifies the member, which is in the format f.
+func (a *Archive) transmogrifyMember(m archiveMember, f FormatType, formats map[string][]byte) ([]byte, error) {
+	var fm *format
+	fmtName := formatFileFor(m.name)
+	if b, ok := formats[fmtName]; ok {
+		var err error
+		fm, err = readFormat(bytes.NewReader(b))
+		if err != nil {
+			return nil, &FormatError{Name: fmtName, Err: fmt.Errorf("%s: %s", fmtName, err)}
+		}
+	}
+	c, _ := compressionFromName(m.name)
+	r, err := decompress(ioutil.NopCloser(bytes.NewReader(m.data)), c)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	header, rows, err := decodeTable(r, f, fm, fmtName, decodeOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return encodeTable(header, rows, fm, decodeOptions{}, a.format, m.name)
+}
+
+// archiveWriter writes the outputs of an Archive.
+type archiveWriter interface {
+	// write writes the output with the name, a path within the output,
+	// and returns where it was written.
+	write(name string, modTime time.Time, b []byte) (string, error)
+	Close() error
+}
+
+// newArchiveWriter returns the archiveWriter for the Archive's dest.
+func (a *Archive) newArchiveWriter() (archiveWriter, error) {
+	dest := a.dest
+	if dest.Name == "" && dest.URI == "" {
+		if a.source.Type != File || a.source.Archive != "" {
+			return nil, fmt.Errorf("%s: no destination was specified", a.source)
+		}
+		dest = resource{Path: a.source.Path, Type: File, write: a.dest.write}
+		return dirWriter{dest}, nil
+	}
+	typ := archiveTypeFromName(dest.String())
+	if typ == noArchive {
+		return dirWriter{dest}, nil
+	}
+	dest.Compression = archiveCompression(dest.String())
+	w, err := dest.Create()
+	if err != nil {
+		return nil, err
+	}
+	if typ == zipArchive {
+		return &zipWriter{w: w, zw: zip.NewWriter(w)}, nil
+	}
+	return &tarWriter{w: w, tw: tar.NewWriter(w)}, nil
+}
+
+// dirWriter writes outputs to a directory; local directories are created as
+// needed.
+type dirWriter struct {
+	dir resource
+}
+
+func (d dirWriter) write(name string, modTime time.Time, b []byte) (string, error) {
+	r := d.resource(name)
+	if r.Type == File {
+		err := os.MkdirAll(filepath.Dir(r.String()), 0755)
+		if err != nil {
+			return "", err
+		}
+	}
+	_, err := writeResource(r, b)
+	return r.String(), err
+}
+
+// resource returns the resource for the output with the name, a slash
+// separated path within dir.
+func (d dirWriter) resource(name string) resource {
+	var r resource
+	if d.dir.Type == File {
+		r = NewResource(filepath.Join(d.dir.String(), filepath.FromSlash(name)), FmtUnsupported, File)
+	} else {
+		r = NewResource(strings.TrimSuffix(d.dir.String(), "/")+"/"+name, FmtUnsupported, d.dir.Type)
+	}
+	r.Format, _ = formatFromResource(r)
+	r.copyConfig(d.dir)
+	return r
+}
+
+func (d dirWriter) Close() error { return nil }
+
+// zipWriter writes outputs to a zip archive.
+type zipWriter struct {
+	w  io.WriteCloser
+	zw *zip.Writer
+}
+
+func (z *zipWriter) write(name string, modTime time.Time, b []byte) (string, error) {
+	w, err := z.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime})
+	if err != nil {
+		return "", err
+	}
+	_, err = w.Write(b)
+	return name, err
+}
+
+func (z *zipWriter) Close() error {
+	err := z.zw.Close()
+	cerr := z.w.Close()
+	if err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// tarWriter writes outputs to a tar archive.
+type tarWriter struct {
+	w  io.WriteCloser
+	tw *tar.Writer
+}
+
+func (t *tarWriter) write(name string, modTime time.Time, b []byte) (string, error) {
+	err := t.tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(b)), ModTime: modTime, Typeflag: tar.TypeReg})
+	if err != nil {
+		return "", err
+	}
+	_, err = t.tw.Write(b)
+	return name, err
+}
+
+func (t *tarWriter) Close() error {
+	err := t.tw.Close()
+	cerr := t.w.Close()
+	if err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,239 @@
+package transmogrifier
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// bundleFiles are the members of the test archives.
+var bundleFiles = []struct {
+	name string
+	data string
+}{
+	{"reports/q3.csv", "Item,Price\ntowel,$42.00\n"},
+	{"reports/q3.fmt", "Item,Price\nleft,right\nbold,\n"},
+	{"reports/notes.txt", "not a table\n"},
+	{"./fixed/test.fwf", "Id  Name\n1   towel\n"},
+	{"bad.csv", "a,b\n1,2,3\n"},
+}
+
+// writeBundle writes the bundleFiles to a zip or tar archive, depending on
+// the name's extension.
+func writeBundle(t *testing.T, name string) {
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if strings.HasSuffix(name, ".zip") {
+		zw := zip.NewWriter(f)
+		for _, b := range bundleFiles {
+			w, _ := zw.Create(b.name)
+			w.Write([]byte(b.data))
+		}
+		zw.Close()
+		return
+	}
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	tw.WriteHeader(&tar.Header{Name: "reports/", Mode: 0755, Typeflag: tar.TypeDir})
+	for _, b := range bundleFiles {
+		tw.WriteHeader(&tar.Header{Name: b.name, Mode: 0644, Size: int64(len(b.data)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(b.data))
+	}
+	tw.Close()
+	gw.Close()
+}
+
+func TestSplitArchivePath(t *testing.T) {
+	tests := []struct {
+		s       string
+		archive string
+		member  string
+		ok      bool
+	}{
+		{"bundle.zip!/reports/q3.csv", "bundle.zip", "reports/q3.csv", true},
+		{"path/bundle.TAR.GZ!/q3.csv", "path/bundle.TAR.GZ", "q3.csv", true},
+		{"bundle.tgz!//./reports/../q3.csv", "bundle.tgz", "q3.csv", true},
+		{"bundle.zip!/", "", "", false},
+		{"bundle.csv!/q3.csv", "", "", false},
+		{"bundle.zip", "", "", false},
+	}
+	for i, test := range tests {
+		archive, member, ok := splitArchivePath(test.s)
+		if archive != test.archive || member != test.member || ok != test.ok {
+			t.Errorf("%d: expected %q %q %t, got %q %q %t", i, test.archive, test.member, test.ok, archive, member, ok)
+		}
+	}
+}
+
+func TestReadArchiveMember(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"bundle.zip", "bundle.tar.gz"} {
+		archive := filepath.Join(dir, name)
+		writeBundle(t, archive)
+		c := NewCSVSource(archive + "!/reports/q3.csv")
+		err := c.ReadSource()
+		if err != nil {
+			t.Errorf("%s: expected no error, got %q", name, err)
+			continue
+		}
+		if strings.Join(c.HeaderRow(), ",") != "Item,Price" || len(c.Rows()) != 1 {
+			t.Errorf("%s: unexpected data %v %v", name, c.HeaderRow(), c.Rows())
+		}
+		fw := NewFixedWidthSource(archive + "!/fixed/test.fwf")
+		err = fw.ReadSource()
+		if err != nil || len(fw.Rows()) != 1 || fw.Rows()[0][1] != "towel" {
+			t.Errorf("%s: unexpected fixed-width data %v %v", name, fw.Rows(), err)
+		}
+		c.SetSource(archive + "!/reports/missing.csv")
+		err = c.ReadSource()
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: expected a not exist error, got %v", name, err)
+		}
+	}
+
+	md := NewMDTable()
+	err = md.SetSource(filepath.Join(dir, "bundle.zip") + "!/reports/q3.csv")
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	md.SetDest("")
+	if md.dest.String() != filepath.Join(dir, "q3.md") {
+		t.Errorf("expected %q, got %q", filepath.Join(dir, "q3.md"), md.dest.String())
+	}
+	md.SetDest(filepath.Join(dir, "bundle.zip") + "!/q3.md")
+	_, _, err = md.WriteToFile()
+	if err == nil || !strings.HasSuffix(err.Error(), "archive members can't be written to") {
+		t.Errorf("expected an archive member write error, got %v", err)
+	}
+}
+
+func TestArchiveTransmogrify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	q3 := "|Item|Price|  \n|:---|---:|  \n|__towel__|$42.00|  \n"
+	fixed := "|Id|Name|  \n|---|---|  \n|1|towel|  \n"
+	for _, name := range []string{"bundle.zip", "bundle.tar.gz"} {
+		src := filepath.Join(dir, name)
+		writeBundle(t, src)
+		for _, dest := range []string{"out", "out.zip", "out.tgz"} {
+			dest = filepath.Join(dir, name+"-"+dest)
+			a := NewArchive(src)
+			a.SetDest(dest)
+			results, err := a.Transmogrify()
+			if err == nil || err.Error() != src+": 1 of 3 members failed" {
+				t.Errorf("%s: expected 1 of 3 members failed, got %v", dest, err)
+			}
+			if len(results) != 3 {
+				t.Errorf("%s: expected 3 results, got %d", dest, len(results))
+				continue
+			}
+			if results[2].Member != "bad.csv" || results[2].Err == nil {
+				t.Errorf("%s: expected bad.csv to fail, got %+v", dest, results[2])
+			}
+			got := map[string]string{}
+			if strings.HasSuffix(dest, "out") {
+				for _, res := range results[:2] {
+					b, _ := ioutil.ReadFile(res.Dest)
+					rel, _ := filepath.Rel(dest, res.Dest)
+					got[filepath.ToSlash(rel)] = string(b)
+				}
+			} else {
+				members, err := readArchive(NewResource(dest, FmtUnsupported, File))
+				if err != nil {
+					t.Errorf("%s: expected no error, got %q", dest, err)
+				}
+				for _, m := range members {
+					got[m.name] = string(m.data)
+				}
+			}
+			if len(got) != 2 || got["reports/q3.md"] != q3 || got["fixed/test.md"] != fixed {
+				t.Errorf("%s: unexpected output %q", dest, got)
+			}
+		}
+	}
+
+	// the default dest is the archive's directory.
+	a := NewArchive(filepath.Join(dir, "bundle.zip"))
+	a.SetFormat(FmtCSV)
+	results, _ := a.Transmogrify()
+	var names []string
+	for _, res := range results {
+		if res.Err == nil {
+			names = append(names, res.Dest)
+		}
+	}
+	sort.Strings(names)
+	expected := []string{filepath.Join(dir, "fixed", "test.csv"), filepath.Join(dir, "reports", "q3.csv")}
+	if strings.Join(names, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+
+	_, err = NewArchive("test_files/test.csv").Transmogrify()
+	if err == nil || err.Error() != "test_files/test.csv: not a zip or tar archive" {
+		t.Errorf("expected not an archive error, got %v", err)
+	}
+}
+
+func TestArchiveTransmogrifyDuplicateDest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "dup.zip")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, name := range []string{"q3.csv", "q3.fwf", "q4.csv"} {
+		w, _ := zw.Create(name)
+		w.Write([]byte("a,b\n1,2\n"))
+	}
+	zw.Close()
+	f.Close()
+	out := filepath.Join(dir, "out")
+	a := NewArchive(src)
+	a.SetDest(out)
+	results, err := a.Transmogrify()
+	if err == nil || err.Error() != src+": 2 of 3 members failed" {
+		t.Errorf("expected 2 of 3 members failed, got %v", err)
+	}
+	expected := []string{
+		"q3.csv: duplicate destination q3.md: also the destination of q3.fwf",
+		"q3.fwf: duplicate destination q3.md: also the destination of q3.csv",
+		"",
+	}
+	for i, res := range results {
+		var got string
+		if res.Err != nil {
+			got = res.Err.Error()
+		}
+		if i >= len(expected) || got != expected[i] {
+			t.Errorf("%d: unexpected result %+v", i, res)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(out, "q3.md")); !os.IsNotExist(err) {
+		t.Errorf("expected q3.md not to be written, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(out, "q4.md")); err != nil {
+		t.Errorf("expected q4.md to be written, got %v", err)
+	}
+}
@@ -0,0 +1,495 @@
+package transmogrifier
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BatchResult is the result of transmogrifying a file of a batch.
+type BatchResult struct {
+	// Source is the file that was transmogrified.
+	Source string
+	// Dest is the file the output was written to.
+	Dest string
+	// Err is the error, if any, that occurred transmogrifying the file.
+	Err error
+}
+
+// BatchError is the error transmogrifying a file of a batch.
+type BatchError struct {
+	Source string // Source is the file that failed.
+	Err    error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Source, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// BatchErrors are all of the errors encountered by a batch.
+type BatchErrors []*BatchError
+
+func (e BatchErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", e[0], len(e)-1)
+}
+
+// Batch transmogrifies the files matched by globs, and the files in
+// directory trees. Every file in a supported format, CSV or fixed-width, is
+// transmogrified, using its format file, e.g. 'data.fmt' for 'data.csv', if
+// it has one.
+type Batch struct {
+	// sources are the files, directories, and globs to transmogrify.
+	sources []string
+	// include and exclude are the patterns that files must, and must not,
+	// match.
+	include []string
+	exclude []string
+	// dest is the output root.
+	dest resource
+	// format is the format the files are transmogrified to.
+	format FormatType
+	// workers is the number of files transmogrified concurrently.
+	workers int
+	// check: whether the outputs are compared with their destinations,
+	// instead of being written.
+	check bool
+	// opts are the options used to read the files.
+	opts decodeOptions
+}
+
+// NewBatch returns a Batch for the sources, each of which can be a file, a
+// directory, which is walked recursively, or a glob. Globs use the syntax of
+// path.Match, plus '**', which matches any number of directories, e.g.
+// 'data/**/*.csv'. The files are transmogrified to MD tables, which are
+// written next to their source, using as many workers as there are CPUs.
+func NewBatch(sources ...string) *Batch {
+	return &Batch{sources: sources, format: FmtMDTable, workers: runtime.NumCPU()}
+}
+
+// SetInclude sets the patterns that files must match one of to be
+// transmogrified. Patterns are matched against the file's path relative to
+// the directory, or the static part of the glob, that it was found in;
+// patterns without a '/' are matched against the file's name, e.g. '*.csv'.
+func (b *Batch) SetInclude(patterns ...string) {
+	b.include = patterns
+}
+
+// SetExclude sets the patterns of the files, and directories, that aren't
+// transmogrified. Patterns are matched the same way as include patterns.
+func (b *Batch) SetExclude(patterns ...string) {
+	b.exclude = patterns
+}
+
+// SetDest sets the output root. The directory structure of each source is
+// mirrored into it, relative to the directory, or the static part of the
+// glob, that the file was found in; directories are created as needed. If
+// the destination is an empty string, "", the outputs are written next to
+// their source.
+func (b *Batch) SetDest(s string) {
+	dest := b.dest
+	b.dest = NewResource(s, FmtUnsupported, File)
+	b.dest.copyConfig(dest)
+}
+
+// SetWriteOptions sets how the outputs are written, when they are local
+// files.
+func (b *Batch) SetWriteOptions(opts *WriteOptions) {
+	b.dest.write = opts
+}
+
+// SetFormat sets the format the files are transmogrified to.
+func (b *Batch) SetFormat(f FormatType) {
+	b.format = f
+}
+
+// SetWorkers sets the number of files that are transmogrified concurrently.
+// Values less than 1 are treated as 1.
+func (b *Batch) SetWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	b.workers = n
+}
+
+// SetCheck sets whether the outputs are compared with the current content of
+// their destinations, instead of being written. Destinations that aren't up
+// to date fail with a *CheckError.
+func (b *Batch) SetCheck(check bool) {
+	b.check = check
+}
+
+// SetDialect sets the dialect of the CSV files.
+func (b *Batch) SetDialect(d CSVDialect) {
+	b.opts.dialect = d
+}
+
+// SetHasHeader sets whether the first row of the files is the column names.
+// If it isn't, the column names come from the files' format files.
+func (b *Batch) SetHasHeader(hasHeader bool) {
+	b.opts.noHeader = !hasHeader
+}
+
+// SetProjection sets the projection that selects, reorders, and renames the
+// columns of every file. If it isn't set, each file's format file's
+// projection, if any, is used.
+func (b *Batch) SetProjection(p *Projection) {
+	b.opts.projection = p
+}
+
+// SetFilter sets the filter that selects the rows of every file. If it isn't
+// set, each file's format file's filter, if any, is used.
+func (b *Batch) SetFilter(f *Filter) {
+	b.opts.filter = f
+}
+
+// SetSort sets the sort that orders the rows of every file. If it isn't set,
+// each file's format file's sort, if any, is used.
+func (b *Batch) SetSort(s *Sort) {
+	b.opts.sort = s
+}
+
+// SetGrouping sets the grouping that groups the rows of every file. If it
+// isn't set, each file's format file's grouping, if any, is used.
+func (b *Batch) SetGrouping(g *Grouping) {
+	b.opts.grouping = g
+}
+
+// SetTotals sets the totals that add summary rows to every file. If they
+// aren't set, each file's format file's totals, if any, are used.
+func (b *Batch) SetTotals(t *Totals) {
+	b.opts.totals = t
+}
+
+// SetComputed sets the computed columns that are added to every file's
+// table, after those of its format file, if any.
+func (b *Batch) SetComputed(c *Computed) {
+	b.opts.computed = c
+}
+
+// SetTemplates sets the templates that render the cells of their columns of
+// every file's md table; they replace those of its format file, if any, for
+// the same columns.
+func (b *Batch) SetTemplates(t *Templates) {
+	b.opts.templates = t
+}
+
+// SetRules sets the conditional formatting rules that style the cells of
+// every file's md table. If they aren't set, each file's format file's rules,
+// if any, are used.
+func (b *Batch) SetRules(r *CellRules) {
+	b.opts.rules = r
+}
+
+// SetReshape sets the operation that reshapes every file's table. If it
+// isn't set, each file's format file's reshape, if any, is used.
+func (b *Batch) SetReshape(r Reshape) {
+	b.opts.reshape = r
+}
+
+// batchFile is a file of a batch.
+type batchFile struct {
+	// source is the file's path.
+	source string
+	// root is the directory the file was found in; the output's path
+	// relative to the output root is the file's path relative to root.
+	root string
+}
+
+// Files returns the files that will be transmogrified, in lexical order.
+func (b *Batch) Files() ([]string, error) {
+	files, err := b.files()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.source
+	}
+	return names, nil
+}
+
+// files returns the files of the batch.
+func (b *Batch) files() ([]batchFile, error) {
+	for _, p := range append(append([]string{}, b.include...), b.exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %s", p, err)
+		}
+	}
+	seen := map[string]bool{}
+	var files []batchFile
+	for _, s := range b.sources {
+		root, pattern := globRoot(s)
+		fi, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			// files are added as is, so long as they aren't excluded.
+			if pattern == "" && !seen[s] && !matchAny(b.exclude, filepath.ToSlash(filepath.Base(s))) {
+				seen[s] = true
+				files = append(files, batchFile{source: s, root: filepath.Dir(s)})
+			}
+			continue
+		}
+		err = filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if fi.IsDir() {
+				if rel != "." && matchAny(b.exclude, rel) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if pattern != "" && !matchGlob(pattern, filepath.ToSlash(p)) {
+				return nil
+			}
+			if fi.Mode()&os.ModeType != 0 || seen[p] || matchAny(b.exclude, rel) {
+				return nil
+			}
+			if len(b.include) > 0 && !matchAny(b.include, rel) {
+				return nil
+			}
+			f, _ := formatFromResource(NewResource(p, FmtUnsupported, File))
+			if !isDecodable(f) {
+				return nil
+			}
+			seen[p] = true
+			files = append(files, batchFile{source: p, root: root})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].source < files[j].source })
+	return files, nil
+}
+
+// Transmogrify transmogrifies the files of the batch on a pool of workers.
+// The result of every file is returned, in the order of Files; a file that
+// fails doesn't stop the others. Files with the same destination, e.g.
+// 'a.csv' and 'a.fwf', fail before any file is transmogrified. If any files
+// failed, their errors are returned as BatchErrors. Any other error is
+// returned if the files couldn't be found.
+func (b *Batch) Transmogrify() ([]BatchResult, error) {
+	files, err := b.files()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]BatchResult, len(files))
+	dests := make([]batchDest, len(files))
+	// failed are the files that aren't transmogrified because their
+	// destination couldn't be determined, or is shared with another file.
+	failed := make([]bool, len(files))
+	for i, f := range files {
+		dests[i], err = b.destOf(f)
+		if err != nil {
+			results[i], failed[i] = BatchResult{Source: f.source, Err: err}, true
+		}
+	}
+	b.checkDests(files, dests, results, failed)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	workers := b.workers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results[j] = b.transmogrify(files[j], dests[j])
+			}
+		}()
+	}
+	for i := range files {
+		if !failed[i] {
+			jobs <- i
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	var errs BatchErrors
+	for _, res := range results {
+		if res.Err != nil {
+			errs = append(errs, &BatchError{Source: res.Source, Err: res.Err})
+		}
+	}
+	if len(errs) > 0 {
+		return results, errs
+	}
+	return results, nil
+}
+
+// checkDests fails the files whose destination is also the destination of
+// another file, e.g. 'a.csv' and 'a.fwf', which are both written to 'a.md';
+// none of them are transmogrified.
+func (b *Batch) checkDests(files []batchFile, dests []batchDest, results []BatchResult, failed []bool) {
+	byDest := map[string][]int{}
+	var order []string
+	for i := range files {
+		if failed[i] {
+			continue
+		}
+		d := dests[i].resource().String()
+		if _, ok := byDest[d]; !ok {
+			order = append(order, d)
+		}
+		byDest[d] = append(byDest[d], i)
+	}
+	for _, d := range order {
+		if len(byDest[d]) < 2 {
+			continue
+		}
+		for _, i := range byDest[d] {
+			var others []string
+			for _, j := range byDest[d] {
+				if j != i {
+					others = append(others, files[j].source)
+				}
+			}
+			results[i] = BatchResult{Source: files[i].source, Dest: d, Err: fmt.Errorf("duplicate destination %s: also the destination of %s", d, strings.Join(others, ", "))}
+			failed[i] = true
+		}
+	}
+}
+
+// batchDest is the destination of a file's output: the name, a slash
+// separated path, within the directory.
+type batchDest struct {
+	dir  dirWriter
+	name string
+}
+
+func (d batchDest) resource() resource { return d.dir.resource(d.name) }
+
+// destOf returns the destination of the file's output.
+func (b *Batch) destOf(f batchFile) (batchDest, error) {
+	rel, err := filepath.Rel(f.root, f.source)
+	if err != nil {
+		return batchDest{}, err
+	}
+	dir := b.dest
+	if dir.Name == "" && dir.URI == "" {
+		dir = resource{Path: f.root, Type: File, write: b.dest.write}
+	}
+	return batchDest{dirWriter{dir}, filenameFor(filepath.ToSlash(rel), b.format)}, nil
+}
+
+// transmogrify transmogrifies the file and writes the output to dest.
+func (b *Batch) transmogrify(f batchFile, dest batchDest) BatchResult {
+	res := BatchResult{Source: f.source}
+	out, err := transmogrifyResource(NewResource(f.source, FmtUnsupported, File), b.format, b.opts)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	if b.check {
+		r := dest.resource()
+		res.Dest, res.Err = r.String(), checkResource(r, out)
+		return res
+	}
+	res.Dest, res.Err = dest.dir.write(dest.name, time.Time{}, out)
+	return res
+}
+
+// globRoot returns the directory to walk for the source and, if the source
+// is a glob, the cleaned pattern. The directory is the part of the glob
+// before the first element with a meta character.
+func globRoot(s string) (root, pattern string) {
+	if !strings.ContainsAny(s, "*?[") {
+		return s, ""
+	}
+	pattern = path.Clean(filepath.ToSlash(s))
+	elems := strings.Split(pattern, "/")
+	var i int
+	for i < len(elems) && !strings.ContainsAny(elems[i], "*?[") {
+		i++
+	}
+	root = strings.Join(elems[:i], "/")
+	if root == "" {
+		root = "."
+		if strings.HasPrefix(pattern, "/") {
+			root = "/"
+		}
+	}
+	return filepath.FromSlash(root), pattern
+}
+
+// matchGlob returns whether the file, or any of its directories, matches the
+// glob; matching a directory matches everything in it.
+func matchGlob(pattern, name string) bool {
+	for name != "." && name != "/" {
+		if matchPattern(pattern, name) {
+			return true
+		}
+		name = path.Dir(name)
+	}
+	return false
+}
+
+// matchAny returns whether the relative path matches any of the patterns.
+// Patterns without a '/' are matched against the path's last element.
+func matchAny(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if !strings.Contains(p, "/") {
+			if ok, _ := path.Match(p, path.Base(rel)); ok {
+				return true
+			}
+			continue
+		}
+		if matchPattern(p, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern returns whether name matches the pattern. Elements of the
+// pattern are matched using path.Match, except '**', which matches any
+// number of elements.
+func matchPattern(pattern, name string) bool {
+	return matchElems(strings.Split(path.Clean(pattern), "/"), strings.Split(path.Clean(name), "/"))
+}
+
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
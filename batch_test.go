@@ -0,0 +1,205 @@
+package transmogrifier
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTree writes the files, by slash separated path, under dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{"*.csv", "a.csv", true},
+		{"*.csv", "sub/a.csv", false},
+		{"sub/*.csv", "sub/a.csv", true},
+		{"**/*.csv", "a.csv", true},
+		{"**/*.csv", "sub/deeper/a.csv", true},
+		{"sub/**", "sub/deeper/a.csv", true},
+		{"sub/**/a.csv", "sub/a.csv", true},
+		{"sub/**/a.csv", "other/a.csv", false},
+		{"[ab].csv", "b.csv", true},
+		{"[", "[", false},
+	}
+	for i, test := range tests {
+		if matchPattern(test.pattern, test.name) != test.expected {
+			t.Errorf("%d: %q %q: expected %t, got %t", i, test.pattern, test.name, test.expected, !test.expected)
+		}
+	}
+}
+
+func TestBatchFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTree(t, dir, map[string]string{
+		"data/a.csv":            "a,b\n1,2\n",
+		"data/a.fmt":            "a,b\nleft,right\n,\n",
+		"data/x.fwf":            "Id Name\n1  towel\n",
+		"data/sub/b.csv":        "a,b\n1,2\n",
+		"data/sub/notes.txt":    "notes\n",
+		"data/sub/skip/c.csv":   "a,b\n1,2\n",
+		"data/sub/skip/d.csv":   "a,b\n1,2\n",
+		"other/e.csv.gz.backup": "",
+	})
+	data := filepath.Join(dir, "data")
+	join := func(names ...string) string {
+		for i, n := range names {
+			names[i] = filepath.Join(data, filepath.FromSlash(n))
+		}
+		return strings.Join(names, " ")
+	}
+	tests := []struct {
+		sources  []string
+		include  []string
+		exclude  []string
+		expected string
+	}{
+		{[]string{data}, nil, nil, join("a.csv", "sub/b.csv", "sub/skip/c.csv", "sub/skip/d.csv", "x.fwf")},
+		{[]string{data}, []string{"*.csv"}, []string{"skip"}, join("a.csv", "sub/b.csv")},
+		{[]string{data}, []string{"sub/**"}, []string{"d.csv"}, join("sub/b.csv", "sub/skip/c.csv")},
+		{[]string{filepath.Join(data, "*.csv"), filepath.Join(data, "a.csv")}, nil, nil, join("a.csv")},
+		{[]string{filepath.Join(data, "**", "c.csv"), filepath.Join(data, "x.fwf")}, nil, nil, join("sub/skip/c.csv", "x.fwf")},
+		{[]string{filepath.Join(data, "s*")}, nil, []string{"sub/skip"}, join("sub/b.csv")},
+		{[]string{filepath.Join(dir, "other")}, nil, nil, ""},
+	}
+	for i, test := range tests {
+		b := NewBatch(test.sources...)
+		b.SetInclude(test.include...)
+		b.SetExclude(test.exclude...)
+		files, err := b.Files()
+		if err != nil {
+			t.Errorf("%d: expected no error, got %q", i, err)
+			continue
+		}
+		if strings.Join(files, " ") != test.expected {
+			t.Errorf("%d: expected %q, got %q", i, test.expected, strings.Join(files, " "))
+		}
+	}
+
+	b := NewBatch(data)
+	b.SetExclude("[")
+	_, err = b.Files()
+	if err == nil || err.Error() != `invalid pattern "[": syntax error in pattern` {
+		t.Errorf("expected invalid pattern error, got %v", err)
+	}
+	_, err = NewBatch(filepath.Join(dir, "missing")).Files()
+	if !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+}
+
+func TestBatchTransmogrify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTree(t, dir, map[string]string{
+		"data/a.csv":          "a,b\n1,2\n",
+		"data/a.fmt":          "a,b\nleft,right\n,\n",
+		"data/sub/b.csv":      "a,b\n1,2\n",
+		"data/sub/bad.csv":    "a,b\n1,2,3\n",
+		"data/sub/deep/c.csv": "a\n1\n",
+	})
+	data := filepath.Join(dir, "data")
+	out := filepath.Join(dir, "out")
+	b := NewBatch(data)
+	b.SetDest(out)
+	b.SetWorkers(2)
+	results, err := b.Transmogrify()
+	errs, ok := err.(BatchErrors)
+	if !ok || len(errs) != 1 || errs[0].Source != filepath.Join(data, "sub", "bad.csv") {
+		t.Fatalf("expected 1 BatchError for bad.csv, got %v", err)
+	}
+	expected := map[string]string{
+		"a.csv":          "|a|b|  \n|:---|---:|  \n|1|2|  \n",
+		"sub/b.csv":      "|a|b|  \n|---|---|  \n|1|2|  \n",
+		"sub/deep/c.csv": "|a|  \n|---|  \n|1|  \n",
+	}
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(results))
+	}
+	for i, res := range results {
+		rel, _ := filepath.Rel(data, res.Source)
+		md, ok := expected[filepath.ToSlash(rel)]
+		if !ok {
+			if res.Err == nil {
+				t.Errorf("%d: %s: expected an error", i, res.Source)
+			}
+			continue
+		}
+		if res.Err != nil {
+			t.Errorf("%d: %s: expected no error, got %q", i, res.Source, res.Err)
+			continue
+		}
+		dest := filepath.Join(out, strings.TrimSuffix(rel, ".csv")+".md")
+		if res.Dest != dest {
+			t.Errorf("%d: expected %q, got %q", i, dest, res.Dest)
+		}
+		b, _ := ioutil.ReadFile(dest)
+		if string(b) != md {
+			t.Errorf("%d: expected %q, got %q", i, md, b)
+		}
+	}
+
+	// without a dest, the outputs are written next to the sources.
+	b = NewBatch(filepath.Join(data, "sub", "*.csv"))
+	b.SetFormat(FmtFixedWidth)
+	b.SetExclude("bad.csv")
+	results, err = b.Transmogrify()
+	if err != nil || len(results) != 1 || results[0].Dest != filepath.Join(data, "sub", "b.fwf") {
+		t.Errorf("expected sub/b.fwf, got %v %v", results, err)
+	}
+
+	// files with the same destination aren't transmogrified.
+	writeTree(t, dir, map[string]string{
+		"dup/a.csv": "a,b\n1,2\n",
+		"dup/a.fwf": "a b\n1 2\n",
+		"dup/b.csv": "a,b\n1,2\n",
+	})
+	dup := filepath.Join(dir, "dup")
+	results, err = NewBatch(dup).Transmogrify()
+	errs, ok = err.(BatchErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expected 2 BatchErrors, got %v", err)
+	}
+	md := filepath.Join(dup, "a.md")
+	expectedErrs := []string{
+		fmt.Sprintf("%s: duplicate destination %s: also the destination of %s", filepath.Join(dup, "a.csv"), md, filepath.Join(dup, "a.fwf")),
+		fmt.Sprintf("%s: duplicate destination %s: also the destination of %s", filepath.Join(dup, "a.fwf"), md, filepath.Join(dup, "a.csv")),
+	}
+	for i, e := range errs {
+		if e.Error() != expectedErrs[i] {
+			t.Errorf("%d: expected %q, got %q", i, expectedErrs[i], e)
+		}
+	}
+	if _, err := os.Stat(md); !os.IsNotExist(err) {
+		t.Errorf("expected %s to not be written, got %v", md, err)
+	}
+	if len(results) != 3 || results[2].Err != nil || results[2].Dest != filepath.Join(dup, "b.md") {
+		t.Errorf("expected b.csv to be transmogrified, got %v", results)
+	}
+}
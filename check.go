@@ -0,0 +1,167 @@
+package transmogrifier
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// The markers of a region of a Markdown file that holds generated output. If
+// a Markdown destination has a marked region, only the region is replaced
+// when the destination is written, or compared when it is checked; the rest
+// of the file is left as it is, e.g.:
+//
+//	# Prices
+//	<!-- mog:begin -->
+//	|Item|Price|
+//	...
+//	<!-- mog:end -->
+const (
+	RegionBegin = "<!-- mog:begin -->"
+	RegionEnd   = "<!-- mog:end -->"
+)
+
+// CheckError is the error returned when a destination isn't up to date: its
+// content, or its marked region, isn't what would be written to it.
+type CheckError struct {
+	// Dest is the destination that was checked.
+	Dest string
+	// Diff is the unified diff of the destination's current content and
+	// what would be written to it.
+	Diff string
+}
+
+func (e *CheckError) Error() string {
+	return fmt.Sprintf("%s is out of date", e.Dest)
+}
+
+// regionMarkers returns the markers of the named region; the unnamed region
+// uses RegionBegin and RegionEnd.
+func regionMarkers(name string) (begin, end string) {
+	if name == "" {
+		return RegionBegin, RegionEnd
+	}
+	return "<!-- mog:begin " + name + " -->", "<!-- mog:end " + name + " -->"
+}
+
+// markedRegion returns the offsets of the content between the markers of the
+// named region in b; the markers are on their own lines. False is returned if
+// b doesn't have the region.
+func markedRegion(b []byte, name string) (start, end int, ok bool) {
+	begin, endMarker := regionMarkers(name)
+	i := bytes.Index(b, []byte(begin))
+	if i < 0 {
+		return 0, 0, false
+	}
+	start = i + len(begin)
+	nl := bytes.IndexByte(b[start:], '\n')
+	if nl < 0 {
+		return 0, 0, false
+	}
+	start += nl + 1
+	j := bytes.Index(b[start:], []byte(endMarker))
+	if j < 0 {
+		return 0, 0, false
+	}
+	end = start + j
+	// the end marker's indentation isn't part of the region.
+	end = bytes.LastIndexByte(b[:end], '\n') + 1
+	if end < start {
+		end = start
+	}
+	return start, end, true
+}
+
+// spliceRegion returns current with its named region replaced by b. If
+// current doesn't have the region, b is returned.
+func spliceRegion(current, b []byte, name string) []byte {
+	start, end, ok := markedRegion(current, name)
+	if !ok {
+		return b
+	}
+	out := make([]byte, 0, len(current)-(end-start)+len(b))
+	out = append(out, current[:start]...)
+	out = append(out, b...)
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		out = append(out, '\n')
+	}
+	return append(out, current[end:]...)
+}
+
+// spliceResource returns what the destination's content is once b is written
+// to it, given its current content: current with its marked region replaced,
+// or b. A destination with a named region must have the region.
+func spliceResource(r resource, current, b []byte) ([]byte, error) {
+	if r.region == "" {
+		if !hasRegions(r) {
+			return b, nil
+		}
+		return spliceRegion(current, b, ""), nil
+	}
+	if !hasRegions(r) {
+		return nil, fmt.Errorf("%s: regions can only be injected into local Markdown files", r)
+	}
+	if _, _, ok := markedRegion(current, r.region); !ok {
+		return nil, fmt.Errorf("%s: region %q not found", r, r.region)
+	}
+	return spliceRegion(current, b, r.region), nil
+}
+
+// hasRegions returns whether the destination can have a marked region:
+// Markdown files.
+func hasRegions(r resource) bool {
+	return r.Type == File && r.Archive == "" && (r.Format == FmtMD || r.Format == FmtMDTable)
+}
+
+// readCurrent returns the current content of the destination. A destination
+// that doesn't exist is empty.
+func readCurrent(r resource) ([]byte, error) {
+	rc, err := r.Open()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// checkResource compares b with the current content of the destination, or
+// its marked region. A *CheckError is returned if they differ.
+func checkResource(r resource, b []byte) error {
+	current, err := readCurrent(r)
+	if err != nil {
+		return err
+	}
+	expected, err := spliceResource(r, current, b)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(current, expected) {
+		return nil
+	}
+	return &CheckError{Dest: r.String(), Diff: unifiedDiff(r.String(), r.String()+" (generated)", current, expected)}
+}
+
+// Check compares the md table with the current content of the dest, or the
+// dest's marked region, without writing anything. A *CheckError, with the
+// unified diff of the two, is returned if they differ; a dest that doesn't
+// exist differs.
+func (m *MDTable) Check() error {
+	return checkResource(m.dest, m.md)
+}
+
+// Check compares the fixed-width output with the current content of the
+// dest, without writing anything. A *CheckError is returned if they differ.
+func (f *FixedWidthTable) Check() error {
+	return checkResource(f.dest, f.fw)
+}
+
+// Check compares the sql with the current content of the dest, without
+// writing anything. A *CheckError is returned if they differ.
+func (s *SQLTable) Check() error {
+	return checkResource(s.dest, s.sql)
+}
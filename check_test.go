@@ -0,0 +1,117 @@
+package transmogrifier
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSpliceRegion(t *testing.T) {
+	tests := []struct {
+		current  string
+		b        string
+		expected string
+	}{
+		{"", "|a|\n", "|a|\n"},
+		{"# Title\n", "|a|\n", "|a|\n"},
+		{"# Title\n<!-- mog:begin -->\n<!-- mog:end -->\ntext\n", "|a|\n", "# Title\n<!-- mog:begin -->\n|a|\n<!-- mog:end -->\ntext\n"},
+		{"<!-- mog:begin -->\n|old|\n|old|\n  <!-- mog:end -->", "|a|", "<!-- mog:begin -->\n|a|\n  <!-- mog:end -->"},
+		{"<!-- mog:begin -->\n|old|\n", "|a|\n", "|a|\n"},
+	}
+	for i, test := range tests {
+		out := spliceRegion([]byte(test.current), []byte(test.b), "")
+		if string(out) != test.expected {
+			t.Errorf("%d: expected %q, got %q", i, test.expected, out)
+		}
+	}
+}
+
+func TestMDTableCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "test.md")
+	md := NewMDTable()
+	md.SetHasColumnNames(true)
+	md.TransmogrifyStringTable([][]string{[]string{"a", "b"}, []string{"1", "2"}})
+	md.SetDest(dest)
+
+	var cerr *CheckError
+	err = md.Check()
+	if !errors.As(err, &cerr) || cerr.Dest != dest || !strings.Contains(cerr.Diff, "@@ -0,0 +1,3 @@") {
+		t.Errorf("missing: expected a CheckError, got %#v", err)
+	}
+	md.WriteToFile()
+	err = md.Check()
+	if err != nil {
+		t.Errorf("written: expected no error, got %q", err)
+	}
+
+	ioutil.WriteFile(dest, []byte("|a|b|  \n|---|---|  \n|1|3|  \n"), 0644)
+	err = md.Check()
+	expected := "--- " + dest + "\n+++ " + dest + " (generated)\n@@ -1,3 +1,3 @@\n |a|b|  \n |---|---|  \n-|1|3|  \n+|1|2|  \n"
+	if !errors.As(err, &cerr) || cerr.Diff != expected {
+		t.Errorf("changed: expected diff %q, got %v", expected, err)
+	} else if err.Error() != dest+" is out of date" {
+		t.Errorf("changed: expected %q, got %q", dest+" is out of date", err)
+	}
+
+	// only the marked region is compared, and written.
+	doc := "# Prices\n\n<!-- mog:begin -->\n|old|\n<!-- mog:end -->\n\nhand written\n"
+	ioutil.WriteFile(dest, []byte(doc), 0644)
+	err = md.Check()
+	if !errors.As(err, &cerr) || !strings.Contains(cerr.Diff, "-|old|\n+|a|b|  \n") || strings.Contains(cerr.Diff, "-hand written") {
+		t.Errorf("region: expected a diff of the region, got %v", err)
+	}
+	_, _, err = md.WriteToFile()
+	if err != nil {
+		t.Fatalf("region: expected no error, got %q", err)
+	}
+	b, _ := ioutil.ReadFile(dest)
+	if string(b) != strings.Replace(doc, "|old|\n", md.String(), 1) {
+		t.Errorf("region: unexpected content %q", b)
+	}
+	err = md.Check()
+	if err != nil {
+		t.Errorf("region: expected no error, got %q", err)
+	}
+}
+
+func TestBatchCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTree(t, dir, map[string]string{
+		"a.csv": "a\n1\n",
+		"a.md":  "|a|  \n|---|  \n|1|  \n",
+		"b.csv": "b\n2\n",
+		"b.md":  "|b|  \n|---|  \n|3|  \n",
+		"c.csv": "c\n3\n",
+	})
+	b := NewBatch(dir)
+	b.SetCheck(true)
+	results, err := b.Transmogrify()
+	errs, ok := err.(BatchErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %v", err)
+	}
+	var cerr *CheckError
+	for i, name := range []string{"b.md", "c.md"} {
+		if !errors.As(errs[i], &cerr) || cerr.Dest != filepath.Join(dir, name) {
+			t.Errorf("%d: expected a CheckError for %s, got %v", i, name, errs[i])
+		}
+	}
+	if len(results) != 3 || results[0].Err != nil {
+		t.Errorf("expected a.md to be up to date, got %+v", results)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "c.md")); !os.IsNotExist(err) {
+		t.Errorf("expected c.md not to be written, got %v", err)
+	}
+}
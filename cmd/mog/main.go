@@ -0,0 +1,603 @@
+// Command mog transmogrifies table data, CSV or fixed-width text, into GitHub
+// Flavored Markdown tables, CSV, fixed-width text, or SQL.
+//
+// Usage:
+//
+//	mog [flags] [source ...]
+//
+// A source is a file, a directory, a glob, or any URI supported by the
+// transmogrifier package; "-", or no source, is stdin. A single file is
+// written to -o, or next to the source with the output format's extension;
+// stdin is written to stdout. Directories, globs, and multiple sources are
+// transmogrified as a batch, with -o as the output root; only local paths are
+// globs or directories, not URIs, including file: URIs.
+//
+// With -config, the jobs of a config file, mog.yaml or mog.toml, are run, in
+// order; see transmogrifier.Config for its format. Only -check and -v can be
+// used with -config.
+//
+// The exit status is 0 on success, 1 if an output couldn't be written or,
+// with -check, isn't up to date, 2 for usage errors, 3 if a source couldn't
+// be read, and 4 for format errors: an invalid format file or an unsupported
+// format. An invalid config file is a usage error.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mohae/transmogrifier"
+)
+
+// The exit codes.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+	exitInput   = 3
+	exitFormat  = 4
+)
+
+// patterns is a flag that can be set more than once.
+type patterns []string
+
+func (p *patterns) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patterns) Set(s string) error {
+	*p = append(*p, s)
+	return nil
+}
+
+// usageError is an error with the command's arguments.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+// configError is an error reading the config file; its exit code is that of
+// usage errors.
+type configError struct {
+	err error
+}
+
+func (e configError) Error() string {
+	return e.err.Error()
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// options are the command's flags.
+type options struct {
+	dest       string
+	from       string
+	to         string
+	formatFile string
+	comma      string
+	comment    string
+	fields     int
+	lazyQuotes bool
+	trim       bool
+	noHeader   bool
+	columns    string
+	filter     string
+	sort       string
+	groupBy    string
+	aggregate  string
+	totals     string
+	subtotals  string
+	compute    patterns
+	templates  patterns
+	rules      patterns
+	ruleMatch  string
+	reshape    string
+	union      patterns
+	unionAll   bool
+	join       string
+	on         string
+	joinType   string
+	collision  string
+	diff       string
+	key        string
+	diffStyle  string
+	unchanged  bool
+	include    patterns
+	exclude    patterns
+	workers    int
+	check      bool
+	noClobber  bool
+	backup     bool
+	verbose    bool
+	config     string
+}
+
+// run runs the command with the args and returns its exit code. Check diffs
+// go to stdout; errors, and with -v, what was written and a join's unmatched
+// keys, go to stderr.
+func run(args []string, stdout, stderr io.Writer) int {
+	var opts options
+	fs := flag.NewFlagSet("mog", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&opts.dest, "o", "", "the output `file`, or, for a batch, the output root; \"-\" is stdout")
+	fs.StringVar(&opts.from, "from", "", "the source `format`: csv or fixed; by default, the source's extension")
+	fs.StringVar(&opts.to, "to", "md", "the output `format`: md, csv, fixed, or sql")
+	fs.StringVar(&opts.formatFile, "fmt", "", "the format `file`; by default, the source's .fmt file, if it exists")
+	fs.StringVar(&opts.comma, "comma", "", "the CSV field delimiter; \\t is a tab")
+	fs.StringVar(&opts.comment, "comment", "", "the CSV comment character")
+	fs.IntVar(&opts.fields, "fields", 0, "the number of fields per CSV record; 0 is the number in the first record, -1 is any number")
+	fs.BoolVar(&opts.lazyQuotes, "lazyquotes", false, "allow quotes in unquoted CSV fields")
+	fs.BoolVar(&opts.trim, "trim", false, "trim the leading space of CSV fields")
+	fs.BoolVar(&opts.noHeader, "noheader", false, "the first row is data, not the column names; the names come from the format file")
+	fs.StringVar(&opts.columns, "columns", "", "select, reorder, and rename the `columns`, e.g. \"Item, Price as Cost, !Notes\"")
+	fs.StringVar(&opts.filter, "filter", "", "only output the rows that match the `expression`, e.g. 'status == \"open\" && priority <= 2'")
+	fs.StringVar(&opts.sort, "sort", "", "sort the rows by the `keys`, e.g. \"priority desc, due nulls first\"")
+	fs.StringVar(&opts.groupBy, "group", "", "group the rows by the `columns`, e.g. \"region, product\"; each group is aggregated into a row")
+	fs.StringVar(&opts.aggregate, "aggregate", "", "the `aggregates` of each group, e.g. \"sum(amount) as Total, count(*)\"; without -group, of every row")
+	fs.StringVar(&opts.totals, "totals", "", "add a footer row with the `aggregates`, e.g. \"sum(amount)\"")
+	fs.StringVar(&opts.subtotals, "subtotals", "", "add a subtotal row, with the -totals aggregates, after each group of the `columns`")
+	fs.Var(&opts.compute, "compute", "add the computed column of the `expression`, e.g. \"total = qty * price\"; can be repeated")
+	fs.Var(&opts.templates, "template", "render the cells of a column of an md table with the `column=template`, e.g. \"name={{link .Value .Row.url}}\"; can be repeated")
+	fs.Var(&opts.rules, "rule", "style the cells of an md table that the `rule` matches, e.g. \"bold on price when price > 100\"; can be repeated")
+	fs.StringVar(&opts.ruleMatch, "rulematch", "all", "how the -rule rules are matched: all, every rule that matches a cell styles it, or first, only the first")
+	fs.StringVar(&opts.reshape, "reshape", "", "pivot, unpivot, or transpose the table, before the other options, e.g. \"pivot region; quarter; sum(amount)\"")
+	fs.Var(&opts.union, "union", "append the rows of the `file` to the source's; can be repeated")
+	fs.BoolVar(&opts.unionAll, "unionall", false, "union the columns of the -union files, instead of requiring the source's")
+	fs.StringVar(&opts.join, "join", "", "join the source with the table of the `file`, on the -on columns")
+	fs.StringVar(&opts.on, "on", "", "the key `columns` of the -join, e.g. \"sku\" or \"sku = id\"")
+	fs.StringVar(&opts.joinType, "jointype", "inner", "the `type` of the -join: inner, left, right, or full")
+	fs.StringVar(&opts.collision, "collision", "suffix", "how the -join handles columns that both tables have: suffix, left, right, or error")
+	fs.StringVar(&opts.diff, "diff", "", "output the diff of the old version of the source, the `file`, and the source, by the -key columns")
+	fs.StringVar(&opts.key, "key", "", "the key `columns` of the -diff's rows, e.g. \"sku\"")
+	fs.StringVar(&opts.diffStyle, "diffstyle", "inline", "how the -diff is rendered: inline, with ~~old~~ **new** cells, or status, with a status column")
+	fs.BoolVar(&opts.unchanged, "unchanged", false, "include the -diff's unchanged rows")
+	fs.Var(&opts.include, "include", "only transmogrify the batch's files that match the `pattern`; can be repeated")
+	fs.Var(&opts.exclude, "exclude", "don't transmogrify the batch's files, or directories, that match the `pattern`; can be repeated")
+	fs.IntVar(&opts.workers, "workers", 0, "the number of a batch's files transmogrified concurrently; by default, the number of CPUs")
+	fs.BoolVar(&opts.check, "check", false, "report outputs that aren't up to date, with a diff, instead of writing them")
+	fs.BoolVar(&opts.noClobber, "noclobber", false, "don't replace existing files")
+	fs.BoolVar(&opts.backup, "backup", false, "back up replaced files to a .bak file")
+	fs.BoolVar(&opts.verbose, "v", false, "report what was written")
+	fs.StringVar(&opts.config, "config", "", "run the jobs of the config `file`, mog.yaml or mog.toml")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: mog [flags] [source ...]\n\nA source is a file, directory, glob, or URI; \"-\", or no source, is stdin.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	if err != nil {
+		return exitUsage
+	}
+	if opts.config != "" {
+		err = runConfig(opts, fs, stdout, stderr)
+	} else {
+		err = transmogrify(opts, fs.Args(), stdout, stderr)
+	}
+	if err == nil {
+		return exitOK
+	}
+	code := exitCode(err)
+	if errors.As(err, new(usageError)) {
+		fmt.Fprintf(stderr, "mog: %s\n", err)
+		fs.Usage()
+		return code
+	}
+	var errs transmogrifier.BatchErrors
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			fmt.Fprintf(stderr, "mog: %s\n", e)
+		}
+		return code
+	}
+	fmt.Fprintf(stderr, "mog: %s\n", err)
+	return code
+}
+
+// exitCode returns the exit code for the error. The code of a batch is that
+// of its most severe error: format errors, then input errors.
+func exitCode(err error) int {
+	if errors.As(err, new(usageError)) || errors.As(err, new(configError)) {
+		return exitUsage
+	}
+	var errs transmogrifier.BatchErrors
+	if errors.As(err, &errs) {
+		code := exitFailure
+		for _, e := range errs {
+			if c := exitCode(e.Err); c > code {
+				code = c
+			}
+		}
+		return code
+	}
+	var ferr *transmogrifier.FormatError
+	if errors.As(err, &ferr) {
+		return exitFormat
+	}
+	var serr *transmogrifier.SourceError
+	if errors.As(err, &serr) {
+		return exitInput
+	}
+	return exitFailure
+}
+
+// transmogrify transmogrifies the sources. A single file, URI, or stdin is
+// run as a Job; anything else is run as a Batch.
+func transmogrify(opts options, sources []string, stdout, stderr io.Writer) error {
+	to := transmogrifier.FormatTypeFromString(opts.to)
+	if to == transmogrifier.FmtUnsupported {
+		return usageError{fmt.Sprintf("unsupported output format: %q", opts.to)}
+	}
+	var from transmogrifier.FormatType
+	if opts.from != "" {
+		from = transmogrifier.FormatTypeFromString(opts.from)
+		if from != transmogrifier.FmtCSV && from != transmogrifier.FmtFixedWidth {
+			return usageError{fmt.Sprintf("unsupported source format: %q", opts.from)}
+		}
+	}
+	dialect := transmogrifier.CSVDialect{
+		FieldsPerRecord:  opts.fields,
+		LazyQuotes:       opts.lazyQuotes,
+		TrimLeadingSpace: opts.trim,
+	}
+	var err error
+	dialect.Comma, err = runeFlag("comma", opts.comma)
+	if err != nil {
+		return err
+	}
+	dialect.Comment, err = runeFlag("comment", opts.comment)
+	if err != nil {
+		return err
+	}
+	if opts.subtotals != "" && opts.totals == "" {
+		return usageError{"-subtotals needs -totals"}
+	}
+	compute := strings.Join(opts.compute, "; ")
+	var templates map[string]string
+	for _, t := range opts.templates {
+		i := strings.Index(t, "=")
+		if i < 0 {
+			return usageError{fmt.Sprintf("-template %q: expected COLUMN=TEMPLATE", t)}
+		}
+		if templates == nil {
+			templates = map[string]string{}
+		}
+		templates[strings.TrimSpace(t[:i])] = t[i+1:]
+	}
+	rules := strings.Join(opts.rules, "; ")
+	var firstMatch bool
+	switch opts.ruleMatch {
+	case "first":
+		firstMatch = true
+	case "all":
+	default:
+		return usageError{fmt.Sprintf("unknown -rulematch %q: expected first or all", opts.ruleMatch)}
+	}
+	var join *transmogrifier.JoinTable
+	if opts.join != "" || opts.on != "" {
+		if opts.join == "" || opts.on == "" {
+			return usageError{"-join needs -on"}
+		}
+		join = &transmogrifier.JoinTable{Source: opts.join, On: opts.on}
+		join.Type, err = transmogrifier.ParseJoinType(opts.joinType)
+		if err != nil {
+			return usageError{err.Error()}
+		}
+		join.Collision, err = transmogrifier.ParseJoinCollision(opts.collision)
+		if err != nil {
+			return usageError{err.Error()}
+		}
+	}
+	var diff *transmogrifier.DiffSource
+	if opts.diff != "" || opts.key != "" {
+		if opts.diff == "" || opts.key == "" {
+			return usageError{"-diff needs -key"}
+		}
+		diff = &transmogrifier.DiffSource{Source: opts.diff, Key: opts.key, Unchanged: opts.unchanged}
+		diff.Style, err = transmogrifier.ParseDiffStyle(opts.diffStyle)
+		if err != nil {
+			return usageError{err.Error()}
+		}
+	}
+	var write *transmogrifier.WriteOptions
+	if opts.noClobber || opts.backup {
+		write = &transmogrifier.WriteOptions{NoClobber: opts.noClobber, Backup: opts.backup}
+	}
+	if len(sources) == 0 {
+		sources = []string{"-"}
+	}
+	if len(sources) == 1 && !isBatch(sources[0]) {
+		if len(opts.include) > 0 || len(opts.exclude) > 0 {
+			return usageError{"-include and -exclude are only used by batches"}
+		}
+		job := transmogrifier.Job{
+			Source:       sources[0],
+			Dest:         opts.dest,
+			SourceFormat: from,
+			Format:       to,
+			FormatSource: opts.formatFile,
+			Dialect:      dialect,
+			NoHeader:     opts.noHeader,
+			Columns:      opts.columns,
+			Filter:       opts.filter,
+			Sort:         opts.sort,
+			GroupBy:      opts.groupBy,
+			Aggregate:    opts.aggregate,
+			Totals:       opts.totals,
+			Subtotals:    opts.subtotals,
+			Compute:      compute,
+			Templates:    templates,
+			Rules:        rules,
+			FirstMatch:   firstMatch,
+			Reshape:      opts.reshape,
+			Union:        opts.union,
+			UnionAll:     opts.unionAll,
+			Join:         join,
+			Diff:         diff,
+			Check:        opts.check,
+			Write:        write,
+		}
+		if opts.verbose {
+			job.Unmatched = func(source string, keys [][]string) {
+				fmt.Fprintf(stderr, "%s: unmatched keys: %s\n", source, formatKeys(keys))
+			}
+		}
+		dest, err := job.Run()
+		// the job validates its options; invalid ones are usage errors.
+		var oerr *transmogrifier.OptionError
+		if errors.As(err, &oerr) {
+			return usageError{oerr.Error()}
+		}
+		if err != nil {
+			report(stdout, err)
+			return err
+		}
+		if opts.verbose {
+			fmt.Fprintf(stderr, "%s -> %s\n", sources[0], dest)
+		}
+		return nil
+	}
+	for _, s := range sources {
+		if s == "-" {
+			return usageError{"stdin can't be part of a batch"}
+		}
+	}
+	if len(opts.union) > 0 || join != nil || diff != nil {
+		return usageError{"-union, -join, and -diff can't be used with a batch"}
+	}
+	if from != transmogrifier.FmtUnsupported || opts.formatFile != "" {
+		return usageError{"-from and -fmt can't be used with a batch; each file's extension, and format file, is used"}
+	}
+	if opts.dest == "-" {
+		return usageError{"a batch can't be written to stdout"}
+	}
+	b := transmogrifier.NewBatch(sources...)
+	b.SetFormat(to)
+	b.SetDest(opts.dest)
+	b.SetDialect(dialect)
+	b.SetHasHeader(!opts.noHeader)
+	err = setBatchOptions(b, opts, compute, templates, rules, firstMatch)
+	if err != nil {
+		return usageError{err.Error()}
+	}
+	b.SetInclude(opts.include...)
+	b.SetExclude(opts.exclude...)
+	b.SetCheck(opts.check)
+	b.SetWriteOptions(write)
+	if opts.workers > 0 {
+		b.SetWorkers(opts.workers)
+	}
+	results, err := b.Transmogrify()
+	return reportResults(stdout, stderr, results, err, opts.verbose)
+}
+
+// setBatchOptions parses the options that select, order, and render the rows
+// and columns, and sets them on the batch.
+func setBatchOptions(b *transmogrifier.Batch, opts options, compute string, templates map[string]string, rules string, firstMatch bool) error {
+	if opts.columns != "" {
+		p, err := transmogrifier.ParseProjection(opts.columns)
+		if err != nil {
+			return err
+		}
+		b.SetProjection(p)
+	}
+	if opts.filter != "" {
+		f, err := transmogrifier.ParseFilter(opts.filter)
+		if err != nil {
+			return err
+		}
+		b.SetFilter(f)
+	}
+	if opts.sort != "" {
+		srt, err := transmogrifier.ParseSort(opts.sort)
+		if err != nil {
+			return err
+		}
+		b.SetSort(srt)
+	}
+	if opts.groupBy != "" || opts.aggregate != "" {
+		g, err := transmogrifier.ParseGrouping(opts.groupBy, opts.aggregate)
+		if err != nil {
+			return err
+		}
+		b.SetGrouping(g)
+	}
+	if opts.totals != "" {
+		t, err := transmogrifier.ParseTotals(opts.totals, opts.subtotals)
+		if err != nil {
+			return err
+		}
+		b.SetTotals(t)
+	}
+	if compute != "" {
+		c, err := transmogrifier.ParseComputed(compute)
+		if err != nil {
+			return err
+		}
+		b.SetComputed(c)
+	}
+	if len(templates) > 0 {
+		cols := make([]string, 0, len(templates))
+		for c := range templates {
+			cols = append(cols, c)
+		}
+		sort.Strings(cols)
+		t := transmogrifier.NewTemplates()
+		for _, c := range cols {
+			err := t.Add(c, templates[c])
+			if err != nil {
+				return err
+			}
+		}
+		b.SetTemplates(t)
+	}
+	if rules != "" {
+		r, err := transmogrifier.ParseRules(rules)
+		if err != nil {
+			return err
+		}
+		r.FirstMatch = firstMatch
+		b.SetRules(r)
+	}
+	if opts.reshape != "" {
+		r, err := transmogrifier.ParseReshape(opts.reshape)
+		if err != nil {
+			return err
+		}
+		b.SetReshape(r)
+	}
+	return nil
+}
+
+// formatKeys returns the keys as a comma separated list; the values of keys
+// of more than one column are separated by '/'.
+func formatKeys(keys [][]string) string {
+	s := make([]string, len(keys))
+	for i, k := range keys {
+		s[i] = strings.Join(k, "/")
+	}
+	return strings.Join(s, ", ")
+}
+
+// runConfig runs, or checks, the jobs of the config file.
+func runConfig(opts options, fs *flag.FlagSet, stdout, stderr io.Writer) error {
+	if fs.NArg() > 0 {
+		return usageError{"sources can't be used with -config"}
+	}
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "config", "check", "v":
+		default:
+			if err == nil {
+				err = usageError{fmt.Sprintf("-%s can't be used with -config; set it in the config file", f.Name)}
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	c, err := transmogrifier.ReadConfig(opts.config)
+	if err != nil {
+		return configError{err}
+	}
+	var results []transmogrifier.BatchResult
+	if opts.check {
+		results, err = c.Check()
+	} else {
+		results, err = c.Run()
+	}
+	return reportResults(stdout, stderr, results, err, opts.verbose)
+}
+
+// reportResults reports the results of a batch, or config: the diffs of
+// outputs that aren't up to date, to stdout, and, if verbose is set, what was
+// written, to stderr. It returns err, the batch's error.
+func reportResults(stdout, stderr io.Writer, results []transmogrifier.BatchResult, err error, verbose bool) error {
+	for _, res := range results {
+		if res.Err != nil {
+			report(stdout, res.Err)
+			continue
+		}
+		if verbose {
+			fmt.Fprintf(stderr, "%s -> %s\n", res.Source, res.Dest)
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	var errs transmogrifier.BatchErrors
+	if errors.As(err, &errs) {
+		return err
+	}
+	// the batch's files couldn't be found.
+	return &transmogrifier.SourceError{Err: err}
+}
+
+// report writes the diff of a check error to w.
+func report(w io.Writer, err error) {
+	var cerr *transmogrifier.CheckError
+	if errors.As(err, &cerr) {
+		fmt.Fprint(w, cerr.Diff)
+	}
+}
+
+// isBatch returns whether the source is transmogrified as a batch: it is a
+// local path that is a glob or a directory. Stdin and URIs, including file:
+// URIs, aren't, e.g. the query of a URL isn't a glob.
+func isBatch(s string) bool {
+	if s == "-" || hasScheme(s) {
+		return false
+	}
+	if strings.ContainsAny(s, "*?[") {
+		return true
+	}
+	fi, err := os.Stat(s)
+	return err == nil && fi.IsDir()
+}
+
+// hasScheme returns whether s starts with a URI scheme, e.g. https: or data:.
+// A single letter is a Windows drive letter, not a scheme.
+func hasScheme(s string) bool {
+	i := strings.Index(s, ":")
+	if i < 2 {
+		return false
+	}
+	for j, c := range s[:i] {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case j > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// runeFlag returns the rune of the flag's value, which must be a single
+// character, or '\t'. An empty value is 0.
+func runeFlag(name, s string) (rune, error) {
+	if s == `\t` {
+		return '\t', nil
+	}
+	if s == "" {
+		return 0, nil
+	}
+	r, n := utf8.DecodeRuneInString(s)
+	if n != len(s) || r == utf8.RuneError {
+		return 0, usageError{fmt.Sprintf("-%s must be a single character: %q", name, s)}
+	}
+	return r, nil
+}
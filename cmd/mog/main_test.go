@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"a.csv":          "a,b\n1,2\n",
+		"tabs.txt":       "a\tb\n1\t2\n",
+		"bad.csv":        "a,\"b\n",
+		"badfmt/x.csv":   "a,b\n",
+		"badfmt/x.fmt":   "a\n",
+		"tree/one.csv":   "x\n1\n",
+		"tree/sub/2.csv": "y\n2\n",
+		"current.md":     "|a|b|  \n|---|---|  \n|1|3|  \n",
+		"b.csv":          "a,c\n1,x\n3,y\n",
+	}
+	for name, s := range files {
+		p := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		ioutil.WriteFile(p, []byte(s), 0644)
+	}
+	p := func(name string) string { return filepath.Join(dir, name) }
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("a,b\n" + r.URL.Query().Get("x") + ",2\n"))
+	}))
+	defer srv.Close()
+	tests := []struct {
+		args     []string
+		code     int
+		file     string
+		expected string
+	}{
+		{[]string{p("a.csv")}, exitOK, "a.md", "|a|b|  \n|---|---|  \n|1|2|  \n"},
+		{[]string{"-to", "sql", "-o", p("a.sql"), p("a.csv")}, exitOK, "a.sql", "CREATE TABLE \"a\""},
+		{[]string{"-from", "csv", "-comma", `\t`, "-to", "csv", "-o", p("tabs.csv"), p("tabs.txt")}, exitOK, "tabs.csv", "a,b\n1,2\n"},
+		{[]string{"-o", p("out"), "-exclude", "sub", p("tree")}, exitOK, "out/one.md", "|x|  \n|---|  \n|1|  \n"},
+		// the query of a URL, and the data of a data URI, aren't globs.
+		{[]string{"-o", p("query.md"), srv.URL + "/t.csv?x=[1]"}, exitOK, "query.md", "|a|b|  \n|---|---|  \n|[1]|2|  \n"},
+		{[]string{"-to", "csv", "-o", p("data.csv"), "data:text/csv,a,b%0A*,[2]"}, exitOK, "data.csv", "a,b\n*,[2]\n"},
+		{[]string{"-check", "-o", p("current.md"), p("a.csv")}, exitFailure, "current.md", "|1|3|"},
+		{[]string{"-noclobber", p("a.csv")}, exitFailure, "a.md", "|1|2|"},
+		{[]string{"-filter", "b > 1 && a in (1, 3)", "-o", p("filtered.md"), p("a.csv")}, exitOK, "filtered.md", "|1|2|"},
+		{[]string{"-join", p("b.csv"), "-on", "a", "-jointype", "full", "-o", p("joined.md"), p("a.csv")}, exitOK, "joined.md", "|1|2|x|  \n|3||y|"},
+		{[]string{"-union", p("a.csv"), "-to", "csv", "-o", p("union.csv"), p("a.csv")}, exitOK, "union.csv", "a,b\n1,2\n1,2\n"},
+		{[]string{"-diff", p("b.csv"), "-key", "a", "-diffstyle", "status", "-to", "csv", "-o", p("diff.csv"), p("a.csv")}, exitOK, "diff.csv", "status,a,b,c\nremoved,3,,y\n"},
+		{[]string{"-compute", "c = a + b", "-compute", "d = c * 2", "-to", "csv", "-o", p("computed.csv"), p("a.csv")}, exitOK, "computed.csv", "a,b,c,d\n1,2,3,6\n"},
+		{[]string{"-compute", "c = a +", p("a.csv")}, exitUsage, "", ""},
+		{[]string{"-template", "a=[{{.Value}}]", "-template", "#2 ={{.Row.a}}{{.Value}}", "-o", p("tmpl.md"), p("a.csv")}, exitOK, "tmpl.md", "|a|b|  \n|---|---|  \n|[1]|12|  \n"},
+		{[]string{"-template", "a", p("a.csv")}, exitUsage, "", ""},
+		{[]string{"-rule", "bold on a when b > 1", "-rule", "italic when a == 1", "-rulematch", "first", "-o", p("rule.md"), p("a.csv")}, exitOK, "rule.md", "|a|b|  \n|---|---|  \n|__1__|_2_|  \n"},
+		{[]string{"-rule", "blink", p("a.csv")}, exitUsage, "", ""},
+		{[]string{"-rule", "bold", "-rulematch", "last", p("a.csv")}, exitUsage, "", ""},
+		{[]string{"-template", "a={{", p("a.csv")}, exitUsage, "", ""},
+		{[]string{"-diff", p("b.csv"), p("a.csv")}, exitUsage, "", ""},
+		{[]string{"-join", p("b.csv"), p("a.csv")}, exitUsage, "", ""},
+		{[]string{"-join", p("b.csv"), "-on", "a", "-jointype", "outside", p("a.csv")}, exitUsage, "", ""},
+		{[]string{"-to", "json", p("a.csv")}, exitUsage, "", ""},
+		{[]string{"-filter", "b >", p("a.csv")}, exitUsage, "", ""},
+		{[]string{"-filter", "b >", "-o", p("out"), p("tree")}, exitUsage, "", ""},
+		{[]string{"-subtotals", "a", p("a.csv")}, exitUsage, "", ""},
+		{[]string{"-comma", ";;", p("a.csv")}, exitUsage, "", ""},
+		{[]string{"-nosuchflag", p("a.csv")}, exitUsage, "", ""},
+		{[]string{"-fmt", p("a.fmt"), p("tree")}, exitUsage, "", ""},
+		{[]string{"-include", "*.csv", p("a.csv")}, exitUsage, "", ""},
+		{[]string{p("missing.csv")}, exitInput, "", ""},
+		{[]string{p("bad.csv")}, exitInput, "", ""},
+		{[]string{p("missing")}, exitInput, "", ""},
+		{[]string{p("badfmt/x.csv")}, exitFormat, "", ""},
+		{[]string{p("tabs.txt")}, exitFormat, "", ""},
+		{[]string{"-o", p("batch"), p("badfmt"), p("bad.csv")}, exitFormat, "", ""},
+	}
+	for i, test := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(test.args, &stdout, &stderr)
+		if code != test.code {
+			t.Errorf("%d: expected exit code %d, got %d: %s", i, test.code, code, stderr.String())
+			continue
+		}
+		if test.file == "" {
+			continue
+		}
+		b, _ := ioutil.ReadFile(p(test.file))
+		if !strings.Contains(string(b), test.expected) {
+			t.Errorf("%d: expected %s to contain %q, got %q", i, test.file, test.expected, b)
+		}
+	}
+	if _, err := os.Stat(p("out/sub/2.md")); !os.IsNotExist(err) {
+		t.Errorf("expected out/sub/2.md to be excluded, got %v", err)
+	}
+}
+
+func TestRunCheckDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "a.csv")
+	ioutil.WriteFile(src, []byte("a\n1\n"), 0644)
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-check", src}, &stdout, &stderr)
+	if code != exitFailure {
+		t.Fatalf("expected exit code %d, got %d", exitFailure, code)
+	}
+	if !strings.Contains(stdout.String(), "+|a|  \n") || !strings.Contains(stderr.String(), "a.md is out of date") {
+		t.Errorf("expected a diff and an out of date error, got %q and %q", stdout.String(), stderr.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.md")); !os.IsNotExist(err) {
+		t.Errorf("expected a.md not to be written, got %v", err)
+	}
+}
+
+func TestRunVerbose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src, join := filepath.Join(dir, "a.csv"), filepath.Join(dir, "b.csv")
+	ioutil.WriteFile(src, []byte("a,b\n1,2\n"), 0644)
+	ioutil.WriteFile(join, []byte("a,c\n1,x\n3,y\n"), 0644)
+	dest := filepath.Join(dir, "a.md")
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-v", "-join", join, "-on", "a", "-o", dest, src}, &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("expected exit code %d, got %d: %s", exitOK, code, stderr.String())
+	}
+	// stdout is left to the output, e.g. with -o -.
+	if stdout.Len() != 0 {
+		t.Errorf("expected nothing on stdout, got %q", stdout.String())
+	}
+	expected := join + ": unmatched keys: 3\n" + src + " -> " + dest + "\n"
+	if stderr.String() != expected {
+		t.Errorf("expected %q, got %q", expected, stderr.String())
+	}
+}
+
+func TestRunConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := func(name string) string { return filepath.Join(dir, name) }
+	ioutil.WriteFile(p("a.csv"), []byte("a\n1\n"), 0644)
+	ioutil.WriteFile(p("mog.toml"), []byte("[defaults]\nformat = \"csv\"\n\n[[jobs]]\nsource = \"a.csv\"\ndest = \"out.csv\"\n"), 0644)
+	ioutil.WriteFile(p("bad.yaml"), []byte("jobs:\n  - source: a.csv\n    dset: out.csv\n"), 0644)
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{[]string{"-config", p("mog.toml"), "-check"}, exitFailure},
+		{[]string{"-config", p("mog.toml")}, exitOK},
+		{[]string{"-config", p("mog.toml"), "-check"}, exitOK},
+		{[]string{"-config", p("mog.toml"), "-to", "sql"}, exitUsage},
+		{[]string{"-config", p("mog.toml"), p("a.csv")}, exitUsage},
+		{[]string{"-config", p("bad.yaml")}, exitUsage},
+	}
+	for i, test := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(test.args, &stdout, &stderr)
+		if code != test.code {
+			t.Errorf("%d: expected exit code %d, got %d: %s", i, test.code, code, stderr.String())
+		}
+	}
+	b, _ := ioutil.ReadFile(p("out.csv"))
+	if string(b) != "a\n1\n" {
+		t.Errorf("expected %q, got %q", "a\n1\n", b)
+	}
+}
@@ -0,0 +1,213 @@
+package transmogrifier
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Compression is the compression of a resource. Gzip and bzip2 can be read,
+// and gzip written, without registering anything. Zstd and xz are only
+// detected: the standard library doesn't have decompressors for them, so
+// reading them returns a 'no decompressor registered' error unless one is
+// registered with RegisterDecompressor.
+type Compression int
+
+const (
+	NoCompression Compression = iota
+	Gzip
+	Bzip2
+	Zstd
+	Xz
+)
+
+func (c Compression) String() string { return compressions[c] }
+
+var compressions = [...]string{
+	"none",
+	"gzip",
+	"bzip2",
+	"zstd",
+	"xz",
+}
+
+// compressionExts are the file extensions of each compression.
+var compressionExts = [...]string{
+	"",
+	".gz",
+	".bz2",
+	".zst",
+	".xz",
+}
+
+// Ext returns the file extension for the compression, e.g. ".gz".
+func (c Compression) Ext() string { return compressionExts[c] }
+
+// CompressionFromString returns the Compression constant for a name or a
+// file extension, with or without the '.'. NoCompression is returned for
+// anything that isn't recognized.
+func CompressionFromString(s string) Compression {
+	s = strings.TrimPrefix(strings.ToLower(s), ".")
+	switch s {
+	case "gzip", "gz":
+		return Gzip
+	case "bzip2", "bz2":
+		return Bzip2
+	case "zstd", "zst":
+		return Zstd
+	case "xz":
+		return Xz
+	}
+	return NoCompression
+}
+
+// compressionFromName returns the compression indicated by the name's
+// extension, and the name without that extension.
+func compressionFromName(name string) (Compression, string) {
+	lower := strings.ToLower(name)
+	for c := Gzip; c <= Xz; c++ {
+		if strings.HasSuffix(lower, c.Ext()) {
+			return c, name[:len(name)-len(c.Ext())]
+		}
+	}
+	return NoCompression, name
+}
+
+// compressionMagic are the magic bytes at the start of compressed data.
+var compressionMagic = []struct {
+	c     Compression
+	magic []byte
+}{
+	{Gzip, []byte{0x1f, 0x8b}},
+	{Zstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{Xz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+}
+
+// bzip2BlockMagic follows the "BZh" and block size of bzip2 data.
+var bzip2BlockMagic = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+
+// compressionFromMagic returns the compression indicated by the magic bytes
+// at the start of b.
+func compressionFromMagic(b []byte) Compression {
+	for _, m := range compressionMagic {
+		if bytes.HasPrefix(b, m.magic) {
+			return m.c
+		}
+	}
+	// "BZh" is plausible text, so the block magic is checked too.
+	if len(b) >= 10 && bytes.HasPrefix(b, []byte("BZh")) && b[3] >= '1' && b[3] <= '9' && bytes.Equal(b[4:10], bzip2BlockMagic) {
+		return Bzip2
+	}
+	return NoCompression
+}
+
+var (
+	compressMu    sync.RWMutex
+	decompressors = map[Compression]func(io.Reader) (io.ReadCloser, error){
+		Gzip: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+		Bzip2: func(r io.Reader) (io.ReadCloser, error) {
+			return readCloser{bzip2.NewReader(r), nopCloser}, nil
+		},
+	}
+	compressors = map[Compression]func(io.Writer) (io.WriteCloser, error){
+		Gzip: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+	}
+)
+
+// RegisterDecompressor registers the func that returns a reader that
+// decompresses the compression. Gzip and bzip2 are registered by default;
+// zstd and xz are detected, but need a decompressor to be registered before
+// they can be read, e.g. one that wraps github.com/klauspost/compress/zstd or
+// github.com/ulikunitz/xz.
+func RegisterDecompressor(c Compression, fn func(io.Reader) (io.ReadCloser, error)) {
+	compressMu.Lock()
+	defer compressMu.Unlock()
+	decompressors[c] = fn
+}
+
+// RegisterCompressor registers the func that returns a writer that compresses
+// using the compression. Gzip is registered by default.
+func RegisterCompressor(c Compression, fn func(io.Writer) (io.WriteCloser, error)) {
+	compressMu.Lock()
+	defer compressMu.Unlock()
+	compressors[c] = fn
+}
+
+// decompress returns a reader that decompresses r. The compression is
+// detected from the magic bytes; if there aren't any, c, the compression
+// indicated by the name, is used. The returned ReadCloser closes r.
+func decompress(r io.ReadCloser, c Compression) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(10)
+	if m := compressionFromMagic(magic); m != NoCompression {
+		c = m
+	}
+	if c == NoCompression {
+		return readCloser{br, r.Close}, nil
+	}
+	compressMu.RLock()
+	fn, ok := decompressors[c]
+	compressMu.RUnlock()
+	if !ok {
+		r.Close()
+		return nil, fmt.Errorf("no decompressor registered for %s", c)
+	}
+	dr, err := fn(br)
+	if err != nil {
+		r.Close()
+		return nil, fmt.Errorf("%s: %s", c, err)
+	}
+	return readCloser{dr, func() error {
+		dr.Close()
+		return r.Close()
+	}}, nil
+}
+
+// compress returns a writer that compresses what is written to w. Closing
+// the returned WriteCloser closes w.
+func compress(w io.WriteCloser, c Compression) (io.WriteCloser, error) {
+	if c == NoCompression {
+		return w, nil
+	}
+	compressMu.RLock()
+	fn, ok := compressors[c]
+	compressMu.RUnlock()
+	if !ok {
+		w.Close()
+		return nil, fmt.Errorf("no compressor registered for %s", c)
+	}
+	cw, err := fn(w)
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	return writeCloser{cw, func() error {
+		err := cw.Close()
+		cerr := w.Close()
+		if err == nil {
+			err = cerr
+		}
+		return err
+	}}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r readCloser) Close() error { return r.close() }
+
+type writeCloser struct {
+	io.Writer
+	close func() error
+}
+
+func (w writeCloser) Close() error { return w.close() }
+
+func nopCloser() error { return nil }
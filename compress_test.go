@@ -0,0 +1,146 @@
+package transmogrifier
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompressionFromName(t *testing.T) {
+	tests := []struct {
+		name         string
+		expected     Compression
+		expectedName string
+	}{
+		{"", NoCompression, ""},
+		{"data.csv", NoCompression, "data.csv"},
+		{"data.csv.gz", Gzip, "data.csv"},
+		{"data.CSV.GZ", Gzip, "data.CSV"},
+		{"path/data.csv.bz2", Bzip2, "path/data.csv"},
+		{"data.csv.zst", Zstd, "data.csv"},
+		{"data.csv.xz", Xz, "data.csv"},
+	}
+	for i, test := range tests {
+		c, name := compressionFromName(test.name)
+		if c != test.expected || name != test.expectedName {
+			t.Errorf("%d: expected %s %q, got %s %q", i, test.expected, test.expectedName, c, name)
+		}
+	}
+}
+
+func TestReadCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	gz, _ := ioutil.ReadFile("test_files/test.csv.gz")
+	// gzip data without a compression extension is detected by its magic.
+	ioutil.WriteFile(filepath.Join(dir, "gzipped.csv"), gz, 0600)
+	ioutil.WriteFile(filepath.Join(dir, "test.csv.zst"), []byte{0x28, 0xb5, 0x2f, 0xfd, 0, 0, 0, 0}, 0600)
+	ioutil.WriteFile(filepath.Join(dir, "test.csv.xz"), []byte("\xfd7zXZ\x00\x00\x00"), 0600)
+	// xz data without a compression extension is detected by its magic.
+	ioutil.WriteFile(filepath.Join(dir, "xz.csv"), []byte("\xfd7zXZ\x00\x00\x00"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "bad.csv.gz"), []byte("not gzip data"), 0600)
+	tests := []struct {
+		source      string
+		expectedErr string
+	}{
+		{"test_files/test.csv", ""},
+		{"test_files/test.csv.gz", ""},
+		{"test_files/test.csv.bz2", ""},
+		{filepath.Join(dir, "gzipped.csv"), ""},
+		{filepath.Join(dir, "test.csv.zst"), "no decompressor registered for zstd"},
+		{filepath.Join(dir, "test.csv.xz"), "no decompressor registered for xz"},
+		{filepath.Join(dir, "xz.csv"), "no decompressor registered for xz"},
+		{filepath.Join(dir, "bad.csv.gz"), "gzip: gzip: invalid header"},
+	}
+	for i, test := range tests {
+		c := NewCSVSource(test.source)
+		err := c.ReadSource()
+		if err != nil {
+			if err.Error() != test.expectedErr {
+				t.Errorf("%d: expected %q, got %q", i, test.expectedErr, err)
+			}
+			continue
+		}
+		if test.expectedErr != "" {
+			t.Errorf("%d: expected %q, got no error", i, test.expectedErr)
+			continue
+		}
+		if strings.Join(c.HeaderRow(), ",") != "Item,Id,Description,Price" || len(c.Rows()) != 2 {
+			t.Errorf("%d: unexpected data %v %v", i, c.HeaderRow(), c.Rows())
+		}
+	}
+}
+
+func TestWriteCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	md := NewMDTable()
+	err = md.SetSource(filepath.Join(dir, "test.csv.gz"))
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	md.TransmogrifyStringTable([][]string{[]string{"a", "b"}, []string{"1", "2"}})
+	md.SetDest("")
+	md.SetCompression(Gzip)
+	name, _, err := md.WriteToFile()
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	if name != filepath.Join(dir, "test.md") {
+		t.Errorf("expected %q, got %q", filepath.Join(dir, "test.md"), name)
+	}
+	b, _ := ioutil.ReadFile(name)
+	if compressionFromMagic(b) != Gzip {
+		t.Errorf("expected gzip data, got %q", b)
+	}
+	// the compression is detected when it is read back
+	r, err := NewResource(name, FmtMD, File).Open()
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	defer r.Close()
+	b, _ = ioutil.ReadAll(r)
+	if string(b) != md.String() {
+		t.Errorf("expected %q, got %q", md.String(), b)
+	}
+
+	md.SetCompression(Xz)
+	_, _, err = md.WriteToFile()
+	if err == nil || err.Error() != "no compressor registered for xz" {
+		t.Errorf("expected no compressor error, got %v", err)
+	}
+}
+
+func TestRegisterDecompressor(t *testing.T) {
+	// a stand-in "xz" that upper cases the data after the magic bytes.
+	RegisterDecompressor(Xz, func(r io.Reader) (io.ReadCloser, error) {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(bytes.ToUpper(b[6:]))), nil
+	})
+	defer func() {
+		compressMu.Lock()
+		delete(decompressors, Xz)
+		compressMu.Unlock()
+	}()
+	rc, err := decompress(ioutil.NopCloser(bytes.NewReader([]byte("\xfd7zXZ\x00a,b\n"))), NoCompression)
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	b, _ := ioutil.ReadAll(rc)
+	if string(b) != "A,B\n" {
+		t.Errorf("expected %q, got %q", "A,B\n", b)
+	}
+}
@@ -0,0 +1,570 @@
+package transmogrifier
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Row is a row of a table, with the table's column names.
+type Row struct {
+	// Index is the row's index, from 0, in the table's data rows.
+	Index int
+	// Header is the table's column names; it is nil if the table doesn't
+	// have any.
+	Header []string
+	Values []string
+}
+
+// Get returns the value of the column, a name or a '#' position; it is empty
+// if the row doesn't have the column.
+func (r Row) Get(column string) string {
+	v, _ := r.Lookup(column)
+	return v
+}
+
+// Lookup returns the value of the column, a name or a '#' position, and
+// whether the row has the column.
+func (r Row) Lookup(column string) (string, bool) {
+	ref, err := parseColumnRef(column)
+	if err != nil {
+		return "", false
+	}
+	c, err := ref.resolve(r.Header, len(r.Values))
+	if err != nil || c >= len(r.Values) {
+		return "", false
+	}
+	return r.Values[c], true
+}
+
+// Computed is a list of computed columns: columns whose values are computed
+// from the other columns of their row, by a Go func or an expression. Each
+// column is added after the columns of the table, unless the table has a
+// column with its name, which it replaces; later columns can use earlier
+// ones. Computed columns are added before anything else is applied, so they
+// can be filtered, sorted, and aligned like any other column.
+//
+// An expression, e.g. 'total = qty * price' or 'link = "[" + name + "](" +
+// url + ")"', is the column's name, an '=', and its value, of:
+//
+//	columns and literals    as in a Filter, e.g. qty, `Unit Price`, #2,
+//	                        "text", 'text', and 1.5
+//	+ - * / %               arithmetic; '+' of a value that isn't a number
+//	                        concatenates
+//	( )                     grouping
+//	upper(s) lower(s) trim(s) replace(s, old, new) concat(v, ...)
+//	coalesce(v, ...) round(n[, decimals]) abs(n)
+//	                        functions
+//
+// A column's value is a number if it is one, or an amount, e.g. '$1,200.50';
+// string literals are never numbers. The result of arithmetic on an empty
+// value is empty. Sums and differences have the decimals of the operand with
+// the most, products those of both operands, e.g. 2 * 1.25 is 2.50, and
+// quotients as many as they need.
+type Computed struct {
+	columns []computedColumn
+}
+
+type computedColumn struct {
+	name string
+	fn   func(row Row) (string, error)
+	// expr is the column's expression, if it has one, instead of fn.
+	expr *computedExpr
+}
+
+// NewComputed returns an empty list of computed columns.
+func NewComputed() *Computed {
+	return &Computed{}
+}
+
+// ParseComputed parses the expressions of computed columns, separated by
+// semicolons, e.g. 'total = qty * price; tax = total * 0.2'.
+func ParseComputed(s string) (*Computed, error) {
+	c := NewComputed()
+	for _, e := range splitExprs(s) {
+		if strings.TrimSpace(e) == "" {
+			continue
+		}
+		err := c.AddExpr(e)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(c.columns) == 0 {
+		return nil, fmt.Errorf("computed columns: no columns")
+	}
+	return c, nil
+}
+
+// Add adds the column name, whose values are those returned by fn. An error
+// returned by fn is returned by Apply.
+func (c *Computed) Add(name string, fn func(row Row) (string, error)) {
+	c.columns = append(c.columns, computedColumn{name: name, fn: fn})
+}
+
+// AddExpr adds the column of the expression, e.g. 'total = qty * price'.
+func (c *Computed) AddExpr(s string) error {
+	e, err := parseComputedExpr(strings.TrimSpace(s))
+	if err != nil {
+		return err
+	}
+	c.columns = append(c.columns, computedColumn{name: e.name, expr: e})
+	return nil
+}
+
+// Names returns the names of the computed columns.
+func (c *Computed) Names() []string {
+	names := make([]string, len(c.columns))
+	for i, col := range c.columns {
+		names[i] = col.name
+	}
+	return names
+}
+
+// Apply returns the header and rows with the computed columns. The rows
+// aren't modified.
+func (c *Computed) Apply(header []string, rows [][]string) ([]string, [][]string, error) {
+	n := tableWidthOf(header, rows)
+	out := make([][]string, len(rows))
+	for i, row := range rows {
+		out[i] = make([]string, n, n+len(c.columns))
+		copy(out[i], row)
+	}
+	if len(header) > 0 {
+		header = append([]string{}, header...)
+	}
+	for _, cc := range c.columns {
+		col := -1
+		if len(header) > 0 {
+			col = indexOf(header, cc.name)
+		}
+		if col < 0 {
+			col = n
+			n++
+			if len(header) > 0 {
+				header = append(header, cc.name)
+			}
+			for i := range out {
+				out[i] = append(out[i], "")
+			}
+		}
+		fn := cc.fn
+		if cc.expr != nil {
+			var err error
+			fn, err = cc.expr.bind(header, n)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		for i, row := range out {
+			v, err := fn(Row{Index: i, Header: header, Values: row})
+			if err != nil {
+				return nil, nil, fmt.Errorf("computed column %q: row %d: %s", cc.name, i+1, err)
+			}
+			row[col] = v
+		}
+	}
+	return header, out, nil
+}
+
+// Compute returns the header and rows of the CSV with the computed columns.
+func (c *CSV) Compute(cc *Computed) ([]string, [][]string, error) {
+	return cc.Apply(c.headerRow, c.rows)
+}
+
+// merge returns the computed columns of c followed by those of o; either can
+// be nil.
+func (c *Computed) merge(o *Computed) *Computed {
+	switch {
+	case c == nil:
+		return o
+	case o == nil:
+		return c
+	}
+	return &Computed{columns: append(append([]computedColumn{}, c.columns...), o.columns...)}
+}
+
+// splitExprs splits s at the semicolons that aren't quoted.
+func splitExprs(s string) []string {
+	var parts []string
+	var q byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case q != 0 && s[i] == '\\':
+			i++
+		case q != 0:
+			if s[i] == q {
+				q = 0
+			}
+		case s[i] == '"' || s[i] == '\'' || s[i] == '`':
+			q = s[i]
+		case s[i] == ';':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// computedExpr is a parsed computed column expression.
+type computedExpr struct {
+	name string
+	// filter holds the expression, and its column references.
+	filter *Filter
+	root   exprNode
+}
+
+// parseComputedExpr parses 'name = expression'.
+func parseComputedExpr(s string) (*computedExpr, error) {
+	p := &filterParser{filter: &Filter{expr: s}, arith: true}
+	err := p.lex()
+	if err != nil {
+		return nil, err
+	}
+	t := p.next()
+	if t.kind != tokIdent && (t.kind != tokColumn || strings.HasPrefix(t.text, "#")) {
+		return nil, p.errorf(t.pos, "expected the column's name, got %q", t.text)
+	}
+	e := &computedExpr{name: t.text, filter: p.filter}
+	if t := p.next(); !t.is("=") {
+		return nil, p.errorf(t.pos, "expected '=', got %q", t.text)
+	}
+	e.root, err = p.additive()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t.pos, "unexpected %q", t.text)
+	}
+	return e, nil
+}
+
+// bind returns the func of the expression for a table with the header and n
+// columns.
+func (e *computedExpr) bind(header []string, n int) (func(Row) (string, error), error) {
+	cols := make([]int, len(e.filter.columns))
+	for i, c := range e.filter.columns {
+		var err error
+		cols[i], err = c.ref.resolve(header, n)
+		if err != nil {
+			return nil, &FilterError{Expr: e.filter.expr, Pos: c.pos, Msg: err.Error(), what: "computed column"}
+		}
+	}
+	return func(row Row) (string, error) {
+		v, err := e.root.eval(&exprContext{cols: cols, row: row.Values})
+		return v.s, err
+	}, nil
+}
+
+// additive parses: term { ("+" | "-") term }
+func (p *filterParser) additive() (exprNode, error) {
+	n, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is("+") || p.peek().is("-") {
+		op := p.next().text
+		r, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		n = arithNode{op, n, r}
+	}
+	return n, nil
+}
+
+// term parses: unary { ("*" | "/" | "%") unary }
+func (p *filterParser) term() (exprNode, error) {
+	n, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is("*") || p.peek().is("/") || p.peek().is("%") {
+		op := p.next().text
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		n = arithNode{op, n, r}
+	}
+	return n, nil
+}
+
+// unary parses: "-" unary | "(" additive ")" | func "(" [ additive { ","
+// additive } ] ")" | operand
+func (p *filterParser) unary() (exprNode, error) {
+	t := p.peek()
+	switch {
+	case t.is("-"):
+		p.next()
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return negNode{n}, nil
+	case t.is("("):
+		p.next()
+		n, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); !t.is(")") {
+			return nil, p.errorf(t.pos, "expected ')', got %q", t.text)
+		}
+		return n, nil
+	case t.kind == tokIdent && p.toks[p.i+1].is("("):
+		return p.call()
+	}
+	o, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	return operandNode{o}, nil
+}
+
+// call parses a function call.
+func (p *filterParser) call() (exprNode, error) {
+	t := p.next()
+	f, ok := exprFuncs[strings.ToLower(t.text)]
+	if !ok {
+		return nil, p.errorf(t.pos, "unknown function %q", t.text)
+	}
+	p.next()
+	n := callNode{name: strings.ToLower(t.text), f: f}
+	if p.peek().is(")") {
+		p.next()
+	} else {
+		for {
+			a, err := p.additive()
+			if err != nil {
+				return nil, err
+			}
+			n.args = append(n.args, a)
+			t := p.next()
+			if t.is(")") {
+				break
+			}
+			if !t.is(",") {
+				return nil, p.errorf(t.pos, "expected ',' or ')', got %q", t.text)
+			}
+		}
+	}
+	if len(n.args) < f.min || f.max >= 0 && len(n.args) > f.max {
+		return nil, p.errorf(t.pos, "wrong number of arguments to %s", n.name)
+	}
+	return n, nil
+}
+
+// exprContext is the context that a computed column expression is evaluated
+// in.
+type exprContext struct {
+	// cols are the columns of the expression's column references.
+	cols []int
+	row  []string
+}
+
+// exprValue is the value of an expression: a string, or, if num is set, the
+// number n, with dec decimals. An empty value is null.
+type exprValue struct {
+	s   string
+	num bool
+	n   float64
+	dec int
+}
+
+// numberValue returns the value of the number n with dec decimals.
+func numberValue(n float64, dec int) exprValue {
+	if dec < 0 {
+		s := strconv.FormatFloat(math.Round(n*1e10)/1e10, 'f', -1, 64)
+		return exprValue{s: s, num: true, n: n, dec: decimalsOf(s)}
+	}
+	return exprValue{s: strconv.FormatFloat(n, 'f', dec, 64), num: true, n: n, dec: dec}
+}
+
+// cellValue returns the value of a cell: a number if it is a number, or an
+// amount.
+func cellValue(s string) exprValue {
+	t := strings.TrimSpace(s)
+	if n, ok := parseCurrency(t); ok {
+		return exprValue{s: s, num: true, n: n, dec: decimalsOf(strings.TrimRight(t, ")"))}
+	}
+	return exprValue{s: s}
+}
+
+// decimalsOf returns the number of decimals of the number s.
+func decimalsOf(s string) int {
+	if i := strings.LastIndex(s, "."); i >= 0 {
+		return len(s) - i - 1
+	}
+	return 0
+}
+
+// exprNode is a node of a computed column expression.
+type exprNode interface {
+	eval(ctx *exprContext) (exprValue, error)
+}
+
+type operandNode struct{ o filterOperand }
+
+func (n operandNode) eval(ctx *exprContext) (exprValue, error) {
+	switch o := n.o.(type) {
+	case columnOperand:
+		return cellValue(cell(ctx.row, ctx.cols[o])), nil
+	case literalOperand:
+		if o.kind == kindNumber {
+			return exprValue{s: o.s, num: true, n: o.n, dec: decimalsOf(o.s)}, nil
+		}
+		return exprValue{s: o.s}, nil
+	}
+	return exprValue{}, nil
+}
+
+type negNode struct{ x exprNode }
+
+func (n negNode) eval(ctx *exprContext) (exprValue, error) {
+	v, err := n.x.eval(ctx)
+	if err != nil || v.s == "" {
+		return v, err
+	}
+	if !v.num {
+		return exprValue{}, fmt.Errorf("%q isn't a number", v.s)
+	}
+	return numberValue(-v.n, v.dec), nil
+}
+
+type arithNode struct {
+	op   string
+	l, r exprNode
+}
+
+func (n arithNode) eval(ctx *exprContext) (exprValue, error) {
+	l, err := n.l.eval(ctx)
+	if err != nil {
+		return l, err
+	}
+	r, err := n.r.eval(ctx)
+	if err != nil {
+		return r, err
+	}
+	if n.op == "+" && (!l.num && l.s != "" || !r.num && r.s != "") {
+		return exprValue{s: l.s + r.s}, nil
+	}
+	if l.s == "" || r.s == "" {
+		return exprValue{}, nil
+	}
+	for _, v := range []exprValue{l, r} {
+		if !v.num {
+			return exprValue{}, fmt.Errorf("%q isn't a number", v.s)
+		}
+	}
+	dec := l.dec
+	if r.dec > dec {
+		dec = r.dec
+	}
+	switch n.op {
+	case "+":
+		return numberValue(l.n+r.n, dec), nil
+	case "-":
+		return numberValue(l.n-r.n, dec), nil
+	case "*":
+		return numberValue(l.n*r.n, l.dec+r.dec), nil
+	}
+	if r.n == 0 {
+		return exprValue{}, fmt.Errorf("division by zero")
+	}
+	if n.op == "%" {
+		return numberValue(math.Mod(l.n, r.n), dec), nil
+	}
+	return numberValue(l.n/r.n, -1), nil
+}
+
+type callNode struct {
+	name string
+	f    exprFunc
+	args []exprNode
+}
+
+func (n callNode) eval(ctx *exprContext) (exprValue, error) {
+	args := make([]exprValue, len(n.args))
+	for i, a := range n.args {
+		var err error
+		args[i], err = a.eval(ctx)
+		if err != nil {
+			return args[i], err
+		}
+	}
+	v, err := n.f.fn(args)
+	if err != nil {
+		return v, fmt.Errorf("%s: %s", n.name, err)
+	}
+	return v, nil
+}
+
+// exprFunc is a function of computed column expressions, with min to max
+// arguments; a max of -1 is any number.
+type exprFunc struct {
+	min, max int
+	fn       func(args []exprValue) (exprValue, error)
+}
+
+// stringFunc returns the function of one string.
+func stringFunc(f func(string) string) exprFunc {
+	return exprFunc{1, 1, func(args []exprValue) (exprValue, error) {
+		return exprValue{s: f(args[0].s)}, nil
+	}}
+}
+
+// exprFuncs are the functions of computed column expressions.
+var exprFuncs = map[string]exprFunc{
+	"upper": stringFunc(strings.ToUpper),
+	"lower": stringFunc(strings.ToLower),
+	"trim":  stringFunc(strings.TrimSpace),
+	"replace": {3, 3, func(args []exprValue) (exprValue, error) {
+		return exprValue{s: strings.Replace(args[0].s, args[1].s, args[2].s, -1)}, nil
+	}},
+	"concat": {1, -1, func(args []exprValue) (exprValue, error) {
+		var b strings.Builder
+		for _, a := range args {
+			b.WriteString(a.s)
+		}
+		return exprValue{s: b.String()}, nil
+	}},
+	"coalesce": {1, -1, func(args []exprValue) (exprValue, error) {
+		for _, a := range args {
+			if a.s != "" {
+				return a, nil
+			}
+		}
+		return exprValue{}, nil
+	}},
+	"round": {1, 2, func(args []exprValue) (exprValue, error) {
+		v := args[0]
+		if v.s == "" {
+			return v, nil
+		}
+		if !v.num {
+			return exprValue{}, fmt.Errorf("%q isn't a number", v.s)
+		}
+		var dec int
+		if len(args) == 2 {
+			if !args[1].num || args[1].n != math.Trunc(args[1].n) || args[1].n < 0 {
+				return exprValue{}, fmt.Errorf("%q isn't a number of decimals", args[1].s)
+			}
+			dec = int(args[1].n)
+		}
+		p := math.Pow10(dec)
+		return numberValue(math.Round(v.n*p)/p, dec), nil
+	}},
+	"abs": {1, 1, func(args []exprValue) (exprValue, error) {
+		v := args[0]
+		if v.s == "" {
+			return v, nil
+		}
+		if !v.num {
+			return exprValue{}, fmt.Errorf("%q isn't a number", v.s)
+		}
+		return numberValue(math.Abs(v.n), v.dec), nil
+	}},
+}
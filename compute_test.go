@@ -0,0 +1,120 @@
+package transmogrifier
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestComputedApply(t *testing.T) {
+	header := []string{"item", "qty", "price", "url"}
+	rows := [][]string{
+		[]string{"towel", "2", "1.25", "http://t"},
+		[]string{"mug", "3", "$4", "http://m"},
+		[]string{"pen", "", "0.5", ""},
+	}
+	tests := []struct {
+		exprs       string
+		cols        string
+		expected    [][]string
+		expectedErr string
+	}{
+		{"total = qty * price", "total", [][]string{{"2.50"}, {"12"}, {""}}, ""},
+		{"link = '[' + item + '](' + url + ')'", "link", [][]string{{"[towel](http://t)"}, {"[mug](http://m)"}, {"[pen]()"}}, ""},
+		{"q = qty / 4; r = qty % 2", "q,r", [][]string{{"0.5", "0"}, {"0.75", "1"}, {"", ""}}, ""},
+		{"`Item Code` = upper(item) + '-' + #2", "Item Code", [][]string{{"TOWEL-2"}, {"MUG-3"}, {"PEN-"}}, ""},
+		{"n = -(qty + 1) * 2; c = coalesce(qty, 'none')", "n,c", [][]string{{"-6", "2"}, {"-8", "3"}, {"", "none"}}, ""},
+		{"total = qty * price; tax = round(total * 0.2, 2)", "total,tax", [][]string{{"2.50", "0.50"}, {"12", "2.40"}, {"", ""}}, ""},
+		{"price = replace(price, '$', ''); cents = price * 100", "price,cents", [][]string{{"1.25", "125.00"}, {"4", "400"}, {"0.5", "50.0"}}, ""},
+		{"total = item * 2", "", nil, `computed column "total": row 1: "towel" isn't a number`},
+		{"t = qty / (qty - qty)", "", nil, `computed column "t": row 1: division by zero`},
+		{"total = nope * 2", "", nil, "computed column: unknown column \"nope\" at 9:\n\ttotal = nope * 2\n\t        ^"},
+		{"total qty", "", nil, "computed column: expected '=', got \"qty\" at 7:\n\ttotal qty\n\t      ^"},
+		{"t = sqrt(qty)", "", nil, "computed column: unknown function \"sqrt\" at 5:\n\tt = sqrt(qty)\n\t    ^"},
+		{"t = round()", "", nil, "computed column: wrong number of arguments to round at 5:\n\tt = round()\n\t    ^"},
+		{"#1 = qty", "", nil, "computed column: expected the column's name, got \"#1\" at 1:\n\t#1 = qty\n\t^"},
+		{" ; ", "", nil, "computed columns: no columns"},
+	}
+	for i, test := range tests {
+		c, err := ParseComputed(test.exprs)
+		var h []string
+		var r [][]string
+		if err == nil {
+			h, r, err = c.Apply(header, rows)
+		}
+		if err != nil {
+			if err.Error() != test.expectedErr {
+				t.Errorf("%d: expected error %q, got %q", i, test.expectedErr, err)
+			}
+			continue
+		}
+		if test.expectedErr != "" {
+			t.Errorf("%d: expected error %q, got none", i, test.expectedErr)
+			continue
+		}
+		var got [][]string
+		for _, row := range r {
+			var vals []string
+			for _, n := range strings.Split(test.cols, ",") {
+				vals = append(vals, row[indexOf(h, n)])
+			}
+			got = append(got, vals)
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%d: %s: expected %q, got %q", i, test.exprs, test.expected, got)
+		}
+	}
+	if rows[1][2] != "$4" {
+		t.Errorf("expected the rows not to be modified, got %q", rows[1])
+	}
+}
+
+func TestComputedFunc(t *testing.T) {
+	c := NewComputed()
+	c.Add("label", func(row Row) (string, error) {
+		return fmt.Sprintf("%d:%s", row.Index, row.Get("name")), nil
+	})
+	c.Add("check", func(row Row) (string, error) {
+		if _, ok := row.Lookup("#4"); ok {
+			return "", fmt.Errorf("unexpected #4")
+		}
+		return row.Get("label") + row.Get("missing"), nil
+	})
+	h, rows, err := c.Apply([]string{"name"}, [][]string{{"a"}, {"b"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	expected := [][]string{{"a", "0:a", "0:a"}, {"b", "1:b", "1:b"}}
+	if !reflect.DeepEqual(h, []string{"name", "label", "check"}) || !reflect.DeepEqual(rows, expected) {
+		t.Errorf("expected %q, got %q and %q", expected, h, rows)
+	}
+	c.Add("fail", func(row Row) (string, error) {
+		return "", fmt.Errorf("no")
+	})
+	_, _, err = c.Apply(nil, [][]string{{"a"}})
+	if err == nil || err.Error() != `computed column "fail": row 1: no` {
+		t.Errorf("expected the func's error, got %v", err)
+	}
+}
+
+func TestMDTableComputed(t *testing.T) {
+	c, err := ParseComputed("total = qty * price")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := NewMDTable()
+	md.SetHasColumnNames(true)
+	md.SetUseFormat(true)
+	md.SetColumnAlignment([]string{"", "r", "r", "r"})
+	md.SetColumnEmphasis([]string{"", "", "", "b"})
+	md.SetComputed(c)
+	err = md.TransmogrifyStringTable([][]string{{"item", "qty", "price"}, {"towel", "2", "1.5"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	expected := "|item|qty|price|total|  \n|---|---:|---:|---:|  \n|towel|2|1.5|__3.0__|  \n"
+	if md.String() != expected {
+		t.Errorf("expected %q, got %q", expected, md.String())
+	}
+}
@@ -0,0 +1,680 @@
+package transmogrifier
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Config is a list of jobs, read from a config file by ReadConfig. A config
+// file is YAML, 'mog.yaml', or TOML, 'mog.toml', with the jobs, and the
+// defaults that every job inherits:
+//
+//	defaults:
+//	  format: md
+//	  dialect:
+//	    comma: ";"
+//	  options:
+//	    backup: true
+//	jobs:
+//	  - source: data/prices.csv
+//	    dest: docs/README.md
+//	    inject: prices
+//	  - source: ${DATA_DIR}/stock.fwf
+//	    format_source: formats/stock.fmt
+//	    no_header: true
+//
+// The keys of a job are:
+//
+//	source         the source; required
+//	dest           the destination
+//	source_format  the source's format: csv or fixed
+//	format         the output format: md, csv, fixed, or sql
+//	format_source  the format file
+//	dialect        the CSV dialect: comma, comment, fields, lazy_quotes, and
+//	               trim_leading_space
+//	no_header      whether the source's first row is data
+//	columns        the projection of the columns, e.g. "Item, Price as Cost"
+//	filter         the filter of the rows, e.g. 'status == "open"'; a '$',
+//	               e.g. of a regular expression, is written '$$'
+//	sort           the sort keys of the rows, e.g. "priority desc, due"
+//	group_by       the columns the rows are grouped by, e.g. "region"
+//	aggregate      the aggregates of each group, e.g. "sum(amount), count(*)"
+//	totals         the aggregates of the footer row, e.g. "sum(amount)"
+//	subtotals      the columns whose groups have subtotal rows
+//	compute        computed columns, e.g. "total = qty * price": a string, or
+//	               a list of them
+//	templates      the templates of columns, a table of the column names and
+//	               their templates, e.g. name = "{{link .Value .Row.url}}";
+//	               a '$' is written '$$'
+//	rules          conditional formatting rules, e.g. "bold on price when
+//	               price > 100": a string, or a list of them
+//	rule_match     how the rules are matched: first or all
+//	reshape        pivots, unpivots, or transposes the table, e.g.
+//	               "pivot region; quarter; sum(amount)"
+//	union          more sources whose rows are appended: a list of paths
+//	union_all      whether the union's columns are unioned
+//	join           the table the source is joined with: source, on, the key
+//	               columns, e.g. "sku = id", type, inner, left, right, or
+//	               full, collision, suffix, left, right, or error, and
+//	               suffix
+//	diff           the old version of the source that it is diffed with:
+//	               source, key, the key columns, style, inline or status,
+//	               and unchanged, whether unchanged rows are included
+//	inject         the name of the dest's region that the output is injected
+//	               into
+//	options        how the dest is written: no_clobber, backup, and mode, an
+//	               octal string, e.g. "0644"
+//
+// See Job for what each does. The defaults can have any key but source and
+// dest; a job's dialect and options are merged with the defaults'. Unknown
+// keys are errors.
+//
+// '$VAR' and '${VAR}' in values are replaced by the environment variable;
+// '${VAR:-default}' is replaced by default if the variable isn't set, and
+// '$$' by '$'. Any other variable that isn't set is an error. Relative local
+// paths are relative to the config file's directory.
+type Config struct {
+	// Jobs are the jobs, with the defaults applied, in the order they are
+	// in the config file.
+	Jobs []Job
+}
+
+// ReadConfig reads the config file, which is YAML, if its extension is
+// '.yaml' or '.yml', or TOML, if its extension is '.toml'.
+func ReadConfig(name string) (*Config, error) {
+	var parse func([]byte) (map[string]interface{}, error)
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		parse = parseYAML
+	case ".toml":
+		parse = parseTOML
+	default:
+		return nil, fmt.Errorf("%s: unsupported config format: %q", name, filepath.Ext(name))
+	}
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s", name, strings.TrimPrefix(err.Error(), "line "))
+	}
+	d := configDecoder{dir: filepath.Dir(name)}
+	c, err := d.config(tree)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return c, nil
+}
+
+// Run runs the jobs, in order; jobs can write to the same destination, e.g.
+// to different regions of a Markdown file. The result of every job is
+// returned; a job that fails doesn't stop the others. If any jobs failed,
+// their errors are returned as BatchErrors.
+func (c *Config) Run() ([]BatchResult, error) {
+	return c.run(false)
+}
+
+// Check checks the jobs, in order, instead of running them: the output of
+// each is compared with its destination. Destinations that aren't up to date
+// fail with a *CheckError.
+func (c *Config) Check() ([]BatchResult, error) {
+	return c.run(true)
+}
+
+func (c *Config) run(check bool) ([]BatchResult, error) {
+	results := make([]BatchResult, len(c.Jobs))
+	var errs BatchErrors
+	for i, j := range c.Jobs {
+		j.Check = j.Check || check
+		results[i].Source = j.Source
+		results[i].Dest, results[i].Err = j.Run()
+		if results[i].Err != nil {
+			errs = append(errs, &BatchError{Source: j.Source, Err: results[i].Err})
+		}
+	}
+	if len(errs) > 0 {
+		return results, errs
+	}
+	return results, nil
+}
+
+// configDecoder decodes the parsed config file into a Config.
+type configDecoder struct {
+	// dir is the config file's directory; relative paths are relative to
+	// it.
+	dir string
+}
+
+// sortedKeys returns the keys of m in order, so that errors are
+// deterministic.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// config decodes the config.
+func (d configDecoder) config(tree map[string]interface{}) (*Config, error) {
+	for _, k := range sortedKeys(tree) {
+		if k != "defaults" && k != "jobs" {
+			return nil, fmt.Errorf("%s: unknown key", k)
+		}
+	}
+	var defaults map[string]interface{}
+	if v := tree["defaults"]; v != nil {
+		var ok bool
+		defaults, ok = v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("defaults: expected a table")
+		}
+		for _, k := range []string{"source", "dest"} {
+			if _, ok := defaults[k]; ok {
+				return nil, fmt.Errorf("defaults.%s: can't be a default", k)
+			}
+		}
+		// the defaults are decoded on their own so that their errors are
+		// reported once, as errors in the defaults.
+		_, err := d.job("defaults", defaults)
+		if err != nil {
+			return nil, err
+		}
+	}
+	jobs, ok := tree["jobs"].([]interface{})
+	if !ok || len(jobs) == 0 {
+		return nil, fmt.Errorf("jobs: expected a list of jobs")
+	}
+	c := &Config{Jobs: make([]Job, len(jobs))}
+	for i, v := range jobs {
+		key := fmt.Sprintf("jobs[%d]", i)
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: expected a table", key)
+		}
+		if m["source"] == nil {
+			return nil, fmt.Errorf("%s: no source", key)
+		}
+		j, err := d.job(key, mergeConfig(defaults, m))
+		if err != nil {
+			return nil, err
+		}
+		c.Jobs[i] = j
+	}
+	return c, nil
+}
+
+// mergeConfig returns the job's table with the defaults that it doesn't
+// set. Tables are merged.
+func mergeConfig(defaults, job map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(defaults)+len(job))
+	for k, v := range defaults {
+		m[k] = v
+	}
+	for k, v := range job {
+		dv, dok := m[k].(map[string]interface{})
+		jv, jok := v.(map[string]interface{})
+		if dok && jok {
+			v = mergeConfig(dv, jv)
+		}
+		m[k] = v
+	}
+	return m
+}
+
+// job decodes the table of the job, or the defaults, at key.
+func (d configDecoder) job(key string, m map[string]interface{}) (Job, error) {
+	var j Job
+	var err error
+	for _, k := range sortedKeys(m) {
+		v := m[k]
+		if v == nil {
+			continue
+		}
+		kk := key + "." + k
+		switch k {
+		case "source":
+			j.Source, err = d.path(kk, v)
+		case "dest":
+			j.Dest, err = d.path(kk, v)
+		case "format_source":
+			j.FormatSource, err = d.path(kk, v)
+		case "source_format":
+			j.SourceFormat, err = d.format(kk, v)
+			if err == nil && !isDecodable(j.SourceFormat) {
+				err = fmt.Errorf("%s: unsupported source format: %q", kk, j.SourceFormat)
+			}
+		case "format":
+			j.Format, err = d.format(kk, v)
+		case "dialect":
+			j.Dialect, err = d.dialect(kk, v)
+		case "no_header":
+			j.NoHeader, err = d.bool(kk, v)
+		case "columns":
+			j.Columns, err = d.expr(kk, v, func(s string) error {
+				_, err := ParseProjection(s)
+				return err
+			})
+		case "filter":
+			j.Filter, err = d.expr(kk, v, func(s string) error {
+				_, err := ParseFilter(s)
+				return err
+			})
+		case "sort":
+			j.Sort, err = d.expr(kk, v, func(s string) error {
+				_, err := ParseSort(s)
+				return err
+			})
+		case "group_by":
+			j.GroupBy, err = d.expr(kk, v, func(s string) error {
+				_, err := parseColumnList(s)
+				return err
+			})
+		case "aggregate":
+			j.Aggregate, err = d.expr(kk, v, func(s string) error {
+				_, err := ParseAggregates(s)
+				return err
+			})
+		case "totals":
+			j.Totals, err = d.expr(kk, v, func(s string) error {
+				_, err := ParseAggregates(s)
+				return err
+			})
+		case "subtotals":
+			j.Subtotals, err = d.expr(kk, v, func(s string) error {
+				_, err := parseColumnList(s)
+				return err
+			})
+		case "compute":
+			j.Compute, err = d.exprs(kk, v, func(s string) error {
+				_, err := ParseComputed(s)
+				return err
+			})
+		case "rules":
+			j.Rules, err = d.exprs(kk, v, func(s string) error {
+				_, err := ParseRules(s)
+				return err
+			})
+		case "rule_match":
+			var s string
+			s, err = d.string(kk, v)
+			if err == nil {
+				j.FirstMatch, err = parseRuleMatch(s)
+				if err != nil {
+					err = fmt.Errorf("%s: %s", kk, err)
+				}
+			}
+		case "templates":
+			j.Templates, err = d.templates(kk, v)
+		case "reshape":
+			j.Reshape, err = d.expr(kk, v, func(s string) error {
+				_, err := ParseReshape(s)
+				return err
+			})
+		case "union":
+			j.Union, err = d.paths(kk, v)
+		case "union_all":
+			j.UnionAll, err = d.bool(kk, v)
+		case "join":
+			j.Join, err = d.join(kk, v)
+		case "diff":
+			j.Diff, err = d.diff(kk, v)
+		case "inject":
+			j.Region, err = d.string(kk, v)
+		case "options":
+			j.Write, err = d.writeOptions(kk, v)
+		default:
+			err = fmt.Errorf("%s: unknown key", kk)
+		}
+		if err != nil {
+			return Job{}, err
+		}
+	}
+	return j, nil
+}
+
+// dialect decodes a dialect table.
+func (d configDecoder) dialect(key string, v interface{}) (CSVDialect, error) {
+	var dialect CSVDialect
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return dialect, fmt.Errorf("%s: expected a table", key)
+	}
+	var err error
+	for _, k := range sortedKeys(m) {
+		kk := key + "." + k
+		switch k {
+		case "comma":
+			dialect.Comma, err = d.rune(kk, m[k])
+		case "comment":
+			dialect.Comment, err = d.rune(kk, m[k])
+		case "fields":
+			dialect.FieldsPerRecord, err = d.int(kk, m[k])
+		case "lazy_quotes":
+			dialect.LazyQuotes, err = d.bool(kk, m[k])
+		case "trim_leading_space":
+			dialect.TrimLeadingSpace, err = d.bool(kk, m[k])
+		default:
+			err = fmt.Errorf("%s: unknown key", kk)
+		}
+		if err != nil {
+			return dialect, err
+		}
+	}
+	return dialect, nil
+}
+
+// join decodes a join table.
+func (d configDecoder) join(key string, v interface{}) (*JoinTable, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: expected a table", key)
+	}
+	jt := &JoinTable{}
+	var err error
+	for _, k := range sortedKeys(m) {
+		kk := key + "." + k
+		var s string
+		switch k {
+		case "source":
+			jt.Source, err = d.path(kk, m[k])
+		case "on":
+			jt.On, err = d.expr(kk, m[k], func(s string) error {
+				_, err := ParseJoin(s)
+				return err
+			})
+		case "type":
+			s, err = d.string(kk, m[k])
+			if err == nil {
+				jt.Type, err = ParseJoinType(s)
+				if err != nil {
+					err = fmt.Errorf("%s: %s", kk, err)
+				}
+			}
+		case "collision":
+			s, err = d.string(kk, m[k])
+			if err == nil {
+				jt.Collision, err = ParseJoinCollision(s)
+				if err != nil {
+					err = fmt.Errorf("%s: %s", kk, err)
+				}
+			}
+		case "suffix":
+			jt.Suffix, err = d.string(kk, m[k])
+		default:
+			err = fmt.Errorf("%s: unknown key", kk)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if jt.Source == "" || jt.On == "" {
+		return nil, fmt.Errorf("%s: expected a source and on", key)
+	}
+	return jt, nil
+}
+
+// diff decodes a diff table.
+func (d configDecoder) diff(key string, v interface{}) (*DiffSource, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: expected a table", key)
+	}
+	ds := &DiffSource{}
+	var err error
+	for _, k := range sortedKeys(m) {
+		kk := key + "." + k
+		switch k {
+		case "source":
+			ds.Source, err = d.path(kk, m[k])
+		case "key":
+			ds.Key, err = d.expr(kk, m[k], func(s string) error {
+				_, err := parseColumnList(s)
+				return err
+			})
+		case "style":
+			var s string
+			s, err = d.string(kk, m[k])
+			if err == nil {
+				ds.Style, err = ParseDiffStyle(s)
+				if err != nil {
+					err = fmt.Errorf("%s: %s", kk, err)
+				}
+			}
+		case "unchanged":
+			ds.Unchanged, err = d.bool(kk, m[k])
+		default:
+			err = fmt.Errorf("%s: unknown key", kk)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if ds.Source == "" || ds.Key == "" {
+		return nil, fmt.Errorf("%s: expected a source and key", key)
+	}
+	return ds, nil
+}
+
+// writeOptions decodes an options table.
+func (d configDecoder) writeOptions(key string, v interface{}) (*WriteOptions, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: expected a table", key)
+	}
+	opts := &WriteOptions{}
+	var err error
+	for _, k := range sortedKeys(m) {
+		kk := key + "." + k
+		switch k {
+		case "no_clobber":
+			opts.NoClobber, err = d.bool(kk, m[k])
+		case "backup":
+			opts.Backup, err = d.bool(kk, m[k])
+		case "mode":
+			opts.Mode, err = d.mode(kk, m[k])
+		default:
+			err = fmt.Errorf("%s: unknown key", kk)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+// string decodes a string, expanding its environment variables.
+func (d configDecoder) string(key string, v interface{}) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s: expected a string, got %v", key, v)
+	}
+	var err error
+	s = os.Expand(s, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		def, hasDef := "", false
+		if i := strings.Index(name, ":-"); i >= 0 {
+			name, def, hasDef = name[:i], name[i+2:], true
+		}
+		val, ok := os.LookupEnv(name)
+		if ok && (val != "" || !hasDef) {
+			return val
+		}
+		if !hasDef && err == nil {
+			err = fmt.Errorf("%s: $%s isn't set", key, name)
+		}
+		return def
+	})
+	return s, err
+}
+
+// expr decodes a string that is checked by parse, e.g. a filter
+// expression.
+func (d configDecoder) expr(key string, v interface{}, parse func(string) error) (string, error) {
+	s, err := d.string(key, v)
+	if err != nil {
+		return "", err
+	}
+	err = parse(s)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", key, err)
+	}
+	return s, nil
+}
+
+// path decodes a path; relative local paths are made relative to the config
+// file's directory.
+func (d configDecoder) path(key string, v interface{}) (string, error) {
+	s, err := d.string(key, v)
+	if err != nil || s == "" || s == "-" || uriScheme(s) != "" || filepath.IsAbs(s) {
+		return s, err
+	}
+	return filepath.Join(d.dir, s), nil
+}
+
+// exprs decodes expressions separated by semicolons, e.g. of computed
+// columns: a string, or a list of them, which are joined with semicolons.
+// Each is checked by parse.
+func (d configDecoder) exprs(key string, v interface{}, parse func(string) error) (string, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return d.expr(key, v, parse)
+	}
+	exprs := make([]string, len(list))
+	for i, v := range list {
+		var err error
+		exprs[i], err = d.expr(fmt.Sprintf("%s[%d]", key, i), v, parse)
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(exprs, "; "), nil
+}
+
+// templates decodes a table of column templates.
+func (d configDecoder) templates(key string, v interface{}) (map[string]string, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: expected a table", key)
+	}
+	templates := map[string]string{}
+	for _, k := range sortedKeys(m) {
+		kk := key + "." + k
+		var err error
+		templates[k], err = d.expr(kk, m[k], func(s string) error {
+			return NewTemplates().Add(k, s)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return templates, nil
+}
+
+// paths decodes a list of paths, or a path.
+func (d configDecoder) paths(key string, v interface{}) ([]string, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		p, err := d.path(key, v)
+		if err != nil {
+			return nil, err
+		}
+		return []string{p}, nil
+	}
+	paths := make([]string, len(list))
+	for i, v := range list {
+		var err error
+		paths[i], err = d.path(fmt.Sprintf("%s[%d]", key, i), v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// format decodes a FormatType.
+func (d configDecoder) format(key string, v interface{}) (FormatType, error) {
+	s, err := d.string(key, v)
+	if err != nil {
+		return FmtUnsupported, err
+	}
+	f := FormatTypeFromString(s)
+	if f == FmtUnsupported {
+		return f, fmt.Errorf("%s: unsupported format: %q", key, s)
+	}
+	return f, nil
+}
+
+// bool decodes a bool, or a string that is 'true' or 'false'.
+func (d configDecoder) bool(key string, v interface{}) (bool, error) {
+	if b, ok := v.(bool); ok {
+		return b, nil
+	}
+	s, err := d.string(key, v)
+	if err == nil {
+		switch s {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("%s: expected true or false, got %v", key, v)
+}
+
+// int decodes an integer, or a string that is an integer.
+func (d configDecoder) int(key string, v interface{}) (int, error) {
+	if i, ok := v.(int64); ok {
+		return int(i), nil
+	}
+	s, err := d.string(key, v)
+	if err == nil {
+		var i int
+		i, err = strconv.Atoi(s)
+		if err == nil {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%s: expected an integer, got %v", key, v)
+}
+
+// rune decodes a string that is a single character; '\t' is a tab.
+func (d configDecoder) rune(key string, v interface{}) (rune, error) {
+	s, err := d.string(key, v)
+	if err != nil {
+		return 0, err
+	}
+	if s == `\t` {
+		return '\t', nil
+	}
+	r := []rune(s)
+	if len(r) != 1 {
+		return 0, fmt.Errorf("%s: expected a single character, got %q", key, s)
+	}
+	return r[0], nil
+}
+
+// mode decodes a file mode: an octal string, e.g. "0644", or an integer.
+func (d configDecoder) mode(key string, v interface{}) (os.FileMode, error) {
+	if i, ok := v.(int64); ok && i >= 0 && i <= 0777 {
+		return os.FileMode(i), nil
+	}
+	s, err := d.string(key, v)
+	if err == nil {
+		var m uint64
+		m, err = strconv.ParseUint(s, 8, 32)
+		if err == nil && m <= 0777 {
+			return os.FileMode(m), nil
+		}
+	}
+	return 0, fmt.Errorf("%s: expected an octal mode, e.g. \"0644\", got %v", key, v)
+}
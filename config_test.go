@@ -0,0 +1,178 @@
+package transmogrifier
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("MOG_TEST_DATA", "/data")
+	defer os.Unsetenv("MOG_TEST_DATA")
+	os.Unsetenv("MOG_TEST_UNSET")
+	tests := []struct {
+		name        string
+		doc         string
+		expected    []Job
+		expectedErr string
+	}{
+		{
+			"mog.yaml",
+			"defaults:\n  format: sql\n  dialect:\n    comma: ';'\n    trim_leading_space: true\n  options:\n    backup: true\njobs:\n  - source: a.csv\n    dest: ${MOG_TEST_DATA}/a.sql\n  - source: $MOG_TEST_DATA/b.fwf\n    format: md\n    format_source: ${MOG_TEST_UNSET:-b}.fmt\n    dialect:\n      comma: \"\\t\"\n    options:\n      mode: \"0600\"\n    inject: prices\n    no_header: true\n  - source: https://example.com/c.csv?price=$$5\n    source_format: csv\n",
+			[]Job{
+				{Source: filepath.Join(dir, "a.csv"), Dest: "/data/a.sql", Format: FmtSQL, Dialect: CSVDialect{Comma: ';', TrimLeadingSpace: true}, Write: &WriteOptions{Backup: true}},
+				{Source: "/data/b.fwf", Format: FmtMD, FormatSource: filepath.Join(dir, "b.fmt"), Dialect: CSVDialect{Comma: '\t', TrimLeadingSpace: true}, Write: &WriteOptions{Backup: true, Mode: 0600}, Region: "prices", NoHeader: true},
+				{Source: "https://example.com/c.csv?price=$5", SourceFormat: FmtCSV, Format: FmtSQL, Dialect: CSVDialect{Comma: ';', TrimLeadingSpace: true}, Write: &WriteOptions{Backup: true}},
+			},
+			"",
+		},
+		{
+			"mog.toml",
+			"[defaults]\nno_header = true\n\n[[jobs]]\nsource = \"a.csv\"\ndialect = { fields = -1, lazy_quotes = true }\n\n[[jobs]]\nsource = \"b.csv\"\nno_header = false\n[jobs.options]\nmode = 0o640\n",
+			[]Job{
+				{Source: filepath.Join(dir, "a.csv"), NoHeader: true, Dialect: CSVDialect{FieldsPerRecord: -1, LazyQuotes: true}},
+				{Source: filepath.Join(dir, "b.csv"), Write: &WriteOptions{Mode: 0640}},
+			},
+			"",
+		},
+		{
+			"mog.yaml",
+			"jobs:\n  - source: a.csv\n    filter: 'name =~ \"^a$$\" && price > 2'\n    columns: name\n",
+			[]Job{{Source: filepath.Join(dir, "a.csv"), Filter: `name =~ "^a$" && price > 2`, Columns: "name"}},
+			"",
+		},
+		{
+			"mog.yaml",
+			"jobs:\n  - source: products.csv\n    union:\n      - more.csv\n    union_all: true\n    join:\n      source: prices.csv\n      on: sku = id\n      type: left outer\n      collision: left\n",
+			[]Job{{Source: filepath.Join(dir, "products.csv"), Union: []string{filepath.Join(dir, "more.csv")}, UnionAll: true, Join: &JoinTable{Source: filepath.Join(dir, "prices.csv"), On: "sku = id", Type: LeftJoin, Collision: CollisionLeft}}},
+			"",
+		},
+		{"mog.yaml", "jobs:\n  - source: a.csv\n    join:\n      source: b.csv\n      on: id\n      type: outside\n", nil, `mog.yaml: jobs[0].join.type: unknown join type: "outside"`},
+		{"mog.yaml", "jobs:\n  - source: a.csv\n    join:\n      on: id\n", nil, "mog.yaml: jobs[0].join: expected a source and on"},
+		{
+			"mog.toml",
+			"[[jobs]]\nsource = \"new.csv\"\n[jobs.diff]\nsource = \"old.csv\"\nkey = \"sku\"\nstyle = \"status\"\nunchanged = true\n",
+			[]Job{{Source: filepath.Join(dir, "new.csv"), Diff: &DiffSource{Source: filepath.Join(dir, "old.csv"), Key: "sku", Style: DiffStatusColumn, Unchanged: true}}},
+			"",
+		},
+		{"mog.yaml", "jobs:\n  - source: a.csv\n    diff:\n      source: b.csv\n      key: id\n      style: sideways\n", nil, `mog.yaml: jobs[0].diff.style: unknown diff style: "sideways"`},
+		{
+			"mog.yaml",
+			"jobs:\n  - source: a.csv\n    compute:\n      - total = qty * price\n      - \"link = '[' + name + ']'\"\n",
+			[]Job{{Source: filepath.Join(dir, "a.csv"), Compute: "total = qty * price; link = '[' + name + ']'"}},
+			"",
+		},
+		{
+			"mog.yaml",
+			"jobs:\n  - source: a.csv\n    templates:\n      name: '{{link .Value .Row.url}}'\n      total: '{{$$t := .Value}}{{$$t}}'\n",
+			[]Job{{Source: filepath.Join(dir, "a.csv"), Templates: map[string]string{"name": "{{link .Value .Row.url}}", "total": "{{$t := .Value}}{{$t}}"}}},
+			"",
+		},
+		{
+			"mog.yaml",
+			"jobs:\n  - source: a.csv\n    rules:\n      - bold on price when price > 100\n      - strikethrough when status == 'discontinued'\n    rule_match: first\n",
+			[]Job{{Source: filepath.Join(dir, "a.csv"), Rules: "bold on price when price > 100; strikethrough when status == 'discontinued'", FirstMatch: true}},
+			"",
+		},
+		{"mog.yaml", "jobs:\n  - source: a.csv\n    rules: blink\n", nil, "mog.yaml: jobs[0].rules: rule \"blink\": unknown style \"blink\""},
+		{"mog.yaml", "jobs:\n  - source: a.csv\n    rule_match: last\n", nil, "mog.yaml: jobs[0].rule_match: unknown rule match \"last\": expected first or all"},
+		{"mog.yaml", "jobs:\n  - source: a.csv\n    templates: '{{.Value}}'\n", nil, "mog.yaml: jobs[0].templates: expected a table"},
+		{"mog.yaml", "jobs:\n  - source: a.csv\n    templates:\n      name: '{{nope}}'\n", nil, "mog.yaml: jobs[0].templates.name: template: name:1: function \"nope\" not defined"},
+		{"mog.yaml", "jobs:\n  - source: a.csv\n    compute: total\n", nil, "mog.yaml: jobs[0].compute: computed column: expected '=', got \"end of expression\" at 6:\n\ttotal\n\t     ^"},
+		{"mog.yaml", "jobs:\n  - source: a.csv\n    filter: 'a >'\n", nil, "mog.yaml: jobs[0].filter: filter: expected an operand, got \"end of expression\" at 4:\n\ta >\n\t   ^"},
+		{"mog.json", "{}", nil, `mog.json: unsupported config format: ".json"`},
+		{"mog.yaml", "jobs:\n  - source: a.csv\n    dialect:\n      comam: ';'\n", nil, "mog.yaml: jobs[0].dialect.comam: unknown key"},
+		{"mog.yaml", "job:\n  - source: a.csv\n", nil, "mog.yaml: job: unknown key"},
+		{"mog.toml", "[defaults]\nformatt = \"md\"\n[[jobs]]\nsource = \"a.csv\"\n", nil, "mog.toml: defaults.formatt: unknown key"},
+		{"mog.toml", "[defaults]\nsource = \"a.csv\"\n[[jobs]]\nsource = \"a.csv\"\n", nil, "mog.toml: defaults.source: can't be a default"},
+		{"mog.yaml", "jobs:\n  - dest: a.md\n", nil, "mog.yaml: jobs[0]: no source"},
+		{"mog.yaml", "jobs: []\n", nil, "mog.yaml: jobs: expected a list of jobs"},
+		{"mog.yaml", "jobs:\n  - source: $MOG_TEST_UNSET/a.csv\n", nil, "mog.yaml: jobs[0].source: $MOG_TEST_UNSET isn't set"},
+		{"mog.yaml", "jobs:\n  - source: a.csv\n    format: json\n", nil, `mog.yaml: jobs[0].format: unsupported format: "json"`},
+		{"mog.yaml", "jobs:\n  - source: a.csv\n    source_format: sql\n", nil, `mog.yaml: jobs[0].source_format: unsupported source format: "sql"`},
+		{"mog.yaml", "jobs:\n  - source: a.csv\n    no_header: yes\n", nil, "mog.yaml: jobs[0].no_header: expected true or false, got yes"},
+		{"mog.yaml", "jobs:\n  - source: a.csv\n    dialect:\n      comma: ';;'\n", nil, `mog.yaml: jobs[0].dialect.comma: expected a single character, got ";;"`},
+		{"mog.yaml", "jobs:\n  - source: a.csv\n    options:\n      mode: 0999\n", nil, `mog.yaml: jobs[0].options.mode: expected an octal mode, e.g. "0644", got 0999`},
+		{"mog.yaml", "jobs:\n  - source: a.csv\n  dest: a.md\n", nil, "mog.yaml:3: unexpected indentation"},
+		{"mog.toml", "[[jobs]]\nsource = 1\n", nil, "mog.toml: jobs[0].source: expected a string, got 1"},
+	}
+	for i, test := range tests {
+		name := filepath.Join(dir, test.name)
+		ioutil.WriteFile(name, []byte(test.doc), 0644)
+		c, err := ReadConfig(name)
+		if err != nil {
+			if err.Error() != filepath.Join(dir, test.expectedErr) {
+				t.Errorf("%d: expected %q, got %q", i, test.expectedErr, strings.TrimPrefix(err.Error(), dir+string(filepath.Separator)))
+			}
+			continue
+		}
+		if test.expectedErr != "" {
+			t.Errorf("%d: expected %q, got no error", i, test.expectedErr)
+			continue
+		}
+		if !reflect.DeepEqual(c.Jobs, test.expected) {
+			t.Errorf("%d: expected %+v, got %+v", i, test.expected, c.Jobs)
+		}
+	}
+}
+
+func TestConfigRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	doc := "# Inventory\n\n<!-- mog:begin prices -->\n<!-- mog:end prices -->\n\n<!-- mog:begin stock -->\n<!-- mog:end stock -->\n"
+	writeTree(t, dir, map[string]string{
+		"data/prices.csv": "item,price\ntowel,42\n",
+		"data/stock.csv":  "item;count\ntowel;1\n",
+		"docs/README.md":  doc,
+	})
+	config := "jobs:\n  - source: data/prices.csv\n    dest: docs/README.md\n    inject: prices\n  - source: data/stock.csv\n    dest: docs/README.md\n    inject: stock\n    dialect:\n      comma: ';'\n"
+	ioutil.WriteFile(filepath.Join(dir, "mog.yaml"), []byte(config), 0644)
+	c, err := ReadConfig(filepath.Join(dir, "mog.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Check()
+	errs, ok := err.(BatchErrors)
+	if !ok || len(errs) != 2 || !errors.As(errs[0], new(*CheckError)) {
+		t.Errorf("check: expected 2 CheckErrors, got %v", err)
+	}
+	results, err := c.Run()
+	if err != nil {
+		t.Fatalf("run: expected no error, got %q", err)
+	}
+	if len(results) != 2 || results[1].Dest != filepath.Join(dir, "docs", "README.md") {
+		t.Errorf("run: unexpected results %+v", results)
+	}
+	b, _ := ioutil.ReadFile(filepath.Join(dir, "docs", "README.md"))
+	expected := "# Inventory\n\n<!-- mog:begin prices -->\n|item|price|  \n|---|---|  \n|towel|42|  \n<!-- mog:end prices -->\n\n<!-- mog:begin stock -->\n|item|count|  \n|---|---|  \n|towel|1|  \n<!-- mog:end stock -->\n"
+	if string(b) != expected {
+		t.Errorf("run: expected %q, got %q", expected, b)
+	}
+	_, err = c.Check()
+	if err != nil {
+		t.Errorf("check: expected no error, got %q", err)
+	}
+
+	// a missing region is an error, and nothing is written.
+	c.Jobs[0].Region = "missing"
+	_, err = c.Run()
+	if err == nil || !strings.Contains(err.Error(), `region "missing" not found`) {
+		t.Errorf("missing region: expected a not found error, got %v", err)
+	}
+	b2, _ := ioutil.ReadFile(filepath.Join(dir, "docs", "README.md"))
+	if string(b2) != expected {
+		t.Errorf("missing region: expected %q, got %q", expected, b2)
+	}
+}
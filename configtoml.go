@@ -0,0 +1,421 @@
+package transmogrifier
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// tomlParser parses the subset of TOML that config files use: tables, arrays
+// of tables, dotted keys, strings, integers, booleans, arrays, and inline
+// tables. Floats and dates aren't supported.
+type tomlParser struct {
+	s    string
+	pos  int
+	line int
+	root map[string]interface{}
+	// defined are the tables that have had a header.
+	defined map[string]bool
+}
+
+// parseTOML parses the TOML document in b.
+func parseTOML(b []byte) (map[string]interface{}, error) {
+	p := &tomlParser{s: string(b), line: 1, root: map[string]interface{}{}, defined: map[string]bool{}}
+	cur := p.root
+	for {
+		p.skip(true)
+		if p.pos == len(p.s) {
+			return p.root, nil
+		}
+		var err error
+		if p.s[p.pos] == '[' {
+			cur, err = p.header()
+		} else {
+			err = p.keyValue(cur)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", p.line, err)
+		}
+		// the rest of the line can only be a comment.
+		p.skip(false)
+		if p.pos < len(p.s) && p.s[p.pos] != '\n' {
+			return nil, fmt.Errorf("line %d: expected the end of the line, got %q", p.line, p.rest())
+		}
+	}
+}
+
+// rest returns the rest of the current line, for errors.
+func (p *tomlParser) rest() string {
+	s := p.s[p.pos:]
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimRight(s, "\r")
+}
+
+// skip skips white space and comments and, if newlines is set, newlines.
+func (p *tomlParser) skip(newlines bool) {
+	for p.pos < len(p.s) {
+		switch c := p.s[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && newlines:
+			p.pos++
+			p.line++
+		case c == '#':
+			for p.pos < len(p.s) && p.s[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// header parses a table, or array of tables, header and returns the table
+// that the following keys are in.
+func (p *tomlParser) header() (map[string]interface{}, error) {
+	array := strings.HasPrefix(p.s[p.pos:], "[[")
+	if array {
+		p.pos += 2
+	} else {
+		p.pos++
+	}
+	p.skip(false)
+	keys, err := p.keys()
+	if err != nil {
+		return nil, err
+	}
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	if !strings.HasPrefix(p.s[p.pos:], closing) {
+		return nil, fmt.Errorf("expected %q, got %q", closing, p.rest())
+	}
+	p.pos += len(closing)
+	parent, err := p.table(p.root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+	if array {
+		v, ok := parent[last]
+		if !ok {
+			v = []interface{}{}
+		}
+		tables, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s isn't an array of tables", strings.Join(keys, "."))
+		}
+		t := map[string]interface{}{}
+		parent[last] = append(tables, t)
+		// the subtables of the new table haven't been defined.
+		prefix := strings.Join(keys, ".") + "."
+		for name := range p.defined {
+			if strings.HasPrefix(name, prefix) {
+				delete(p.defined, name)
+			}
+		}
+		return t, nil
+	}
+	name := strings.Join(keys, ".")
+	if p.defined[name] {
+		return nil, fmt.Errorf("table %s is defined more than once", name)
+	}
+	p.defined[name] = true
+	return p.table(parent, []string{last})
+}
+
+// table returns the table at the keys in t, creating the tables that don't
+// exist. A key that is an array of tables is its last table.
+func (p *tomlParser) table(t map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for _, k := range keys {
+		switch v := t[k].(type) {
+		case nil:
+			next := map[string]interface{}{}
+			t[k] = next
+			t = next
+		case map[string]interface{}:
+			t = v
+		case []interface{}:
+			if len(v) == 0 {
+				return nil, fmt.Errorf("%s isn't a table", k)
+			}
+			last, ok := v[len(v)-1].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s isn't a table", k)
+			}
+			t = last
+		default:
+			return nil, fmt.Errorf("%s isn't a table", k)
+		}
+	}
+	return t, nil
+}
+
+// keys parses a, possibly dotted, key.
+func (p *tomlParser) keys() ([]string, error) {
+	var keys []string
+	for {
+		p.skip(false)
+		if p.pos == len(p.s) {
+			return nil, fmt.Errorf("expected a key")
+		}
+		var k string
+		switch p.s[p.pos] {
+		case '"', '\'':
+			v, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			k = v
+		default:
+			start := p.pos
+			for p.pos < len(p.s) && isBareKeyChar(p.s[p.pos]) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, fmt.Errorf("expected a key, got %q", p.rest())
+			}
+			k = p.s[start:p.pos]
+		}
+		keys = append(keys, k)
+		p.skip(false)
+		if p.pos == len(p.s) || p.s[p.pos] != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+// isBareKeyChar returns whether c can be part of a bare key.
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// keyValue parses 'key = value' into t.
+func (p *tomlParser) keyValue(t map[string]interface{}) error {
+	keys, err := p.keys()
+	if err != nil {
+		return err
+	}
+	if p.pos == len(p.s) || p.s[p.pos] != '=' {
+		return fmt.Errorf("expected '=' after %s", strings.Join(keys, "."))
+	}
+	p.pos++
+	p.skip(false)
+	v, err := p.value()
+	if err != nil {
+		return err
+	}
+	t, err = p.table(t, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, ok := t[last]; ok {
+		return fmt.Errorf("duplicate key %s", strings.Join(keys, "."))
+	}
+	t[last] = v
+	return nil
+}
+
+// value parses a value.
+func (p *tomlParser) value() (interface{}, error) {
+	if p.pos == len(p.s) {
+		return nil, fmt.Errorf("expected a value")
+	}
+	switch c := p.s[p.pos]; {
+	case c == '"' || c == '\'':
+		return p.str()
+	case c == '[':
+		return p.array()
+	case c == '{':
+		return p.inlineTable()
+	case strings.HasPrefix(p.s[p.pos:], "true"):
+		p.pos += 4
+		return true, nil
+	case strings.HasPrefix(p.s[p.pos:], "false"):
+		p.pos += 5
+		return false, nil
+	}
+	start := p.pos
+	for p.pos < len(p.s) && (isBareKeyChar(p.s[p.pos]) || strings.IndexByte("+.:", p.s[p.pos]) >= 0) {
+		p.pos++
+	}
+	s := p.s[start:p.pos]
+	if s == "" {
+		return nil, fmt.Errorf("expected a value, got %q", p.rest())
+	}
+	// ParseInt would read a leading zero as an octal prefix.
+	digits := strings.TrimLeft(s, "+-")
+	if len(digits) > 1 && digits[0] == '0' && digits[1] >= '0' && digits[1] <= '9' {
+		return nil, fmt.Errorf("integers can't have leading zeros: %s", s)
+	}
+	i, err := strconv.ParseInt(s, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported value: %s", s)
+	}
+	return i, nil
+}
+
+// array parses an array, which can span lines.
+func (p *tomlParser) array() ([]interface{}, error) {
+	p.pos++
+	a := []interface{}{}
+	for {
+		p.skip(true)
+		if p.pos == len(p.s) {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		if p.s[p.pos] == ']' {
+			p.pos++
+			return a, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+		p.skip(true)
+		if p.pos < len(p.s) && p.s[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+		if p.pos == len(p.s) || p.s[p.pos] != ']' {
+			return nil, fmt.Errorf("expected ',' or ']' in array, got %q", p.rest())
+		}
+	}
+}
+
+// inlineTable parses an inline table, which is on one line.
+func (p *tomlParser) inlineTable() (map[string]interface{}, error) {
+	p.pos++
+	t := map[string]interface{}{}
+	p.skip(false)
+	if p.pos < len(p.s) && p.s[p.pos] == '}' {
+		p.pos++
+		return t, nil
+	}
+	for {
+		err := p.keyValue(t)
+		if err != nil {
+			return nil, err
+		}
+		p.skip(false)
+		if p.pos == len(p.s) {
+			return nil, fmt.Errorf("unterminated inline table")
+		}
+		switch p.s[p.pos] {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return t, nil
+		default:
+			return nil, fmt.Errorf("expected ',' or '}' in inline table, got %q", p.rest())
+		}
+	}
+}
+
+// str parses a basic, or literal, string; either can be multi-line.
+func (p *tomlParser) str() (string, error) {
+	q := p.s[p.pos : p.pos+1]
+	multi := strings.HasPrefix(p.s[p.pos:], q+q+q)
+	delim := q
+	if multi {
+		delim = q + q + q
+	}
+	p.pos += len(delim)
+	// a newline right after the opening delimiter is trimmed.
+	if multi {
+		if strings.HasPrefix(p.s[p.pos:], "\r\n") {
+			p.pos += 2
+			p.line++
+		} else if strings.HasPrefix(p.s[p.pos:], "\n") {
+			p.pos++
+			p.line++
+		}
+	}
+	var b strings.Builder
+	for {
+		if p.pos == len(p.s) {
+			return "", fmt.Errorf("unterminated string")
+		}
+		if strings.HasPrefix(p.s[p.pos:], delim) {
+			p.pos += len(delim)
+			return b.String(), nil
+		}
+		c := p.s[p.pos]
+		switch {
+		case c == '\n' && !multi:
+			return "", fmt.Errorf("unterminated string")
+		case c == '\n':
+			p.line++
+		case c == '\\' && q == `"`:
+			r, err := p.escape(multi)
+			if err != nil {
+				return "", err
+			}
+			if r >= 0 {
+				b.WriteRune(r)
+			}
+			continue
+		}
+		b.WriteByte(c)
+		p.pos++
+	}
+}
+
+// escape parses the escape sequence at the current position. In multi-line
+// strings, a '\' at the end of a line trims the newline and the white space
+// that follows; -1 is returned for it.
+func (p *tomlParser) escape(multi bool) (rune, error) {
+	p.pos++
+	if p.pos == len(p.s) {
+		return 0, fmt.Errorf("unterminated string")
+	}
+	c := p.s[p.pos]
+	p.pos++
+	switch c {
+	case 'b':
+		return '\b', nil
+	case 't':
+		return '\t', nil
+	case 'n':
+		return '\n', nil
+	case 'f':
+		return '\f', nil
+	case 'r':
+		return '\r', nil
+	case '"', '\\':
+		return rune(c), nil
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.s) {
+			return 0, fmt.Errorf("invalid escape: \\%c", c)
+		}
+		r, err := strconv.ParseUint(p.s[p.pos:p.pos+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return 0, fmt.Errorf("invalid escape: \\%c%s", c, p.s[p.pos:p.pos+n])
+		}
+		p.pos += n
+		return rune(r), nil
+	}
+	if multi && (c == ' ' || c == '\t' || c == '\r' || c == '\n') {
+		p.pos--
+		for p.pos < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.pos]) >= 0 {
+			if p.s[p.pos] == '\n' {
+				p.line++
+			}
+			p.pos++
+		}
+		return -1, nil
+	}
+	return 0, fmt.Errorf("invalid escape: \\%c", c)
+}
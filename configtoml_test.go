@@ -0,0 +1,59 @@
+package transmogrifier
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		doc         string
+		expected    map[string]interface{}
+		expectedErr string
+	}{
+		{"", map[string]interface{}{}, ""},
+		{
+			"# comment\na = \"x\\ty\" # trailing\nb = 'C:\\dir'\nc = 0o644\nd = true\ne = [1, 2,\n  3,]\nf.g = -1_000\n",
+			map[string]interface{}{"a": "x\ty", "b": `C:\dir`, "c": int64(0644), "d": true, "e": []interface{}{int64(1), int64(2), int64(3)}, "f": map[string]interface{}{"g": int64(-1000)}},
+			"",
+		},
+		{
+			"[defaults]\nformat = \"md\"\n[defaults.dialect]\ncomma = \";\"\n\n[[jobs]]\nsource = \"a.csv\"\n[jobs.options]\nbackup = true\n\n[[jobs]]\nsource = \"b.csv\"\noptions = { mode = \"0644\", no_clobber = false }\n[jobs.dialect]\ncomment = \"#\"\n",
+			map[string]interface{}{
+				"defaults": map[string]interface{}{"format": "md", "dialect": map[string]interface{}{"comma": ";"}},
+				"jobs": []interface{}{
+					map[string]interface{}{"source": "a.csv", "options": map[string]interface{}{"backup": true}},
+					map[string]interface{}{"source": "b.csv", "options": map[string]interface{}{"mode": "0644", "no_clobber": false}, "dialect": map[string]interface{}{"comment": "#"}},
+				},
+			},
+			"",
+		},
+		{"s = \"\"\"\nline one \\\n   still one\nline two\"\"\"\nt = '''\nraw \\n'''\n", map[string]interface{}{"s": "line one still one\nline two", "t": "raw \\n"}, ""},
+		{"\"quoted.key\" = \"\\u00e9\"\n", map[string]interface{}{"quoted.key": "é"}, ""},
+		{"a = 1\na = 2\n", nil, "line 2: duplicate key a"},
+		{"[a]\n[a]\n", nil, "line 2: table a is defined more than once"},
+		{"a = 1\n[[a]]\n", nil, "line 2: a isn't an array of tables"},
+		{"a = 1.5\n", nil, "line 1: unsupported value: 1.5"},
+		{"a = 0644\n", nil, "line 1: integers can't have leading zeros: 0644"},
+		{"a = \"open\n", nil, "line 1: unterminated string"},
+		{"a = 1 b = 2\n", nil, "line 1: expected the end of the line, got \"b = 2\""},
+		{"a 1\n", nil, "line 1: expected '=' after a"},
+		{"a = \"\\q\"\n", nil, "line 1: invalid escape: \\q"},
+	}
+	for i, test := range tests {
+		m, err := parseTOML([]byte(test.doc))
+		if err != nil {
+			if err.Error() != test.expectedErr {
+				t.Errorf("%d: expected %q, got %q", i, test.expectedErr, err)
+			}
+			continue
+		}
+		if test.expectedErr != "" {
+			t.Errorf("%d: expected %q, got no error", i, test.expectedErr)
+			continue
+		}
+		if !reflect.DeepEqual(m, test.expected) {
+			t.Errorf("%d: expected %#v, got %#v", i, test.expected, m)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package transmogrifier
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a line of a YAML document, without its comment.
+type yamlLine struct {
+	n      int    // n is the line number, from 1.
+	indent int    // indent is the number of leading spaces.
+	text   string // text is the line without its indentation.
+}
+
+// yamlParser parses the subset of YAML that config files use: block
+// mappings and sequences, flow sequences and mappings, and plain, single
+// quoted, and double quoted scalars. Scalars are strings; '~' and 'null' are
+// nil. Block scalars, anchors, aliases, tags, and multiple documents aren't
+// supported.
+type yamlParser struct {
+	lines []yamlLine
+	i     int
+}
+
+// parseYAML parses the YAML document in b, which must be a mapping.
+func parseYAML(b []byte) (map[string]interface{}, error) {
+	p := &yamlParser{}
+	for i, s := range strings.Split(string(b), "\n") {
+		s = strings.TrimRight(stripYAMLComment(strings.TrimRight(s, "\r")), " \t")
+		text := strings.TrimLeft(s, " ")
+		if text == "" || (len(text) == len(s) && (text == "---" || text == "...")) {
+			continue
+		}
+		if text[0] == '\t' {
+			return nil, fmt.Errorf("line %d: tabs can't be used for indentation", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{n: i + 1, indent: len(s) - len(text), text: text})
+	}
+	if len(p.lines) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	v, err := p.block(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("line %d: expected a mapping", p.lines[0].n)
+	}
+	if p.i < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.i].n)
+	}
+	return m, nil
+}
+
+// stripYAMLComment returns s without its comment, if it has one. A comment
+// starts with a '#' that is at the start of s, or after white space, and
+// isn't quoted.
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			// quotes only start a scalar at the start of a value.
+			if i == 0 || strings.ContainsRune(" \t:-[{,", rune(s[i-1])) {
+				quote = c
+			}
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// isSeqItem returns whether the text is a block sequence item.
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// block parses the block mapping, or sequence, at the current line, which is
+// indented by indent.
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	if isSeqItem(p.lines[p.i].text) {
+		return p.seq(indent)
+	}
+	return p.mapping(indent)
+}
+
+// nested parses the value of a key, or sequence item, that is on the
+// following lines: a block that is indented by more than indent, or, for
+// mappings, a sequence with the same indentation. If there isn't one, the
+// value is nil.
+func (p *yamlParser) nested(indent int, seqOK bool) (interface{}, error) {
+	if p.i == len(p.lines) {
+		return nil, nil
+	}
+	next := p.lines[p.i]
+	if next.indent > indent || (seqOK && next.indent == indent && isSeqItem(next.text)) {
+		return p.block(next.indent)
+	}
+	return nil, nil
+}
+
+// seq parses a block sequence.
+func (p *yamlParser) seq(indent int) ([]interface{}, error) {
+	seq := []interface{}{}
+	for p.i < len(p.lines) {
+		l := p.lines[p.i]
+		// a sequence that is a value of a mapping can have the same
+		// indentation as its key.
+		if l.indent < indent || (l.indent == indent && !isSeqItem(l.text)) {
+			break
+		}
+		if l.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", l.n)
+		}
+		rest := strings.TrimLeft(l.text[1:], " ")
+		if rest == "" {
+			p.i++
+			v, err := p.nested(indent, false)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+			continue
+		}
+		if _, _, ok := splitYAMLKey(rest); ok || isSeqItem(rest) {
+			// the item is a block that starts on this line, indented
+			// by the column of its content.
+			p.lines[p.i] = yamlLine{n: l.n, indent: indent + len(l.text) - len(rest), text: rest}
+			v, err := p.block(p.lines[p.i].indent)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+			continue
+		}
+		v, err := parseYAMLValue(rest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", l.n, err)
+		}
+		seq = append(seq, v)
+		p.i++
+	}
+	return seq, nil
+}
+
+// mapping parses a block mapping.
+func (p *yamlParser) mapping(indent int) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	for p.i < len(p.lines) {
+		l := p.lines[p.i]
+		if l.indent < indent || (l.indent == indent && isSeqItem(l.text)) {
+			break
+		}
+		if l.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", l.n)
+		}
+		key, rest, ok := splitYAMLKey(l.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected 'key: value'", l.n)
+		}
+		if _, ok := m[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %q", l.n, key)
+		}
+		p.i++
+		var v interface{}
+		var err error
+		if rest == "" {
+			v, err = p.nested(indent, true)
+		} else {
+			v, err = parseYAMLValue(rest)
+			if err != nil {
+				err = fmt.Errorf("line %d: %s", l.n, err)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+// splitYAMLKey splits 'key: value' into its key and value; the value may be
+// empty. False is returned if text isn't a mapping entry.
+func splitYAMLKey(text string) (key, value string, ok bool) {
+	var i int
+	if text[0] == '"' || text[0] == '\'' {
+		end := quotedEnd(text)
+		if end < 0 {
+			return "", "", false
+		}
+		k, err := parseYAMLValue(text[:end])
+		if err != nil {
+			return "", "", false
+		}
+		key, _ = k.(string)
+		i = end
+		if i == len(text) || text[i] != ':' {
+			return "", "", false
+		}
+	} else {
+		i = strings.Index(text, ": ")
+		if i < 0 {
+			if !strings.HasSuffix(text, ":") {
+				return "", "", false
+			}
+			i = len(text) - 1
+		}
+		// a flow collection isn't a key.
+		if strings.ContainsAny(text[:1], "[{") {
+			return "", "", false
+		}
+		key = strings.TrimRight(text[:i], " ")
+	}
+	return key, strings.TrimSpace(text[i+1:]), true
+}
+
+// quotedEnd returns the offset just past the closing quote of the quoted
+// scalar that s starts with, or -1 if it isn't closed.
+func quotedEnd(s string) int {
+	q := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case q == '"' && s[i] == '\\':
+			i++
+		case q == '\'' && s[i] == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case s[i] == q:
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// parseYAMLValue parses a value that is on one line: a flow sequence or
+// mapping, or a scalar.
+func parseYAMLValue(s string) (interface{}, error) {
+	switch s[0] {
+	case '[', '{':
+		end := byte(']')
+		if s[0] == '{' {
+			end = '}'
+		}
+		if s[len(s)-1] != end {
+			return nil, fmt.Errorf("unterminated flow collection: %s", s)
+		}
+		items, err := splitFlow(s[1 : len(s)-1])
+		if err != nil {
+			return nil, err
+		}
+		if s[0] == '[' {
+			seq := []interface{}{}
+			for _, item := range items {
+				v, err := parseYAMLValue(item)
+				if err != nil {
+					return nil, err
+				}
+				seq = append(seq, v)
+			}
+			return seq, nil
+		}
+		m := map[string]interface{}{}
+		for _, item := range items {
+			key, value, ok := splitYAMLKey(item)
+			if !ok {
+				return nil, fmt.Errorf("expected 'key: value': %s", item)
+			}
+			var v interface{}
+			if value != "" {
+				v, err = parseYAMLValue(value)
+				if err != nil {
+					return nil, err
+				}
+			}
+			m[key] = v
+		}
+		return m, nil
+	case '"':
+		if quotedEnd(s) != len(s) {
+			return nil, fmt.Errorf("invalid quoted scalar: %s", s)
+		}
+		return unquoteYAML(s)
+	case '\'':
+		if quotedEnd(s) != len(s) {
+			return nil, fmt.Errorf("invalid quoted scalar: %s", s)
+		}
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	case '|', '>':
+		return nil, fmt.Errorf("block scalars aren't supported")
+	case '&', '*', '!':
+		return nil, fmt.Errorf("anchors, aliases, and tags aren't supported")
+	}
+	switch s {
+	case "~", "null", "Null", "NULL":
+		return nil, nil
+	}
+	return s, nil
+}
+
+// splitFlow splits the content of a flow collection into its items.
+func splitFlow(s string) ([]string, error) {
+	var items []string
+	var depth, start int
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			end := quotedEnd(s[i:])
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted scalar: %s", s[i:])
+			}
+			i += end - 1
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				items = append(items, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	last := strings.TrimSpace(s[start:])
+	if last != "" {
+		items = append(items, last)
+	}
+	for _, item := range items {
+		if item == "" {
+			return nil, fmt.Errorf("empty flow collection item")
+		}
+	}
+	return items, nil
+}
+
+// unquoteYAML returns the value of a double quoted scalar.
+func unquoteYAML(s string) (string, error) {
+	var b strings.Builder
+	s = s[1 : len(s)-1]
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			return "", fmt.Errorf("invalid escape")
+		}
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '0':
+			b.WriteByte(0)
+		case '"', '\\', '/', ' ':
+			b.WriteByte(s[i])
+		case 'u', 'U', 'x':
+			n := map[byte]int{'x': 2, 'u': 4, 'U': 8}[s[i]]
+			if i+1+n > len(s) {
+				return "", fmt.Errorf("invalid escape: \\%s", s[i:])
+			}
+			r, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("invalid escape: \\%s", s[i:i+1+n])
+			}
+			b.WriteRune(rune(r))
+			i += n
+		default:
+			return "", fmt.Errorf("invalid escape: \\%c", s[i])
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,58 @@
+package transmogrifier
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		doc         string
+		expected    map[string]interface{}
+		expectedErr string
+	}{
+		{"", map[string]interface{}{}, ""},
+		{"# comment\na: 1 # trailing\nb: 'x # y'\nc: \"q\\tr\"\nd:\ne: ~\n", map[string]interface{}{"a": "1", "b": "x # y", "c": "q\tr", "d": nil, "e": nil}, ""},
+		{
+			"---\ndefaults:\n  dialect:\n    comma: \";\"\njobs:\n  - source: a.csv\n    dest: a.md\n  -\n    source: b.csv\n  - source: c.csv\n    options: {backup: true, mode: '0644'}\n",
+			map[string]interface{}{
+				"defaults": map[string]interface{}{"dialect": map[string]interface{}{"comma": ";"}},
+				"jobs": []interface{}{
+					map[string]interface{}{"source": "a.csv", "dest": "a.md"},
+					map[string]interface{}{"source": "b.csv"},
+					map[string]interface{}{"source": "c.csv", "options": map[string]interface{}{"backup": "true", "mode": "0644"}},
+				},
+			},
+			"",
+		},
+		{"jobs:\n- source: a.csv\n- source: b.csv\nlist: [a, 'b, c', [d]]\n", map[string]interface{}{
+			"jobs": []interface{}{map[string]interface{}{"source": "a.csv"}, map[string]interface{}{"source": "b.csv"}},
+			"list": []interface{}{"a", "b, c", []interface{}{"d"}},
+		}, ""},
+		{"url: http://example.com/a.csv\n\"quoted key\": 'it''s'\n", map[string]interface{}{"url": "http://example.com/a.csv", "quoted key": "it's"}, ""},
+		{"a: 1\n  b: 2\n", nil, "line 2: unexpected indentation"},
+		{"a: 1\na: 2\n", nil, "line 2: duplicate key \"a\""},
+		{"a: |\n  text\n", nil, "line 1: block scalars aren't supported"},
+		{"a: *ref\n", nil, "line 1: anchors, aliases, and tags aren't supported"},
+		{"a\n", nil, "line 1: expected 'key: value'"},
+		{"- a\n", nil, "line 1: expected a mapping"},
+		{"a:\n\tb: 1\n", nil, "line 2: tabs can't be used for indentation"},
+		{"a: [b, c\n", nil, "line 1: unterminated flow collection: [b, c"},
+	}
+	for i, test := range tests {
+		m, err := parseYAML([]byte(test.doc))
+		if err != nil {
+			if err.Error() != test.expectedErr {
+				t.Errorf("%d: expected %q, got %q", i, test.expectedErr, err)
+			}
+			continue
+		}
+		if test.expectedErr != "" {
+			t.Errorf("%d: expected %q, got no error", i, test.expectedErr)
+			continue
+		}
+		if !reflect.DeepEqual(m, test.expected) {
+			t.Errorf("%d: expected %#v, got %#v", i, test.expected, m)
+		}
+	}
+}
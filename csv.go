@@ -68,11 +68,18 @@ func NewCSVSource(s string) *CSV {
 func (c *CSV) Read(r io.Reader) error {
 	var err error
 	cr := csv.NewReader(r)
+	if c.comma != 0 {
+		cr.Comma = c.comma
+	}
+	cr.Comment = c.comment
+	cr.FieldsPerRecord = c.fieldsPerRecord
+	cr.LazyQuotes = c.lazyQuotes
+	cr.TrimLeadingSpace = c.trimLeadingSpace
 	c.rows, err = cr.ReadAll()
 	if err != nil {
 		return err
 	}
-	if c.hasHeader {
+	if c.hasHeader && len(c.rows) > 0 {
 		c.headerRow = c.rows[0]
 		c.rows = c.rows[1:]
 	}
@@ -96,14 +103,33 @@ func (c *CSV) ReadFile(f string) error {
 	return c.Read(file)
 }
 
+// ReadSource reads the source, which can be a file or any URI supported by
+// NewResource.
 func (c *CSV) ReadSource() error {
-	return c.ReadFile(c.source.String())
+	r, err := c.source.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return c.Read(r)
 }
 
 // SetSource sets the source and has the formatFile updated, if applicable.
-// TODO: Currently assumes file, refactor to support other types when needed.
+// The source can be a file path or any URI supported by NewResource.
 func (c *CSV) SetSource(s string) {
-	c.source = NewResource(s, FmtCSV, File)
+	r := NewResource(s, FmtCSV, File)
+	r.copyConfig(c.source)
+	c.source = r
+}
+
+// SetHTTPConfig sets the configuration used when the source is a http(s) URL.
+func (c *CSV) SetHTTPConfig(cfg *HTTPConfig) {
+	c.source.http = cfg
+}
+
+// SetS3Config sets the configuration used when the source is an s3:// URI.
+func (c *CSV) SetS3Config(cfg *S3Config) {
+	c.source.s3 = cfg
 }
 
 // Source returns the source string
@@ -111,6 +137,56 @@ func (c *CSV) Source() string {
 	return c.source.String()
 }
 
+// SetComma sets the field delimiter. A zero value leaves the csv.Reader
+// default, ',', in place.
+func (c *CSV) SetComma(r rune) {
+	c.comma = r
+}
+
+// SetComment sets the comment character. Lines beginning with the comment
+// character are ignored.
+func (c *CSV) SetComment(r rune) {
+	c.comment = r
+}
+
+// SetFieldsPerRecord sets the number of expected fields per record. See
+// csv.Reader.FieldsPerRecord for how 0 and negative values are handled.
+func (c *CSV) SetFieldsPerRecord(i int) {
+	c.fieldsPerRecord = i
+}
+
+// SetLazyQuotes sets whether quotes may appear in unquoted fields and
+// non-doubled quotes may appear in quoted fields.
+func (c *CSV) SetLazyQuotes(b bool) {
+	c.lazyQuotes = b
+}
+
+// SetTrimLeadingSpace sets whether leading white space in a field is
+// ignored.
+func (c *CSV) SetTrimLeadingSpace(b bool) {
+	c.trimLeadingSpace = b
+}
+
+// CSVDialect is the dialect of CSV data. The fields are those of csv.Reader;
+// zero values leave the csv.Reader defaults in place.
+type CSVDialect struct {
+	Comma            rune
+	Comment          rune
+	FieldsPerRecord  int
+	LazyQuotes       bool
+	TrimLeadingSpace bool
+}
+
+// SetDialect sets the dialect of the csv data.
+func (c *CSV) SetDialect(d CSVDialect) {
+	c.comma = d.Comma
+	c.comment = d.Comment
+	c.fieldsPerRecord = d.FieldsPerRecord
+	c.lazyQuotes = d.LazyQuotes
+	c.trimLeadingSpace = d.TrimLeadingSpace
+}
+
+// SetHasHeader sets whether the csv data's first row is the header row.
 func (c *CSV) SetHasHeader(b bool) {
 	c.hasHeader = b
 }
@@ -129,3 +205,9 @@ func (c *CSV) HeaderRow() []string {
 func (c *CSV) Rows() [][]string {
 	return c.rows
 }
+
+// ColumnTypes returns the inferred type of each column. Empty values are
+// treated as nulls.
+func (c *CSV) ColumnTypes() []ColumnType {
+	return InferColumnTypes(c.rows)
+}
@@ -0,0 +1,32 @@
+package transmogrifier
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		a        string
+		b        string
+		expected string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{"", "a\nb\n", "--- from\n+++ to\n@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"a\nb\n", "", "--- from\n+++ to\n@@ -1,2 +0,0 @@\n-a\n-b\n"},
+		{"a\n", "b\n", "--- from\n+++ to\n@@ -1 +1 @@\n-a\n+b\n"},
+		{
+			"a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n",
+			"a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk",
+			"--- from\n+++ to\n@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n@@ -8,3 +8,4 @@\n h\n i\n j\n+k\n\\ No newline at end of file\n",
+		},
+		{
+			"a\nb\nc\nd\ne\nf\ng\nh\n",
+			"a\nB\nc\nd\ne\nf\ng\nH\n",
+			"--- from\n+++ to\n@@ -1,8 +1,8 @@\n a\n-b\n+B\n c\n d\n e\n f\n g\n-h\n+H\n",
+		},
+	}
+	for i, test := range tests {
+		diff := unifiedDiff("from", "to", []byte(test.a), []byte(test.b))
+		if diff != test.expected {
+			t.Errorf("%d: expected %q, got %q", i, test.expected, diff)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package transmogrifier
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+)
+
+// Encoder is implemented by the types that transmogrify table data into a
+// format, e.g. MDTable. Encoders are registered by FormatType using
+// RegisterEncoder.
+type Encoder interface {
+	SetColumnNames(cols []string)
+	SetColumnAlignment(cols []string)
+	TransmogrifyStringTable(t [][]string) error
+	Bytes() []byte
+}
+
+// RowEncoder is an Encoder that can encode its output a row at a time, so
+// that the rows don't have to be held in memory. EncodeHeader is called once,
+// after the column names and alignment have been set, and before any calls to
+// EncodeRow.
+type RowEncoder interface {
+	Encoder
+	EncodeHeader() error
+	EncodeRow(row []string) error
+}
+
+var (
+	encodersMu sync.RWMutex
+	encoders   = map[FormatType]func() Encoder{}
+)
+
+func init() {
+	RegisterEncoder(FmtCSV, func() Encoder { return newCSVEncoder() })
+	RegisterEncoder(FmtMDTable, func() Encoder { return NewMDTable() })
+	RegisterEncoder(FmtFixedWidth, func() Encoder { return NewFixedWidthTable() })
+	RegisterEncoder(FmtSQL, func() Encoder { return NewSQLTable() })
+}
+
+// RegisterEncoder registers fn as the func that returns a new Encoder for the
+// format. Registering a format that is already registered replaces it.
+func RegisterEncoder(f FormatType, fn func() Encoder) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	encoders[f] = fn
+}
+
+// NewEncoder returns a new Encoder for the format. An error is returned if no
+// Encoder has been registered for it.
+func NewEncoder(f FormatType) (Encoder, error) {
+	encodersMu.RLock()
+	fn, ok := encoders[f]
+	encodersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no encoder registered for format %q", f)
+	}
+	return fn(), nil
+}
+
+// csvEncoder is the Encoder for CSV output.
+type csvEncoder struct {
+	c   *CSV
+	buf bytes.Buffer
+}
+
+func newCSVEncoder() *csvEncoder {
+	return &csvEncoder{c: NewCSV()}
+}
+
+func (e *csvEncoder) SetColumnNames(cols []string) {
+	e.c.headerRow = make([]string, len(cols))
+	copy(e.c.headerRow, cols)
+}
+
+// SetColumnAlignment is a no-op; CSV doesn't have alignment.
+func (e *csvEncoder) SetColumnAlignment(cols []string) {}
+
+func (e *csvEncoder) TransmogrifyStringTable(t [][]string) error {
+	if t == nil {
+		return fmt.Errorf("unable to tranmogrify string table: received nil")
+	}
+	e.c.rows = t
+	return e.c.Write(&e.buf)
+}
+
+func (e *csvEncoder) Bytes() []byte {
+	return e.buf.Bytes()
+}
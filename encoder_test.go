@@ -0,0 +1,33 @@
+package transmogrifier
+
+import "testing"
+
+func TestNewEncoder(t *testing.T) {
+	tests := []struct {
+		format      FormatType
+		expectedErr string
+	}{
+		{FmtUnsupported, "no encoder registered for format \"unsupported\""},
+		{FmtCSV, ""},
+		{FmtMDTable, ""},
+		{FmtFixedWidth, ""},
+		{FmtSQL, ""},
+	}
+	for i, test := range tests {
+		_, err := NewEncoder(test.format)
+		if err != nil {
+			if err.Error() != test.expectedErr {
+				t.Errorf("%d: expected %q, got %q", i, test.expectedErr, err)
+			}
+			continue
+		}
+		if test.expectedErr != "" {
+			t.Errorf("%d: expected %q, got no error", i, test.expectedErr)
+		}
+	}
+	// encoders implementing RowEncoder
+	enc, _ := NewEncoder(FmtMDTable)
+	if _, ok := enc.(RowEncoder); !ok {
+		t.Error("expected the mdtable encoder to be a RowEncoder")
+	}
+}
@@ -0,0 +1,736 @@
+package transmogrifier
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Filter selects the rows of a table with an expression, e.g.:
+//
+//	status == "open" && priority <= 2
+//	name =~ "^T" || `Unit Price` > 9.99
+//	due < "2024-07-01" and not (owner in ("sam", "kim"))
+//
+// Columns are referenced by their name; names that aren't identifiers are
+// quoted with backticks, and '#3' is the third column. Strings are quoted
+// with double or single quotes.
+//
+//	== != < <= > >=    comparisons; '=' is '=='
+//	=~ !~              regular expression match, and non-match
+//	in, not in         membership of a list, e.g. ("a", "b") or [1, 2]
+//	&& || !            and, or, and not; also 'and', 'or', and 'not'
+//
+// Values are compared using the inferred type of their column: numbers
+// numerically, dates and datetimes chronologically, and everything else as
+// strings; a literal is converted to the column's type. Empty values are
+// only equal to "". A column on its own is true if it isn't empty, or, for
+// bool columns, if it's true.
+type Filter struct {
+	expr string
+	root filterNode
+	// columns are the column references of the expression.
+	columns []filterColumn
+}
+
+// FilterError is an error in a filter, or computed column, expression: a
+// syntax error, or a reference to a column that the table doesn't have.
+type FilterError struct {
+	Expr string
+	// Pos is the offset, in bytes, of the offending character.
+	Pos int
+	Msg string
+	// what is what the expression is; if it is empty, it is a filter.
+	what string
+}
+
+func (e *FilterError) Error() string {
+	what := e.what
+	if what == "" {
+		what = "filter"
+	}
+	col := utf8.RuneCountInString(e.Expr[:e.Pos])
+	return fmt.Sprintf("%s: %s at %d:\n\t%s\n\t%s^", what, e.Msg, col+1, e.Expr, strings.Repeat(" ", col))
+}
+
+// ParseFilter parses the filter expression.
+func ParseFilter(s string) (*Filter, error) {
+	p := &filterParser{filter: &Filter{expr: s}}
+	err := p.lex()
+	if err != nil {
+		return nil, err
+	}
+	p.filter.root, err = p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t.pos, "unexpected %q", t.text)
+	}
+	return p.filter, nil
+}
+
+// String returns the filter's expression.
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// Apply returns the rows that match the filter. The column types are
+// inferred from the rows.
+func (f *Filter) Apply(header []string, rows [][]string) ([][]string, error) {
+	ctx, err := f.context(header, rows)
+	if err != nil {
+		return nil, err
+	}
+	var out [][]string
+	for _, row := range rows {
+		ok, err := f.match(ctx, row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, row)
+		}
+	}
+	return out, nil
+}
+
+// context returns the context the filter is evaluated in for the rows of the
+// table; the column types are inferred from the rows.
+func (f *Filter) context(header []string, rows [][]string) (*filterContext, error) {
+	ctx := &filterContext{cols: make([]int, len(f.columns)), types: InferColumnTypes(rows)}
+	n := len(ctx.types)
+	if len(header) > n {
+		n = len(header)
+	}
+	for i, c := range f.columns {
+		var err error
+		ctx.cols[i], err = c.ref.resolve(header, n)
+		if err != nil {
+			return nil, &FilterError{Expr: f.expr, Pos: c.pos, Msg: err.Error()}
+		}
+	}
+	return ctx, nil
+}
+
+// match returns whether the row matches the filter, in the context of its
+// table.
+func (f *Filter) match(ctx *filterContext, row []string) (bool, error) {
+	ctx.row = row
+	return f.root.eval(ctx)
+}
+
+// Filter returns the rows that match the filter.
+func (c *CSV) Filter(f *Filter) ([][]string, error) {
+	return f.Apply(c.headerRow, c.rows)
+}
+
+// filterColumn is a column reference of an expression.
+type filterColumn struct {
+	ref columnRef
+	pos int
+}
+
+// filterContext is the context that a filter is evaluated in.
+type filterContext struct {
+	// cols are the columns of the filter's column references.
+	cols  []int
+	types []ColumnType
+	row   []string
+}
+
+// The kinds of filter tokens.
+const (
+	tokEOF = iota
+	tokIdent
+	tokColumn // a backtick quoted name, or a '#' position
+	tokString
+	tokNumber
+	tokRegex
+	tokOp
+)
+
+type filterToken struct {
+	kind int
+	text string // text is the token's value; strings are unquoted.
+	pos  int
+}
+
+// filterParser is a recursive descent parser of filter expressions, and,
+// with arith set, of computed column expressions.
+type filterParser struct {
+	filter *Filter
+	toks   []filterToken
+	i      int
+	// arith: '+', '-', '*', '/', and '%' are operators; there are no
+	// regular expressions, or negative numbers, which are negated.
+	arith bool
+}
+
+func (p *filterParser) errorf(pos int, format string, args ...interface{}) error {
+	e := &FilterError{Expr: p.filter.expr, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+	if p.arith {
+		e.what = "computed column"
+	}
+	return e
+}
+
+// filterOps are the operators, longest first; arithOps are the operators of
+// computed column expressions.
+var (
+	filterOps = []string{"==", "!=", "<=", ">=", "=~", "!~", "&&", "||", "<", ">", "=", "!", "(", ")", "[", "]", ","}
+	arithOps  = append(filterOps[:len(filterOps):len(filterOps)], "+", "-", "*", "/", "%")
+)
+
+// lex splits the expression into tokens.
+func (p *filterParser) lex() error {
+	s := p.filter.expr
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '"' || r == '\'' || r == '`':
+			text, end, err := unquoteFilter(s, i)
+			if err != nil {
+				return p.errorf(i, "%s", err)
+			}
+			kind := tokString
+			if r == '`' {
+				kind = tokColumn
+			}
+			p.toks = append(p.toks, filterToken{kind, text, i})
+			i = end
+		case r == '#':
+			j := i + 1
+			if j < len(s) && s[j] == '-' {
+				j++
+			}
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			p.toks = append(p.toks, filterToken{tokColumn, s[i:j], i})
+			i = j
+		case r >= '0' && r <= '9' || r == '.' || (r == '-' && !p.arith && i+1 < len(s) && (s[i+1] >= '0' && s[i+1] <= '9' || s[i+1] == '.')):
+			j := i + 1
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || strings.IndexByte(".eE", s[j]) >= 0 || (s[j] == '-' || s[j] == '+') && (s[j-1] == 'e' || s[j-1] == 'E')) {
+				j++
+			}
+			if _, err := strconv.ParseFloat(s[i:j], 64); err != nil {
+				return p.errorf(i, "invalid number %q", s[i:j])
+			}
+			p.toks = append(p.toks, filterToken{tokNumber, s[i:j], i})
+			i = j
+		case r == '/' && !p.arith:
+			j := strings.IndexByte(s[i+1:], '/')
+			for j >= 0 && s[i+j] == '\\' {
+				k := strings.IndexByte(s[i+j+2:], '/')
+				if k < 0 {
+					j = -1
+					break
+				}
+				j += k + 1
+			}
+			if j < 0 {
+				return p.errorf(i, "unterminated regular expression")
+			}
+			p.toks = append(p.toks, filterToken{tokRegex, s[i+1 : i+1+j], i})
+			i += j + 2
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(s) {
+				r, size := utf8.DecodeRuneInString(s[j:])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '.' {
+					break
+				}
+				j += size
+			}
+			p.toks = append(p.toks, filterToken{tokIdent, s[i:j], i})
+			i = j
+		default:
+			ops := filterOps
+			if p.arith {
+				ops = arithOps
+			}
+			var op string
+			for _, o := range ops {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return p.errorf(i, "unexpected %q", r)
+			}
+			p.toks = append(p.toks, filterToken{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	p.toks = append(p.toks, filterToken{tokEOF, "end of expression", len(s)})
+	return nil
+}
+
+// unquoteFilter returns the value of the quoted string, or column name, that
+// starts at s[i], and the offset after it. Backslash escapes the quote and
+// itself.
+func unquoteFilter(s string, i int) (string, int, error) {
+	q := s[i]
+	var b strings.Builder
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			if j+1 < len(s) && (s[j+1] == q || s[j+1] == '\\') {
+				j++
+			}
+		case q:
+			return b.String(), j + 1, nil
+		}
+		b.WriteByte(s[j])
+	}
+	if q == '`' {
+		return "", 0, fmt.Errorf("unterminated column name")
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.toks[p.i]
+}
+
+func (p *filterParser) next() filterToken {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// is returns whether the token is the operator, or keyword, s.
+func (t filterToken) is(s string) bool {
+	switch t.kind {
+	case tokOp:
+		return t.text == s
+	case tokIdent:
+		return strings.EqualFold(t.text, s)
+	}
+	return false
+}
+
+// or parses: and { ("||" | "or") and }
+func (p *filterParser) or() (filterNode, error) {
+	n, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is("||") || p.peek().is("or") {
+		p.next()
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		n = orNode{n, r}
+	}
+	return n, nil
+}
+
+// and parses: not { ("&&" | "and") not }
+func (p *filterParser) and() (filterNode, error) {
+	n, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is("&&") || p.peek().is("and") {
+		p.next()
+		r, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		n = andNode{n, r}
+	}
+	return n, nil
+}
+
+// not parses: ("!" | "not") not | "(" or ")" | comparison
+func (p *filterParser) not() (filterNode, error) {
+	t := p.peek()
+	if t.is("!") || t.is("not") {
+		p.next()
+		n, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	}
+	if t.is("(") {
+		p.next()
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); !t.is(")") {
+			return nil, p.errorf(t.pos, "expected ')', got %q", t.text)
+		}
+		return n, nil
+	}
+	return p.comparison()
+}
+
+// comparisonOps are the comparison operators.
+var comparisonOps = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "=": true}
+
+// comparison parses: operand [ op operand | ["not"] "in" list | ("=~" | "!~") regex ]
+func (p *filterParser) comparison() (filterNode, error) {
+	l, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	switch {
+	case t.kind == tokOp && comparisonOps[t.text]:
+		p.next()
+		op := t.text
+		if op == "=" {
+			op = "=="
+		}
+		r, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return cmpNode{op, l, r}, nil
+	case t.is("=~") || t.is("!~"):
+		p.next()
+		rt := p.next()
+		if rt.kind != tokString && rt.kind != tokRegex {
+			return nil, p.errorf(rt.pos, "expected a regular expression, got %q", rt.text)
+		}
+		re, err := regexp.Compile(rt.text)
+		if err != nil {
+			return nil, p.errorf(rt.pos, "invalid regular expression: %s", err)
+		}
+		return matchNode{l, re, t.text == "!~"}, nil
+	case t.is("in"), t.is("not") && p.toks[p.i+1].is("in"):
+		negate := t.is("not")
+		if negate {
+			p.next()
+		}
+		p.next()
+		list, err := p.list()
+		if err != nil {
+			return nil, err
+		}
+		return inNode{l, list, negate}, nil
+	}
+	return truthNode{l}, nil
+}
+
+// list parses: ("(" | "[") operand { "," operand } (")" | "]")
+func (p *filterParser) list() ([]filterOperand, error) {
+	t := p.next()
+	if !t.is("(") && !t.is("[") {
+		return nil, p.errorf(t.pos, "expected a list, got %q", t.text)
+	}
+	end := ")"
+	if t.is("[") {
+		end = "]"
+	}
+	var list []filterOperand
+	for {
+		o, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, o)
+		t := p.next()
+		if t.is(end) {
+			return list, nil
+		}
+		if !t.is(",") {
+			return nil, p.errorf(t.pos, "expected ',' or '%s', got %q", end, t.text)
+		}
+	}
+}
+
+// operand parses a column reference or a literal.
+func (p *filterParser) operand() (filterOperand, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return literalOperand(stringValue(t.text)), nil
+	case tokNumber:
+		v, _ := strconv.ParseFloat(t.text, 64)
+		return literalOperand(filterValue{kind: kindNumber, s: t.text, n: v}), nil
+	case tokColumn:
+		if !strings.HasPrefix(t.text, "#") {
+			return p.column(columnRef{name: t.text}, t.pos), nil
+		}
+		ref, err := parseColumnRef(t.text)
+		if err != nil {
+			return nil, p.errorf(t.pos, "%s", err)
+		}
+		return p.column(ref, t.pos), nil
+	case tokIdent:
+		switch strings.ToLower(t.text) {
+		case "true", "false":
+			return literalOperand(filterValue{kind: kindBool, s: t.text, b: strings.EqualFold(t.text, "true")}), nil
+		case "and", "or", "not", "in":
+			return nil, p.errorf(t.pos, "expected an operand, got %q", t.text)
+		}
+		return p.column(columnRef{name: t.text}, t.pos), nil
+	}
+	return nil, p.errorf(t.pos, "expected an operand, got %q", t.text)
+}
+
+// column adds the column reference to the filter.
+func (p *filterParser) column(ref columnRef, pos int) filterOperand {
+	p.filter.columns = append(p.filter.columns, filterColumn{ref, pos})
+	return columnOperand(len(p.filter.columns) - 1)
+}
+
+// The kinds of filter values.
+const (
+	kindNull = iota
+	kindString
+	kindNumber
+	kindTime
+	kindBool
+)
+
+// filterValue is a typed value. s is the value's text.
+type filterValue struct {
+	kind int
+	s    string
+	n    float64
+	t    time.Time
+	b    bool
+}
+
+func stringValue(s string) filterValue {
+	return filterValue{kind: kindString, s: s}
+}
+
+// typedValue returns the value of s for the column type.
+func typedValue(s string, typ ColumnType) filterValue {
+	if s == "" {
+		return filterValue{kind: kindNull}
+	}
+	v, ok := convertValue(stringValue(s), typ)
+	if !ok {
+		return stringValue(s)
+	}
+	return v
+}
+
+// convertValue converts the string value to the column type.
+func convertValue(v filterValue, typ ColumnType) (filterValue, bool) {
+	s := strings.TrimSpace(v.s)
+	switch typ {
+	case TypeInt, TypeFloat:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return v, false
+		}
+		return filterValue{kind: kindNumber, s: v.s, n: n}, true
+	case TypeDate, TypeDateTime:
+		t, ok := parseLayouts(s, dateLayouts)
+		if !ok {
+			t, ok = parseLayouts(s, dateTimeLayouts)
+		}
+		if !ok {
+			return v, false
+		}
+		return filterValue{kind: kindTime, s: v.s, t: t}, true
+	case TypeBool:
+		switch strings.ToLower(s) {
+		case "true":
+			return filterValue{kind: kindBool, s: v.s, b: true}, true
+		case "false":
+			return filterValue{kind: kindBool, s: v.s}, true
+		}
+		return v, false
+	}
+	return v, true
+}
+
+// kindType is the column type that values of the kind are converted to.
+var kindType = map[int]ColumnType{kindNumber: TypeFloat, kindTime: TypeDateTime, kindBool: TypeBool}
+
+// compareValues compares a and b: -1, 0, or 1. A string value is converted
+// to the other value's kind; if it can't be, both are compared as strings.
+func compareValues(a, b filterValue) int {
+	if a.kind != b.kind {
+		var ok bool
+		if a.kind == kindString {
+			a, ok = convertValue(a, kindType[b.kind])
+		} else if b.kind == kindString {
+			b, ok = convertValue(b, kindType[a.kind])
+		}
+		if !ok || a.kind != b.kind {
+			return strings.Compare(a.s, b.s)
+		}
+	}
+	switch a.kind {
+	case kindNumber:
+		switch {
+		case a.n < b.n:
+			return -1
+		case a.n > b.n:
+			return 1
+		}
+		return 0
+	case kindTime:
+		switch {
+		case a.t.Before(b.t):
+			return -1
+		case a.t.After(b.t):
+			return 1
+		}
+		return 0
+	case kindBool:
+		switch {
+		case a.b == b.b:
+			return 0
+		case b.b:
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a.s, b.s)
+}
+
+// equalValues returns whether a and b are equal. Empty values are only equal
+// to "".
+func equalValues(a, b filterValue) bool {
+	if a.kind == kindNull || b.kind == kindNull {
+		return a.s == b.s
+	}
+	return compareValues(a, b) == 0
+}
+
+// filterOperand is a column reference, or a literal.
+type filterOperand interface {
+	value(ctx *filterContext) filterValue
+}
+
+type columnOperand int
+
+func (c columnOperand) value(ctx *filterContext) filterValue {
+	i := ctx.cols[c]
+	if i >= len(ctx.row) {
+		return filterValue{kind: kindNull}
+	}
+	typ := TypeString
+	if i < len(ctx.types) {
+		typ = ctx.types[i]
+	}
+	return typedValue(ctx.row[i], typ)
+}
+
+type literalOperand filterValue
+
+func (l literalOperand) value(ctx *filterContext) filterValue {
+	return filterValue(l)
+}
+
+// filterNode is a node of a filter expression.
+type filterNode interface {
+	eval(ctx *filterContext) (bool, error)
+}
+
+type orNode struct{ l, r filterNode }
+
+func (n orNode) eval(ctx *filterContext) (bool, error) {
+	ok, err := n.l.eval(ctx)
+	if ok || err != nil {
+		return ok, err
+	}
+	return n.r.eval(ctx)
+}
+
+type andNode struct{ l, r filterNode }
+
+func (n andNode) eval(ctx *filterContext) (bool, error) {
+	ok, err := n.l.eval(ctx)
+	if !ok || err != nil {
+		return ok, err
+	}
+	return n.r.eval(ctx)
+}
+
+type notNode struct{ x filterNode }
+
+func (n notNode) eval(ctx *filterContext) (bool, error) {
+	ok, err := n.x.eval(ctx)
+	return !ok, err
+}
+
+type cmpNode struct {
+	op   string
+	l, r filterOperand
+}
+
+func (n cmpNode) eval(ctx *filterContext) (bool, error) {
+	l, r := n.l.value(ctx), n.r.value(ctx)
+	switch n.op {
+	case "==":
+		return equalValues(l, r), nil
+	case "!=":
+		return !equalValues(l, r), nil
+	}
+	// empty values aren't ordered.
+	if l.kind == kindNull || r.kind == kindNull {
+		return false, nil
+	}
+	c := compareValues(l, r)
+	switch n.op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	}
+	return c >= 0, nil
+}
+
+type matchNode struct {
+	x      filterOperand
+	re     *regexp.Regexp
+	negate bool
+}
+
+func (n matchNode) eval(ctx *filterContext) (bool, error) {
+	return n.re.MatchString(n.x.value(ctx).s) != n.negate, nil
+}
+
+type inNode struct {
+	x      filterOperand
+	list   []filterOperand
+	negate bool
+}
+
+func (n inNode) eval(ctx *filterContext) (bool, error) {
+	v := n.x.value(ctx)
+	for _, o := range n.list {
+		if equalValues(v, o.value(ctx)) {
+			return !n.negate, nil
+		}
+	}
+	return n.negate, nil
+}
+
+type truthNode struct{ x filterOperand }
+
+func (n truthNode) eval(ctx *filterContext) (bool, error) {
+	v := n.x.value(ctx)
+	switch v.kind {
+	case kindNull:
+		return false, nil
+	case kindBool:
+		return v.b, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,137 @@
+package transmogrifier
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilterApply(t *testing.T) {
+	header := []string{"id", "status", "priority", "due", "owner", "Unit Price", "done"}
+	rows := [][]string{
+		[]string{"007", "open", "1", "2024-06-30", "sam", "9.5", "false"},
+		[]string{"8", "closed", "2", "2024-07-15", "kim", "10", "true"},
+		[]string{"10", "open", "3", "", "Tom", "100", "false"},
+		[]string{"9", "blocked", "10", "2024-05-01", "", "", "true"},
+	}
+	tests := []struct {
+		expr        string
+		expected    []string
+		expectedErr string
+	}{
+		{`status == "open" && priority <= 2`, []string{"007"}, ""},
+		{`status = 'open' or status == "blocked"`, []string{"007", "10", "9"}, ""},
+		{`priority > 2`, []string{"10", "9"}, ""},
+		{`priority < "10"`, []string{"007", "8", "10"}, ""},
+		// "007" makes id a string column.
+		{`id > "8"`, []string{"9"}, ""},
+		{`id == 7`, []string{"007"}, ""},
+		{`due < "2024-07-01"`, []string{"007", "9"}, ""},
+		{`due >= "2024-07-01T00:00:00Z"`, []string{"8"}, ""},
+		{`due == ""`, []string{"10"}, ""},
+		{`due != ""`, []string{"007", "8", "9"}, ""},
+		{"`Unit Price` > 9.99", []string{"8", "10"}, ""},
+		{"#6 >= 10 && #-1", []string{"8"}, ""},
+		{`owner =~ "^[a-z]+$"`, []string{"007", "8"}, ""},
+		{`owner !~ /^[a-z]/`, []string{"10", "9"}, ""},
+		{`owner in ("sam", "kim")`, []string{"007", "8"}, ""},
+		{`priority not in [1, 2]`, []string{"10", "9"}, ""},
+		{`!(owner in ("sam", "kim")) && !done`, []string{"10"}, ""},
+		{`not owner`, []string{"9"}, ""},
+		{`done == true`, []string{"8", "9"}, ""},
+		{`status == "open" || status == "closed" && priority > 1`, []string{"007", "8", "10"}, ""},
+		{`(status == "open" || status == "closed") && priority > 1`, []string{"8", "10"}, ""},
+		{`status == "done"`, nil, ""},
+		{`state == "open"`, nil, "filter: unknown column \"state\" at 1:\n\tstate == \"open\"\n\t^"},
+		{`#8 > 1`, nil, "filter: column #8 is out of range: the table has 7 columns at 1:\n\t#8 > 1\n\t^"},
+	}
+	for i, test := range tests {
+		f, err := ParseFilter(test.expr)
+		if err != nil {
+			t.Errorf("%d: expected no error, got %q", i, err)
+			continue
+		}
+		r, err := f.Apply(header, rows)
+		if err != nil {
+			if err.Error() != test.expectedErr {
+				t.Errorf("%d: expected error %q, got %q", i, test.expectedErr, err)
+			}
+			continue
+		}
+		if test.expectedErr != "" {
+			t.Errorf("%d: expected error %q, got none", i, test.expectedErr)
+			continue
+		}
+		var ids []string
+		for _, row := range r {
+			ids = append(ids, row[0])
+		}
+		if !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("%d: %s: expected %q, got %q", i, test.expr, test.expected, ids)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	tests := []struct {
+		expr        string
+		expectedMsg string
+		expectedPos int
+	}{
+		{`status == "open`, "unterminated string", 10},
+		{"`status == 1", "unterminated column name", 0},
+		{`status = "open" & priority < 2`, `unexpected '&'`, 16},
+		{`status == `, `expected an operand, got "end of expression"`, 10},
+		{`(status == "open"`, `expected ')', got "end of expression"`, 17},
+		{`status == "open" priority`, `unexpected "priority"`, 17},
+		{`status in "open"`, `expected a list, got "open"`, 10},
+		{`status in ("open" "closed")`, `expected ',' or ')', got "closed"`, 18},
+		{`name =~ "(a"`, "invalid regular expression: error parsing regexp: missing closing ): `(a`", 8},
+		{`name =~ 1`, `expected a regular expression, got "1"`, 8},
+		{`name =~ /a`, "unterminated regular expression", 8},
+		{`price > 1.2.3`, `invalid number "1.2.3"`, 8},
+		{`#0 > 1`, `invalid column position: "#0"`, 0},
+		{`a && and`, `expected an operand, got "and"`, 5},
+		{`prix € 1`, `unexpected '€'`, 5},
+	}
+	for i, test := range tests {
+		_, err := ParseFilter(test.expr)
+		ferr, ok := err.(*FilterError)
+		if !ok {
+			t.Errorf("%d: expected a *FilterError, got %v", i, err)
+			continue
+		}
+		if ferr.Msg != test.expectedMsg {
+			t.Errorf("%d: expected %q, got %q", i, test.expectedMsg, ferr.Msg)
+		}
+		if ferr.Pos != test.expectedPos {
+			t.Errorf("%d: expected position %d, got %d", i, test.expectedPos, ferr.Pos)
+		}
+	}
+	_, err := ParseFilter(`prix € 1`)
+	expected := "filter: unexpected '€' at 6:\n\tprix € 1\n\t     ^"
+	if err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err)
+	}
+}
+
+func TestCSVFilter(t *testing.T) {
+	c := NewCSV()
+	c.SetHasHeader(true)
+	err := c.Read(strings.NewReader("status,priority\nopen,1\nclosed,2\nopen,3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ParseFilter(`status == "open" && priority >= 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := c.Filter(f)
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	expected := [][]string{{"open", "3"}}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("expected %q, got %q", expected, rows)
+	}
+}
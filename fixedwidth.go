@@ -0,0 +1,479 @@
+package transmogrifier
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// FixedWidth is a struct for representing and working with fixed-width text
+// data. Once read, the data is available in the same header/rows form that
+// CSV provides.
+type FixedWidth struct {
+	// source information.
+	source resource
+	// formatSource is the format file to get the column boundaries from. If
+	// it isn't set, and no boundaries have been set, the boundaries are
+	// inferred from the whitespace gutters in the data.
+	formatSource string
+	// hasHeader: whether the data includes a header row as its first row.
+	hasHeader bool
+	// columnStarts is the starting position, in runes, of each column.
+	columnStarts []int
+	// columnWidths is the width, in runes, of each column. A width of 0
+	// means the column extends to the start of the next column or, for the
+	// last column, the end of the line.
+	columnWidths []int
+	// headerRow contains the header row information.
+	headerRow []string
+	// rows is the parsed fixed-width data
+	rows [][]string
+}
+
+// NewFixedWidth returns an initialized FixedWidth object. It still needs to
+// be configured for use.
+func NewFixedWidth() *FixedWidth {
+	return &FixedWidth{
+		source:    resource{},
+		hasHeader: true,
+		headerRow: []string{},
+		rows:      [][]string{},
+	}
+}
+
+// NewFixedWidthSource creates a new *FixedWidth with its source set.
+func NewFixedWidthSource(s string) *FixedWidth {
+	f := NewFixedWidth()
+	f.SetSource(s)
+	return f
+}
+
+// SetSource sets the source.
+func (f *FixedWidth) SetSource(s string) {
+	f.source = NewResource(s, FmtFixedWidth, File)
+}
+
+// Source returns the source string
+func (f *FixedWidth) Source() string {
+	return f.source.String()
+}
+
+// SetFormatSource sets the format file that the column boundaries are read
+// from. The start and width of each column are set in the format file using
+// the 'start' and 'width' directives, e.g.:
+//
+//	start,0,10,16,56
+//	width,10,6,40,8
+//
+// Only one of the two directives is required: starts are derived from the
+// widths and widths from the starts.
+func (f *FixedWidth) SetFormatSource(s string) error {
+	if s == "" {
+		return fmt.Errorf("unable to set format source: received empty string")
+	}
+	f.formatSource = s
+	return nil
+}
+
+// SetColumnStarts sets the starting position of each column.
+func (f *FixedWidth) SetColumnStarts(starts []int) {
+	f.columnStarts = make([]int, len(starts))
+	copy(f.columnStarts, starts)
+}
+
+// SetColumnWidths sets the width of each column.
+func (f *FixedWidth) SetColumnWidths(widths []int) {
+	f.columnWidths = make([]int, len(widths))
+	copy(f.columnWidths, widths)
+}
+
+// ColumnStarts returns the starting position of each column.
+func (f *FixedWidth) ColumnStarts() []int {
+	return f.columnStarts
+}
+
+// ColumnWidths returns the width of each column.
+func (f *FixedWidth) ColumnWidths() []int {
+	return f.columnWidths
+}
+
+func (f *FixedWidth) SetHasHeader(b bool) {
+	f.hasHeader = b
+}
+
+// HasHeader returns the hasHeader bool
+func (f *FixedWidth) HasHeader() bool {
+	return f.hasHeader
+}
+
+// HeaderRow returns the header row, if it exists.
+func (f *FixedWidth) HeaderRow() []string {
+	return f.headerRow
+}
+
+// Rows returns the rows.
+func (f *FixedWidth) Rows() [][]string {
+	return f.rows
+}
+
+// Read takes a reader and reads the data connected with it as fixed-width
+// data. The column boundaries come from, in order of precedence, the set
+// starts and widths, the format file, or the whitespace gutters in the data.
+// Blank lines are skipped. If there is a header row, the headerRow field is
+// populated with the first row of the source.
+func (f *FixedWidth) Read(r io.Reader) error {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(f.columnStarts) == 0 && len(f.columnWidths) == 0 {
+		err := f.boundariesFromFormat()
+		if err != nil {
+			return err
+		}
+	}
+	if len(f.columnStarts) == 0 && len(f.columnWidths) == 0 {
+		f.columnStarts, f.columnWidths = inferColumnBoundaries(lines)
+	}
+	starts, widths, err := resolveColumnBoundaries(f.columnStarts, f.columnWidths)
+	if err != nil {
+		return err
+	}
+	f.rows = make([][]string, 0, len(lines))
+	for _, line := range lines {
+		f.rows = append(f.rows, splitFixedWidth(line, starts, widths))
+	}
+	if f.hasHeader && len(f.rows) > 0 {
+		f.headerRow = f.rows[0]
+		f.rows = f.rows[1:]
+	}
+	return nil
+}
+
+// ReadFile takes a path, reads the contents of the file and returns any error
+// encountered. The entire file will be read at once.
+func (f *FixedWidth) ReadFile(s string) error {
+	if s == "" {
+		return ErrNoSource
+	}
+	file, err := os.Open(s)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return f.Read(file)
+}
+
+// ReadSource reads the source, which can be a file or any URI supported by
+// NewResource.
+func (f *FixedWidth) ReadSource() error {
+	r, err := f.source.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return f.Read(r)
+}
+
+// boundariesFromFormat sets the column boundaries from the format file, if
+// one was set.
+func (f *FixedWidth) boundariesFromFormat() error {
+	if f.formatSource == "" {
+		return nil
+	}
+	fm, err := readFormatFile(f.formatSource)
+	if err != nil {
+		return err
+	}
+	return f.boundariesFrom(fm, f.formatSource)
+}
+
+// boundariesFrom sets the column boundaries from the start and width
+// directives of the format; name is the format's source, for errors.
+func (f *FixedWidth) boundariesFrom(fm *format, name string) error {
+	var err error
+	f.columnStarts, err = fm.directiveInts("start")
+	if err != nil {
+		return err
+	}
+	f.columnWidths, err = fm.directiveInts("width")
+	if err != nil {
+		return err
+	}
+	if len(f.columnStarts) == 0 && len(f.columnWidths) == 0 {
+		return fmt.Errorf("format %q: neither a start nor a width directive was found", name)
+	}
+	return nil
+}
+
+// resolveColumnBoundaries fills in whichever of starts and widths is
+// missing. When both are set, they must have the same number of columns.
+func resolveColumnBoundaries(starts, widths []int) ([]int, []int, error) {
+	for i, start := range starts {
+		if start < 0 {
+			return nil, nil, fmt.Errorf("column %d: start %d is negative", i, start)
+		}
+	}
+	for i, width := range widths {
+		if width < 0 {
+			return nil, nil, fmt.Errorf("column %d: width %d is negative", i, width)
+		}
+	}
+	switch {
+	case len(starts) == 0:
+		starts = make([]int, len(widths))
+		for i := 1; i < len(widths); i++ {
+			if widths[i-1] <= 0 {
+				return nil, nil, fmt.Errorf("column %d: width must be > 0 when starts aren't set", i-1)
+			}
+			starts[i] = starts[i-1] + widths[i-1]
+		}
+		return starts, widths, nil
+	case len(widths) == 0:
+		widths = make([]int, len(starts))
+	case len(starts) != len(widths):
+		return nil, nil, fmt.Errorf("column boundary mismatch: %d starts, %d widths", len(starts), len(widths))
+	}
+	resolved := make([]int, len(widths))
+	copy(resolved, widths)
+	for i := range starts {
+		if i > 0 && starts[i] < starts[i-1] {
+			return nil, nil, fmt.Errorf("column %d: start %d is before the previous column's start", i, starts[i])
+		}
+		if resolved[i] == 0 && i < len(starts)-1 {
+			resolved[i] = starts[i+1] - starts[i]
+		}
+	}
+	return starts, resolved, nil
+}
+
+// splitFixedWidth splits the line into its columns. Each column is trimmed of
+// surrounding spaces. A width of 0 extends to the end of the line.
+func splitFixedWidth(line string, starts, widths []int) []string {
+	runes := []rune(line)
+	cols := make([]string, len(starts))
+	for i, start := range starts {
+		if start >= len(runes) {
+			continue
+		}
+		end := len(runes)
+		if widths[i] > 0 && start+widths[i] < end {
+			end = start + widths[i]
+		}
+		cols[i] = strings.TrimSpace(string(runes[start:end]))
+	}
+	return cols
+}
+
+// inferColumnBoundaries finds the columns of the lines using the whitespace
+// gutters between them: a position that is a space, or past the end, in
+// every line is a gutter. Each column starts at the end of a gutter and
+// extends to the start of the next column; the last column has a width of 0.
+func inferColumnBoundaries(lines []string) (starts, widths []int) {
+	var max int
+	for _, line := range lines {
+		if n := utf8.RuneCountInString(line); n > max {
+			max = n
+		}
+	}
+	used := make([]bool, max)
+	for _, line := range lines {
+		var i int
+		for _, r := range line {
+			if r != ' ' && r != '\t' {
+				used[i] = true
+			}
+			i++
+		}
+	}
+	for i := range used {
+		if used[i] && (i == 0 || !used[i-1]) {
+			starts = append(starts, i)
+		}
+	}
+	widths = make([]int, len(starts))
+	for i := 0; i < len(starts)-1; i++ {
+		widths[i] = starts[i+1] - starts[i]
+	}
+	// the first column always starts at the beginning of the line.
+	if len(starts) > 0 {
+		widths[0] += starts[0]
+		starts[0] = 0
+	}
+	return starts, widths
+}
+
+// FixedWidthTable is a struct for representing and working with fixed-width
+// text output.
+type FixedWidthTable struct {
+	// sink information
+	dest resource
+	// hasColumnNames: whether the first row of the table is the column names.
+	hasColumnNames bool
+	// columnNames contains the name of each column.
+	columnNames []string
+	// columnWidths contains the width of each column. Columns without a
+	// width, or with a width of 0, are as wide as their widest value.
+	columnWidths []int
+	// columnAlignment contains the alignment information, if any, for each
+	// column. This determines which side a value is padded on: left aligned
+	// values are padded on the right, right aligned values on the left, and
+	// centered values on both sides. The default is left.
+	columnAlignment []string
+	// separator is written between columns.
+	separator string
+	// fw is the fixed-width output, in bytes
+	fw []byte
+}
+
+// NewFixedWidthTable returns an empty FixedWidthTable struct. Columns are
+// separated by a single space.
+func NewFixedWidthTable() *FixedWidthTable {
+	return &FixedWidthTable{columnNames: []string{}, columnWidths: []int{}, columnAlignment: []string{}, separator: " ", fw: []byte{}}
+}
+
+func (f FixedWidthTable) String() string {
+	return string(f.fw)
+}
+
+func (f FixedWidthTable) Bytes() []byte {
+	return f.fw
+}
+
+// SetHasColumnNames
+func (f *FixedWidthTable) SetHasColumnNames(b bool) {
+	f.hasColumnNames = b
+}
+
+// SetColumnNames
+func (f *FixedWidthTable) SetColumnNames(cols []string) {
+	f.columnNames = make([]string, len(cols))
+	copy(f.columnNames, cols)
+}
+
+func (f *FixedWidthTable) SetColumnWidths(widths []int) {
+	f.columnWidths = make([]int, len(widths))
+	copy(f.columnWidths, widths)
+}
+
+func (f *FixedWidthTable) SetColumnAlignment(cols []string) {
+	f.columnAlignment = make([]string, len(cols))
+	copy(f.columnAlignment, cols)
+}
+
+// SetSeparator sets the string written between columns.
+func (f *FixedWidthTable) SetSeparator(s string) {
+	f.separator = s
+}
+
+// TransmogrifyStringTable transmogrifies the table into fixed-width text.
+// The result is held in fw and can be obtained by f.String() or f.Bytes().
+// Values that are wider than their column are truncated.
+func (f *FixedWidthTable) TransmogrifyStringTable(t [][]string) error {
+	if t == nil {
+		return fmt.Errorf("unable to tranmogrify string table: received nil")
+	}
+	if f.hasColumnNames && len(t) > 0 {
+		f.SetColumnNames(t[0])
+		t = t[1:]
+	}
+	widths := f.widths(t)
+	if len(f.columnNames) > 0 {
+		f.appendRow(f.columnNames, widths)
+	}
+	for _, row := range t {
+		f.appendRow(row, widths)
+	}
+	return nil
+}
+
+// widths returns the width of every column; unset widths are calculated from
+// the widest value in the column.
+func (f *FixedWidthTable) widths(t [][]string) []int {
+	n := len(f.columnNames)
+	for _, row := range t {
+		if len(row) > n {
+			n = len(row)
+		}
+	}
+	widths := make([]int, n)
+	copy(widths, f.columnWidths)
+	for i := range widths {
+		if widths[i] > 0 {
+			continue
+		}
+		if i < len(f.columnNames) {
+			widths[i] = utf8.RuneCountInString(f.columnNames[i])
+		}
+		for _, row := range t {
+			if i < len(row) && utf8.RuneCountInString(row[i]) > widths[i] {
+				widths[i] = utf8.RuneCountInString(row[i])
+			}
+		}
+	}
+	return widths
+}
+
+// appendRow appends the row, padded to the column widths, to fw.
+func (f *FixedWidthTable) appendRow(row []string, widths []int) {
+	for i, w := range widths {
+		if i > 0 {
+			f.fw = append(f.fw, f.separator...)
+		}
+		var col, align string
+		if i < len(row) {
+			col = row[i]
+		}
+		if i < len(f.columnAlignment) {
+			align = f.columnAlignment[i]
+		}
+		f.fw = append(f.fw, padFixedWidth(col, w, align)...)
+	}
+	f.fw = append(f.fw, '\n')
+}
+
+// padFixedWidth pads, or truncates, s to w runes. The alignment determines
+// which side the padding goes on.
+func padFixedWidth(s string, w int, align string) string {
+	runes := []rune(s)
+	if len(runes) >= w {
+		return string(runes[:w])
+	}
+	pad := w - len(runes)
+	switch align {
+	case "right", "r":
+		return strings.Repeat(" ", pad) + s
+	case "center", "centered", "c":
+		return strings.Repeat(" ", pad/2) + s + strings.Repeat(" ", pad-pad/2)
+	}
+	return s + strings.Repeat(" ", pad)
+}
+
+// SetDest sets the destination of the Write operation.
+func (f *FixedWidthTable) SetDest(s string) {
+	dest := f.dest
+	f.dest = NewResource(s, FmtFixedWidth, File)
+	f.dest.copyConfig(dest)
+}
+
+// SetWriteOptions sets how the dest is written, when it is a local file.
+func (f *FixedWidthTable) SetWriteOptions(opts *WriteOptions) {
+	f.dest.write = opts
+}
+
+// WriteToFile saves the fixed-width output to the destination.
+func (f *FixedWidthTable) WriteToFile() (name string, n int, err error) {
+	n, err = writeResource(f.dest, f.fw)
+	return f.dest.String(), n, err
+}
@@ -0,0 +1,130 @@
+package transmogrifier
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFixedWidthReadFile(t *testing.T) {
+	expectedHeader := []string{"Item", "Id", "Description", "Price"}
+	expectedRows := [][]string{
+		[]string{"string", "00042", "a string of indeterminate length", "$9.99"},
+		[]string{"towel", "10042", "an intergalactic traveller's essential", "$42.00"},
+	}
+	tests := []struct {
+		name         string
+		formatSource string
+		starts       []int
+		widths       []int
+		expectedErr  string
+	}{
+		{"inferred", "", nil, nil, ""},
+		{"format file", "test_files/test-fwf.fmt", nil, nil, ""},
+		{"widths", "", nil, []int{8, 7, 39, 6}, ""},
+		{"starts", "", []int{0, 8, 15, 54}, nil, ""},
+		{"starts and widths", "", []int{0, 8, 15, 54}, []int{6, 5, 38, 6}, ""},
+		{"mismatch", "", []int{0, 8, 15}, []int{6, 5, 38, 6}, "column boundary mismatch: 3 starts, 4 widths"},
+		{"negative start", "", []int{0, -8, 15, 54}, nil, "column 1: start -8 is negative"},
+		{"negative width", "", nil, []int{8, -7, 39, 6}, "column 1: width -7 is negative"},
+		{"negative format start", "test_files/test-fwf-negative.fmt", nil, nil, "format directive \"start\": column 0: -1 is negative"},
+		{"no directives", "test_files/test.fmt", nil, nil, "format \"test_files/test.fmt\": neither a start nor a width directive was found"},
+	}
+	for _, test := range tests {
+		f := NewFixedWidthSource("test_files/test.fwf")
+		if test.formatSource != "" {
+			f.SetFormatSource(test.formatSource)
+		}
+		if test.starts != nil {
+			f.SetColumnStarts(test.starts)
+		}
+		if test.widths != nil {
+			f.SetColumnWidths(test.widths)
+		}
+		err := f.ReadSource()
+		if err != nil {
+			if err.Error() != test.expectedErr {
+				t.Errorf("%s: expected %q, got %q", test.name, test.expectedErr, err)
+			}
+			continue
+		}
+		if test.expectedErr != "" {
+			t.Errorf("%s: expected %q, got no error", test.name, test.expectedErr)
+			continue
+		}
+		if strings.Join(f.HeaderRow(), "|") != strings.Join(expectedHeader, "|") {
+			t.Errorf("%s: expected header %q, got %q", test.name, expectedHeader, f.HeaderRow())
+		}
+		if len(f.Rows()) != len(expectedRows) {
+			t.Errorf("%s: expected %d rows, got %d", test.name, len(expectedRows), len(f.Rows()))
+			continue
+		}
+		for i, row := range f.Rows() {
+			if strings.Join(row, "|") != strings.Join(expectedRows[i], "|") {
+				t.Errorf("%s: row %d: expected %q, got %q", test.name, i, expectedRows[i], row)
+			}
+		}
+	}
+}
+
+func TestInferColumnBoundaries(t *testing.T) {
+	tests := []struct {
+		lines          []string
+		expectedStarts []int
+		expectedWidths []int
+	}{
+		{[]string{}, nil, []int{}},
+		{[]string{"abc"}, []int{0}, []int{0}},
+		{[]string{"a  b  c", "aa bb cc"}, []int{0, 3, 6}, []int{3, 3, 0}},
+		{[]string{"  1 x", " 10 y", "100 z"}, []int{0, 4}, []int{4, 0}},
+	}
+	for i, test := range tests {
+		starts, widths := inferColumnBoundaries(test.lines)
+		if len(starts) != len(test.expectedStarts) {
+			t.Errorf("%d: expected starts %v, got %v", i, test.expectedStarts, starts)
+			continue
+		}
+		for j := range starts {
+			if starts[j] != test.expectedStarts[j] || widths[j] != test.expectedWidths[j] {
+				t.Errorf("%d: expected %v %v, got %v %v", i, test.expectedStarts, test.expectedWidths, starts, widths)
+				break
+			}
+		}
+	}
+}
+
+func TestFixedWidthTableTransmogrifyStringTable(t *testing.T) {
+	rows := [][]string{
+		[]string{"Item", "Id", "Price"},
+		[]string{"string", "00042", "$9.99"},
+		[]string{"towel", "10042", "$42.00"},
+	}
+	tests := []struct {
+		widths    []int
+		alignment []string
+		separator string
+		expected  string
+	}{
+		{nil, nil, " ", "Item   Id    Price \nstring 00042 $9.99 \ntowel  10042 $42.00\n"},
+		{nil, []string{"", "c", "r"}, "|", "Item  | Id  | Price\nstring|00042| $9.99\ntowel |10042|$42.00\n"},
+		{[]int{4, 0, 8}, []string{"l", "r", "right"}, "", "Item   Id   Price\nstri00042   $9.99\ntowe10042  $42.00\n"},
+	}
+	for i, test := range tests {
+		f := NewFixedWidthTable()
+		f.SetHasColumnNames(true)
+		f.SetSeparator(test.separator)
+		if test.widths != nil {
+			f.SetColumnWidths(test.widths)
+		}
+		if test.alignment != nil {
+			f.SetColumnAlignment(test.alignment)
+		}
+		err := f.TransmogrifyStringTable(rows)
+		if err != nil {
+			t.Errorf("%d: expected no error, got %q", i, err)
+			continue
+		}
+		if f.String() != test.expected {
+			t.Errorf("%d: expected %q, got %q", i, test.expected, f.String())
+		}
+	}
+}
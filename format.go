@@ -0,0 +1,338 @@
+package transmogrifier
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// format is the information read from a format file. The first three rows of
+// a format file are positional: the column names, the column alignment, and
+// the column emphasis. Any rows after those are directives; the first field
+// of a directive row is the directive's name and the remaining fields are its
+// values, e.g.:
+//
+//	width,10,6,40,8
+type format struct {
+	columnNames     []string
+	columnAlignment []string
+	columnEmphasis  []string
+	// directives holds the directive rows, by lowercased name, in the order
+	// they appear in the format file.
+	directives map[string][][]string
+}
+
+// readFormatFile reads the format file f, which can be a file path or any URI
+// supported by NewResource.
+func readFormatFile(f string) (*format, error) {
+	fsource := newFormatCSV()
+	fsource.SetSource(f)
+	err := fsource.ReadSource()
+	if err != nil {
+		return nil, err
+	}
+	return parseFormat(fsource.rows)
+}
+
+// readFormat reads the format information from r.
+func readFormat(r io.Reader) (*format, error) {
+	fsource := newFormatCSV()
+	err := fsource.Read(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseFormat(fsource.rows)
+}
+
+// newFormatCSV returns a CSV configured for reading format files.
+func newFormatCSV() *CSV {
+	fsource := NewCSV()
+	fsource.SetHasHeader(false)
+	// directive rows don't have to have the same number of fields as the
+	// column rows.
+	fsource.SetFieldsPerRecord(-1)
+	return fsource
+}
+
+// parseFormat returns the format for the rows of a format file.
+func parseFormat(rows [][]string) (*format, error) {
+	if len(rows) < 3 {
+		return nil, fmt.Errorf("insufficient format rows: expected at least 3, got %d", len(rows))
+	}
+	fm := &format{
+		columnNames:     rows[0],
+		columnAlignment: rows[1],
+		columnEmphasis:  rows[2],
+		directives:      map[string][][]string{},
+	}
+	for _, row := range rows[3:] {
+		name := strings.ToLower(strings.TrimSpace(row[0]))
+		if name == "" {
+			continue
+		}
+		fm.directives[name] = append(fm.directives[name], row[1:])
+	}
+	// the column boundaries of fixed-width data can't be negative.
+	for _, n := range []string{"start", "width"} {
+		if _, err := fm.directiveInts(n); err != nil {
+			return nil, err
+		}
+	}
+	return fm, nil
+}
+
+// directive returns the values of the first directive named n. False is
+// returned if the format doesn't have that directive.
+func (f *format) directive(n string) ([]string, bool) {
+	d, ok := f.directives[n]
+	if !ok {
+		return nil, false
+	}
+	return d[0], true
+}
+
+// directiveInts returns the values of the first directive named n as ints.
+// Empty values are returned as 0; negative values are an error.
+func (f *format) directiveInts(n string) ([]int, error) {
+	vals, ok := f.directive(n)
+	if !ok {
+		return nil, nil
+	}
+	ints := make([]int, len(vals))
+	for i, v := range vals {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		j, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("format directive %q: column %d: %q is not an int", n, i, v)
+		}
+		if j < 0 {
+			return nil, fmt.Errorf("format directive %q: column %d: %d is negative", n, i, j)
+		}
+		ints[i] = j
+	}
+	return ints, nil
+}
+
+// projection returns the projection of the 'columns' directive, e.g.
+// 'columns,Item,Price as Cost,!Notes'. Nil is returned if the format doesn't
+// have one.
+func (f *format) projection() (*Projection, error) {
+	vals, ok := f.directive("columns")
+	if !ok {
+		return nil, nil
+	}
+	p, err := parseProjectionItems(vals)
+	if err != nil {
+		return nil, fmt.Errorf("format directive %q: %s", "columns", err)
+	}
+	return p, nil
+}
+
+// filter returns the filter of the 'filter' directive, e.g.
+// 'filter,status == "open"'. The directive's values are joined with commas,
+// so lists don't have to be quoted, e.g. 'filter,priority in (1,2)'. Nil is
+// returned if the format doesn't have one.
+func (f *format) filter() (*Filter, error) {
+	vals, ok := f.directive("filter")
+	if !ok {
+		return nil, nil
+	}
+	flt, err := ParseFilter(strings.Join(vals, ","))
+	if err != nil {
+		return nil, fmt.Errorf("format directive %q: %s", "filter", err)
+	}
+	return flt, nil
+}
+
+// sort returns the sort of the 'sort' directive, e.g.
+// 'sort,priority desc,due nulls first'. Nil is returned if the format
+// doesn't have one.
+func (f *format) sort() (*Sort, error) {
+	vals, ok := f.directive("sort")
+	if !ok {
+		return nil, nil
+	}
+	srt, err := parseSortKeys(vals)
+	if err != nil {
+		return nil, fmt.Errorf("format directive %q: %s", "sort", err)
+	}
+	return srt, nil
+}
+
+// grouping returns the grouping of the 'group' and 'aggregate' directives,
+// e.g. 'group,region' and 'aggregate,sum(amount) as Total,count(*)'. Without
+// a 'group' directive, every row is aggregated into one. Nil is returned if
+// the format has neither.
+func (f *format) grouping() (*Grouping, error) {
+	by, hasBy := f.directive("group")
+	aggs, hasAggs := f.directive("aggregate")
+	if !hasBy && !hasAggs {
+		return nil, nil
+	}
+	g := &Grouping{}
+	var err error
+	g.By, err = parseColumnItems(by)
+	if err != nil {
+		return nil, fmt.Errorf("format directive %q: %s", "group", err)
+	}
+	g.Aggregates, err = parseAggregateItems(aggs)
+	if err != nil {
+		return nil, fmt.Errorf("format directive %q: %s", "aggregate", err)
+	}
+	return g, nil
+}
+
+// totals returns the totals of the 'totals' directive, e.g.
+// 'totals,sum(amount),count(*)', with the subtotal columns of the
+// 'subtotals' directive, the footer and subtotal labels of the
+// 'totals_label' directive, and the emphasis of the 'totals_emphasis'
+// directive. Nil is returned if the format doesn't have a 'totals'
+// directive.
+func (f *format) totals() (*Totals, error) {
+	aggs, ok := f.directive("totals")
+	if !ok {
+		return nil, nil
+	}
+	t := &Totals{}
+	var err error
+	t.Aggregates, err = parseAggregateItems(aggs)
+	if err != nil {
+		return nil, fmt.Errorf("format directive %q: %s", "totals", err)
+	}
+	by, _ := f.directive("subtotals")
+	t.SubtotalBy, err = parseColumnItems(by)
+	if err != nil {
+		return nil, fmt.Errorf("format directive %q: %s", "subtotals", err)
+	}
+	labels, _ := f.directive("totals_label")
+	if len(labels) > 0 {
+		t.Label = strings.TrimSpace(labels[0])
+	}
+	if len(labels) > 1 {
+		t.SubtotalLabel = strings.TrimSpace(labels[1])
+	}
+	if e, ok := f.directive("totals_emphasis"); ok {
+		t.Emphasis = e
+	}
+	return t, nil
+}
+
+// reshape returns the reshape operation of the 'reshape' directive, e.g.
+// 'reshape,pivot region;quarter;sum(amount)'. The directive's values are
+// joined with commas. Nil is returned if the format doesn't have one.
+func (f *format) reshape() (Reshape, error) {
+	vals, ok := f.directive("reshape")
+	if !ok {
+		return nil, nil
+	}
+	r, err := ParseReshape(strings.Join(vals, ","))
+	if err != nil {
+		return nil, fmt.Errorf("format directive %q: %s", "reshape", err)
+	}
+	return r, nil
+}
+
+// computed returns the computed columns of the 'compute' directives, e.g.
+// 'compute,total = qty * price', in order; a format can have any number of
+// them. The values of each directive are joined with commas, so function
+// arguments don't have to be quoted; strings are best quoted with single
+// quotes, which CSV doesn't need to escape. Nil is returned if the format
+// doesn't have any.
+func (f *format) computed() (*Computed, error) {
+	var c *Computed
+	for _, vals := range f.directives["compute"] {
+		if c == nil {
+			c = NewComputed()
+		}
+		err := c.AddExpr(strings.Join(vals, ","))
+		if err != nil {
+			return nil, fmt.Errorf("format directive %q: %s", "compute", err)
+		}
+	}
+	return c, nil
+}
+
+// templates returns the column templates of the 'template' directives, e.g.
+// 'template,name,{{link .Value .Row.url}}': the column, and its template.
+// The template's fields are joined with commas, so they don't have to be
+// quoted; quoted strings in a template are best quoted with backticks, which
+// CSV doesn't need to escape. Nil is returned if the format doesn't have
+// any.
+func (f *format) templates() (*Templates, error) {
+	var t *Templates
+	for _, vals := range f.directives["template"] {
+		if len(vals) < 2 {
+			return nil, fmt.Errorf("format directive %q: expected a column and a template", "template")
+		}
+		if t == nil {
+			t = NewTemplates()
+		}
+		err := t.Add(vals[0], strings.Join(vals[1:], ","))
+		if err != nil {
+			return nil, fmt.Errorf("format directive %q: %s", "template", err)
+		}
+	}
+	return t, nil
+}
+
+// rules returns the conditional formatting rules of the 'rule' directives,
+// e.g. 'rule,bold on price when price > 100', in order; a format can have
+// any number of them. The values of each directive are joined with commas;
+// strings are best quoted with single quotes, which CSV doesn't need to
+// escape. A 'rule_match' directive, first or all, sets how they are
+// matched. Nil is returned if the format doesn't have any.
+func (f *format) rules() (*CellRules, error) {
+	var r *CellRules
+	for _, vals := range f.directives["rule"] {
+		if r == nil {
+			r = &CellRules{}
+		}
+		err := r.Add(strings.Join(vals, ","))
+		if err != nil {
+			return nil, fmt.Errorf("format directive %q: %s", "rule", err)
+		}
+	}
+	if vals, ok := f.directive("rule_match"); ok && r != nil {
+		var err error
+		r.FirstMatch, err = parseRuleMatch(strings.Join(vals, ""))
+		if err != nil {
+			return nil, fmt.Errorf("format directive %q: %s", "rule_match", err)
+		}
+	}
+	return r, nil
+}
+
+// withColumns returns the format of a table whose columns come from the
+// columns cols of f's table, or, where they are -1, the columns otherCols of
+// other's; either format can be nil. The format has the directives of f, and
+// the alignment and emphasis of the columns, but no column names. Nil is
+// returned if both formats are nil.
+func (f *format) withColumns(cols []int, other *format, otherCols []int) *format {
+	if f == nil && other == nil {
+		return nil
+	}
+	fm := &format{directives: map[string][][]string{}}
+	if f != nil {
+		fm.directives = f.directives
+		fm.columnAlignment = projectRow(f.columnAlignment, cols)
+		fm.columnEmphasis = projectRow(f.columnEmphasis, cols)
+	} else {
+		fm.columnAlignment = make([]string, len(cols))
+		fm.columnEmphasis = make([]string, len(cols))
+	}
+	if other != nil {
+		alignment := projectRow(other.columnAlignment, otherCols)
+		emphasis := projectRow(other.columnEmphasis, otherCols)
+		for i := range fm.columnAlignment {
+			if i < len(cols) && cols[i] >= 0 {
+				continue
+			}
+			fm.columnAlignment[i], fm.columnEmphasis[i] = alignment[i], emphasis[i]
+		}
+	}
+	return fm
+}
@@ -0,0 +1,318 @@
+package transmogrifier
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Job is the conversion of a source to an output format, and where the
+// output goes. Unlike the MDTable, FixedWidthTable, and SQLTable types, a Job
+// handles the whole conversion: reading the source, in any supported format,
+// applying its format file, encoding the output, and writing it.
+type Job struct {
+	// Source is the file path, or any URI supported by NewResource, of the
+	// table data; "-" is stdin.
+	Source string
+	// Dest is where the output is written; "-" is stdout. If it is empty,
+	// the output is written next to the source, or the archive the source
+	// is in, with the output format's extension; the output of stdin and
+	// data URIs is written to stdout. Remote sources need a Dest.
+	Dest string
+	// SourceFormat is the format of the source. If it is FmtUnsupported,
+	// the format is determined by the source's extension, or media type;
+	// stdin is CSV.
+	SourceFormat FormatType
+	// Format is the output format. If it is FmtUnsupported, the output is
+	// an md table.
+	Format FormatType
+	// FormatSource is the format file. If it is empty, the source's format
+	// file, e.g. 'data.fmt' for 'data.csv', is used if it exists.
+	FormatSource string
+	// Dialect is the dialect of CSV sources.
+	Dialect CSVDialect
+	// NoHeader: the source's first row is data, not the column names. The
+	// column names come from the format file, if there is one.
+	NoHeader bool
+	// Columns is the projection that selects, reorders, and renames the
+	// columns, e.g. 'Item, Price as Cost, !Notes'; see Projection. If it
+	// is empty, the format file's 'columns' directive, if any, is used.
+	Columns string
+	// Filter is the filter expression that selects the rows, e.g.
+	// 'status == "open" && priority <= 2'; see Filter. It is applied
+	// before Columns, so it can use columns that aren't output. If it is
+	// empty, the format file's 'filter' directive, if any, is used.
+	Filter string
+	// Sort is the sort keys that order the rows, e.g. 'priority desc, due';
+	// see Sort. The rows are sorted after they are filtered. If it is
+	// empty, the format file's 'sort' directive, if any, is used.
+	Sort string
+	// GroupBy and Aggregate group the sorted rows: the rows with the same
+	// GroupBy columns, e.g. 'region, product', are aggregated into one row
+	// by the Aggregate columns, e.g. 'sum(amount) as Total, count(*)'; see
+	// Grouping. Without GroupBy, every row is aggregated into one. If both
+	// are empty, the format file's 'group' and 'aggregate' directives, if
+	// any, are used.
+	GroupBy   string
+	Aggregate string
+	// Totals are the aggregates of the footer row, e.g. 'sum(amount)', and
+	// Subtotals the columns whose groups have subtotal rows; see Totals. If
+	// Totals is empty, the format file's 'totals' directive, if any, is
+	// used.
+	Totals    string
+	Subtotals string
+	// Compute are the expressions of computed columns, separated by
+	// semicolons, e.g. 'total = qty * price'; see Computed. Computed adds
+	// more, e.g. with Go funcs, after them. They are added before anything
+	// else is applied, after those of the format file's 'compute'
+	// directives.
+	Compute  string
+	Computed *Computed
+	// Templates are the text/template templates, by column, that render
+	// the cells of their columns of md tables, e.g. '{{link .Value
+	// .Row.url}}'; see Templates. They replace the format file's 'template'
+	// directives for the same columns.
+	Templates map[string]string
+	// Rules are the conditional formatting rules, separated by semicolons,
+	// that style the cells of md tables, e.g. 'bold on price when price >
+	// 100'; see Rule. With FirstMatch, only the first rule that matches a
+	// cell styles it. If Rules is empty, the format file's 'rule'
+	// directives, if any, are used.
+	Rules      string
+	FirstMatch bool
+	// Reshape pivots, unpivots, or transposes the table, e.g. 'pivot
+	// region; quarter; sum(amount)'; see ParseReshape. The table is
+	// reshaped before it is filtered, so the other options apply to the
+	// reshaped table. If it is empty, the format file's 'reshape'
+	// directive, if any, is used.
+	Reshape string
+	// Union are more sources whose rows are appended to the Source's, e.g.
+	// the files of each month. They are read with their own format files,
+	// if any. Unless UnionAll is set, their columns must be those of the
+	// Source, in any order; with UnionAll, the columns are unioned. See
+	// CSV.Union.
+	Union    []string
+	UnionAll bool
+	// Join, if it isn't nil, is the table that the source, with the Union,
+	// is joined with, before anything else is applied.
+	Join *JoinTable
+	// Unmatched, if it isn't nil, is called with the keys of the rows of
+	// each table of the Join that don't have a match in the other.
+	Unmatched func(source string, keys [][]string)
+	// Diff, if it isn't nil, replaces the table, with the Union and Join,
+	// with its diff with an old version of it; see TableDiff. The other
+	// options apply to the diff.
+	Diff *DiffSource
+	// Region is the name of the region of a Markdown Dest that the output
+	// is injected into: the content between '<!-- mog:begin NAME -->' and
+	// '<!-- mog:end NAME -->'. The rest of the Dest is left as it is; it is
+	// an error if the Dest doesn't have the region. If Region is empty, the
+	// Dest's unnamed region, RegionBegin to RegionEnd, is used if it has
+	// one.
+	Region string
+	// Check: whether the output is compared with the current content of
+	// the destination, instead of being written. A *CheckError is returned
+	// if they differ.
+	Check bool
+	// Write sets how the output is written, when it is a local file.
+	Write *WriteOptions
+	// HTTP and S3 are the configurations used for http(s) URLs and s3://
+	// URIs.
+	HTTP *HTTPConfig
+	S3   *S3Config
+}
+
+// Run runs the job and returns where the output was written, or, when
+// checking, the destination that was checked. Errors reading the source are
+// *SourceErrors; errors with the format file, or an unsupported format, are
+// *FormatErrors, as are invalid options, e.g. a Filter that doesn't parse,
+// whose Err is an *OptionError.
+func (j *Job) Run() (dest string, err error) {
+	to := j.Format
+	if to == FmtUnsupported {
+		to = FmtMDTable
+	}
+	if j.Source == "" {
+		return "", &SourceError{Err: ErrNoSource}
+	}
+	opts := decodeOptions{
+		format:       j.SourceFormat,
+		formatSource: j.FormatSource,
+		dialect:      j.Dialect,
+		noHeader:     j.NoHeader,
+	}
+	if j.Columns != "" {
+		opts.projection, err = ParseProjection(j.Columns)
+		if err != nil {
+			return "", optionError("Columns", j.Columns, err)
+		}
+	}
+	if j.Filter != "" {
+		opts.filter, err = ParseFilter(j.Filter)
+		if err != nil {
+			return "", optionError("Filter", j.Filter, err)
+		}
+	}
+	if j.Sort != "" {
+		opts.sort, err = ParseSort(j.Sort)
+		if err != nil {
+			return "", optionError("Sort", j.Sort, err)
+		}
+	}
+	if j.Compute != "" {
+		opts.computed, err = ParseComputed(j.Compute)
+		if err != nil {
+			return "", optionError("Compute", j.Compute, err)
+		}
+	}
+	opts.computed = opts.computed.merge(j.Computed)
+	if len(j.Templates) > 0 {
+		cols := make([]string, 0, len(j.Templates))
+		for c := range j.Templates {
+			cols = append(cols, c)
+		}
+		sort.Strings(cols)
+		opts.templates = NewTemplates()
+		for _, c := range cols {
+			err = opts.templates.Add(c, j.Templates[c])
+			if err != nil {
+				return "", optionError("Templates", j.Templates[c], err)
+			}
+		}
+	}
+	if j.Rules != "" {
+		opts.rules, err = ParseRules(j.Rules)
+		if err != nil {
+			return "", optionError("Rules", j.Rules, err)
+		}
+		opts.rules.FirstMatch = j.FirstMatch
+	}
+	if j.Reshape != "" {
+		opts.reshape, err = ParseReshape(j.Reshape)
+		if err != nil {
+			return "", optionError("Reshape", j.Reshape, err)
+		}
+	}
+	if j.GroupBy != "" || j.Aggregate != "" {
+		opts.grouping, err = ParseGrouping(j.GroupBy, j.Aggregate)
+		if err != nil {
+			return "", optionError("Aggregate", j.Aggregate, err)
+		}
+	}
+	if j.Totals != "" {
+		opts.totals, err = ParseTotals(j.Totals, j.Subtotals)
+		if err != nil {
+			return "", optionError("Totals", j.Totals, err)
+		}
+	} else if j.Subtotals != "" {
+		return "", optionError("Subtotals", j.Subtotals, fmt.Errorf("subtotals need totals"))
+	}
+	src := j.resource(j.Source)
+	for _, u := range j.Union {
+		opts.union = append(opts.union, j.resource(u))
+	}
+	opts.unionAll = j.UnionAll
+	if j.Diff != nil {
+		if j.Diff.Source == "" {
+			return "", &SourceError{Err: ErrNoSource}
+		}
+		opts.diffKey, err = parseColumnList(j.Diff.Key)
+		if err == nil && len(opts.diffKey) == 0 {
+			err = fmt.Errorf("diff: no key columns")
+		}
+		if err != nil {
+			return "", optionError("Diff.Key", j.Diff.Key, err)
+		}
+		d := j.resource(j.Diff.Source)
+		opts.diffSource, opts.diffStyle, opts.diffUnchanged = &d, j.Diff.Style, j.Diff.Unchanged
+	}
+	if j.Join != nil {
+		if j.Join.Source == "" {
+			return "", &SourceError{Err: ErrNoSource}
+		}
+		opts.join, err = ParseJoin(j.Join.On)
+		if err != nil {
+			return "", optionError("Join.On", j.Join.On, err)
+		}
+		opts.join.Type, opts.join.Collision, opts.join.Suffix = j.Join.Type, j.Join.Collision, j.Join.Suffix
+		opts.joinSource = j.resource(j.Join.Source)
+		opts.unmatched = j.Unmatched
+	}
+	out, err := transmogrifyResource(src, to, opts)
+	if err != nil {
+		return "", err
+	}
+	d, err := j.dest(src, to)
+	if err != nil {
+		return "", err
+	}
+	if j.Check {
+		return d.String(), checkResource(d, out)
+	}
+	_, err = writeResource(d, out)
+	return d.String(), err
+}
+
+// optionError returns the *FormatError of the Job's option, and its value,
+// that is invalid.
+func optionError(option, value string, err error) error {
+	return &FormatError{Name: value, Err: &OptionError{Option: option, Err: err}}
+}
+
+// resource returns the resource of a source.
+func (j *Job) resource(s string) resource {
+	r := NewResource(s, FmtUnsupported, File)
+	r.http, r.s3 = j.HTTP, j.S3
+	return r
+}
+
+// dest returns the resource the output, in the format to, of src is written
+// to.
+func (j *Job) dest(src resource, to FormatType) (resource, error) {
+	var d resource
+	switch {
+	case j.Dest != "":
+		d = NewResource(j.Dest, to, File)
+	case src.Type == Stdio || src.Type == Data:
+		d = NewResource("-", to, File)
+	case src.Type == File:
+		d = NewResource("", to, File)
+		// the output of an archive member goes next to the archive.
+		if src.Archive != "" {
+			d.SetPath(NewResource(src.Archive, FmtUnsupported, File).Path)
+		} else {
+			d.SetPath(src.Path)
+		}
+		d.SetName(filenameFor(src.Name, to))
+	default:
+		return resource{}, ErrNoDest
+	}
+	d.http, d.s3, d.write, d.region = j.HTTP, j.S3, j.Write, j.Region
+	return d, nil
+}
+
+// JoinTable is a table that a Job's source is joined with.
+type JoinTable struct {
+	// Source is the file path, or any URI supported by NewResource, of the
+	// table. Its format file, if it has one, is used.
+	Source string
+	// On are the key columns, e.g. 'sku' or 'sku = id'; see ParseJoin.
+	On string
+	// Type, Collision, and Suffix are those of the Join.
+	Type      JoinType
+	Collision JoinCollision
+	Suffix    string
+}
+
+// DiffSource is an old version of a Job's source, that the source is diffed
+// with.
+type DiffSource struct {
+	// Source is the file path, or any URI supported by NewResource, of the
+	// old table. Its format file, if it has one, is used.
+	Source string
+	// Key are the key columns, e.g. 'sku' or 'region, sku'.
+	Key string
+	// Style is how the diff is rendered.
+	Style DiffStyle
+	// Unchanged: whether the unchanged rows are included.
+	Unchanged bool
+}
@@ -0,0 +1,175 @@
+package transmogrifier
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJobRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTree(t, dir, map[string]string{
+		"a.csv":     "a,b\n1,2\n",
+		"semi.csv":  "# comment\n1; 2\n",
+		"semi.fmt":  "x,y\nl,r\n,b\n",
+		"bad.csv":   "a,\"b\n",
+		"data.txt":  "a,b\n1,2\n",
+		"other.fmt": "c,d\n,\n,\n",
+		"badw.fwf":  "a  b\n1  2\n",
+		"badw.fmt":  "a,b\n,\n,\nwidth,x,2\n",
+		"proj.csv":  "a,b,c\n1,2,3\n",
+		"proj.fmt":  "x,y,z\nl,c,r\n,,b\ncolumns,z,x as X\n",
+		"flt.csv":   "id,status,pri\n1,open,3\n2,closed,1\n3,open,2\n",
+		"flt.fmt":   "id,status,pri\n,,\n,,\nfilter,pri in (1,2)\n",
+		"srt.csv":   "a,b\n1,x\n2,y\n",
+		"srt.fmt":   "a,b\n,\n,\nsort,a desc\n",
+		"sum.csv":   "region,amount\neast,2\neast,3\nwest,4\n",
+		"wide.csv":  "region,Q1,Q2\neast,10,20\n",
+		"wide.fmt":  "region,Q1,Q2\nl,r,r\nb,,\nreshape,unpivot region;quarter;amount\n",
+		"sum.fmt":   "region,amount\n,r\n,\ntotals,sum(amount)\ntotals_emphasis,b,b\n",
+		"a2.csv":    "b,a\n3,4\n",
+		"prod.csv":  "sku,name\nA1,towel\nB2,mug\n",
+		"prod.fmt":  "sku,name\nl,\n,b\n",
+		"price.csv": "id,price\nA1,42\nC3,7\n",
+		"price.fmt": "id,price\n,r\n,\n",
+		"old.csv":   "id,price\nA1,40\nB2,7\n",
+		"comp.csv":  "item,qty,price\ntowel,2,1.25\nmug,3,4\n",
+		"tmpl.csv":  "name,url,price\nmog,http://m,1200\n",
+		"rule.csv":  "item,price,status\ntowel,150,pass\nmug,20,fail\n",
+		"rule.fmt":  "item,price,status\n,r,\n,,\nrule,bold on price when price > 100\nrule,prefix '✅ ' on status when status == 'pass'\nrule,italic when price < 100\nrule_match,first\n",
+		"tmpl.fmt":  "name,url,price\n,,r\n,,\ncolumns,name,price\ntemplate,name,{{link .Value .Row.url}}\ntemplate,price,{{.Value | number 2}}\n",
+		"comp.fmt":  "item,qty,price,total\n,r,r,r\n,,,b\ncompute,total = qty * price\nsort,total desc\n",
+	})
+	tests := []struct {
+		job      Job
+		dest     string
+		expected string
+		errType  string
+	}{
+		{Job{Source: "a.csv"}, "a.md", "|a|b|  \n|---|---|  \n|1|2|  \n", ""},
+		{Job{Source: "a.csv", Format: FmtCSV, Dest: "copy.csv"}, "copy.csv", "a,b\n1,2\n", ""},
+		{Job{Source: "a.csv", Format: FmtMD, FormatSource: "other.fmt"}, "a.md", "|c|d|  \n|---|---|  \n|1|2|  \n", ""},
+		{Job{Source: "semi.csv", NoHeader: true, Dialect: CSVDialect{Comma: ';', Comment: '#', TrimLeadingSpace: true}}, "semi.md", "|x|y|  \n|:---|---:|  \n|1|__2__|  \n", ""},
+		{Job{Source: "a.csv", NoHeader: true, Dest: "blank.md"}, "blank.md", "|||  \n|---|---|  \n|a|b|  \n|1|2|  \n", ""},
+		{Job{Source: "data.txt", SourceFormat: FmtCSV, Format: FmtCSV}, "data.csv", "a,b\n1,2\n", ""},
+		{Job{Source: "proj.csv"}, "proj.md", "|z|X|  \n|---:|:---|  \n|__3__|1|  \n", ""},
+		{Job{Source: "proj.csv", Columns: "#2", Dest: "cols.md"}, "cols.md", "|y|  \n|:---:|  \n|2|  \n", ""},
+		{Job{Source: "proj.csv", Columns: "w"}, "", "", "format"},
+		{Job{Source: "flt.csv"}, "flt.md", "|id|status|pri|  \n|---|---|---|  \n|2|closed|1|  \n|3|open|2|  \n", ""},
+		{Job{Source: "flt.csv", Filter: `status == "open"`, Columns: "id", Dest: "open.md"}, "open.md", "|id|  \n|---|  \n|1|  \n|3|  \n", ""},
+		{Job{Source: "flt.csv", Filter: `status == "open"`, Sort: "pri", Dest: "sorted.md"}, "sorted.md", "|id|status|pri|  \n|---|---|---|  \n|3|open|2|  \n|1|open|3|  \n", ""},
+		{Job{Source: "srt.csv"}, "srt.md", "|a|b|  \n|---|---|  \n|2|y|  \n|1|x|  \n", ""},
+		{Job{Source: "sum.csv"}, "sum.md", "|region|amount|  \n|---|---:|  \n|east|2|  \n|east|3|  \n|west|4|  \n|__Total__|__9__|  \n", ""},
+		{Job{Source: "sum.csv", GroupBy: "region", Aggregate: "sum(amount) as amount", Dest: "grp.md"}, "grp.md", "|region|amount|  \n|---|---:|  \n|east|5|  \n|west|4|  \n|__Total__|__9__|  \n", ""},
+		{Job{Source: "sum.csv", Totals: "count(*)", Subtotals: "region", Format: FmtCSV, Dest: "sub.csv"}, "sub.csv", "region,amount\neast,2\neast,3\neast,Subtotal: 2\nwest,4\nwest,Subtotal: 1\n,Total: 3\n", ""},
+		{Job{Source: "sum.csv", Subtotals: "region"}, "", "", "option"},
+		{Job{Source: "sum.csv", Aggregate: "sum(region)"}, "", "", "format"},
+		{Job{Source: "wide.csv"}, "wide.md", "|region|quarter|amount|  \n|:---|---|---:|  \n|__east__|Q1|10|  \n|__east__|Q2|20|  \n", ""},
+		{Job{Source: "a.csv", Reshape: "transpose", Format: FmtCSV, Dest: "t.csv"}, "t.csv", "a,1\nb,2\n", ""},
+		{Job{Source: "a.csv", Reshape: "pivot a; b"}, "", "", "format"},
+		{Job{Source: "comp.csv"}, "comp.md", "|item|qty|price|total|  \n|---|---:|---:|---:|  \n|mug|3|4|__12__|  \n|towel|2|1.25|__2.50__|  \n", ""},
+		{Job{Source: "a.csv", Compute: "c = a + b; d = round(c / 2)", Filter: "c > 2", Format: FmtCSV, Dest: "computed.csv"}, "computed.csv", "a,b,c,d\n1,2,3,2\n", ""},
+		{Job{Source: "a.csv", Compute: "c ="}, "", "", "option"},
+		{Job{Source: "tmpl.csv"}, "tmpl.md", "|name|price|  \n|---|---:|  \n|[mog](http://m)|1,200.00|  \n", ""},
+		{Job{Source: "tmpl.csv", Templates: map[string]string{"price": "${{.Value}}"}}, "tmpl.md", "|name|price|  \n|---|---:|  \n|[mog](http://m)|$1200|  \n", ""},
+		{Job{Source: "tmpl.csv", Format: FmtCSV, Dest: "tmpl.out.csv"}, "tmpl.out.csv", "name,price\nmog,1200\n", ""},
+		{Job{Source: "tmpl.csv", Templates: map[string]string{"name": "{{"}}, "", "", "format"},
+		{Job{Source: "a.csv", Templates: map[string]string{"c": "{{.Value}}"}}, "", "", "format"},
+		{Job{Source: "rule.csv"}, "rule.md", "|item|price|status|  \n|---|---:|---|  \n|towel|__150__|✅ pass|  \n|_mug_|_20_|_fail_|  \n", ""},
+		{Job{Source: "rule.csv", Rules: "strikethrough on item when status == 'fail'; bold on item", FirstMatch: true}, "rule.md", "|item|price|status|  \n|---|---:|---|  \n|__towel__|150|pass|  \n|~~mug~~|20|fail|  \n", ""},
+		{Job{Source: "rule.csv", Rules: "bold on item", Format: FmtCSV, Dest: "rule.out.csv"}, "rule.out.csv", "item,price,status\ntowel,150,pass\nmug,20,fail\n", ""},
+		{Job{Source: "rule.csv", Rules: "blink"}, "", "", "format"},
+		{Job{Source: "a.csv", Union: []string{"a2.csv"}, Format: FmtCSV, Dest: "u.csv"}, "u.csv", "a,b\n1,2\n4,3\n", ""},
+		{Job{Source: "a.csv", Union: []string{"prod.csv"}, UnionAll: true, Format: FmtCSV, Dest: "ua.csv"}, "ua.csv", "a,b,sku,name\n1,2,,\n,,A1,towel\n,,B2,mug\n", ""},
+		{Job{Source: "prod.csv", Join: &JoinTable{Source: "price.csv", On: "sku = id", Type: LeftJoin}, Dest: "join.md"}, "join.md", "|sku|name|price|  \n|:---|---|---:|  \n|A1|__towel__|42|  \n|B2|__mug__||  \n", ""},
+		{Job{Source: "price.csv", Diff: &DiffSource{Source: "old.csv", Key: "id"}, Dest: "diff.md"}, "diff.md", "|id|price|  \n|---|---:|  \n|A1|~~40~~ **42**|  \n|~~B2~~|~~7~~|  \n|**C3**|**7**|  \n", ""},
+		{Job{Source: "price.csv", Diff: &DiffSource{Source: "old.csv", Key: "id", Style: DiffStatusColumn}, Filter: `status == "added"`, Format: FmtCSV, Dest: "diff.csv"}, "diff.csv", "status,id,price\nadded,C3,7\n", ""},
+		{Job{Source: "price.csv", Diff: &DiffSource{Source: "old.csv", Key: "sku"}}, "", "", "format"},
+		{Job{Source: "a.csv", Union: []string{"prod.csv"}}, "", "", "format"},
+		{Job{Source: "prod.csv", Join: &JoinTable{Source: "price.csv", On: "sku"}}, "", "", "format"},
+		{Job{Source: "prod.csv", Join: &JoinTable{Source: "missing.csv", On: "sku"}}, "", "", "source"},
+		{Job{Source: "a.csv", Sort: "c"}, "", "", "format"},
+		{Job{Source: "a.csv", Filter: "c > 1"}, "", "", "format"},
+		{Job{Source: "a.csv", Filter: "a >"}, "", "", "format"},
+		{Job{Source: "data.txt"}, "", "", "format"},
+		{Job{Source: "a.csv", SourceFormat: FmtSQL}, "", "", "format"},
+		{Job{Source: "a.csv", FormatSource: "missing.fmt"}, "", "", "format"},
+		{Job{Source: "badw.fwf"}, "", "", "format"},
+		{Job{Source: "missing.csv"}, "", "", "source"},
+		{Job{Source: "bad.csv"}, "", "", "source"},
+	}
+	for i, test := range tests {
+		job := test.job
+		job.Source = filepath.Join(dir, job.Source)
+		if job.FormatSource != "" {
+			job.FormatSource = filepath.Join(dir, job.FormatSource)
+		}
+		if job.Dest != "" {
+			job.Dest = filepath.Join(dir, job.Dest)
+		}
+		for k, u := range job.Union {
+			job.Union[k] = filepath.Join(dir, u)
+		}
+		if job.Diff != nil {
+			ds := *job.Diff
+			ds.Source = filepath.Join(dir, ds.Source)
+			job.Diff = &ds
+		}
+		if job.Join != nil {
+			jt := *job.Join
+			jt.Source = filepath.Join(dir, jt.Source)
+			job.Join = &jt
+		}
+		dest, err := job.Run()
+		var serr *SourceError
+		var ferr *FormatError
+		var oerr *OptionError
+		switch {
+		case test.errType == "source" && !errors.As(err, &serr):
+			t.Errorf("%d: expected a SourceError, got %v", i, err)
+		case test.errType == "format" && !errors.As(err, &ferr):
+			t.Errorf("%d: expected a FormatError, got %v", i, err)
+		case test.errType == "option" && (!errors.As(err, &ferr) || !errors.As(err, &oerr)):
+			t.Errorf("%d: expected a FormatError with an OptionError, got %v", i, err)
+		case test.errType == "" && err != nil:
+			t.Errorf("%d: expected no error, got %q", i, err)
+		}
+		if test.errType != "" {
+			continue
+		}
+		if dest != filepath.Join(dir, test.dest) {
+			t.Errorf("%d: expected %q, got %q", i, filepath.Join(dir, test.dest), dest)
+		}
+		b, _ := ioutil.ReadFile(dest)
+		if string(b) != test.expected {
+			t.Errorf("%d: expected %q, got %q", i, test.expected, b)
+		}
+	}
+}
+
+func TestJobRunStdio(t *testing.T) {
+	stdin = strings.NewReader("a,b\n1,2\n")
+	var out strings.Builder
+	stdout = &out
+	defer func() { stdin, stdout = os.Stdin, os.Stdout }()
+	job := Job{Source: "-", Format: FmtSQL}
+	dest, err := job.Run()
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	if dest != "-" || !strings.Contains(out.String(), "CREATE TABLE") {
+		t.Errorf("expected sql on stdout, got %q: %q", dest, out.String())
+	}
+	job = Job{Source: "https://example.com/a.csv"}
+	_, err = job.Run()
+	if err == nil {
+		t.Errorf("expected an error, got none")
+	}
+}
@@ -0,0 +1,440 @@
+package transmogrifier
+
+import (
+	"fmt"
+	"strings"
+)
+
+// JoinType is the type of a join: which of the rows without a match, in the
+// other table, are kept.
+type JoinType int
+
+const (
+	// InnerJoin keeps only the rows that match.
+	InnerJoin JoinType = iota
+	// LeftJoin keeps every row of the left table.
+	LeftJoin
+	// RightJoin keeps every row of the right table.
+	RightJoin
+	// FullJoin, a full outer join, keeps every row of both tables.
+	FullJoin
+)
+
+var joinTypeNames = [...]string{"inner", "left", "right", "full"}
+
+func (t JoinType) String() string {
+	if t < 0 || int(t) >= len(joinTypeNames) {
+		return "unknown"
+	}
+	return joinTypeNames[t]
+}
+
+// ParseJoinType parses a join type: inner, left, right, or full; 'outer' is
+// full, and 'left outer', 'right outer', and 'full outer' are accepted.
+func ParseJoinType(s string) (JoinType, error) {
+	f := strings.Fields(strings.ToLower(s))
+	if len(f) == 2 && f[1] == "outer" && f[0] != "inner" {
+		f = f[:1]
+	}
+	if len(f) == 1 {
+		if f[0] == "outer" {
+			return FullJoin, nil
+		}
+		for i, n := range joinTypeNames {
+			if f[0] == n {
+				return JoinType(i), nil
+			}
+		}
+	}
+	return InnerJoin, fmt.Errorf("unknown join type: %q", s)
+}
+
+// JoinCollision is how a join handles a column of the right table that has
+// the name of a column of the left table.
+type JoinCollision int
+
+const (
+	// CollisionSuffix keeps both columns; the right table's is renamed by
+	// adding the Join's Suffix.
+	CollisionSuffix JoinCollision = iota
+	// CollisionLeft merges the columns: a row's value is the left table's,
+	// or, if that is empty, the right table's.
+	CollisionLeft
+	// CollisionRight merges the columns: a row's value is the right
+	// table's, or, if that is empty, the left table's.
+	CollisionRight
+	// CollisionError makes the join an error.
+	CollisionError
+)
+
+var joinCollisionNames = [...]string{"suffix", "left", "right", "error"}
+
+func (c JoinCollision) String() string {
+	if c < 0 || int(c) >= len(joinCollisionNames) {
+		return "unknown"
+	}
+	return joinCollisionNames[c]
+}
+
+// ParseJoinCollision parses a JoinCollision: suffix, left, right, or error.
+func ParseJoinCollision(s string) (JoinCollision, error) {
+	for i, n := range joinCollisionNames {
+		if strings.EqualFold(strings.TrimSpace(s), n) {
+			return JoinCollision(i), nil
+		}
+	}
+	return CollisionSuffix, fmt.Errorf("unknown join collision: %q", s)
+}
+
+// Join joins a left and a right table on their key columns: the rows whose
+// keys are the same are combined into one. A row that matches more than one
+// row of the other table is combined with each of them.
+//
+// The joined table has the left table's columns, then the right table's,
+// without its key columns, whose values are the left's. The rows are in the
+// left table's order, each followed by its matches in the right table's
+// order, then, for right and full joins, the right table's rows without a
+// match; their key columns have the right table's keys.
+type Join struct {
+	Type JoinType
+	// Left and Right are the key columns, names or '#' positions, of the
+	// left and right tables, in the same order. If Right is empty, the
+	// right table's key columns are the Left columns.
+	Left  []string
+	Right []string
+	// Collision is how columns of the right table that have the name of a
+	// column of the left table are handled.
+	Collision JoinCollision
+	// Suffix is added to the names of the right table's columns that
+	// collide, including those with the name of an earlier column of the
+	// right table; if it is empty, it is "_2". It is added again until the
+	// name is unique.
+	Suffix string
+}
+
+// JoinResult is a joined table, with the keys that didn't match.
+type JoinResult struct {
+	Header []string
+	Rows   [][]string
+	// UnmatchedLeft and UnmatchedRight are the keys of the rows of the
+	// left and right tables that don't have a match in the other table,
+	// in the order they are first seen; each key is the values of the
+	// key columns.
+	UnmatchedLeft  [][]string
+	UnmatchedRight [][]string
+}
+
+// ParseJoin parses the key columns of an inner join: a comma separated list
+// of columns, names or '#' positions, that both tables have, or 'LEFT =
+// RIGHT' pairs, e.g. 'sku' or 'sku = "Product ID", region'. Names with
+// commas, or an '=', are quoted.
+func ParseJoin(on string) (*Join, error) {
+	items, err := splitUnquoted(on)
+	if err != nil {
+		return nil, fmt.Errorf("join %q: %s", on, err)
+	}
+	j := &Join{}
+	var pairs bool
+	for _, s := range items {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		l, r := s, s
+		if i := indexUnquoted(s, "="); i >= 0 {
+			l, r = strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+			pairs = true
+		}
+		for _, c := range []string{l, r} {
+			if c == "" {
+				return nil, fmt.Errorf("join %q: %q: expected LEFT = RIGHT", on, s)
+			}
+			if _, err := parseColumnRef(c); err != nil {
+				return nil, fmt.Errorf("join %q: %s", on, err)
+			}
+		}
+		j.Left, j.Right = append(j.Left, l), append(j.Right, r)
+	}
+	if len(j.Left) == 0 {
+		return nil, fmt.Errorf("join %q: no key columns", on)
+	}
+	if !pairs {
+		j.Right = nil
+	}
+	return j, nil
+}
+
+// Apply returns the join of the left and right tables.
+func (j *Join) Apply(leftHeader []string, left [][]string, rightHeader []string, right [][]string) (*JoinResult, error) {
+	res, _, _, err := j.apply(leftHeader, left, rightHeader, right)
+	return res, err
+}
+
+// Join returns the join of the CSV, the left table, and other.
+func (c *CSV) Join(other *CSV, j *Join) (*JoinResult, error) {
+	return j.Apply(c.headerRow, c.rows, other.headerRow, other.rows)
+}
+
+// apply joins the tables. leftCols and rightCols are the columns of the left
+// and right tables that the joined table's columns come from, for their
+// alignment and emphasis; -1 is none.
+func (j *Join) apply(leftHeader []string, left [][]string, rightHeader []string, right [][]string) (res *JoinResult, leftCols, rightCols []int, err error) {
+	if len(j.Left) == 0 {
+		return nil, nil, nil, fmt.Errorf("join: no key columns")
+	}
+	rightRefs := j.Right
+	if len(rightRefs) == 0 {
+		rightRefs = j.Left
+	}
+	if len(rightRefs) != len(j.Left) {
+		return nil, nil, nil, fmt.Errorf("join: %d left key columns, but %d right", len(j.Left), len(rightRefs))
+	}
+	lkeys, err := resolveColumns(j.Left, leftHeader, left)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	rkeys, err := resolveColumns(rightRefs, rightHeader, right)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	nl, nr := tableWidthOf(leftHeader, left), tableWidthOf(rightHeader, right)
+	res = &JoinResult{}
+	if len(leftHeader) > 0 {
+		res.Header = append(res.Header, columnNames(leftHeader, seq(nl))...)
+	}
+	for i := 0; i < nl; i++ {
+		leftCols = append(leftCols, i)
+		rightCols = append(rightCols, -1)
+	}
+	// keyOf is the left column of each right key column; merged is the
+	// left column of each right column that is merged with one.
+	keyOf := map[int]int{}
+	for i, c := range rkeys {
+		keyOf[c] = lkeys[i]
+		rightCols[lkeys[i]] = c
+	}
+	merged := map[int]int{}
+	// added are the right table's columns that are added.
+	var added []int
+	names := map[string]bool{}
+	for _, n := range res.Header {
+		names[n] = true
+	}
+	for c := 0; c < nr; c++ {
+		if _, ok := keyOf[c]; ok {
+			continue
+		}
+		if len(leftHeader) > 0 {
+			n := columnNames(rightHeader, []int{c})[0]
+			// a right column with the name of an earlier right column,
+			// but not of a left one, is renamed by the suffix.
+			if l := indexOf(res.Header[:nl], n); l >= 0 {
+				switch j.Collision {
+				case CollisionLeft, CollisionRight:
+					merged[c] = l
+					rightCols[l] = c
+					continue
+				case CollisionError:
+					return nil, nil, nil, fmt.Errorf("join: both tables have a %q column", n)
+				}
+			}
+			if names[n] {
+				suffix := j.Suffix
+				if suffix == "" {
+					suffix = "_2"
+				}
+				for names[n] {
+					n += suffix
+				}
+			}
+			names[n] = true
+			res.Header = append(res.Header, n)
+		}
+		added = append(added, c)
+		leftCols = append(leftCols, -1)
+		rightCols = append(rightCols, c)
+	}
+	// combine returns the joined row of l and r; either can be nil.
+	combine := func(l, r []string) []string {
+		row := make([]string, nl, nl+len(added))
+		copy(row, l)
+		if r == nil {
+			return append(row, make([]string, len(added))...)
+		}
+		if l == nil {
+			for i, c := range rkeys {
+				row[lkeys[i]] = cell(r, c)
+			}
+		}
+		for c, i := range merged {
+			lv, rv := row[i], cell(r, c)
+			if rv != "" && (lv == "" || j.Collision == CollisionRight) {
+				row[i] = rv
+			}
+		}
+		return append(row, projectRow(r, added)...)
+	}
+	index := map[string][]int{}
+	for i, row := range right {
+		k := groupKey(row, rkeys)
+		index[k] = append(index[k], i)
+	}
+	matched := make([]bool, len(right))
+	seen := map[string]bool{}
+	for _, l := range left {
+		k := groupKey(l, lkeys)
+		matches := index[k]
+		if len(matches) == 0 {
+			if !seen[k] {
+				seen[k] = true
+				res.UnmatchedLeft = append(res.UnmatchedLeft, projectRow(l, lkeys))
+			}
+			if j.Type == LeftJoin || j.Type == FullJoin {
+				res.Rows = append(res.Rows, combine(l, nil))
+			}
+			continue
+		}
+		for _, i := range matches {
+			matched[i] = true
+			res.Rows = append(res.Rows, combine(l, right[i]))
+		}
+	}
+	seen = map[string]bool{}
+	for i, r := range right {
+		if matched[i] {
+			continue
+		}
+		k := groupKey(r, rkeys)
+		if !seen[k] {
+			seen[k] = true
+			res.UnmatchedRight = append(res.UnmatchedRight, projectRow(r, rkeys))
+		}
+		if j.Type == RightJoin || j.Type == FullJoin {
+			res.Rows = append(res.Rows, combine(nil, r))
+		}
+	}
+	return res, leftCols, rightCols, nil
+}
+
+// Union returns the rows of the CSV followed by those of the others. With
+// all, the header is the union of the tables' columns, in the order they
+// are first seen, and the values of the columns that a table doesn't have
+// are empty; otherwise, the tables must have the same columns, though they
+// can be in a different order, and the header is the CSV's. Tables without
+// headers are concatenated as they are, but can't be combined with tables
+// that have them.
+func (c *CSV) Union(all bool, others ...*CSV) ([]string, [][]string, error) {
+	tables := append([]*CSV{c}, others...)
+	names := make([]string, len(tables))
+	headers := make([][]string, len(tables))
+	rows := make([][][]string, len(tables))
+	for i, t := range tables {
+		names[i], headers[i], rows[i] = t.Source(), t.headerRow, t.rows
+		if names[i] == "" {
+			names[i] = fmt.Sprintf("table %d", i+1)
+		}
+	}
+	h, r, _, err := union(all, names, headers, rows)
+	return h, r, err
+}
+
+// union concatenates the tables; see CSV.Union. names are the tables' names,
+// for errors. cols are the columns of the first table that the columns come
+// from; -1 is none.
+func union(all bool, names []string, headers [][]string, tables [][][]string) (header []string, rows [][]string, cols []int, err error) {
+	var withHeader int
+	for _, h := range headers {
+		if len(h) > 0 {
+			withHeader++
+		}
+	}
+	if withHeader == 0 {
+		for _, t := range tables {
+			rows = append(rows, t...)
+		}
+		if len(tables) > 0 {
+			cols = seq(tableWidth(tables[0]))
+		}
+		return nil, rows, cols, nil
+	}
+	keys := make([][]string, len(headers))
+	for i, h := range headers {
+		if len(h) == 0 {
+			return nil, nil, nil, fmt.Errorf("union: %s has no header", names[i])
+		}
+		keys[i] = columnKeys(h)
+	}
+	// index is the output column of each column key.
+	index := map[string]int{}
+	for i, k := range keys[0] {
+		index[k] = i
+		cols = append(cols, i)
+	}
+	header = append(header, headers[0]...)
+	for i, h := range headers[1:] {
+		missing := len(index) != len(h)
+		for c, k := range keys[i+1] {
+			if _, ok := index[k]; ok {
+				continue
+			}
+			missing = true
+			if all {
+				index[k] = len(header)
+				header = append(header, h[c])
+				cols = append(cols, -1)
+			}
+		}
+		if missing && !all {
+			return nil, nil, nil, fmt.Errorf("union: the columns of %s, %q, aren't those of %s, %q", names[i+1], h, names[0], headers[0])
+		}
+	}
+	for i, t := range tables {
+		// to is the output column of each of the table's columns.
+		to := make([]int, len(keys[i]))
+		for c, k := range keys[i] {
+			to[c] = index[k]
+		}
+		for _, r := range t {
+			row := make([]string, len(header))
+			for c, v := range r {
+				if c < len(to) {
+					row[to[c]] = v
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	return header, rows, cols, nil
+}
+
+// columnKeys returns the keys of the columns of the header: their names,
+// with the number of earlier columns with the same name, so that columns
+// with the same name are distinct.
+func columnKeys(header []string) []string {
+	keys := make([]string, len(header))
+	count := map[string]int{}
+	for i, n := range header {
+		keys[i] = fmt.Sprintf("%s\x00%d", n, count[n])
+		count[n]++
+	}
+	return keys
+}
+
+// seq returns the columns 0 to n-1.
+func seq(n int) []int {
+	cols := make([]int, n)
+	for i := range cols {
+		cols[i] = i
+	}
+	return cols
+}
+
+// indexOf returns the index of the first s in names, or -1.
+func indexOf(names []string, s string) int {
+	for i, n := range names {
+		if n == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,174 @@
+package transmogrifier
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJoinApply(t *testing.T) {
+	productHeader := []string{"sku", "name", "price"}
+	products := [][]string{
+		[]string{"A1", "towel", ""},
+		[]string{"B2", "mug", "3"},
+		[]string{"A1", "towel", ""},
+	}
+	priceHeader := []string{"id", "price", "currency"}
+	prices := [][]string{
+		[]string{"A1", "42", "EUR"},
+		[]string{"C3", "7", "USD"},
+		[]string{"B2", "4", "EUR"},
+		[]string{"B2", "5", "USD"},
+	}
+	tests := []struct {
+		on             string
+		typ            JoinType
+		collision      JoinCollision
+		expectedHeader []string
+		expectedRows   [][]string
+		expectedErr    string
+	}{
+		{
+			"sku = id", InnerJoin, CollisionSuffix,
+			[]string{"sku", "name", "price", "price_2", "currency"},
+			[][]string{{"A1", "towel", "", "42", "EUR"}, {"B2", "mug", "3", "4", "EUR"}, {"B2", "mug", "3", "5", "USD"}, {"A1", "towel", "", "42", "EUR"}},
+			"",
+		},
+		{
+			"sku = id", LeftJoin, CollisionLeft,
+			[]string{"sku", "name", "price", "currency"},
+			[][]string{{"A1", "towel", "42", "EUR"}, {"B2", "mug", "3", "EUR"}, {"B2", "mug", "3", "USD"}, {"A1", "towel", "42", "EUR"}},
+			"",
+		},
+		{
+			"#1 = id", RightJoin, CollisionRight,
+			[]string{"sku", "name", "price", "currency"},
+			[][]string{{"A1", "towel", "42", "EUR"}, {"B2", "mug", "4", "EUR"}, {"B2", "mug", "5", "USD"}, {"A1", "towel", "42", "EUR"}, {"C3", "", "7", "USD"}},
+			"",
+		},
+		{"sku = id", FullJoin, CollisionError, nil, nil, `join: both tables have a "price" column`},
+		{"sku", InnerJoin, CollisionSuffix, nil, nil, `unknown column "sku"`},
+	}
+	for i, test := range tests {
+		j, err := ParseJoin(test.on)
+		if err != nil {
+			t.Errorf("%d: expected no error, got %q", i, err)
+			continue
+		}
+		j.Type, j.Collision = test.typ, test.collision
+		res, err := j.Apply(productHeader, products, priceHeader, prices)
+		if err != nil {
+			if err.Error() != test.expectedErr {
+				t.Errorf("%d: expected error %q, got %q", i, test.expectedErr, err)
+			}
+			continue
+		}
+		if test.expectedErr != "" {
+			t.Errorf("%d: expected error %q, got none", i, test.expectedErr)
+			continue
+		}
+		if !reflect.DeepEqual(res.Header, test.expectedHeader) {
+			t.Errorf("%d: expected header %q, got %q", i, test.expectedHeader, res.Header)
+		}
+		if !reflect.DeepEqual(res.Rows, test.expectedRows) {
+			t.Errorf("%d: expected rows %q, got %q", i, test.expectedRows, res.Rows)
+		}
+		if !reflect.DeepEqual(res.UnmatchedRight, [][]string{{"C3"}}) || res.UnmatchedLeft != nil {
+			t.Errorf("%d: expected unmatched right key C3, got %q and %q", i, res.UnmatchedLeft, res.UnmatchedRight)
+		}
+	}
+}
+
+// The right table's columns with the same name, that the left table doesn't
+// have, are renamed by the suffix, whatever the collision.
+func TestJoinApplyDuplicateRightColumns(t *testing.T) {
+	expectedHeader := []string{"id", "x", "b", "b_2"}
+	expectedRows := [][]string{{"1", "a", "p", "q"}}
+	for i, collision := range []JoinCollision{CollisionSuffix, CollisionLeft, CollisionRight, CollisionError} {
+		j := &Join{Left: []string{"id"}, Collision: collision}
+		res, err := j.Apply([]string{"id", "x"}, [][]string{{"1", "a"}}, []string{"id", "b", "b"}, [][]string{{"1", "p", "q"}})
+		if err != nil {
+			t.Errorf("%d: expected no error, got %q", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(res.Header, expectedHeader) {
+			t.Errorf("%d: expected header %q, got %q", i, expectedHeader, res.Header)
+		}
+		if !reflect.DeepEqual(res.Rows, expectedRows) {
+			t.Errorf("%d: expected rows %q, got %q", i, expectedRows, res.Rows)
+		}
+	}
+}
+
+func TestParseJoin(t *testing.T) {
+	tests := []struct {
+		on          string
+		left, right []string
+		expectedErr string
+	}{
+		{"sku", []string{"sku"}, nil, ""},
+		{`sku = "Product ID", region`, []string{"sku", "region"}, []string{`"Product ID"`, "region"}, ""},
+		{"sku =", nil, nil, `join "sku =": "sku =": expected LEFT = RIGHT`},
+		{"#0", nil, nil, `join "#0": invalid column position: "#0"`},
+		{" , ", nil, nil, `join " , ": no key columns`},
+	}
+	for i, test := range tests {
+		j, err := ParseJoin(test.on)
+		if err != nil {
+			if err.Error() != test.expectedErr {
+				t.Errorf("%d: expected error %q, got %q", i, test.expectedErr, err)
+			}
+			continue
+		}
+		if test.expectedErr != "" {
+			t.Errorf("%d: expected error %q, got none", i, test.expectedErr)
+			continue
+		}
+		if !reflect.DeepEqual(j.Left, test.left) || !reflect.DeepEqual(j.Right, test.right) {
+			t.Errorf("%d: expected %q = %q, got %q = %q", i, test.left, test.right, j.Left, j.Right)
+		}
+	}
+}
+
+func TestCSVUnion(t *testing.T) {
+	read := func(s string) *CSV {
+		c := NewCSV()
+		c.SetHasHeader(true)
+		err := c.Read(strings.NewReader(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	jan, feb, mar := read("sku,qty\nA1,1\n"), read("qty,sku\n2,B2\n"), read("sku,qty,note\nC3,3,new\n")
+	tests := []struct {
+		all            bool
+		others         []*CSV
+		expectedHeader []string
+		expectedRows   [][]string
+		expectedErr    string
+	}{
+		{false, []*CSV{feb}, []string{"sku", "qty"}, [][]string{{"A1", "1"}, {"B2", "2"}}, ""},
+		{true, []*CSV{feb, mar}, []string{"sku", "qty", "note"}, [][]string{{"A1", "1", ""}, {"B2", "2", ""}, {"C3", "3", "new"}}, ""},
+		{false, []*CSV{mar}, nil, nil, `union: the columns of table 2, ["sku" "qty" "note"], aren't those of table 1, ["sku" "qty"]`},
+	}
+	for i, test := range tests {
+		h, rows, err := jan.Union(test.all, test.others...)
+		if err != nil {
+			if err.Error() != test.expectedErr {
+				t.Errorf("%d: expected error %q, got %q", i, test.expectedErr, err)
+			}
+			continue
+		}
+		if test.expectedErr != "" {
+			t.Errorf("%d: expected error %q, got none", i, test.expectedErr)
+			continue
+		}
+		if !reflect.DeepEqual(h, test.expectedHeader) {
+			t.Errorf("%d: expected header %q, got %q", i, test.expectedHeader, h)
+		}
+		if !reflect.DeepEqual(rows, test.expectedRows) {
+			t.Errorf("%d: expected rows %q, got %q", i, test.expectedRows, rows)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package transmogrifier
+
+import (
+	"encoding"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+)
+
+// timeStringLayout is the layout of time.Time's String method, which Marshal
+// formats time.Time fields without a layout with.
+const timeStringLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// UnmarshalError is an error decoding a CSV value into a struct field.
+type UnmarshalError struct {
+	Row    int    // Row is the index of the row in Rows().
+	Column string // Column is the name of the column.
+	Value  string // Value is the value that couldn't be decoded.
+	Err    error
+}
+
+func (e *UnmarshalError) Error() string {
+	return fmt.Sprintf("row %d: column %q: %q: %s", e.Row, e.Column, e.Value, e.Err)
+}
+
+// UnmarshalErrors are all of the errors encountered by Unmarshal.
+type UnmarshalErrors []*UnmarshalError
+
+func (e UnmarshalErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", e[0], len(e)-1)
+}
+
+// Unmarshal decodes the CSV's rows into v, which must be a pointer to a slice
+// of structs or of pointers to structs. Columns are matched to fields by the
+// field's mog tag name, or the field name, using the header row; an exact
+// match is preferred over a case-insensitive one. Columns without a matching
+// field are ignored.
+//
+// Values are converted to the field's type: strings, bools, ints, uints, and
+// floats are supported, as are time.Time, using the tag's layout or, if it
+// doesn't have one, the layout of time.Time's String method, which Marshal
+// formats them with, and the date and datetime layouts recognized by type
+// inference, and any type that implements encoding.TextUnmarshaler. Pointer
+// fields are left nil for empty values, non-pointer fields are left at their
+// zero value. As with encoding/json, the fields of an embedded pointer to an
+// unexported struct can't be set.
+//
+// Every row is decoded; if any values couldn't be, an UnmarshalErrors is
+// returned.
+func (c *CSV) Unmarshal(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("unable to unmarshal: expected a pointer to a slice, got %T", v)
+	}
+	slice := rv.Elem()
+	elemType := slice.Type().Elem()
+	structType := elemType
+	if structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return fmt.Errorf("unable to unmarshal: unsupported element type %s", elemType)
+	}
+	if len(c.headerRow) == 0 {
+		return fmt.Errorf("unable to unmarshal: no header row")
+	}
+	cols, err := structColumns(structType, nil)
+	if err != nil {
+		return err
+	}
+	fields := matchColumns(c.headerRow, cols)
+	var errs UnmarshalErrors
+	for i, row := range c.rows {
+		elem := reflect.New(structType).Elem()
+		for j, val := range row {
+			if j >= len(fields) || fields[j] == nil {
+				continue
+			}
+			err := setField(elem, fields[j], val)
+			if err != nil {
+				errs = append(errs, &UnmarshalError{Row: i, Column: c.headerRow[j], Value: val, Err: err})
+			}
+		}
+		if elemType.Kind() == reflect.Ptr {
+			elem = elem.Addr()
+		}
+		slice.Set(reflect.Append(slice, elem))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Marshal sets the CSV's header row and rows from v. The header row is the
+// column names. See MDTable.TransmogrifyValues for what v can be.
+func (c *CSV) Marshal(v interface{}) error {
+	vt, err := newValueTable(v)
+	if err != nil {
+		return err
+	}
+	c.headerRow = vt.columnNames
+	c.rows = vt.rows
+	return nil
+}
+
+// Write writes the CSV data to w. If the CSV has a header, the header row is
+// written first.
+func (c *CSV) Write(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if c.comma != 0 {
+		cw.Comma = c.comma
+	}
+	if c.hasHeader && len(c.headerRow) > 0 {
+		err := cw.Write(c.headerRow)
+		if err != nil {
+			return err
+		}
+	}
+	err := cw.WriteAll(c.rows)
+	if err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// matchColumns returns the column, if any, for each header.
+func matchColumns(header []string, cols []valueColumn) []*valueColumn {
+	fields := make([]*valueColumn, len(header))
+	for i, h := range header {
+		for j := range cols {
+			if cols[j].name == h {
+				fields[i] = &cols[j]
+				break
+			}
+		}
+		if fields[i] != nil {
+			continue
+		}
+		for j := range cols {
+			if strings.EqualFold(cols[j].name, h) {
+				fields[i] = &cols[j]
+				break
+			}
+		}
+	}
+	return fields
+}
+
+// setField sets the struct field for col to s.
+func setField(v reflect.Value, col *valueColumn, s string) error {
+	// allocate nil embedded struct pointers along the way.
+	for i, x := range col.index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				// as with encoding/json, the fields of an embedded pointer to
+				// an unexported struct can't be set.
+				if !v.CanSet() {
+					return fmt.Errorf("cannot set embedded pointer to unexported struct %s", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return setValue(v, s, col.layout)
+}
+
+// setValue sets v to the value of s converted to v's type.
+func setValue(v reflect.Value, s, layout string) error {
+	if v.Kind() == reflect.Ptr {
+		if s == "" {
+			return nil
+		}
+		p := reflect.New(v.Type().Elem())
+		err := setValue(p.Elem(), s, layout)
+		if err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	if v.Type() == timeType {
+		if s == "" {
+			return nil
+		}
+		if layout != "" {
+			t, err := time.Parse(layout, s)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(t))
+			return nil
+		}
+		// String's monotonic clock reading, e.g. m=+0.0001, can't be parsed.
+		if i := strings.Index(s, " m="); i >= 0 {
+			s = s[:i]
+		}
+		t, ok := parseLayouts(s, append(append([]string{timeStringLayout}, dateTimeLayouts...), dateLayouts...))
+		if !ok {
+			return fmt.Errorf("unable to parse time")
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	if v.Kind() != reflect.String {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return nil
+		}
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package transmogrifier
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+type testLevel int
+
+func (l *testLevel) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		*l = 0
+	}
+	return nil
+}
+
+type testRecord struct {
+	Item   string
+	ID     int       `mog:"Id"`
+	Price  float64   `mog:"price"`
+	Stock  *uint     `mog:"Stock"`
+	Active bool      `mog:"Active"`
+	Added  time.Time `mog:"Added,layout=01/02/2006"`
+	Level  testLevel `mog:"Level"`
+}
+
+func TestUnmarshal(t *testing.T) {
+	c := NewCSV()
+	c.headerRow = []string{"Item", "Id", "Price", "Stock", "Active", "Added", "Level", "Extra"}
+	c.rows = [][]string{
+		[]string{"towel", "42", "19.99", "7", "true", "10/16/2015", "high", "x"},
+		[]string{"string", "", " 9.99", "", "false", "", "low", "y"},
+	}
+	var records []testRecord
+	err := c.Unmarshal(&records)
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	r := records[0]
+	if r.Item != "towel" || r.ID != 42 || r.Price != 19.99 || r.Stock == nil || *r.Stock != 7 || !r.Active || r.Level != 2 {
+		t.Errorf("0: unexpected record %+v", r)
+	}
+	if !r.Added.Equal(time.Date(2015, 10, 16, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("0: expected Added to be 2015-10-16, got %s", r.Added)
+	}
+	r = records[1]
+	if r.Item != "string" || r.ID != 0 || r.Price != 9.99 || r.Stock != nil || r.Active || !r.Added.IsZero() || r.Level != 1 {
+		t.Errorf("1: unexpected record %+v", r)
+	}
+
+	var ptrs []*testRecord
+	err = c.Unmarshal(&ptrs)
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	if len(ptrs) != 2 || ptrs[0].Item != "towel" {
+		t.Errorf("expected 2 records, got %d", len(ptrs))
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	c := NewCSV()
+	c.headerRow = []string{"Item", "Id", "Active"}
+	c.rows = [][]string{
+		[]string{"towel", "x", "true"},
+		[]string{"string", "1", "maybe"},
+	}
+	var records []testRecord
+	err := c.Unmarshal(&records)
+	errs, ok := err.(UnmarshalErrors)
+	if !ok {
+		t.Fatalf("expected UnmarshalErrors, got %#v", err)
+	}
+	expected := []string{
+		`row 0: column "Id": "x": strconv.ParseInt: parsing "x": invalid syntax`,
+		`row 1: column "Active": "maybe": strconv.ParseBool: parsing "maybe": invalid syntax`,
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %d", len(expected), len(errs))
+	}
+	for i, e := range errs {
+		if e.Error() != expected[i] {
+			t.Errorf("%d: expected %q, got %q", i, expected[i], e)
+		}
+	}
+	if len(records) != 2 || records[1].Item != "string" {
+		t.Errorf("expected every row to be decoded, got %+v", records)
+	}
+
+	tests := []struct {
+		value       interface{}
+		expectedErr string
+	}{
+		{records, "unable to unmarshal: expected a pointer to a slice, got []transmogrifier.testRecord"},
+		{&[]int{}, "unable to unmarshal: unsupported element type int"},
+	}
+	for i, test := range tests {
+		err := c.Unmarshal(test.value)
+		if err == nil || err.Error() != test.expectedErr {
+			t.Errorf("%d: expected %q, got %v", i, test.expectedErr, err)
+		}
+	}
+	err = NewCSV().Unmarshal(&records)
+	if err == nil || err.Error() != "unable to unmarshal: no header row" {
+		t.Errorf("expected no header row error, got %v", err)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	stock := uint(7)
+	records := []testRecord{
+		{"towel", 42, 19.99, &stock, true, time.Date(2015, 10, 16, 0, 0, 0, 0, time.UTC), 2},
+		{Item: "string, long", ID: 1},
+	}
+	c := NewCSV()
+	err := c.Marshal(records)
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	var buf bytes.Buffer
+	err = c.Write(&buf)
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	expected := "Item,Id,price,Stock,Active,Added,Level\n" +
+		"towel,42,19.99,7,true,10/16/2015,2\n" +
+		"\"string, long\",1,0,,false,01/01/0001,0\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+
+	// round trip
+	var decoded []testRecord
+	err = c.Unmarshal(&decoded)
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	if len(decoded) != 2 || decoded[0].Item != "towel" || *decoded[0].Stock != 7 || decoded[1].Item != "string, long" {
+		t.Errorf("round trip: unexpected records %+v", decoded)
+	}
+}
+
+type testStamp struct {
+	Name  string
+	Added time.Time
+}
+
+func TestMarshalUnmarshalTime(t *testing.T) {
+	added := time.Date(2015, 10, 16, 12, 30, 5, 250, time.FixedZone("EDT", -4*3600))
+	tests := []time.Time{
+		time.Date(2015, 10, 16, 0, 0, 0, 0, time.UTC),
+		added,
+		time.Now(),
+	}
+	for i, test := range tests {
+		c := NewCSV()
+		err := c.Marshal([]testStamp{{"towel", test}})
+		if err != nil {
+			t.Errorf("%d: expected no error, got %q", i, err)
+			continue
+		}
+		var stamps []testStamp
+		err = c.Unmarshal(&stamps)
+		if err != nil {
+			t.Errorf("%d: expected no error, got %q", i, err)
+			continue
+		}
+		if len(stamps) != 1 || !stamps[0].Added.Equal(test) {
+			t.Errorf("%d: expected %s, got %+v", i, test, stamps)
+		}
+	}
+}
+
+type testEmbedded struct {
+	Note string
+}
+
+type testEmbeds struct {
+	Name string
+	*testEmbedded
+}
+
+func TestUnmarshalEmbeddedUnexportedPointer(t *testing.T) {
+	c := NewCSV()
+	c.headerRow = []string{"Name", "Note"}
+	c.rows = [][]string{[]string{"towel", "don't panic"}}
+	var records []testEmbeds
+	err := c.Unmarshal(&records)
+	expected := `row 0: column "Note": "don't panic": cannot set embedded pointer to unexported struct transmogrifier.testEmbedded`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+	if len(records) != 1 || records[0].Name != "towel" || records[0].testEmbedded != nil {
+		t.Errorf("expected the other fields to be decoded, got %+v", records)
+	}
+}
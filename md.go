@@ -2,7 +2,7 @@ package transmogrifier
 
 import (
 	"fmt"
-	"os"
+	"io"
 	"strings"
 )
 
@@ -42,6 +42,22 @@ type MDTable struct {
 	// columnEmphasis contains the emphasis information, if any. for each column.
 	// This is supplied by the format.
 	columnEmphasis []string
+	// pipeline is applied to the table; only its rowwise part is applied
+	// to rows that are encoded one at a time. sourceNames are the column
+	// names of those rows, and rowIndex the index of the next data row.
+	pipeline    pipeline
+	sourceNames []string
+	rowIndex    int
+	// styles are the styles of the cells of the rows to be transmogrified,
+	// by column.
+	styles [][]cellStyle
+	// summary is whether each row is a summary row; summaryEmphasis, if
+	// set, is their emphasis.
+	summary         []bool
+	summaryEmphasis []string
+	// compression is the compression used for the dest. If it isn't set,
+	// the compression is determined by the dest's extension.
+	compression Compression
 	// md is the md table, in bytes
 	md []byte
 }
@@ -66,24 +82,52 @@ func (m *MDTable) SetSource(s string) error {
 	if s == "" {
 		return fmt.Errorf("source string was empty")
 	}
-	parts := strings.Split(s, ".")
-	if len(parts) < 2 {
-		return fmt.Errorf("unable to determine format of %q", s)
-	}
-	m.sourceFormat = FormatTypeFromString(parts[len(parts)-1])
+	r := NewResource(s, FmtUnsupported, File)
+	var ext string
+	m.sourceFormat, ext = formatFromResource(r)
 	if m.sourceFormat == FmtUnsupported {
-		return fmt.Errorf("unsupported format for %q: %q", s, parts[len(parts)-1])
+		if ext == "" {
+			return fmt.Errorf("unable to determine format of %q", s)
+		}
+		return fmt.Errorf("unsupported format for %q: %q", s, ext)
 	}
-	m.source = NewResource(s, m.sourceFormat, File)
+	r.Format = m.sourceFormat
+	r.copyConfig(m.source)
+	m.source = r
 	return nil
 }
 
+// SetHTTPConfig sets the configuration used when the source or the dest is
+// a http(s) URL.
+func (m *MDTable) SetHTTPConfig(cfg *HTTPConfig) {
+	m.source.http = cfg
+	m.dest.http = cfg
+}
+
+// SetS3Config sets the configuration used when the source or the dest is an
+// s3:// URI.
+func (m *MDTable) SetS3Config(cfg *S3Config) {
+	m.source.s3 = cfg
+	m.dest.s3 = cfg
+}
+
+// SetWriteOptions sets how the dest is written, when it is a local file.
+func (m *MDTable) SetWriteOptions(opts *WriteOptions) {
+	m.dest.write = opts
+}
+
 // SetUseFormat: whether or not a format should be applied to the MD table.
 func (m *MDTable) SetUseFormat(b bool) {
 	m.useFormat = b
 	m.SetHasColumnNames(b)
 }
 
+// setUseFormat sets whether the column alignment and emphasis are used,
+// without changing whether the table has column names.
+func (m *MDTable) setUseFormat(b bool) {
+	m.useFormat = b
+}
+
 // SetFormatSource set's the source of the format information and sets
 // useFormat to 'true'.  If the formatSource != "", it will be used as the
 // location of the formatting information for the MD Table. If it isn't set and
@@ -119,6 +163,56 @@ func (m *MDTable) SetColumnEmphasis(cols []string) {
 	copy(m.columnEmphasis, cols)
 }
 
+// SetProjection sets the projection that selects, reorders, and renames the
+// table's columns. The column names, alignment, and emphasis are those of the
+// source's columns; they follow their columns when the columns are
+// reordered.
+func (m *MDTable) SetProjection(p *Projection) {
+	m.pipeline.projection = p
+}
+
+// SetComputed sets the computed columns that are added to the table, before
+// the totals and the projection. Their alignment and emphasis are those of
+// their columns: the column they replace, or, for a new column, the one
+// after the table's columns.
+func (m *MDTable) SetComputed(c *Computed) {
+	m.pipeline.computed = c
+}
+
+// SetTemplates sets the templates that render the cells of their columns.
+// The templates' columns are those of the source, so a template can use
+// columns that the projection doesn't select; summary rows aren't rendered
+// by them.
+func (m *MDTable) SetTemplates(t *Templates) {
+	m.pipeline.templates = t
+}
+
+// SetRules sets the conditional formatting rules that style the cells that
+// they match, in addition to their column emphasis. The rules' columns are
+// those of the source; summary rows aren't styled.
+func (m *MDTable) SetRules(r *CellRules) {
+	m.pipeline.rules = r
+}
+
+// setCellStyles sets the styles of the cells of the rows to be
+// transmogrified, by column; they are used if the table doesn't have rules.
+func (m *MDTable) setCellStyles(styles [][]cellStyle) {
+	m.styles = styles
+}
+
+// SetTotals sets the totals that add a footer row, and subtotal rows, to the
+// table. The totals' columns are those of the source. The summary rows use
+// the totals' emphasis, if it is set, and the column emphasis otherwise.
+func (m *MDTable) SetTotals(t *Totals) {
+	m.pipeline.totals = t
+}
+
+// setSummary sets which rows, of the rows to be transmogrified, are summary
+// rows, and their emphasis.
+func (m *MDTable) setSummary(summary []bool, emphasis []string) {
+	m.summary, m.summaryEmphasis = summary, emphasis
+}
+
 // Transmogrify transomgrifies the source into a MD table. The result is held
 // in md and can be obtained by m.MD().  Any error encountered is returned.
 // SetHasHeader needs to be called prior to calling this method.
@@ -133,55 +227,132 @@ func (m *MDTable) TransmogrifyStringTable(t [][]string) error {
 		//remove the first row
 		t = t[1:]
 	}
+	tbl := &pipelineTable{
+		header:          m.columnNames,
+		rows:            t,
+		alignment:       m.columnAlignment,
+		emphasis:        m.columnEmphasis,
+		summary:         m.summary,
+		summaryEmphasis: m.summaryEmphasis,
+		styles:          m.styles,
+	}
+	err := m.pipeline.apply(tbl, true)
+	if err != nil {
+		return err
+	}
+	m.columnNames, m.columnAlignment, m.columnEmphasis = tbl.header, tbl.alignment, tbl.emphasis
+	m.summary, m.summaryEmphasis, m.styles = tbl.summary, tbl.summaryEmphasis, tbl.styles
 	m.tableHeader()
 	// for each row of table data, process it.
-	for _, row := range t {
-		m.rowToMD(row)
+	for i, row := range tbl.rows {
+		if i < len(m.summary) && m.summary[i] {
+			m.encodeSummaryRow(row)
+			continue
+		}
+		var style []cellStyle
+		if i < len(m.styles) {
+			style = m.styles[i]
+		}
+		m.rowToMD(row, style)
 	}
 	return nil
 }
 
+// encodeSummaryRow appends the summary row to the md table, with the summary
+// emphasis, if it is set.
+func (m *MDTable) encodeSummaryRow(row []string) {
+	if m.summaryEmphasis == nil {
+		m.rowToMD(row, nil)
+		return
+	}
+	emphasis, useFormat := m.columnEmphasis, m.useFormat
+	m.columnEmphasis, m.useFormat = m.summaryEmphasis, true
+	m.rowToMD(row, nil)
+	m.columnEmphasis, m.useFormat = emphasis, useFormat
+}
+
 func (m *MDTable) tableHeader() {
+	// column emphasis doesn't apply to the column names, alignment is
+	// applied by the separator row.
 	useFormat := m.useFormat
 	m.useFormat = false
-	m.rowToMD(m.columnNames)
-	m.appendHeaderSeparatorRow()
+	m.rowToMD(m.columnNames, nil)
 	m.useFormat = useFormat
+	m.appendHeaderSeparatorRow()
 }
 
 // rowTomd takes a table row and returns the md version of it consistent
-// with its configuration.
-func (m *MDTable) rowToMD(cols []string) {
+// with its configuration. style is the styles of the row's cells; it is nil
+// for the header and summary rows.
+func (m *MDTable) rowToMD(cols []string, style []cellStyle) {
 	m.appendColumnSeparator()
 	for i, col := range cols {
-		var bcol []byte
-		// TODO this is where column data decoration would occur
-		// with templates
-		if m.useFormat {
-			switch m.columnEmphasis[i] {
-			case "bold", "b":
-				bcol = append(bcol, []byte{'_', '_'}...)
-			case "italic", "italics", "i":
-				bcol = append(bcol, []byte{'_'}...)
-			case "strikethrough", "s":
-				bcol = append(bcol, []byte{'~', '~'}...)
-			}
+		// an empty cell isn't emphasized, e.g. ____ isn't.
+		var e emphasis
+		if m.useFormat && i < len(m.columnEmphasis) && col != "" {
+			e = parseEmphasis(m.columnEmphasis[i])
 		}
-		bcol = append(append(bcol, []byte(col)...), bcol...)
-		m.md = append(m.md, bcol...)
+		var st cellStyle
+		if i < len(style) {
+			st = style[i]
+		}
+		m.md = append(m.md, st.render(col, e)...)
 		m.appendColumnSeparator()
 	}
 	// add a new line at the end of a row
 	m.md = append(m.md, []byte("  \n")...)
 }
 
+// EncodeHeader appends the column names and the header separator row to the
+// md table. The pipeline's rules, templates, and projection are applied to
+// the rows that are then encoded; the rest of it needs the whole table.
+func (m *MDTable) EncodeHeader() error {
+	m.sourceNames, m.rowIndex = m.columnNames, 0
+	tbl := &pipelineTable{
+		header:    m.columnNames,
+		alignment: m.columnAlignment,
+		emphasis:  m.columnEmphasis,
+		width:     len(m.columnNames),
+	}
+	err := m.pipeline.rowwise().apply(tbl, true)
+	if err != nil {
+		return err
+	}
+	m.columnNames, m.columnAlignment, m.columnEmphasis = tbl.header, tbl.alignment, tbl.emphasis
+	m.tableHeader()
+	return nil
+}
+
+// EncodeRow appends the row to the md table.
+func (m *MDTable) EncodeRow(row []string) error {
+	// without the rest of the table, the rules' column types are inferred
+	// from the row.
+	tbl := &pipelineTable{
+		header: m.sourceNames,
+		rows:   [][]string{row},
+		index:  m.rowIndex,
+		width:  len(m.sourceNames),
+	}
+	err := m.pipeline.rowwise().apply(tbl, true)
+	if err != nil {
+		return err
+	}
+	m.rowIndex++
+	var style []cellStyle
+	if len(tbl.styles) > 0 {
+		style = tbl.styles[0]
+	}
+	m.rowToMD(tbl.rows[0], style)
+	return nil
+}
+
 // appendHeaderSeparator adds the configured column  separator
 func (m *MDTable) appendHeaderSeparatorRow() {
 	m.appendColumnSeparator()
 	for i := 0; i < len(m.columnNames); i++ {
 		var separator []byte
 
-		if m.useFormat {
+		if m.useFormat && i < len(m.columnAlignment) {
 			switch m.columnAlignment[i] {
 			case "left", "l":
 				separator = mdLeftJustify
@@ -209,65 +380,84 @@ func (m *MDTable) appendColumnSeparator() {
 	m.md = append(m.md, mdPipe...)
 }
 
-// FormatFromFile loads the format file specified.
+// FormatFromFile loads the format file specified. Its directives are added
+// to the pipeline; those that are already set aren't replaced.
 func (m *MDTable) formatFromFile() error {
 	// if formatSource isn't set, nothing todo
 	if m.formatSource == "" {
 		return nil
 	}
 	// Read from the format file
-	fsource := NewCSV()
-	fsource.SetHasHeader(false)
-	err := fsource.ReadFile(m.formatSource)
+	f, err := readFormatFile(m.formatSource)
 	if err != nil {
 		return err
 	}
-	if len(fsource.rows) < 3 {
-		return fmt.Errorf("insufficient format rows: expected at least 3, got %d", len(fsource.rows))
-	}
-	//Row 0 is the header information
-	m.columnNames = append(m.columnNames, fsource.rows[0]...)
-	//Row 1 is the column alignment information
-	m.columnAlignment = append(m.columnAlignment, fsource.rows[1]...)
-	//Row 2 is the column emphasis information
-	m.columnEmphasis = append(m.columnEmphasis, fsource.rows[2]...)
-	return nil
+	m.columnNames = append(m.columnNames, f.columnNames...)
+	m.columnAlignment = append(m.columnAlignment, f.columnAlignment...)
+	m.columnEmphasis = append(m.columnEmphasis, f.columnEmphasis...)
+	m.pipeline, err = m.pipeline.withFormat(f)
+	return err
 }
 
 // SetDest sets the destination of the Write operation. If the destination is
-// an empty string, "", the source name will be concatinated with '.md'. Any
-// non-empty dest string will be used as the destination.
-//
-// Currently, only write to file is supported.
+// an empty string, "", the source name will be concatinated with '.md', or,
+// if the source is stdin, the destination is stdout. A source that isn't a
+// local file, e.g. a URL, doesn't have a default destination: writing returns
+// ErrNoDest. Any non-empty dest string will be used as the destination; it can
+// be a file path or any URI supported by NewResource.
 func (m *MDTable) SetDest(s string) {
+	dest := m.dest
 	m.dest = NewResource(s, FmtMDTable, File)
+	m.dest.copyConfig(dest)
 	if s != "" {
 		return
 	}
-	m.dest.SetPath(m.source.Path)
+	if m.source.Type == Stdio {
+		m.dest.Type = Stdio
+		m.dest.SetName("-")
+		return
+	}
+	if m.source.Type != File {
+		return
+	}
+	// the md table of an archive member goes next to the archive.
+	if m.source.Archive != "" {
+		m.dest.SetPath(NewResource(m.source.Archive, FmtUnsupported, File).Path)
+	} else {
+		m.dest.SetPath(m.source.Path)
+	}
 	m.dest.SetName(mdFilenameFrom(m.source.Name))
 }
 
-// TODO add support for writing to the received writer
-//
-//
+// WriteTo writes the md table to w.
+func (m *MDTable) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(m.md)
+	return int64(n), err
+}
+
+// SetCompression sets the compression used when writing the md table to the
+// destination. The destination's name isn't changed.
+func (m *MDTable) SetCompression(c Compression) {
+	m.compression = c
+}
 
-// Write saves the md table as a markdown file.
+// Write saves the md table to the destination.
 func (m *MDTable) WriteToFile() (name string, n int, err error) {
-	// Open the destination file and write.
-	f, err := os.OpenFile(m.dest.String(), os.O_CREATE|os.O_APPEND|os.O_RDWR|os.O_TRUNC, 0640)
-	if err != nil {
-		return m.dest.String(), 0, err
+	dest := m.dest
+	if m.compression != NoCompression {
+		dest.Compression = m.compression
 	}
-	defer f.Close()
-	n, err = f.Write(m.md)
+	n, err = writeResource(dest, m.md)
 	return m.dest.String(), n, err
 }
 
+// mdFilenameFrom returns the name with its extension, and any compression
+// extension, replaced by '.md'.
 func mdFilenameFrom(source string) string {
 	if source == "" {
 		return ""
 	}
+	_, source = compressionFromName(source)
 	parts := strings.Split(source, ".")
 	if len(parts) < 2 {
 		return fmt.Sprintf("%s.md", parts[0])
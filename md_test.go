@@ -1,6 +1,8 @@
 package transmogrifier
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -18,6 +20,9 @@ func TestSetSource(t *testing.T) {
 		{"test.csv", FmtCSV, ""},
 		{"test.MD", FmtMD, ""},
 		{"test.md", FmtMD, ""},
+		{"test.csv.gz", FmtCSV, ""},
+		{"path.d/test.csv.bz2", FmtCSV, ""},
+		{"test.gz", FmtUnsupported, "unable to determine format of \"test.gz\""},
 	}
 	md := NewMDTable()
 	for i, test := range tests {
@@ -271,6 +276,20 @@ func TestAppendHeaderSeparatorRow(t *testing.T) {
 	}
 }
 
+func TestTableHeader(t *testing.T) {
+	md := NewMDTable()
+	md.SetUseFormat(true)
+	md.SetColumnNames([]string{"name", "id", "price"})
+	md.SetColumnAlignment([]string{"l", "c", "r"})
+	md.SetColumnEmphasis([]string{"b", "", "i"})
+	md.tableHeader()
+	// the names aren't emphasized, the separator row is aligned.
+	expected := "|name|id|price|  \n|:---|:---:|---:|  \n"
+	if md.String() != expected {
+		t.Errorf("expected %q, got %q", expected, md.String())
+	}
+}
+
 func TestMDFilenameFrom(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -281,6 +300,8 @@ func TestMDFilenameFrom(t *testing.T) {
 		{"test.csv", "test.md"},
 		{"path/to/test.csv", "path/to/test.md"},
 		{"test.file.csv", "test.file.md"},
+		{"test.csv.gz", "test.md"},
+		{"test.csv.zst", "test.md"},
 	}
 	for i, test := range tests {
 		dest := mdFilenameFrom(test.name)
@@ -344,3 +365,27 @@ func TestFormatFromFile(t *testing.T) {
 		}
 	}
 }
+
+func TestFormatFromFileDirectives(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "items.fmt")
+	fmtFile := "name,qty,price\nleft,right,right\n,,\ncompute,total = qty * price\nfilter,qty > 0\nsort,total desc\ntotals,sum(total)\ncolumns,name,total\n"
+	err := os.WriteFile(name, []byte(fmtFile), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := NewMDTable()
+	md.SetFormatSource(name)
+	err = md.formatFromFile()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	err = md.TransmogrifyStringTable([][]string{{"a", "2", "1.5"}, {"b", "0", "9"}, {"c", "1", "10"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "|name|total|  \n|:---|---|  \n|c|10|  \n|a|3.0|  \n|Total|13.0|  \n"
+	if md.String() != expected {
+		t.Errorf("expected %q, got %q", expected, md.String())
+	}
+}
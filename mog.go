@@ -15,6 +15,7 @@ package transmogrifier
 
 import (
 	"errors"
+	"net/url"
 	"path"
 	"path/filepath"
 	"strings"
@@ -30,11 +31,17 @@ const (
 	FmtCSV
 	FmtMD
 	FmtMDTable
+	FmtFixedWidth
+	FmtSQL
 )
 
 const (
 	UnsupportedResource ResourceType = iota
 	File
+	Stdio
+	HTTP
+	Data
+	S3
 )
 
 // FormatType is the format of a resource
@@ -47,6 +54,8 @@ var formatTypes = [...]string{
 	"csv",
 	"md",
 	"mdtable",
+	"fixed",
+	"sql",
 }
 
 func FormatTypeFromString(s string) FormatType {
@@ -58,6 +67,10 @@ func FormatTypeFromString(s string) FormatType {
 		return FmtMD
 	case "mdtable":
 		return FmtMDTable
+	case "fixed", "fwf":
+		return FmtFixedWidth
+	case "sql":
+		return FmtSQL
 	}
 	return FmtUnsupported
 }
@@ -70,6 +83,10 @@ func (r ResourceType) String() string { return resourceTypes[r] }
 var resourceTypes = [...]string{
 	"unsupported",
 	"file",
+	"stdio",
+	"http",
+	"data",
+	"s3",
 }
 
 // ResourceTypeFromString returns the ResourceType constant
@@ -78,6 +95,14 @@ func ResourceTypeFromString(s string) ResourceType {
 	switch s {
 	case "file":
 		return File
+	case "stdio", "stdin", "stdout", "-":
+		return Stdio
+	case "http", "https":
+		return HTTP
+	case "data":
+		return Data
+	case "s3":
+		return S3
 	}
 	return UnsupportedResource
 }
@@ -85,39 +110,152 @@ func ResourceTypeFromString(s string) ResourceType {
 // Common errors
 var (
 	ErrNoSource = errors.New("no source was specified")
+	ErrNoDest   = errors.New("no destination was specified")
 )
 
-// Currently only supporting local file.
-// TODO enable uri support
+// resource is a source or a sink: a local file, stdin/stdout, a http(s) URL,
+// a data URI, or an object in an S3-compatible bucket.
 type resource struct {
 	Name   string       // Name of the resource
 	Path   string       // Path of the resource
 	Host   string       // Host of the resource
+	URI    string       // URI of the resource, for non-file resources
 	Format FormatType   // Format of the resource
 	Type   ResourceType // Type of the resource
+	// Compression is the compression of the resource; it is set from the
+	// name's extension, e.g. '.gz'.
+	Compression Compression
+	// Archive is the zip or tar archive that the resource is a member of,
+	// if any. Name and Path are the member's name and path within it.
+	Archive string
+	// http is the configuration for HTTP resources; if it is nil, the
+	// defaults are used.
+	http *HTTPConfig
+	// s3 is the configuration for S3 resources; if it is nil, the
+	// configuration comes from the environment.
+	s3 *S3Config
+	// write is how local files are written; if it is nil, the defaults
+	// are used.
+	write *WriteOptions
+	// region is the named region of a Markdown sink that output is
+	// injected into; if it is empty, the unnamed region, if any, is used.
+	region string
 }
 
+// NewResource returns a resource for s. URIs are parsed into their
+// ResourceType, which takes precedence over t:
+//
+//	-                      Stdio: stdin for sources, stdout for sinks
+//	file://path/to/file    File
+//	http(s)://host/path    HTTP
+//	data:[<media type>][;base64],<data>  Data
+//	s3://bucket/key        S3
+//
+// A member of a zip or tar archive is referred to by the archive, followed
+// by '!', and the member's path, e.g. bundle.zip!/reports/q3.csv. The archive
+// can be any of the above. Anything else is a path of type t.
 func NewResource(s string, f FormatType, t ResourceType) resource {
 	if s == "" {
 		return resource{Format: f, Type: t}
 	}
+	if s == "-" {
+		return resource{Name: s, Format: f, Type: Stdio}
+	}
+	if archive, member, ok := splitArchivePath(s); ok {
+		ar := NewResource(archive, FmtUnsupported, t)
+		dir := path.Dir(member)
+		if dir == "." {
+			dir = ""
+		}
+		c, _ := compressionFromName(member)
+		return resource{Name: path.Base(member), Path: dir, Host: ar.Host, Format: f, Type: ar.Type, Compression: c, Archive: archive}
+	}
+	switch uriScheme(s) {
+	case "file":
+		u, err := url.Parse(s)
+		if err == nil {
+			// file://relative/path puts the first element in Host.
+			s = u.Path
+			if u.Host != "" && u.Host != "localhost" {
+				s = u.Host + u.Path
+			}
+			t = File
+		}
+	case "http", "https":
+		u, err := url.Parse(s)
+		if err == nil {
+			dir := path.Dir(u.Path)
+			if dir == "." || dir == "/" {
+				dir = ""
+			}
+			c, _ := compressionFromName(u.Path)
+			return resource{Name: path.Base(u.Path), Path: dir, Host: u.Host, URI: s, Format: f, Type: HTTP, Compression: c}
+		}
+	case "data":
+		return resource{URI: s, Format: f, Type: Data}
+	case "s3":
+		u, err := url.Parse(s)
+		if err == nil {
+			dir := path.Dir(u.Path)
+			if dir == "." || dir == "/" {
+				dir = ""
+			}
+			c, _ := compressionFromName(u.Path)
+			return resource{Name: path.Base(u.Path), Path: dir, Host: u.Host, URI: s, Format: f, Type: S3, Compression: c}
+		}
+	}
 	dir := path.Dir(s)
 	// if the path didn't contain a directory, make dir an empty string
 	if dir == "." {
 		dir = ""
 	}
-	return resource{Name: path.Base(s), Path: dir, Format: f, Type: t}
+	c, _ := compressionFromName(s)
+	return resource{Name: path.Base(s), Path: dir, Format: f, Type: t, Compression: c}
 }
 
 // String() returns the resource as a string. The value depends on the format
 // and type.
 func (r resource) String() string {
+	if r.Archive != "" {
+		return r.Archive + "!/" + path.Join(r.Path, r.Name)
+	}
+	switch r.Type {
+	case HTTP, Data, S3:
+		return r.URI
+	case Stdio:
+		return "-"
+	}
 	if r.Path == "" {
 		return r.Name
 	}
 	return filepath.Join(r.Path, r.Name)
 }
 
+// copyConfig copies the HTTP, S3, and write configuration of from.
+func (r *resource) copyConfig(from resource) {
+	r.http = from.http
+	r.s3 = from.s3
+	r.write = from.write
+}
+
+// uriScheme returns the lowercased scheme of s, if it has one. Single letter
+// schemes are assumed to be Windows drive letters.
+func uriScheme(s string) string {
+	i := strings.Index(s, ":")
+	if i < 2 {
+		return ""
+	}
+	for j, c := range s[:i] {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case j > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return ""
+		}
+	}
+	return strings.ToLower(s[:i])
+}
+
 // SetName sets the resource name.
 func (r *resource) SetName(s string) {
 	r.Name = s
@@ -13,6 +13,16 @@ func TestNewResource(t *testing.T) {
 		{"test.txt", FmtUnsupported, File, resource{Name: "test.txt", Format: FmtUnsupported, Type: File}},
 		{"path/test.csv", FmtCSV, File, resource{Name: "test.csv", Path: "path", Format: FmtCSV, Type: File}},
 		{"another/path/test", FmtMDTable, File, resource{Name: "test", Path: "another/path", Format: FmtMDTable, Type: File}},
+		{"-", FmtCSV, File, resource{Name: "-", Format: FmtCSV, Type: Stdio}},
+		{"file:///abs/path/test.csv", FmtCSV, UnsupportedResource, resource{Name: "test.csv", Path: "/abs/path", Format: FmtCSV, Type: File}},
+		{"file://path/test.csv", FmtCSV, File, resource{Name: "test.csv", Path: "path", Format: FmtCSV, Type: File}},
+		{"https://example.com:8080/path/test.csv?x=1", FmtCSV, File, resource{Name: "test.csv", Path: "/path", Host: "example.com:8080", URI: "https://example.com:8080/path/test.csv?x=1", Format: FmtCSV, Type: HTTP}},
+		{"http://example.com/test.csv", FmtCSV, File, resource{Name: "test.csv", Host: "example.com", URI: "http://example.com/test.csv", Format: FmtCSV, Type: HTTP}},
+		{"data:text/csv,a%2Cb", FmtCSV, File, resource{URI: "data:text/csv,a%2Cb", Format: FmtCSV, Type: Data}},
+		{"C:/path/test.csv", FmtCSV, File, resource{Name: "test.csv", Path: "C:/path", Format: FmtCSV, Type: File}},
+		{"path/bundle.zip!/reports/q3.csv.gz", FmtCSV, File, resource{Name: "q3.csv.gz", Path: "reports", Format: FmtCSV, Type: File, Compression: Gzip, Archive: "path/bundle.zip"}},
+		{"https://example.com/bundle.tar.gz!/q3.csv", FmtCSV, File, resource{Name: "q3.csv", Host: "example.com", Format: FmtCSV, Type: HTTP, Archive: "https://example.com/bundle.tar.gz"}},
+		{"not-an-archive.csv!/q3.csv", FmtCSV, File, resource{Name: "q3.csv", Path: "not-an-archive.csv!", Format: FmtCSV, Type: File}},
 	}
 	for i, test := range tests {
 		r := NewResource(test.path, test.format, test.typ)
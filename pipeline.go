@@ -0,0 +1,196 @@
+package transmogrifier
+
+// pipeline is what is applied to a table before it is encoded. In order, the
+// computed columns are added, the reshape reshapes the table, the filter
+// selects the rows, the sort orders them, the grouping groups them, the
+// totals add summary rows, the rules style the cells and the templates render
+// them, for md tables, and then the projection selects the columns. Any of
+// them can be nil.
+type pipeline struct {
+	computed   *Computed
+	reshape    Reshape
+	filter     *Filter
+	sort       *Sort
+	grouping   *Grouping
+	totals     *Totals
+	rules      *CellRules
+	templates  *Templates
+	projection *Projection
+}
+
+// pipelineTable is a table, with its column formatting, that a pipeline is
+// applied to.
+type pipelineTable struct {
+	header    []string
+	rows      [][]string
+	alignment []string
+	emphasis  []string
+	// summary is whether each row is a summary row; summaryEmphasis, if
+	// set, is their emphasis.
+	summary         []bool
+	summaryEmphasis []string
+	// styles are the styles of the cells of each row.
+	styles [][]cellStyle
+	// index is the index, in the table's data rows, of the first data row
+	// of rows; it is used by the templates.
+	index int
+	// width, if set, is the number of the table's columns that the
+	// projection selects from; otherwise, it is that of the widest row, or,
+	// without rows, of the header.
+	width int
+}
+
+// withFormat returns the pipeline with the format file's directives for
+// those that aren't set. The format's computed columns are added before p's,
+// and p's templates replace the format's for the same columns.
+func (p pipeline) withFormat(fm *format) (pipeline, error) {
+	fc, err := fm.computed()
+	if err != nil {
+		return p, err
+	}
+	p.computed = fc.merge(p.computed)
+	ft, err := fm.templates()
+	if err != nil {
+		return p, err
+	}
+	p.templates = ft.merge(p.templates)
+	if p.projection == nil {
+		p.projection, err = fm.projection()
+		if err != nil {
+			return p, err
+		}
+	}
+	if p.filter == nil {
+		p.filter, err = fm.filter()
+		if err != nil {
+			return p, err
+		}
+	}
+	if p.sort == nil {
+		p.sort, err = fm.sort()
+		if err != nil {
+			return p, err
+		}
+	}
+	if p.grouping == nil {
+		p.grouping, err = fm.grouping()
+		if err != nil {
+			return p, err
+		}
+	}
+	if p.totals == nil {
+		p.totals, err = fm.totals()
+		if err != nil {
+			return p, err
+		}
+	}
+	if p.rules == nil {
+		p.rules, err = fm.rules()
+		if err != nil {
+			return p, err
+		}
+	}
+	if p.reshape == nil {
+		p.reshape, err = fm.reshape()
+	}
+	return p, err
+}
+
+// rowwise returns the part of the pipeline that can be applied to a row
+// without the rest of the table: the rules, the templates, and the
+// projection.
+func (p pipeline) rowwise() pipeline {
+	return pipeline{rules: p.rules, templates: p.templates, projection: p.projection}
+}
+
+// apply applies the pipeline to t. The rules and templates, which render md,
+// are only applied if md is set.
+func (p pipeline) apply(t *pipelineTable, md bool) error {
+	var err error
+	if p.computed != nil {
+		t.header, t.rows, err = p.computed.Apply(t.header, t.rows)
+		if err != nil {
+			return err
+		}
+	}
+	if p.reshape != nil {
+		var cols []int
+		t.header, t.rows, cols, err = p.reshape.reshape(t.header, t.rows)
+		if err != nil {
+			return err
+		}
+		t.alignment, t.emphasis = projectSlice(t.alignment, cols), projectSlice(t.emphasis, cols)
+	}
+	if p.filter != nil {
+		t.rows, err = p.filter.Apply(t.header, t.rows)
+		if err != nil {
+			return err
+		}
+	}
+	if p.sort != nil {
+		t.rows, err = p.sort.Apply(t.header, t.rows)
+		if err != nil {
+			return err
+		}
+	}
+	if p.grouping != nil {
+		var cols []int
+		t.header, t.rows, cols, err = p.grouping.apply(t.header, t.rows)
+		if err != nil {
+			return err
+		}
+		// the aggregates have the alignment and emphasis of the columns
+		// they aggregate.
+		t.alignment, t.emphasis = projectSlice(t.alignment, cols), projectSlice(t.emphasis, cols)
+	}
+	if p.totals != nil {
+		t.rows, t.summary, err = p.totals.apply(t.header, t.rows)
+		if err != nil {
+			return err
+		}
+		t.summaryEmphasis = p.totals.Emphasis
+	}
+	// the rules and templates, which render md, can use every column, so
+	// they are applied before the projection; the rules' conditions use
+	// the values before the templates render them.
+	if p.rules != nil && md {
+		t.styles, err = p.rules.styles(t.header, t.rows, t.summary)
+		if err != nil {
+			return err
+		}
+	}
+	if p.templates != nil && md {
+		t.rows, err = p.templates.apply(t.header, t.rows, t.summary, t.index)
+		if err != nil {
+			return err
+		}
+	}
+	if p.projection == nil {
+		return nil
+	}
+	n := t.width
+	if n == 0 {
+		n = tableWidth(t.rows)
+		if len(t.rows) == 0 {
+			n = len(t.header)
+		}
+	}
+	cols, names, err := p.projection.columns(t.header, n)
+	if err != nil {
+		return err
+	}
+	if len(t.header) > 0 || p.projection.renames() {
+		t.header = names
+	}
+	projected := make([][]string, len(t.rows))
+	for i, row := range t.rows {
+		projected[i] = projectRow(row, cols)
+	}
+	t.rows = projected
+	t.alignment, t.emphasis = projectSlice(t.alignment, cols), projectSlice(t.emphasis, cols)
+	t.summaryEmphasis = projectSlice(t.summaryEmphasis, cols)
+	for i := range t.styles {
+		t.styles[i] = projectStyles(t.styles[i], cols)
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+package transmogrifier
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Projection selects, reorders, and renames the columns of a table. It is a
+// list of columns, in their output order; a column is referenced by its name
+// or, with '#', its position, from 1; negative positions count from the last
+// column, e.g. '#-1' is the last column. Names with commas, colons, or
+// leading '#' or '!' can be quoted, e.g. '"Price, USD"'.
+//
+//	Item                a column
+//	#3                  the third column
+//	Price as Cost       a column, renamed
+//	Item:Price          the columns from Item to Price
+//	#2:                 the second column, and every column after it
+//	!Notes              every column but Notes; negations can be ranges
+//
+// Negated columns are removed from the selected columns; if only negations
+// are listed, every column but those is selected.
+type Projection struct {
+	items []projectionItem
+}
+
+// columnRef is a reference to a column: by name, or, if index isn't 0, by
+// position.
+type columnRef struct {
+	name  string
+	index int
+}
+
+// projectionItem is an item of a projection: a column, or a range of
+// columns.
+type projectionItem struct {
+	from columnRef
+	// to is the end of a range, unless it's open.
+	to      *columnRef
+	isRange bool
+	// openFrom and openTo: whether the range starts at the first column,
+	// and ends at the last.
+	openFrom, openTo bool
+	negate           bool
+	rename           string
+}
+
+// ParseProjection parses a projection: a comma separated list of columns,
+// e.g. 'Item, Price as Cost, #5:, !Notes'.
+func ParseProjection(s string) (*Projection, error) {
+	items, err := splitUnquoted(s)
+	if err != nil {
+		return nil, fmt.Errorf("projection %q: %s", s, err)
+	}
+	return parseProjectionItems(items)
+}
+
+// splitUnquoted splits s on the commas that aren't quoted.
+func splitUnquoted(s string) ([]string, error) {
+	var items []string
+	var quoted bool
+	var start int
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				items = append(items, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	return append(items, s[start:]), nil
+}
+
+// parseProjectionItems parses the items of a projection, e.g. the values of
+// a format file's 'columns' directive. Empty items are ignored.
+func parseProjectionItems(items []string) (*Projection, error) {
+	p := &Projection{}
+	for _, s := range items {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		item, err := parseProjectionItem(s)
+		if err != nil {
+			return nil, fmt.Errorf("projection column %q: %s", s, err)
+		}
+		p.items = append(p.items, item)
+	}
+	if len(p.items) == 0 {
+		return nil, fmt.Errorf("projection: no columns")
+	}
+	return p, nil
+}
+
+// parseProjectionItem parses a column, or a range of columns, with its
+// negation and rename.
+func parseProjectionItem(s string) (projectionItem, error) {
+	var item projectionItem
+	if strings.HasPrefix(s, "!") {
+		item.negate = true
+		s = strings.TrimSpace(s[1:])
+	}
+	if i := indexUnquoted(s, " as "); i >= 0 {
+		item.rename = unquoteColumn(strings.TrimSpace(s[i+4:]))
+		s = strings.TrimSpace(s[:i])
+		if item.rename == "" {
+			return item, fmt.Errorf("no new name")
+		}
+		if item.negate {
+			return item, fmt.Errorf("negated columns can't be renamed")
+		}
+	}
+	if i := indexUnquoted(s, ":"); i >= 0 {
+		if item.rename != "" {
+			return item, fmt.Errorf("ranges can't be renamed")
+		}
+		item.isRange = true
+		from, to := strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+		item.openFrom, item.openTo = from == "", to == ""
+		var err error
+		if !item.openFrom {
+			item.from, err = parseColumnRef(from)
+			if err != nil {
+				return item, err
+			}
+		}
+		if !item.openTo {
+			ref, err := parseColumnRef(to)
+			if err != nil {
+				return item, err
+			}
+			item.to = &ref
+		}
+		return item, nil
+	}
+	if s == "" {
+		return item, fmt.Errorf("no column")
+	}
+	var err error
+	item.from, err = parseColumnRef(s)
+	return item, err
+}
+
+// indexUnquoted returns the index of the first sep in s that isn't quoted,
+// or -1.
+func indexUnquoted(s, sep string) int {
+	var quoted bool
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' {
+			quoted = !quoted
+			continue
+		}
+		if !quoted && strings.HasPrefix(s[i:], sep) {
+			return i
+		}
+	}
+	return -1
+}
+
+// unquoteColumn returns the name without its quotes, if it's quoted.
+func unquoteColumn(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// parseColumnRef parses a column name, or a '#' position.
+func parseColumnRef(s string) (columnRef, error) {
+	if strings.HasPrefix(s, "#") {
+		i, err := strconv.Atoi(s[1:])
+		if err != nil || i == 0 {
+			return columnRef{}, fmt.Errorf("invalid column position: %q", s)
+		}
+		return columnRef{index: i}, nil
+	}
+	return columnRef{name: unquoteColumn(s)}, nil
+}
+
+// resolve returns the column, from 0, that the reference is to, in a table
+// with the column names and n columns.
+func (c columnRef) resolve(names []string, n int) (int, error) {
+	if c.index == 0 {
+		for i, name := range names {
+			if name == c.name {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("unknown column %q", c.name)
+	}
+	i := c.index - 1
+	if c.index < 0 {
+		i = n + c.index
+	}
+	if i < 0 || i >= n {
+		return 0, fmt.Errorf("column #%d is out of range: the table has %d columns", c.index, n)
+	}
+	return i, nil
+}
+
+// columns resolves the projection for a table with the column names and n
+// columns. It returns, for each output column, the column of the table that
+// it is, and its name.
+func (p *Projection) columns(names []string, n int) (cols []int, outNames []string, err error) {
+	if len(names) > n {
+		n = len(names)
+	}
+	var selected []int
+	var renames []string
+	negated := map[int]bool{}
+	var positive bool
+	for _, item := range p.items {
+		first, last := 0, n-1
+		if !item.isRange || !item.openFrom {
+			first, err = item.from.resolve(names, n)
+			if err != nil {
+				return nil, nil, err
+			}
+			last = first
+		}
+		if item.isRange && !item.openTo {
+			last, err = item.to.resolve(names, n)
+			if err != nil {
+				return nil, nil, err
+			}
+		} else if item.isRange {
+			last = n - 1
+		}
+		if last < first {
+			return nil, nil, fmt.Errorf("column range %d:%d is reversed", first+1, last+1)
+		}
+		for i := first; i <= last; i++ {
+			if item.negate {
+				negated[i] = true
+				continue
+			}
+			positive = true
+			selected = append(selected, i)
+			renames = append(renames, item.rename)
+		}
+	}
+	if !positive {
+		for i := 0; i < n; i++ {
+			selected = append(selected, i)
+			renames = append(renames, "")
+		}
+	}
+	for j, i := range selected {
+		if negated[i] {
+			continue
+		}
+		cols = append(cols, i)
+		name := renames[j]
+		if name == "" && i < len(names) {
+			name = names[i]
+		}
+		outNames = append(outNames, name)
+	}
+	return cols, outNames, nil
+}
+
+// Apply applies the projection to the table's header and rows. The header
+// can be empty if the columns are referenced by position. Rows that are
+// shorter than the table have empty values for their missing columns.
+func (p *Projection) Apply(header []string, rows [][]string) ([]string, [][]string, error) {
+	cols, names, err := p.columns(header, tableWidth(rows))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(header) == 0 && !p.renames() {
+		names = nil
+	}
+	out := make([][]string, len(rows))
+	for i, row := range rows {
+		out[i] = projectRow(row, cols)
+	}
+	return names, out, nil
+}
+
+// renames returns whether the projection renames any columns.
+func (p *Projection) renames() bool {
+	for _, item := range p.items {
+		if item.rename != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// projectSlice returns the values of s, e.g. the alignment of each column,
+// for the columns; missing values are empty.
+func projectSlice(s []string, cols []int) []string {
+	if len(s) == 0 {
+		return s
+	}
+	return projectRow(s, cols)
+}
+
+// tableWidth returns the number of columns of the widest row.
+func tableWidth(rows [][]string) int {
+	var n int
+	for _, row := range rows {
+		if len(row) > n {
+			n = len(row)
+		}
+	}
+	return n
+}
+
+// projectRow returns the row's values for the columns; missing values, and
+// those of negative columns, are empty.
+func projectRow(row []string, cols []int) []string {
+	out := make([]string, len(cols))
+	for i, c := range cols {
+		if c >= 0 && c < len(row) {
+			out[i] = row[c]
+		}
+	}
+	return out
+}
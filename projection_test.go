@@ -0,0 +1,84 @@
+package transmogrifier
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProjectionApply(t *testing.T) {
+	header := []string{"Item", "Id", "Description", "Price", "Notes"}
+	rows := [][]string{
+		[]string{"towel", "42", "essential", "$42.00", "bring one"},
+		[]string{"string", "7"},
+	}
+	tests := []struct {
+		spec           string
+		header         []string
+		expectedHeader []string
+		expectedRows   [][]string
+		expectedErr    string
+	}{
+		{"Item, Price", header, []string{"Item", "Price"}, [][]string{{"towel", "$42.00"}, {"string", ""}}, ""},
+		{"Price as Cost, Item", header, []string{"Cost", "Item"}, [][]string{{"$42.00", "towel"}, {"", "string"}}, ""},
+		{"#2, #-1", header, []string{"Id", "Notes"}, [][]string{{"42", "bring one"}, {"7", ""}}, ""},
+		{"Id:Price", header, []string{"Id", "Description", "Price"}, [][]string{{"42", "essential", "$42.00"}, {"7", "", ""}}, ""},
+		{"#4:, :Id", header, []string{"Price", "Notes", "Item", "Id"}, [][]string{{"$42.00", "bring one", "towel", "42"}, {"", "", "string", "7"}}, ""},
+		{"!Notes, !Id:Description", header, []string{"Item", "Price"}, [][]string{{"towel", "$42.00"}, {"string", ""}}, ""},
+		{":, !#1", header, []string{"Id", "Description", "Price", "Notes"}, [][]string{{"42", "essential", "$42.00", "bring one"}, {"7", "", "", ""}}, ""},
+		{`"Price, USD" as "Cost: USD"`, []string{"Item", "Price, USD"}, []string{"Cost: USD"}, [][]string{{"42"}, {"7"}}, ""},
+		{"#2, #1", nil, nil, [][]string{{"42", "towel"}, {"7", "string"}}, ""},
+		{"#1 as Name", nil, []string{"Name"}, [][]string{{"towel"}, {"string"}}, ""},
+		{"Cost", header, nil, nil, `unknown column "Cost"`},
+		{"#6", header, nil, nil, "column #6 is out of range: the table has 5 columns"},
+		{"Price:Item", header, nil, nil, "column range 4:1 is reversed"},
+		{"#0", header, nil, nil, `projection column "#0": invalid column position: "#0"`},
+		{"Item:Price as Things", header, nil, nil, `projection column "Item:Price as Things": ranges can't be renamed`},
+		{"!Notes as N", header, nil, nil, `projection column "!Notes as N": negated columns can't be renamed`},
+		{`Item as ""`, header, nil, nil, `projection column "Item as \"\"": no new name`},
+		{" , ", header, nil, nil, "projection: no columns"},
+		{`"Item`, header, nil, nil, `projection "\"Item": unterminated quote`},
+	}
+	for i, test := range tests {
+		p, err := ParseProjection(test.spec)
+		if err == nil {
+			var h []string
+			var r [][]string
+			h, r, err = p.Apply(test.header, rows[:len(test.expectedRows)])
+			if err == nil {
+				if !reflect.DeepEqual(h, test.expectedHeader) {
+					t.Errorf("%d: expected header %q, got %q", i, test.expectedHeader, h)
+				}
+				if !reflect.DeepEqual(r, test.expectedRows) {
+					t.Errorf("%d: expected rows %q, got %q", i, test.expectedRows, r)
+				}
+			}
+		}
+		if err != nil && err.Error() != test.expectedErr {
+			t.Errorf("%d: expected error %q, got %q", i, test.expectedErr, err)
+		}
+		if err == nil && test.expectedErr != "" {
+			t.Errorf("%d: expected error %q, got none", i, test.expectedErr)
+		}
+	}
+}
+
+func TestMDTableProjection(t *testing.T) {
+	p, err := ParseProjection("Price as Cost, Item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := NewMDTable()
+	md.SetHasColumnNames(true)
+	md.SetUseFormat(true)
+	md.SetColumnAlignment([]string{"left", "", "right"})
+	md.SetColumnEmphasis([]string{"bold", "", "italic"})
+	md.SetProjection(p)
+	err = md.TransmogrifyStringTable([][]string{{"Item", "Id", "Price"}, {"towel", "42", "$42.00"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	expected := "|Cost|Item|  \n|---:|:---|  \n|_$42.00_|__towel__|  \n"
+	if md.String() != expected {
+		t.Errorf("expected %q, got %q", expected, md.String())
+	}
+}
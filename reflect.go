@@ -0,0 +1,367 @@
+package transmogrifier
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// mogTag is the struct tag that configures how a field is rendered. The first
+// value is the column name, the rest are key=value options:
+//
+//	Price float64 `mog:"Price,align=right,emphasis=bold"`
+//	Added time.Time `mog:"Added,layout=2006-01-02"`
+//
+// The layout is the time layout used for time.Time fields; because options
+// are comma separated, layouts can't contain commas.
+// A name of "-" skips the field. If the name is empty, the field name is used.
+const mogTag = "mog"
+
+// valueTable is the string table, and its column formatting, that was
+// derived from Go values.
+type valueTable struct {
+	columnNames     []string
+	columnAlignment []string
+	columnEmphasis  []string
+	rows            [][]string
+}
+
+// valueColumn is a column derived from a struct field.
+type valueColumn struct {
+	index     []int
+	name      string
+	alignment string
+	emphasis  string
+	layout    string
+}
+
+// ValuesToStringTable returns the values in v as a string table whose first
+// row is the column names. See MDTable.TransmogrifyValues for what v can be.
+func ValuesToStringTable(v interface{}) ([][]string, error) {
+	vt, err := newValueTable(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([][]string{vt.columnNames}, vt.rows...), nil
+}
+
+// TransmogrifyValues transmogrifies v into a MD table. v can be:
+//
+//	a slice or array of structs or pointers to structs
+//	a slice or array of maps with string keys
+//	a channel of either of the above element types; it is read until closed
+//	an iterator func, func(yield func(T) bool), of either element type
+//
+// For structs, each exported field is a column; the mog struct tag sets the
+// column name, alignment, and emphasis. For maps, the sorted keys are the
+// columns. Values are formatted with their String method, if they implement
+// fmt.Stringer, or MarshalText, if they implement encoding.TextMarshaler;
+// otherwise they are formatted with fmt.Sprint. Nil values are empty.
+func (m *MDTable) TransmogrifyValues(v interface{}) error {
+	vt, err := newValueTable(v)
+	if err != nil {
+		return err
+	}
+	m.SetColumnNames(vt.columnNames)
+	m.SetColumnAlignment(vt.columnAlignment)
+	m.SetColumnEmphasis(vt.columnEmphasis)
+	m.useFormat = true
+	m.hasColumnNames = false
+	return m.TransmogrifyStringTable(vt.rows)
+}
+
+// newValueTable builds a valueTable from v.
+func newValueTable(v interface{}) (*valueTable, error) {
+	elemType, elems, err := collectValues(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	// for interface element types, use the type of the first element.
+	if elemType.Kind() == reflect.Interface {
+		for _, e := range elems {
+			if e = indirectValue(e); e.IsValid() {
+				elemType = e.Type()
+				break
+			}
+		}
+	}
+	for elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	// the elements of an interface type can be of different types.
+	for i, e := range elems {
+		if e = indirectValue(e); e.IsValid() && e.Type() != elemType {
+			return nil, fmt.Errorf("unable to transmogrify values: element %d is a %s, not a %s", i, e.Type(), elemType)
+		}
+	}
+	switch elemType.Kind() {
+	case reflect.Struct:
+		return structTable(elemType, elems)
+	case reflect.Map:
+		if elemType.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unable to transmogrify values: map keys must be strings, got %s", elemType.Key())
+		}
+		return mapTable(elems), nil
+	case reflect.Interface:
+		// every element was nil
+		return &valueTable{rows: [][]string{}}, nil
+	}
+	return nil, fmt.Errorf("unable to transmogrify values: unsupported element type %s", elemType)
+}
+
+// collectValues returns the element type of v and its elements.
+func collectValues(v reflect.Value) (reflect.Type, []reflect.Value, error) {
+	if !v.IsValid() {
+		return nil, nil, fmt.Errorf("unable to transmogrify values: received nil")
+	}
+	var elems []reflect.Value
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			elems = append(elems, v.Index(i))
+		}
+		return v.Type().Elem(), elems, nil
+	case reflect.Chan:
+		for {
+			e, ok := v.Recv()
+			if !ok {
+				return v.Type().Elem(), elems, nil
+			}
+			elems = append(elems, e)
+		}
+	case reflect.Func:
+		// func(yield func(T) bool)
+		t := v.Type()
+		if t.NumIn() != 1 || t.NumOut() != 0 || t.In(0).Kind() != reflect.Func {
+			break
+		}
+		yield := t.In(0)
+		if yield.NumIn() != 1 || yield.NumOut() != 1 || yield.Out(0).Kind() != reflect.Bool {
+			break
+		}
+		fn := reflect.MakeFunc(yield, func(args []reflect.Value) []reflect.Value {
+			elems = append(elems, args[0])
+			return []reflect.Value{reflect.ValueOf(true)}
+		})
+		v.Call([]reflect.Value{fn})
+		return yield.In(0), elems, nil
+	}
+	return nil, nil, fmt.Errorf("unable to transmogrify values: unsupported type %s", v.Type())
+}
+
+// structTable builds a valueTable from struct elements.
+func structTable(t reflect.Type, elems []reflect.Value) (*valueTable, error) {
+	cols, err := structColumns(t, nil)
+	if err != nil {
+		return nil, err
+	}
+	vt := &valueTable{
+		columnNames:     make([]string, len(cols)),
+		columnAlignment: make([]string, len(cols)),
+		columnEmphasis:  make([]string, len(cols)),
+		rows:            make([][]string, 0, len(elems)),
+	}
+	for i, col := range cols {
+		vt.columnNames[i] = col.name
+		vt.columnAlignment[i] = col.alignment
+		vt.columnEmphasis[i] = col.emphasis
+	}
+	for _, e := range elems {
+		e = indirectValue(e)
+		row := make([]string, len(cols))
+		if e.IsValid() {
+			for i, col := range cols {
+				f, ok := fieldByIndex(e, col.index)
+				if ok {
+					row[i] = formatField(f, col.layout)
+				}
+			}
+		}
+		vt.rows = append(vt.rows, row)
+	}
+	return vt, nil
+}
+
+// structColumns returns the columns for the exported fields of t. Embedded
+// structs without a mog tag have their fields promoted.
+func structColumns(t reflect.Type, index []int) ([]valueColumn, error) {
+	var cols []valueColumn
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, hasTag := f.Tag.Lookup(mogTag)
+		if tag == "-" {
+			continue
+		}
+		idx := append(append([]int{}, index...), i)
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && !hasTag && ft.Kind() == reflect.Struct {
+			embedded, err := structColumns(ft, idx)
+			if err != nil {
+				return nil, err
+			}
+			cols = append(cols, embedded...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		col, err := parseMogTag(tag)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %s", f.Name, err)
+		}
+		if col.name == "" {
+			col.name = f.Name
+		}
+		col.index = idx
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
+// parseMogTag parses a mog struct tag.
+func parseMogTag(tag string) (valueColumn, error) {
+	var col valueColumn
+	parts := strings.Split(tag, ",")
+	col.name = strings.TrimSpace(parts[0])
+	for _, opt := range parts[1:] {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			return col, fmt.Errorf("invalid mog tag option %q", opt)
+		}
+		switch strings.TrimSpace(kv[0]) {
+		case "align", "alignment":
+			col.alignment = strings.TrimSpace(kv[1])
+		case "emphasis":
+			col.emphasis = strings.TrimSpace(kv[1])
+		case "layout":
+			col.layout = kv[1]
+		default:
+			return col, fmt.Errorf("unknown mog tag option %q", kv[0])
+		}
+	}
+	return col, nil
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex without the panic on nil
+// embedded pointers; false is returned when one is encountered.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 {
+			v = indirectValue(v)
+			if !v.IsValid() {
+				return v, false
+			}
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// mapTable builds a valueTable from map elements. The columns are the sorted
+// union of the keys of every map.
+func mapTable(elems []reflect.Value) *valueTable {
+	keys := map[string]bool{}
+	for i, e := range elems {
+		e = indirectValue(e)
+		elems[i] = e
+		if !e.IsValid() {
+			continue
+		}
+		for _, k := range e.MapKeys() {
+			keys[k.String()] = true
+		}
+	}
+	vt := &valueTable{rows: make([][]string, 0, len(elems))}
+	for k := range keys {
+		vt.columnNames = append(vt.columnNames, k)
+	}
+	sort.Strings(vt.columnNames)
+	vt.columnAlignment = make([]string, len(vt.columnNames))
+	vt.columnEmphasis = make([]string, len(vt.columnNames))
+	for _, e := range elems {
+		row := make([]string, len(vt.columnNames))
+		if e.IsValid() {
+			for i, k := range vt.columnNames {
+				v := e.MapIndex(reflect.ValueOf(k).Convert(e.Type().Key()))
+				if v.IsValid() {
+					row[i] = formatValue(v)
+				}
+			}
+		}
+		vt.rows = append(vt.rows, row)
+	}
+	return vt
+}
+
+// indirectValue follows pointers and interfaces; an invalid Value is returned
+// for nil.
+func indirectValue(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// formatField returns the string representation of the field. Times are
+// formatted using the layout, if there is one.
+func formatField(f reflect.Value, layout string) string {
+	if v := indirectValue(f); layout != "" && v.IsValid() && v.CanInterface() {
+		if t, ok := v.Interface().(time.Time); ok {
+			return t.Format(layout)
+		}
+	}
+	return formatValue(f)
+}
+
+// formatValue returns the string representation of v.
+func formatValue(v reflect.Value) string {
+	for {
+		if !v.IsValid() {
+			return ""
+		}
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+			return ""
+		}
+		if s, ok := formatMethod(v); ok {
+			return s
+		}
+		// methods with pointer receivers
+		if v.CanAddr() {
+			if s, ok := formatMethod(v.Addr()); ok {
+				return s
+			}
+		}
+		if v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface {
+			return fmt.Sprint(v.Interface())
+		}
+		v = v.Elem()
+	}
+}
+
+// formatMethod formats v using its String or MarshalText method, if it has
+// one.
+func formatMethod(v reflect.Value) (string, bool) {
+	if !v.CanInterface() {
+		return "", false
+	}
+	switch x := v.Interface().(type) {
+	case fmt.Stringer:
+		return x.String(), true
+	case encoding.TextMarshaler:
+		b, err := x.MarshalText()
+		if err != nil {
+			return "", false
+		}
+		return string(b), true
+	}
+	return "", false
+}
@@ -0,0 +1,116 @@
+package transmogrifier
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+type testSKU string
+
+func (s testSKU) String() string { return strings.ToUpper(string(s)) }
+
+type testBase struct {
+	ID int `mog:"Id,align=right"`
+}
+
+type testItem struct {
+	testBase
+	Name    string    `mog:",emphasis=bold"`
+	Price   float64   `mog:"Price,align=right,emphasis=italic"`
+	SKU     testSKU   `mog:"SKU"`
+	Added   time.Time `mog:"Added,align=center"`
+	Note    *string
+	Ignored string `mog:"-"`
+	private string
+}
+
+func TestTransmogrifyValues(t *testing.T) {
+	added := time.Date(2015, 10, 16, 0, 0, 0, 0, time.UTC)
+	note := "don't panic"
+	items := []testItem{
+		{testBase{42}, "towel", 19.99, "tw-42", added, &note, "x", "y"},
+		{testBase{7}, "string", 9.5, "st-7", added, nil, "x", "y"},
+	}
+	expectedItems := "|Id|Name|Price|SKU|Added|Note|  \n" +
+		"|---:|---|---:|---|:---:|---|  \n" +
+		"|42|__towel__|_19.99_|TW-42|2015-10-16 00:00:00 +0000 UTC|don't panic|  \n" +
+		"|7|__string__|_9.5_|ST-7|2015-10-16 00:00:00 +0000 UTC||  \n"
+	ptrs := []*testItem{&items[0], nil}
+	expectedPtrs := "|Id|Name|Price|SKU|Added|Note|  \n" +
+		"|---:|---|---:|---|:---:|---|  \n" +
+		"|42|__towel__|_19.99_|TW-42|2015-10-16 00:00:00 +0000 UTC|don't panic|  \n" +
+		"|||||||  \n"
+	maps := []map[string]interface{}{
+		{"name": "towel", "qty": 1},
+		{"name": "string", "sku": testSKU("st-7")},
+	}
+	expectedMaps := "|name|qty|sku|  \n" +
+		"|---|---|---|  \n" +
+		"|towel|1||  \n" +
+		"|string||ST-7|  \n"
+	ch := make(chan testBase, 2)
+	ch <- testBase{1}
+	ch <- testBase{2}
+	close(ch)
+	expectedIDs := "|Id|  \n|---:|  \n|1|  \n|2|  \n"
+	seq := func(yield func(interface{}) bool) {
+		for _, id := range []int{1, 2} {
+			if !yield(&testBase{id}) {
+				return
+			}
+		}
+	}
+	tests := []struct {
+		value       interface{}
+		expected    string
+		expectedErr string
+	}{
+		{items, expectedItems, ""},
+		{ptrs, expectedPtrs, ""},
+		{maps, expectedMaps, ""},
+		{ch, expectedIDs, ""},
+		{seq, expectedIDs, ""},
+		{nil, "", "unable to transmogrify values: received nil"},
+		{42, "", "unable to transmogrify values: unsupported type int"},
+		{[]int{1}, "", "unable to transmogrify values: unsupported element type int"},
+		{[]interface{}{testBase{1}, testItem{}}, "", "unable to transmogrify values: element 1 is a transmogrifier.testItem, not a transmogrifier.testBase"},
+		{[]map[int]string{}, "", "unable to transmogrify values: map keys must be strings, got int"},
+		{[]struct {
+			A int `mog:"A,bold"`
+		}{}, "", "field A: invalid mog tag option \"bold\""},
+	}
+	for i, test := range tests {
+		md := NewMDTable()
+		err := md.TransmogrifyValues(test.value)
+		if err != nil {
+			if err.Error() != test.expectedErr {
+				t.Errorf("%d: expected %q, got %q", i, test.expectedErr, err)
+			}
+			continue
+		}
+		if test.expectedErr != "" {
+			t.Errorf("%d: expected %q, got no error", i, test.expectedErr)
+			continue
+		}
+		if md.String() != test.expected {
+			t.Errorf("%d: expected\n%s\ngot\n%s", i, test.expected, md.String())
+		}
+	}
+}
+
+func TestValuesToStringTable(t *testing.T) {
+	table, err := ValuesToStringTable([]testBase{{1}, {2}})
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	expected := [][]string{[]string{"Id"}, []string{"1"}, []string{"2"}}
+	if len(table) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, table)
+	}
+	for i, row := range table {
+		if strings.Join(row, ",") != strings.Join(expected[i], ",") {
+			t.Errorf("%d: expected %v, got %v", i, expected[i], row)
+		}
+	}
+}
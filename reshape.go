@@ -0,0 +1,311 @@
+package transmogrifier
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Reshape is an operation that reshapes a table: a *Pivot, an *Unpivot, or
+// a Transpose.
+type Reshape interface {
+	// Apply returns the reshaped table's header and rows.
+	Apply(header []string, rows [][]string) ([]string, [][]string, error)
+	// reshape reshapes the table. cols are the columns of the table whose
+	// alignment and emphasis the reshaped table's columns have; -1 is
+	// none.
+	reshape(header []string, rows [][]string) (outHeader []string, out [][]string, cols []int, err error)
+}
+
+// ParseReshape parses a reshape operation:
+//
+//	pivot ROWS; COLUMN; FUNC(VALUE)
+//	unpivot IDS; VARIABLE; VALUE[; COLUMNS]
+//	transpose
+//
+// e.g. 'pivot region; quarter; sum(amount)' or 'unpivot region; quarter;
+// amount'. ROWS, IDS, and COLUMNS are comma separated lists of columns; see
+// Pivot and Unpivot.
+func ParseReshape(s string) (Reshape, error) {
+	s = strings.TrimSpace(s)
+	op, rest := s, ""
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		op, rest = s[:i], strings.TrimSpace(s[i+1:])
+	}
+	r, err := parseReshape(strings.ToLower(op), rest)
+	if err != nil {
+		return nil, fmt.Errorf("reshape %q: %s", s, err)
+	}
+	return r, nil
+}
+
+func parseReshape(op, s string) (Reshape, error) {
+	parts := strings.Split(s, ";")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	var err error
+	switch op {
+	case "pivot":
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("expected ROWS; COLUMN; FUNC(VALUE)")
+		}
+		p := &Pivot{Column: parts[1]}
+		p.Rows, err = parseColumnList(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		if p.Column == "" {
+			return nil, fmt.Errorf("no column")
+		}
+		if _, err = parseColumnRef(p.Column); err != nil {
+			return nil, err
+		}
+		p.Value, err = parseAggregate(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("%q: %s", parts[2], err)
+		}
+		return p, nil
+	case "unpivot":
+		if len(parts) < 3 || len(parts) > 4 {
+			return nil, fmt.Errorf("expected IDS; VARIABLE; VALUE[; COLUMNS]")
+		}
+		u := &Unpivot{VariableName: unquoteColumn(parts[1]), ValueName: unquoteColumn(parts[2])}
+		u.IDs, err = parseColumnList(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(parts) == 4 {
+			u.Columns, err = parseColumnList(parts[3])
+			if err != nil {
+				return nil, err
+			}
+		}
+		return u, nil
+	case "transpose":
+		if s != "" {
+			return nil, fmt.Errorf("transpose has no arguments")
+		}
+		return Transpose{}, nil
+	}
+	return nil, fmt.Errorf("unknown operation %q", op)
+}
+
+// Pivot reshapes a long table into a wide one: a row for each distinct set
+// of values of the Rows columns, and a column for each distinct value of the
+// Column column, holding the aggregate of the values of the rows that have
+// them, e.g. sum(amount). Rows and columns are in the order they are first
+// seen; cells without any rows are empty. The value columns have the
+// alignment and emphasis of the aggregated column.
+type Pivot struct {
+	// Rows are the columns, names or '#' positions, of the rows' keys.
+	Rows []string
+	// Column is the column whose values are the new columns.
+	Column string
+	// Value is the aggregate of each cell; its name isn't used.
+	Value AggregateColumn
+}
+
+// Apply returns the pivoted table's header and rows.
+func (p *Pivot) Apply(header []string, rows [][]string) ([]string, [][]string, error) {
+	h, r, _, err := p.reshape(header, rows)
+	return h, r, err
+}
+
+func (p *Pivot) reshape(header []string, rows [][]string) (outHeader []string, out [][]string, cols []int, err error) {
+	refs := append(append([]string{}, p.Rows...), p.Column)
+	keyCols, err := resolveColumns(refs, header, rows)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	byCols, col := keyCols[:len(p.Rows)], keyCols[len(p.Rows)]
+	valueCol, err := p.Value.resolve(header, tableWidthOf(header, rows))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var keys, colNames []string
+	seenCols := map[string]bool{}
+	// keyRows are the rows keys' values; cells are the rows of each key
+	// and column.
+	keyRows := map[string][]string{}
+	cells := map[string]map[string][][]string{}
+	for _, row := range rows {
+		k := groupKey(row, byCols)
+		if cells[k] == nil {
+			keys = append(keys, k)
+			keyRows[k] = projectRow(row, byCols)
+			cells[k] = map[string][][]string{}
+		}
+		c := cell(row, col)
+		if !seenCols[c] {
+			seenCols[c] = true
+			colNames = append(colNames, c)
+		}
+		cells[k][c] = append(cells[k][c], row)
+	}
+	outHeader = append(columnNames(header, byCols), colNames...)
+	cols = append(cols, byCols...)
+	for range colNames {
+		cols = append(cols, valueCol)
+	}
+	for _, k := range keys {
+		row := keyRows[k]
+		for _, c := range colNames {
+			group := cells[k][c]
+			if group == nil {
+				row = append(row, "")
+				continue
+			}
+			v, err := p.Value.aggregate(group, valueCol)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			row = append(row, v)
+		}
+		out = append(out, row)
+	}
+	return outHeader, out, cols, nil
+}
+
+// Unpivot, or melt, reshapes a wide table into a long one: each value of the
+// Columns becomes a row with the row's ID columns, the column's name, in the
+// variable column, and the value, in the value column. The ID columns keep
+// their alignment and emphasis; the value column has those of the first of
+// the Columns.
+type Unpivot struct {
+	// IDs are the columns, names or '#' positions, that are kept.
+	IDs []string
+	// Columns are the columns that are unpivoted; if it is empty, every
+	// column that isn't an ID is.
+	Columns []string
+	// VariableName and ValueName are the names of the variable and value
+	// columns; if they are empty, they are "variable" and "value".
+	VariableName string
+	ValueName    string
+}
+
+// Apply returns the unpivoted table's header and rows.
+func (u *Unpivot) Apply(header []string, rows [][]string) ([]string, [][]string, error) {
+	h, r, _, err := u.reshape(header, rows)
+	return h, r, err
+}
+
+func (u *Unpivot) reshape(header []string, rows [][]string) (outHeader []string, out [][]string, cols []int, err error) {
+	ids, err := resolveColumns(u.IDs, header, rows)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	melted, err := resolveColumns(u.Columns, header, rows)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(u.Columns) == 0 {
+		isID := map[int]bool{}
+		for _, c := range ids {
+			isID[c] = true
+		}
+		for i := 0; i < tableWidthOf(header, rows); i++ {
+			if !isID[i] {
+				melted = append(melted, i)
+			}
+		}
+	}
+	variable, value := u.VariableName, u.ValueName
+	if variable == "" {
+		variable = "variable"
+	}
+	if value == "" {
+		value = "value"
+	}
+	outHeader = append(columnNames(header, ids), variable, value)
+	cols = append(append(cols, ids...), -1, -1)
+	if len(melted) > 0 {
+		cols[len(cols)-1] = melted[0]
+	}
+	names := columnNames(header, melted)
+	for _, row := range rows {
+		idVals := projectRow(row, ids)
+		for i, c := range melted {
+			r := append(append([]string{}, idVals...), names[i])
+			out = append(out, append(r, cell(row, c)))
+		}
+	}
+	return outHeader, out, cols, nil
+}
+
+// Transpose swaps the rows and columns of a table. The header becomes the
+// first column, and the first column the header; without a header, every
+// row becomes a column. A transposed table has no column alignment or
+// emphasis.
+type Transpose struct{}
+
+// Apply returns the transposed table's header and rows.
+func (t Transpose) Apply(header []string, rows [][]string) ([]string, [][]string, error) {
+	h, r, _, err := t.reshape(header, rows)
+	return h, r, err
+}
+
+func (Transpose) reshape(header []string, rows [][]string) (outHeader []string, out [][]string, cols []int, err error) {
+	n := tableWidthOf(header, rows)
+	first := 0
+	if len(header) > 0 {
+		outHeader = []string{header[0]}
+		for _, row := range rows {
+			outHeader = append(outHeader, cell(row, 0))
+		}
+		first = 1
+	}
+	for c := first; c < n; c++ {
+		var row []string
+		if len(header) > 0 {
+			row = append(row, cell(header, c))
+		}
+		for _, r := range rows {
+			row = append(row, cell(r, c))
+		}
+		out = append(out, row)
+	}
+	width := len(rows) + first
+	cols = make([]int, width)
+	for i := range cols {
+		cols[i] = -1
+	}
+	return outHeader, out, cols, nil
+}
+
+// Reshape returns the reshaped header and rows of the CSV.
+func (c *CSV) Reshape(r Reshape) ([]string, [][]string, error) {
+	return r.Apply(c.headerRow, c.rows)
+}
+
+// cell returns the row's value of the column; a missing value is empty.
+func cell(row []string, c int) string {
+	if c >= 0 && c < len(row) {
+		return row[c]
+	}
+	return ""
+}
+
+// tableWidthOf returns the number of columns of the table: that of its
+// header or its widest row.
+func tableWidthOf(header []string, rows [][]string) int {
+	n := tableWidth(rows)
+	if len(header) > n {
+		n = len(header)
+	}
+	return n
+}
+
+// columnNames returns the names of the columns; columns that the header
+// doesn't have are named by their '#' position.
+func columnNames(header []string, cols []int) []string {
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		if c < len(header) {
+			names[i] = header[c]
+			continue
+		}
+		names[i] = "#" + strconv.Itoa(c+1)
+	}
+	return names
+}
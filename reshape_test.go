@@ -0,0 +1,68 @@
+package transmogrifier
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReshape(t *testing.T) {
+	long := [][]string{
+		[]string{"east", "Q1", "10"},
+		[]string{"east", "Q2", "20"},
+		[]string{"west", "Q1", "5"},
+		[]string{"east", "Q1", "1.5"},
+	}
+	wide := [][]string{
+		[]string{"east", "10", "20"},
+		[]string{"west", "5", ""},
+	}
+	tests := []struct {
+		spec           string
+		header         []string
+		rows           [][]string
+		expectedHeader []string
+		expectedRows   [][]string
+		expectedErr    string
+	}{
+		{"pivot region; quarter; sum(amount)", []string{"region", "quarter", "amount"}, long, []string{"region", "Q1", "Q2"}, [][]string{{"east", "11.5", "20"}, {"west", "5", ""}}, ""},
+		{"PIVOT #1; #2; count(*)", nil, long, []string{"#1", "Q1", "Q2"}, [][]string{{"east", "2", "1"}, {"west", "1", ""}}, ""},
+		{"pivot ; region; max(amount)", []string{"region", "quarter", "amount"}, long, []string{"east", "west"}, [][]string{{"20", "5"}}, ""},
+		{"unpivot region; quarter; amount", []string{"region", "Q1", "Q2"}, wide, []string{"region", "quarter", "amount"}, [][]string{{"east", "Q1", "10"}, {"east", "Q2", "20"}, {"west", "Q1", "5"}, {"west", "Q2", ""}}, ""},
+		{"unpivot region;;; Q2", []string{"region", "Q1", "Q2"}, wide, []string{"region", "variable", "value"}, [][]string{{"east", "Q2", "20"}, {"west", "Q2", ""}}, ""},
+		{"unpivot ; q; v", nil, wide[:1], []string{"q", "v"}, [][]string{{"#1", "east"}, {"#2", "10"}, {"#3", "20"}}, ""},
+		{"transpose", []string{"region", "Q1", "Q2"}, wide, []string{"region", "east", "west"}, [][]string{{"Q1", "10", "5"}, {"Q2", "20", ""}}, ""},
+		{"transpose", nil, wide, nil, [][]string{{"east", "west"}, {"10", "5"}, {"20", ""}}, ""},
+		{"pivot region; quarter", nil, nil, nil, nil, `reshape "pivot region; quarter": expected ROWS; COLUMN; FUNC(VALUE)`},
+		{"pivot region; ; sum(amount)", nil, nil, nil, nil, `reshape "pivot region; ; sum(amount)": no column`},
+		{"pivot region; quarter; total(amount)", nil, nil, nil, nil, `reshape "pivot region; quarter; total(amount)": "total(amount)": unknown function "total"`},
+		{"unpivot region", nil, nil, nil, nil, `reshape "unpivot region": expected IDS; VARIABLE; VALUE[; COLUMNS]`},
+		{"transpose all", nil, nil, nil, nil, `reshape "transpose all": transpose has no arguments`},
+		{"rotate", nil, nil, nil, nil, `reshape "rotate": unknown operation "rotate"`},
+		{"pivot state; quarter; sum(amount)", []string{"region", "quarter", "amount"}, long, nil, nil, `unknown column "state"`},
+		{"pivot region; amount; sum(quarter)", []string{"region", "quarter", "amount"}, long, nil, nil, `sum(quarter): "Q1" isn't a number`},
+	}
+	for i, test := range tests {
+		r, err := ParseReshape(test.spec)
+		var h []string
+		var rows [][]string
+		if err == nil {
+			h, rows, err = r.Apply(test.header, test.rows)
+		}
+		if err != nil {
+			if err.Error() != test.expectedErr {
+				t.Errorf("%d: expected error %q, got %q", i, test.expectedErr, err)
+			}
+			continue
+		}
+		if test.expectedErr != "" {
+			t.Errorf("%d: expected error %q, got none", i, test.expectedErr)
+			continue
+		}
+		if !reflect.DeepEqual(h, test.expectedHeader) {
+			t.Errorf("%d: expected header %q, got %q", i, test.expectedHeader, h)
+		}
+		if !reflect.DeepEqual(rows, test.expectedRows) {
+			t.Errorf("%d: expected rows %q, got %q", i, test.expectedRows, rows)
+		}
+	}
+}
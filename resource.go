@@ -0,0 +1,310 @@
+package transmogrifier
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// stdin and stdout are what Stdio resources read from and write to.
+var (
+	stdin  io.Reader = os.Stdin
+	stdout io.Writer = os.Stdout
+)
+
+// contentTypes are the media types for each FormatType.
+var contentTypes = map[FormatType]string{
+	FmtCSV:        "text/csv",
+	FmtMD:         "text/markdown",
+	FmtMDTable:    "text/markdown",
+	FmtFixedWidth: "text/plain",
+	FmtSQL:        "application/sql",
+}
+
+// ContentType returns the media type for the format. Unknown formats are
+// application/octet-stream.
+func ContentType(f FormatType) string {
+	ct, ok := contentTypes[f]
+	if !ok {
+		return "application/octet-stream"
+	}
+	return ct
+}
+
+// HTTPConfig configures how HTTP resources are read and written.
+type HTTPConfig struct {
+	// Client is the client used for requests. If it is nil, a client with
+	// Timeout is used.
+	Client *http.Client
+	// Header is added to every request.
+	Header http.Header
+	// Timeout is the time limit for requests, when Client is nil. 0 means
+	// no time limit.
+	Timeout time.Duration
+	// Method is the method used to write to sinks: PUT or POST. The default
+	// is PUT.
+	Method string
+}
+
+func (c *HTTPConfig) client() *http.Client {
+	if c == nil {
+		return http.DefaultClient
+	}
+	if c.Client != nil {
+		return c.Client
+	}
+	return &http.Client{Timeout: c.Timeout}
+}
+
+func (c *HTTPConfig) method() string {
+	if c == nil || c.Method == "" {
+		return "PUT"
+	}
+	return strings.ToUpper(c.Method)
+}
+
+func (c *HTTPConfig) setHeader(req *http.Request) {
+	if c == nil {
+		return
+	}
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+}
+
+// Open opens the resource for reading. Compressed data is decompressed; the
+// compression is detected from the data's magic bytes or, failing that, the
+// resource's Compression. The caller is responsible for closing it.
+func (r resource) Open() (io.ReadCloser, error) {
+	rc, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	return decompress(rc, r.Compression)
+}
+
+func (r resource) open() (io.ReadCloser, error) {
+	if r.Archive != "" {
+		return r.openMember()
+	}
+	switch r.Type {
+	case Stdio:
+		return ioutil.NopCloser(stdin), nil
+	case HTTP:
+		return r.openHTTP()
+	case S3:
+		return r.openS3()
+	case Data:
+		b, _, err := decodeDataURI(r.URI)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+	if r.Name == "" {
+		return nil, ErrNoSource
+	}
+	return os.Open(r.String())
+}
+
+// Create opens the resource for writing. If the resource has a Compression,
+// what is written is compressed. Local files are replaced, according to the
+// resource's WriteOptions, and HTTP and S3 uploads are completed, when the
+// returned WriteCloser is closed; any error with it is returned by Close.
+func (r resource) Create() (io.WriteCloser, error) {
+	w, err := r.create()
+	if err != nil {
+		return nil, err
+	}
+	return compress(w, r.Compression)
+}
+
+func (r resource) create() (io.WriteCloser, error) {
+	if r.Archive != "" {
+		return nil, fmt.Errorf("%s: archive members can't be written to", r)
+	}
+	switch r.Type {
+	case Stdio:
+		return nopWriteCloser{stdout}, nil
+	case HTTP:
+		return &httpWriter{r: r}, nil
+	case S3:
+		return r.createS3()
+	case Data:
+		return nil, fmt.Errorf("data URIs can't be written to")
+	}
+	if r.Name == "" {
+		return nil, ErrNoDest
+	}
+	return createAtomic(r.String(), r.write)
+}
+
+// formatFromResource returns the format of the resource: the media type of
+// data URIs, CSV for stdin, otherwise the name's extension, ignoring any
+// compression extension. The extension is returned for error reporting.
+func formatFromResource(r resource) (FormatType, string) {
+	switch r.Type {
+	case Stdio:
+		return FmtCSV, ""
+	case Data:
+		_, mt, err := decodeDataURI(r.URI)
+		if err != nil {
+			return FmtUnsupported, ""
+		}
+		return formatFromMediaType(mt), mt
+	}
+	_, name := compressionFromName(r.Name)
+	ext := path.Ext(name)
+	if ext == "" {
+		return FmtUnsupported, ""
+	}
+	ext = ext[1:]
+	return FormatTypeFromString(ext), ext
+}
+
+// formatFromMediaType returns the FormatType for a media type. text/plain is
+// too generic to imply a format.
+func formatFromMediaType(mt string) FormatType {
+	switch mt {
+	case "text/csv":
+		return FmtCSV
+	case "text/markdown":
+		return FmtMD
+	case "application/sql":
+		return FmtSQL
+	}
+	return FmtUnsupported
+}
+
+// writeResource writes b to the resource. If the resource is a Markdown file
+// with a marked region, or the resource's named region, only the region is
+// replaced.
+func writeResource(r resource, b []byte) (n int, err error) {
+	if r.Type == File && r.Name == "" {
+		return 0, ErrNoDest
+	}
+	if hasRegions(r) || r.region != "" {
+		current, err := readCurrent(r)
+		if err != nil {
+			return 0, err
+		}
+		b, err = spliceResource(r, current, b)
+		if err != nil {
+			return 0, err
+		}
+	}
+	w, err := r.Create()
+	if err != nil {
+		return 0, err
+	}
+	n, err = w.Write(b)
+	cerr := w.Close()
+	if err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+func (r resource) openHTTP() (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", r.URI, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.http.setHeader(req)
+	resp, err := r.http.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", r.URI, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// httpWriter buffers what is written to it and sends it to the resource's
+// URI when it is closed.
+type httpWriter struct {
+	r   resource
+	buf bytes.Buffer
+}
+
+func (w *httpWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *httpWriter) Close() error {
+	method := w.r.http.method()
+	req, err := http.NewRequest(method, w.r.URI, &w.buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentType(w.r.Format))
+	w.r.http.setHeader(req)
+	resp, err := w.r.http.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s: %s", method, w.r.URI, resp.Status)
+	}
+	return nil
+}
+
+// decodeDataURI returns the data and the media type of a data URI.
+func decodeDataURI(s string) ([]byte, string, error) {
+	if uriScheme(s) != "data" {
+		return nil, "", fmt.Errorf("%q is not a data URI", s)
+	}
+	i := strings.Index(s, ",")
+	if i < 0 {
+		return nil, "", fmt.Errorf("invalid data URI: no ',' found")
+	}
+	meta, data := s[len("data:"):i], s[i+1:]
+	var isBase64 bool
+	if strings.HasSuffix(meta, ";base64") {
+		isBase64 = true
+		meta = strings.TrimSuffix(meta, ";base64")
+	}
+	mt := "text/plain"
+	if meta != "" {
+		var err error
+		mt, _, err = mime.ParseMediaType(meta)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid data URI: %s", err)
+		}
+	}
+	if isBase64 {
+		b, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			// unpadded and URL safe encodings are also accepted
+			b, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(data, "="))
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid data URI: %s", err)
+			}
+		}
+		return b, mt, nil
+	}
+	d, err := url.PathUnescape(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid data URI: %s", err)
+	}
+	return []byte(d), mt, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,164 @@
+package transmogrifier
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResourceOpen(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer 42" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/test.csv" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("a,b\n1,2\n"))
+	}))
+	defer ts.Close()
+	cfg := &HTTPConfig{Header: http.Header{"Authorization": []string{"Bearer 42"}}, Timeout: 5 * time.Second}
+	stdin = strings.NewReader("stdin,data\n")
+	defer func() { stdin = os.Stdin }()
+	tests := []struct {
+		uri         string
+		http        *HTTPConfig
+		expected    string
+		expectedErr string
+	}{
+		{"", nil, "", "no source was specified"},
+		{"-", nil, "stdin,data\n", ""},
+		{"test_files/test.csv", nil, "Item,Id,Description,Price\nstring,00042,a string of indeterminate length,$9.99\ntowel,10042,an intergalactic traveller's essential,$42.00\n", ""},
+		{"data:text/csv,a%2Cb%0A1%2C2", nil, "a,b\n1,2", ""},
+		{"data:text/csv;base64,YSxiCjEsMgo=", nil, "a,b\n1,2\n", ""},
+		{"data:text/csv;base64,!!!", nil, "", "invalid data URI: illegal base64 data at input byte 0"},
+		{ts.URL + "/test.csv", cfg, "a,b\n1,2\n", ""},
+		{ts.URL + "/test.csv", nil, "", "GET " + ts.URL + "/test.csv: 401 Unauthorized"},
+		{ts.URL + "/missing.csv", cfg, "", "GET " + ts.URL + "/missing.csv: 404 Not Found"},
+	}
+	for i, test := range tests {
+		r := NewResource(test.uri, FmtCSV, File)
+		r.http = test.http
+		rc, err := r.Open()
+		if err != nil {
+			if err.Error() != test.expectedErr {
+				t.Errorf("%d: expected %q, got %q", i, test.expectedErr, err)
+			}
+			continue
+		}
+		if test.expectedErr != "" {
+			t.Errorf("%d: expected %q, got no error", i, test.expectedErr)
+			rc.Close()
+			continue
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Errorf("%d: expected no error, got %q", i, err)
+			continue
+		}
+		if string(b) != test.expected {
+			t.Errorf("%d: expected %q, got %q", i, test.expected, string(b))
+		}
+	}
+}
+
+func TestResourceCreate(t *testing.T) {
+	var method, contentType, body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		contentType = r.Header.Get("Content-Type")
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		if r.URL.Path == "/readonly.md" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer ts.Close()
+
+	md := NewMDTable()
+	md.SetHTTPConfig(&HTTPConfig{Method: "post"})
+	md.TransmogrifyStringTable([][]string{[]string{"a", "b"}})
+	md.SetDest(ts.URL + "/table.md")
+	name, n, err := md.WriteToFile()
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	if name != ts.URL+"/table.md" || n != len(md.Bytes()) {
+		t.Errorf("expected %q and %d, got %q and %d", ts.URL+"/table.md", len(md.Bytes()), name, n)
+	}
+	if method != "POST" || contentType != "text/markdown" || body != md.String() {
+		t.Errorf("expected POST text/markdown %q, got %s %s %q", md.String(), method, contentType, body)
+	}
+
+	md.SetHTTPConfig(nil)
+	md.SetDest(ts.URL + "/readonly.md")
+	_, _, err = md.WriteToFile()
+	if err == nil || err.Error() != "PUT "+ts.URL+"/readonly.md: 403 Forbidden" {
+		t.Errorf("expected PUT 403 error, got %v", err)
+	}
+	if method != "PUT" {
+		t.Errorf("expected PUT, got %s", method)
+	}
+
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+	md.SetDest("-")
+	_, _, err = md.WriteToFile()
+	if err != nil {
+		t.Errorf("expected no error, got %q", err)
+	}
+	if buf.String() != md.String() {
+		t.Errorf("expected %q, got %q", md.String(), buf.String())
+	}
+
+	md.SetDest("data:text/plain,x")
+	_, _, err = md.WriteToFile()
+	if err == nil || err.Error() != "data URIs can't be written to" {
+		t.Errorf("expected data URI error, got %v", err)
+	}
+
+	// only a local source has a default dest.
+	for i, src := range []string{ts.URL + "/table.csv", "s3://bucket/table.csv"} {
+		md := NewMDTable()
+		err = md.SetSource(src)
+		if err != nil {
+			t.Errorf("%d: expected no error, got %q", i, err)
+			continue
+		}
+		md.SetDest("")
+		_, _, err = md.WriteToFile()
+		if err != ErrNoDest {
+			t.Errorf("%d: expected %q, got %v", i, ErrNoDest, err)
+		}
+	}
+}
+
+func TestFormatFromResource(t *testing.T) {
+	tests := []struct {
+		uri         string
+		expected    FormatType
+		expectedExt string
+	}{
+		{"-", FmtCSV, ""},
+		{"test", FmtUnsupported, ""},
+		{"path.d/test.csv", FmtCSV, "csv"},
+		{"http://example.com/path/test.md?x=y.csv", FmtMD, "md"},
+		{"data:text/csv,a", FmtCSV, "text/csv"},
+		{"data:,a", FmtUnsupported, "text/plain"},
+	}
+	for i, test := range tests {
+		f, ext := formatFromResource(NewResource(test.uri, FmtUnsupported, File))
+		if f != test.expected || ext != test.expectedExt {
+			t.Errorf("%d: expected %s %q, got %s %q", i, test.expected, test.expectedExt, f, ext)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package transmogrifier
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Rule is a conditional formatting rule: it styles the cells of its Columns
+// of the rows that match its condition, e.g. bolds the price of the rows
+// whose price is over 100. ParseRule parses a rule:
+//
+//	STYLES [on COLUMNS] [when CONDITION]
+//
+// e.g.:
+//
+//	bold on price when price > 100
+//	strikethrough when status == "discontinued"
+//	prefix "✅ " on result when result == "pass"
+//
+// The styles are bold, italic, and strikethrough, or b, i, and s, and
+// prefix and suffix, which are followed by a quoted string; they can be
+// separated by spaces or commas. Without 'on', every cell of the row is
+// styled; without 'when', every row is. The condition is a Filter, so it can
+// use any column of the row.
+type Rule struct {
+	// Columns are the columns, names or '#' positions, whose cells are
+	// styled; if it is empty, every column's are.
+	Columns []string
+	// When is the condition of the rows whose cells are styled; if it is
+	// nil, every row's are.
+	When *Filter
+	// Emphasis are the cells' emphasis: bold, italic, or strikethrough.
+	Emphasis []string
+	// Prefix and Suffix are added before and after the cells' values,
+	// outside of their emphasis.
+	Prefix string
+	Suffix string
+}
+
+// CellRules are conditional formatting rules that style the cells of an md
+// table, in addition to their column's emphasis; see Rule. The rules are
+// evaluated in order. Every rule that matches a cell styles it, adding its
+// emphasis, prefix, and suffix to those of the rules before it, unless
+// FirstMatch is set: then only the first rule that matches a cell styles it.
+// Summary rows, e.g. totals, aren't styled.
+type CellRules struct {
+	Rules      []Rule
+	FirstMatch bool
+}
+
+// ParseRule parses a rule, e.g. 'bold on price when price > 100'.
+func ParseRule(s string) (Rule, error) {
+	var r Rule
+	styles, cond := s, ""
+	if i := indexWhen(s); i >= 0 {
+		styles, cond = s[:i], s[i+len("when"):]
+		if strings.TrimSpace(cond) == "" {
+			return r, fmt.Errorf("rule %q: no condition", s)
+		}
+		var err error
+		r.When, err = ParseFilter(strings.TrimSpace(cond))
+		if err != nil {
+			return r, fmt.Errorf("rule %q: %s", s, err)
+		}
+	}
+	err := r.parseStyles(styles)
+	if err != nil {
+		return r, fmt.Errorf("rule %q: %s", s, err)
+	}
+	return r, nil
+}
+
+// parseStyles parses the styles, and the columns after 'on', of a rule.
+func (r *Rule) parseStyles(s string) error {
+	var styled bool
+	for i := 0; i < len(s); {
+		if s[i] == ' ' || s[i] == '\t' || s[i] == ',' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(s) && s[j] != ' ' && s[j] != '\t' && s[j] != ',' {
+			j++
+		}
+		orig := s[i:j]
+		word := strings.ToLower(orig)
+		i = j
+		switch word {
+		case "bold", "b":
+			r.Emphasis = append(r.Emphasis, "bold")
+		case "italic", "italics", "i":
+			r.Emphasis = append(r.Emphasis, "italic")
+		case "strikethrough", "s":
+			r.Emphasis = append(r.Emphasis, "strikethrough")
+		case "prefix", "suffix":
+			for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+				i++
+			}
+			if i == len(s) || (s[i] != '"' && s[i] != '\'') {
+				return fmt.Errorf("%s needs a quoted string", word)
+			}
+			v, end, err := unquoteFilter(s, i)
+			if err != nil {
+				return err
+			}
+			i = end
+			if word == "prefix" {
+				r.Prefix += v
+			} else {
+				r.Suffix += v
+			}
+		case "on":
+			cols, err := parseColumnList(s[i:])
+			if err != nil {
+				return err
+			}
+			if len(cols) == 0 {
+				return fmt.Errorf("no columns")
+			}
+			r.Columns = cols
+			i = len(s)
+		default:
+			return fmt.Errorf("unknown style %q", orig)
+		}
+		styled = styled || word != "on"
+	}
+	if !styled {
+		return fmt.Errorf("no style")
+	}
+	return nil
+}
+
+// indexWhen returns the index of the first 'when', that isn't quoted, in the
+// rule s; -1 is returned if it doesn't have one.
+func indexWhen(s string) int {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '"' || s[i] == '\'' || s[i] == '`':
+			_, end, err := unquoteFilter(s, i)
+			if err != nil {
+				return -1
+			}
+			i = end - 1
+		case len(s)-i >= 4 && strings.EqualFold(s[i:i+4], "when") &&
+			(i == 0 || s[i-1] == ' ' || s[i-1] == '\t' || s[i-1] == ',') &&
+			(i+4 == len(s) || s[i+4] == ' ' || s[i+4] == '\t'):
+			return i
+		}
+	}
+	return -1
+}
+
+// ParseRules parses the rules, separated by semicolons, e.g. 'bold on price
+// when price > 100; strikethrough when status == "discontinued"'.
+func ParseRules(s string) (*CellRules, error) {
+	r := &CellRules{}
+	for _, rs := range splitExprs(s) {
+		if strings.TrimSpace(rs) == "" {
+			continue
+		}
+		err := r.Add(rs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(r.Rules) == 0 {
+		return nil, fmt.Errorf("rules: no rules")
+	}
+	return r, nil
+}
+
+// Add parses the rule and adds it after the others.
+func (r *CellRules) Add(s string) error {
+	rule, err := ParseRule(strings.TrimSpace(s))
+	if err != nil {
+		return err
+	}
+	r.Rules = append(r.Rules, rule)
+	return nil
+}
+
+// parseRuleMatch parses how the rules are matched: "first", only the first
+// rule that matches a cell styles it, or "all", every one does.
+func parseRuleMatch(s string) (firstMatch bool, err error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "first":
+		return true, nil
+	case "all", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("unknown rule match %q: expected first or all", s)
+}
+
+// Apply returns the rows with the cells that the rules match styled: with
+// their emphasis, as md, and their prefix and suffix. The rows aren't
+// modified.
+func (r *CellRules) Apply(header []string, rows [][]string) ([][]string, error) {
+	styles, err := r.styles(header, rows, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]string, len(rows))
+	for i, row := range rows {
+		out[i] = append([]string{}, row...)
+		for c := range out[i] {
+			if c < len(styles[i]) {
+				out[i][c] = styles[i][c].render(out[i][c], 0)
+			}
+		}
+	}
+	return out, nil
+}
+
+// Style returns the rows of the CSV with the cells that the rules match
+// styled.
+func (c *CSV) Style(r *CellRules) ([][]string, error) {
+	return r.Apply(c.headerRow, c.rows)
+}
+
+// emphasis is a set of md emphasis.
+type emphasis uint8
+
+const (
+	emphasisBold emphasis = 1 << iota
+	emphasisItalic
+	emphasisStrikethrough
+)
+
+// parseEmphasis returns the emphasis of a column emphasis, e.g. "bold" or
+// "b"; an unknown emphasis is none.
+func parseEmphasis(s string) emphasis {
+	switch s {
+	case "bold", "b":
+		return emphasisBold
+	case "italic", "italics", "i":
+		return emphasisItalic
+	case "strikethrough", "s":
+		return emphasisStrikethrough
+	}
+	return 0
+}
+
+// wrap returns s with the emphasis; an empty s isn't emphasized.
+func (e emphasis) wrap(s string) string {
+	if e&emphasisBold != 0 {
+		s = mdMark(s, "__")
+	}
+	if e&emphasisItalic != 0 {
+		s = mdMark(s, "_")
+	}
+	if e&emphasisStrikethrough != 0 {
+		s = mdMark(s, "~~")
+	}
+	return s
+}
+
+// cellStyle is the style of a cell, from the rules that match it.
+type cellStyle struct {
+	emphasis emphasis
+	prefix   string
+	suffix   string
+}
+
+// render returns the value with the style, and the column's emphasis.
+func (st cellStyle) render(v string, column emphasis) string {
+	return st.prefix + (column | st.emphasis).wrap(v) + st.suffix
+}
+
+// styles returns the style of each cell of the rows, by column; the rows that
+// summary is true for, and the rows without any styled cells, are nil. The
+// conditions' column types are inferred from the other rows.
+func (r *CellRules) styles(header []string, rows [][]string, summary []bool) ([][]cellStyle, error) {
+	data := rows
+	if summary != nil {
+		data = nil
+		for i, row := range rows {
+			if i >= len(summary) || !summary[i] {
+				data = append(data, row)
+			}
+		}
+	}
+	n := tableWidthOf(header, rows)
+	// cols are the columns that each rule styles, and ctxs the contexts of
+	// their conditions.
+	cols := make([][]int, len(r.Rules))
+	ctxs := make([]*filterContext, len(r.Rules))
+	for i, rule := range r.Rules {
+		var err error
+		cols[i], err = resolveColumns(rule.Columns, header, rows)
+		if err != nil {
+			return nil, err
+		}
+		if len(rule.Columns) == 0 {
+			cols[i] = seq(n)
+		}
+		if rule.When != nil {
+			ctxs[i], err = rule.When.context(header, data)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	styles := make([][]cellStyle, len(rows))
+	for i, row := range rows {
+		if i < len(summary) && summary[i] {
+			continue
+		}
+		var matched []bool
+		for j, rule := range r.Rules {
+			if rule.When != nil {
+				ok, err := rule.When.match(ctxs[j], row)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					continue
+				}
+			}
+			if styles[i] == nil {
+				styles[i], matched = make([]cellStyle, n), make([]bool, n)
+			}
+			var e emphasis
+			for _, s := range rule.Emphasis {
+				e |= parseEmphasis(s)
+			}
+			for _, c := range cols[j] {
+				if r.FirstMatch && matched[c] {
+					continue
+				}
+				matched[c] = true
+				st := &styles[i][c]
+				st.emphasis |= e
+				st.prefix += rule.Prefix
+				st.suffix = rule.Suffix + st.suffix
+			}
+		}
+	}
+	return styles, nil
+}
+
+// projectStyles returns the styles of the columns cols of the styles.
+func projectStyles(styles []cellStyle, cols []int) []cellStyle {
+	if styles == nil {
+		return nil
+	}
+	out := make([]cellStyle, len(cols))
+	for i, c := range cols {
+		if c >= 0 && c < len(styles) {
+			out[i] = styles[c]
+		}
+	}
+	return out
+}
@@ -0,0 +1,170 @@
+package transmogrifier
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		rule        string
+		columns     []string
+		when        string
+		emphasis    []string
+		prefix      string
+		suffix      string
+		expectedErr string
+	}{
+		{"bold on price when price > 100", []string{"price"}, "price > 100", []string{"bold"}, "", "", ""},
+		{`strikethrough when status == "discontinued"`, nil, `status == "discontinued"`, []string{"strikethrough"}, "", "", ""},
+		{`prefix "✅ " on result when result == "pass"`, []string{"result"}, `result == "pass"`, nil, "✅ ", "", ""},
+		{`B, I suffix ' (when?)' ON a, ` + "`when`" + ` WHEN ` + "`when`" + ` == "x"`, []string{"a", "`when`"}, "`when` == \"x\"", []string{"bold", "italic"}, "", " (when?)", ""},
+		{"s on #2", []string{"#2"}, "", []string{"strikethrough"}, "", "", ""},
+		{"whenever", nil, "", nil, "", "", `rule "whenever": unknown style "whenever"`},
+		{"on price when price > 1", nil, "", nil, "", "", `rule "on price when price > 1": no style`},
+		{"bold when", nil, "", nil, "", "", `rule "bold when": no condition`},
+		{"bold on when x", nil, "", nil, "", "", `rule "bold on when x": no columns`},
+		{"prefix ok when x", nil, "", nil, "", "", `rule "prefix ok when x": prefix needs a quoted string`},
+		{"bold when price >", nil, "", nil, "", "", "rule \"bold when price >\": filter: expected an operand, got \"end of expression\" at 8:\n\tprice >\n\t       ^"},
+	}
+	for i, test := range tests {
+		r, err := ParseRule(test.rule)
+		if err != nil {
+			if err.Error() != test.expectedErr {
+				t.Errorf("%d: expected error %q, got %q", i, test.expectedErr, err)
+			}
+			continue
+		}
+		if test.expectedErr != "" {
+			t.Errorf("%d: expected error %q, got none", i, test.expectedErr)
+			continue
+		}
+		if !reflect.DeepEqual(r.Columns, test.columns) {
+			t.Errorf("%d: expected columns %q, got %q", i, test.columns, r.Columns)
+		}
+		var when string
+		if r.When != nil {
+			when = r.When.String()
+		}
+		if when != test.when {
+			t.Errorf("%d: expected condition %q, got %q", i, test.when, when)
+		}
+		if !reflect.DeepEqual(r.Emphasis, test.emphasis) {
+			t.Errorf("%d: expected emphasis %q, got %q", i, test.emphasis, r.Emphasis)
+		}
+		if r.Prefix != test.prefix || r.Suffix != test.suffix {
+			t.Errorf("%d: expected prefix %q and suffix %q, got %q and %q", i, test.prefix, test.suffix, r.Prefix, r.Suffix)
+		}
+	}
+}
+
+func TestCellRulesApply(t *testing.T) {
+	header := []string{"item", "price", "status"}
+	rows := [][]string{
+		{"towel", "150", "pass"},
+		{"mug", "20", "discontinued"},
+		{"lamp", "99.5", "fail"},
+		{"vase", "", "discontinued"},
+	}
+	tests := []struct {
+		rules       string
+		firstMatch  bool
+		expected    [][]string
+		expectedErr string
+	}{
+		{
+			`bold on price when price > 100; strikethrough when status == "discontinued"`, false,
+			[][]string{{"towel", "__150__", "pass"}, {"~~mug~~", "~~20~~", "~~discontinued~~"}, {"lamp", "99.5", "fail"}, {"~~vase~~", "", "~~discontinued~~"}}, "",
+		},
+		{
+			`prefix "✅ " on status when status == "pass"; prefix "❌ " on status when status == "fail"`, false,
+			[][]string{{"towel", "150", "✅ pass"}, {"mug", "20", "discontinued"}, {"lamp", "99.5", "❌ fail"}, {"vase", "", "discontinued"}}, "",
+		},
+		{
+			`italic on price when price < 100; bold, suffix "!" on #2 when price > 50`, false,
+			[][]string{{"towel", "__150__!", "pass"}, {"mug", "_20_", "discontinued"}, {"lamp", "___99.5___!", "fail"}, {"vase", "", "discontinued"}}, "",
+		},
+		{
+			`italic on price when price < 100; bold, suffix "!" on #2 when price > 50`, true,
+			[][]string{{"towel", "__150__!", "pass"}, {"mug", "_20_", "discontinued"}, {"lamp", "_99.5_", "fail"}, {"vase", "", "discontinued"}}, "",
+		},
+		{
+			`bold on item, price when price >= 99.5; strikethrough when status != "pass"`, true,
+			[][]string{{"__towel__", "__150__", "pass"}, {"~~mug~~", "~~20~~", "~~discontinued~~"}, {"__lamp__", "__99.5__", "~~fail~~"}, {"~~vase~~", "", "~~discontinued~~"}}, "",
+		},
+		{"bold on sku", false, nil, `unknown column "sku"`},
+		{"bold when sku > 1", false, nil, "filter: unknown column \"sku\" at 1:\n\tsku > 1\n\t^"},
+		{" ; ", false, nil, "rules: no rules"},
+	}
+	for i, test := range tests {
+		r, err := ParseRules(test.rules)
+		var out [][]string
+		if err == nil {
+			r.FirstMatch = test.firstMatch
+			out, err = r.Apply(header, rows)
+		}
+		if err != nil {
+			if err.Error() != test.expectedErr {
+				t.Errorf("%d: expected error %q, got %q", i, test.expectedErr, err)
+			}
+			continue
+		}
+		if test.expectedErr != "" {
+			t.Errorf("%d: expected error %q, got none", i, test.expectedErr)
+			continue
+		}
+		if !reflect.DeepEqual(out, test.expected) {
+			t.Errorf("%d: expected %q, got %q", i, test.expected, out)
+		}
+	}
+}
+
+func TestMDTableRules(t *testing.T) {
+	r, err := ParseRules(`italic on price when price > 100; strikethrough when status == "discontinued"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	totals, err := ParseTotals("sum(price)", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ParseProjection("item, price")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := NewMDTable()
+	md.SetHasColumnNames(true)
+	md.SetUseFormat(true)
+	md.SetColumnEmphasis([]string{"", "", "b"})
+	md.SetRules(r)
+	md.SetTotals(totals)
+	md.SetProjection(p)
+	err = md.TransmogrifyStringTable([][]string{{"item", "status", "price"}, {"towel", "ok", "150"}, {"mug", "discontinued", "20"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	expected := "|item|price|  \n|---|---|  \n|towel|___150___|  \n|~~mug~~|~~__20__~~|  \n|Total|__170__|  \n"
+	if md.String() != expected {
+		t.Errorf("expected %q, got %q", expected, md.String())
+	}
+
+	// a streamed row's conditions use the types of the row.
+	md = NewMDTable()
+	md.SetColumnNames([]string{"item", "status", "price"})
+	md.SetRules(r)
+	md.SetProjection(p)
+	err = md.EncodeHeader()
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	for _, row := range [][]string{{"towel", "ok", "150"}, {"mug", "discontinued", "20"}} {
+		err = md.EncodeRow(row)
+		if err != nil {
+			t.Fatalf("expected no error, got %q", err)
+		}
+	}
+	expected = "|item|price|  \n|---|---|  \n|towel|_150_|  \n|~~mug~~|~~20~~|  \n"
+	if md.String() != expected {
+		t.Errorf("expected %q, got %q", expected, md.String())
+	}
+}
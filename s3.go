@@ -0,0 +1,507 @@
+package transmogrifier
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultS3PartSize is the default size of the parts of a multipart upload.
+// Outputs larger than the part size are uploaded using a multipart upload.
+const DefaultS3PartSize = 8 << 20
+
+// minS3PartSize is the smallest part, other than the last, that S3 accepts.
+const minS3PartSize = 5 << 20
+
+// S3Config configures how S3 resources are read and written. Any field that
+// isn't set comes from the environment:
+//
+//	AccessKeyID      AWS_ACCESS_KEY_ID
+//	SecretAccessKey  AWS_SECRET_ACCESS_KEY
+//	SessionToken     AWS_SESSION_TOKEN
+//	Region           AWS_REGION, AWS_DEFAULT_REGION, or us-east-1
+//	Endpoint         AWS_ENDPOINT_URL_S3, AWS_ENDPOINT_URL
+//
+// If the keys aren't in the environment, they are read from the profile,
+// AWS_PROFILE or default, in the shared credentials file,
+// AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials.
+type S3Config struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Region          string
+	// Endpoint is the URL of an S3-compatible service. If it isn't set, the
+	// AWS endpoint for the region is used.
+	Endpoint string
+	// PathStyle: whether the bucket is in the path, instead of the host. It
+	// is always used when Endpoint is set.
+	PathStyle bool
+	// PartSize is the size of the parts of a multipart upload. The default
+	// is DefaultS3PartSize; anything smaller than 5MiB is increased to 5MiB.
+	PartSize int
+	// Client is the client used for requests. If it is nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+}
+
+// resolve returns a copy of the config with the unset fields filled in from
+// the environment.
+func (c *S3Config) resolve() (*S3Config, error) {
+	var r S3Config
+	if c != nil {
+		r = *c
+	}
+	if r.AccessKeyID == "" && r.SecretAccessKey == "" {
+		r.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		r.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		r.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if r.AccessKeyID == "" && r.SecretAccessKey == "" {
+		err := r.credentialsFromFile()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if r.AccessKeyID == "" || r.SecretAccessKey == "" {
+		return nil, fmt.Errorf("s3: no credentials found")
+	}
+	if r.Region == "" {
+		r.Region = firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+	}
+	if r.Region == "" {
+		r.Region = "us-east-1"
+	}
+	if r.Endpoint == "" {
+		r.Endpoint = firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL")
+	}
+	if r.Endpoint != "" {
+		r.PathStyle = true
+	}
+	if r.PartSize == 0 {
+		r.PartSize = DefaultS3PartSize
+	}
+	if r.PartSize < minS3PartSize {
+		r.PartSize = minS3PartSize
+	}
+	if r.Client == nil {
+		r.Client = http.DefaultClient
+	}
+	return &r, nil
+}
+
+// credentialsFromFile reads the keys from the shared credentials file. A
+// missing file isn't an error.
+func (c *S3Config) credentialsFromFile() error {
+	name := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if name == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		name = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	var section string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		v := strings.TrimSpace(kv[1])
+		switch strings.TrimSpace(kv[0]) {
+		case "aws_access_key_id":
+			c.AccessKeyID = v
+		case "aws_secret_access_key":
+			c.SecretAccessKey = v
+		case "aws_session_token":
+			c.SessionToken = v
+		}
+	}
+	return scanner.Err()
+}
+
+func firstEnv(keys ...string) string {
+	for _, k := range keys {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// s3Object is an object in a bucket.
+type s3Object struct {
+	cfg    *S3Config
+	bucket string
+	key    string
+}
+
+// newS3Object returns the s3Object for the resource.
+func newS3Object(r resource) (*s3Object, error) {
+	cfg, err := r.s3.resolve()
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(r.URI)
+	if err != nil {
+		return nil, err
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, fmt.Errorf("s3: %q: expected s3://bucket/key", r.URI)
+	}
+	return &s3Object{cfg: cfg, bucket: u.Host, key: key}, nil
+}
+
+// url returns the URL of the object, with the query, if any.
+func (o *s3Object) url(query url.Values) string {
+	endpoint := o.cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + o.cfg.Region + ".amazonaws.com"
+	}
+	endpoint = strings.TrimRight(endpoint, "/")
+	var u string
+	if o.cfg.PathStyle {
+		u = endpoint + "/" + o.bucket + "/" + s3EscapePath(o.key)
+	} else {
+		i := strings.Index(endpoint, "://") + 3
+		u = endpoint[:i] + o.bucket + "." + endpoint[i:] + "/" + s3EscapePath(o.key)
+	}
+	if len(query) > 0 {
+		u += "?" + s3CanonicalQuery(query)
+	}
+	return u
+}
+
+// do sends a signed request for the object.
+func (o *s3Object) do(method string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, o.url(query), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	signS3Request(req, body, o.cfg, time.Now().UTC())
+	resp, err := o.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, s3ResponseError(method, "s3://"+o.bucket+"/"+o.key, resp)
+	}
+	return resp, nil
+}
+
+// s3Error is the error document returned by S3.
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func s3ResponseError(method, uri string, resp *http.Response) error {
+	b, _ := ioutil.ReadAll(resp.Body)
+	var e s3Error
+	if xml.Unmarshal(b, &e) == nil && e.Code != "" {
+		return fmt.Errorf("s3: %s %s: %s: %s: %s", method, uri, resp.Status, e.Code, e.Message)
+	}
+	return fmt.Errorf("s3: %s %s: %s", method, uri, resp.Status)
+}
+
+// openS3 opens the object for reading.
+func (r resource) openS3() (io.ReadCloser, error) {
+	o, err := newS3Object(r)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := o.do("GET", nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// createS3 returns a writer that uploads to the object.
+func (r resource) createS3() (io.WriteCloser, error) {
+	o, err := newS3Object(r)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Writer{o: o, contentType: ContentType(r.Format)}, nil
+}
+
+// s3Writer uploads what is written to it. Everything is buffered until it
+// exceeds the part size; from then on, a multipart upload is used and each
+// part is uploaded as it fills. The upload is completed by Close.
+type s3Writer struct {
+	o           *s3Object
+	contentType string
+	buf         bytes.Buffer
+	uploadID    string
+	parts       []s3CompletedPart
+	err         error
+}
+
+type s3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, _ := w.buf.Write(p)
+	for w.buf.Len() > w.o.cfg.PartSize {
+		w.err = w.uploadPart(w.buf.Next(w.o.cfg.PartSize))
+		if w.err != nil {
+			w.abort()
+			return n, w.err
+		}
+	}
+	return n, nil
+}
+
+func (w *s3Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.uploadID == "" {
+		resp, err := w.o.do("PUT", nil, http.Header{"Content-Type": {w.contentType}}, w.buf.Bytes())
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+	if w.buf.Len() > 0 {
+		err := w.uploadPart(w.buf.Bytes())
+		if err != nil {
+			w.abort()
+			return err
+		}
+	}
+	err := w.complete()
+	if err != nil {
+		w.abort()
+	}
+	return err
+}
+
+// uploadPart uploads the part, starting the multipart upload if it hasn't
+// been.
+func (w *s3Writer) uploadPart(part []byte) error {
+	if w.uploadID == "" {
+		err := w.initiate()
+		if err != nil {
+			return err
+		}
+	}
+	n := len(w.parts) + 1
+	q := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {w.uploadID}}
+	resp, err := w.o.do("PUT", q, nil, part)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	w.parts = append(w.parts, s3CompletedPart{PartNumber: n, ETag: resp.Header.Get("ETag")})
+	return nil
+}
+
+func (w *s3Writer) initiate() error {
+	resp, err := w.o.do("POST", url.Values{"uploads": {""}}, http.Header{"Content-Type": {w.contentType}}, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return fmt.Errorf("s3: initiate multipart upload: %s", err)
+	}
+	if result.UploadID == "" {
+		return fmt.Errorf("s3: initiate multipart upload: no upload id")
+	}
+	w.uploadID = result.UploadID
+	return nil
+}
+
+func (w *s3Writer) complete() error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+		Parts   []s3CompletedPart `xml:"Part"`
+	}{Parts: w.parts})
+	if err != nil {
+		return err
+	}
+	resp, err := w.o.do("POST", url.Values{"uploadId": {w.uploadID}}, http.Header{"Content-Type": {"application/xml"}}, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// S3 can report an error in the body of a 200 response.
+	b, _ := ioutil.ReadAll(resp.Body)
+	var e s3Error
+	if xml.Unmarshal(b, &e) == nil && e.Code != "" {
+		return fmt.Errorf("s3: complete multipart upload: %s: %s", e.Code, e.Message)
+	}
+	return nil
+}
+
+// abort aborts the multipart upload, if one was started. Errors are ignored;
+// the upload has already failed.
+func (w *s3Writer) abort() {
+	if w.uploadID == "" {
+		return
+	}
+	resp, err := w.o.do("DELETE", url.Values{"uploadId": {w.uploadID}}, nil, nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+}
+
+// signS3Request signs the request using AWS Signature Version 4.
+func signS3Request(req *http.Request, body []byte, cfg *S3Config, t time.Time) {
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+	amzDate := t.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", cfg.SessionToken)
+	}
+	scope := amzDate[:8] + "/" + cfg.Region + "/s3/aws4_request"
+	signedHeaders, signature := s3Signature(req.Method, req.URL.Host, req.URL.EscapedPath(), req.URL.Query(), req.Header, cfg.SecretAccessKey, cfg.Region, amzDate)
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+cfg.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// s3Signature returns the signed headers and the signature of a request.
+// The host, content type, and x-amz-* headers are signed.
+func s3Signature(method, host, escapedPath string, query url.Values, header http.Header, secret, region, amzDate string) (signedHeaders, signature string) {
+	headers := map[string]string{"host": host}
+	for k, v := range header {
+		lk := strings.ToLower(k)
+		if lk == "content-type" || strings.HasPrefix(lk, "x-amz-") {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders string
+	for _, k := range names {
+		canonicalHeaders += k + ":" + headers[k] + "\n"
+	}
+	signedHeaders = strings.Join(names, ";")
+	if escapedPath == "" {
+		escapedPath = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		method,
+		escapedPath,
+		s3CanonicalQuery(query),
+		canonicalHeaders,
+		signedHeaders,
+		header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	scope := amzDate[:8] + "/" + region + "/s3/aws4_request"
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(crHash[:])
+	key := hmacSHA256([]byte("AWS4"+secret), amzDate[:8])
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3CanonicalQuery returns the query sorted by key, with the keys and values
+// escaped the way S3 expects.
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string{}, query[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3EscapePath escapes the key for use in a path; slashes are not escaped.
+func s3EscapePath(key string) string {
+	return s3Escape(key, false)
+}
+
+// s3Escape escapes everything but the unreserved characters, and, if
+// escapeSlash is false, '/'.
+func s3Escape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !escapeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,259 @@
+package transmogrifier
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 is an in-process S3-compatible endpoint. It supports path style
+// GET, PUT, and multipart uploads, and checks the signature of every
+// request.
+type fakeS3 struct {
+	mu           sync.Mutex
+	secret       string
+	objects      map[string][]byte
+	contentTypes map[string]string
+	parts        map[string]map[string][]byte
+	uploads      int
+	aborted      int
+}
+
+func newFakeS3(secret string) *fakeS3 {
+	return &fakeS3{
+		secret:       secret,
+		objects:      map[string][]byte{},
+		contentTypes: map[string]string{},
+		parts:        map[string]map[string][]byte{},
+	}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.validSignature(r) {
+		f.error(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	key := r.URL.Path
+	q := r.URL.Query()
+	switch {
+	case r.Method == "GET":
+		b, ok := f.objects[key]
+		if !ok {
+			f.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Write(b)
+	case r.Method == "PUT" && q.Get("uploadId") == "":
+		f.objects[key] = body
+		f.contentTypes[key] = r.Header.Get("Content-Type")
+	case r.Method == "POST" && q["uploads"] != nil:
+		f.uploads++
+		id := fmt.Sprintf("upload-%d", f.uploads)
+		f.parts[id] = map[string][]byte{}
+		f.contentTypes[key] = r.Header.Get("Content-Type")
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == "PUT":
+		parts, ok := f.parts[q.Get("uploadId")]
+		if !ok {
+			f.error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		parts[q.Get("partNumber")] = body
+		w.Header().Set("ETag", fmt.Sprintf("\"etag-%s\"", q.Get("partNumber")))
+	case r.Method == "POST":
+		parts, ok := f.parts[q.Get("uploadId")]
+		if !ok {
+			f.error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		var complete struct {
+			Parts []s3CompletedPart `xml:"Part"`
+		}
+		xml.Unmarshal(body, &complete)
+		var obj []byte
+		for _, p := range complete.Parts {
+			obj = append(obj, parts[fmt.Sprint(p.PartNumber)]...)
+		}
+		f.objects[key] = obj
+		delete(f.parts, q.Get("uploadId"))
+	case r.Method == "DELETE":
+		f.aborted++
+		delete(f.parts, q.Get("uploadId"))
+	}
+}
+
+func (f *fakeS3) error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>fake s3 error</Message></Error>", code)
+}
+
+func (f *fakeS3) validSignature(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	i := strings.Index(auth, "Signature=")
+	if i < 0 {
+		return false
+	}
+	scope := strings.Split(strings.SplitN(auth, "Credential=", 2)[1], "/")
+	_, sig := s3Signature(r.Method, r.Host, r.URL.EscapedPath(), r.URL.Query(), r.Header, f.secret, scope[2], r.Header.Get("X-Amz-Date"))
+	return sig == auth[i+len("Signature="):]
+}
+
+func TestS3Resource(t *testing.T) {
+	fake := newFakeS3("secret")
+	fake.objects["/bucket/data/test.csv"] = []byte("a,b\n1,2\n")
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+	cfg := &S3Config{AccessKeyID: "key", SecretAccessKey: "secret", Region: "eu-west-1", Endpoint: ts.URL}
+
+	c := NewCSV()
+	c.SetS3Config(cfg)
+	c.SetSource("s3://bucket/data/test.csv")
+	err := c.ReadSource()
+	if err != nil {
+		t.Fatalf("read: expected no error, got %q", err)
+	}
+	if strings.Join(c.HeaderRow(), ",") != "a,b" || len(c.Rows()) != 1 {
+		t.Errorf("read: unexpected data %v %v", c.HeaderRow(), c.Rows())
+	}
+
+	c.SetSource("s3://bucket/data/missing.csv")
+	err = c.ReadSource()
+	if err == nil || err.Error() != "s3: GET s3://bucket/data/missing.csv: 404 Not Found: NoSuchKey: fake s3 error" {
+		t.Errorf("missing: expected NoSuchKey error, got %v", err)
+	}
+
+	md := NewMDTable()
+	md.SetS3Config(cfg)
+	md.TransmogrifyStringTable([][]string{[]string{"a", "b"}})
+	md.SetDest("s3://bucket/out/a table.md")
+	_, _, err = md.WriteToFile()
+	if err != nil {
+		t.Fatalf("write: expected no error, got %q", err)
+	}
+	if string(fake.objects["/bucket/out/a table.md"]) != md.String() {
+		t.Errorf("write: expected %q, got %q", md.String(), fake.objects["/bucket/out/a table.md"])
+	}
+	if fake.contentTypes["/bucket/out/a table.md"] != "text/markdown" {
+		t.Errorf("write: expected text/markdown, got %q", fake.contentTypes["/bucket/out/a table.md"])
+	}
+
+	bad := *cfg
+	bad.SecretAccessKey = "wrong"
+	md.SetS3Config(&bad)
+	_, _, err = md.WriteToFile()
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("bad credentials: expected SignatureDoesNotMatch, got %v", err)
+	}
+}
+
+func TestS3MultipartUpload(t *testing.T) {
+	fake := newFakeS3("secret")
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+	cfg := &S3Config{AccessKeyID: "key", SecretAccessKey: "secret", Endpoint: ts.URL, PartSize: minS3PartSize}
+
+	r := NewResource("s3://bucket/big.csv", FmtCSV, File)
+	r.s3 = cfg
+	data := bytes.Repeat([]byte("0123456789abcdef"), (minS3PartSize*2+1024)/16)
+	w, err := r.Create()
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	for i := 0; i < len(data); i += 1 << 20 {
+		end := i + 1<<20
+		if end > len(data) {
+			end = len(data)
+		}
+		_, err = w.Write(data[i:end])
+		if err != nil {
+			t.Fatalf("expected no error, got %q", err)
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	if fake.uploads != 1 {
+		t.Errorf("expected 1 multipart upload, got %d", fake.uploads)
+	}
+	if !bytes.Equal(fake.objects["/bucket/big.csv"], data) {
+		t.Errorf("expected %d bytes, got %d", len(data), len(fake.objects["/bucket/big.csv"]))
+	}
+	if fake.contentTypes["/bucket/big.csv"] != "text/csv" {
+		t.Errorf("expected text/csv, got %q", fake.contentTypes["/bucket/big.csv"])
+	}
+}
+
+func TestS3ConfigResolve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	creds := filepath.Join(dir, "credentials")
+	ioutil.WriteFile(creds, []byte("[default]\naws_access_key_id = filekey\naws_secret_access_key = filesecret\n\n[other]\naws_access_key_id = otherkey\naws_secret_access_key = othersecret\n"), 0600)
+	for _, k := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_REGION", "AWS_DEFAULT_REGION", "AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL", "AWS_PROFILE"} {
+		t.Setenv(k, "")
+	}
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", creds)
+
+	cfg, err := (*S3Config)(nil).resolve()
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	if cfg.AccessKeyID != "filekey" || cfg.SecretAccessKey != "filesecret" || cfg.Region != "us-east-1" || cfg.PathStyle || cfg.PartSize != DefaultS3PartSize {
+		t.Errorf("file: unexpected config %+v", cfg)
+	}
+
+	t.Setenv("AWS_PROFILE", "other")
+	cfg, _ = (*S3Config)(nil).resolve()
+	if cfg.AccessKeyID != "otherkey" {
+		t.Errorf("profile: expected otherkey, got %q", cfg.AccessKeyID)
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "envkey")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "envsecret")
+	t.Setenv("AWS_REGION", "eu-central-1")
+	t.Setenv("AWS_ENDPOINT_URL", "http://localhost:9000")
+	cfg, _ = (&S3Config{PartSize: 1}).resolve()
+	if cfg.AccessKeyID != "envkey" || cfg.Region != "eu-central-1" || cfg.Endpoint != "http://localhost:9000" || !cfg.PathStyle || cfg.PartSize != minS3PartSize {
+		t.Errorf("env: unexpected config %+v", cfg)
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "missing"))
+	_, err = (*S3Config)(nil).resolve()
+	if err == nil || err.Error() != "s3: no credentials found" {
+		t.Errorf("expected no credentials error, got %v", err)
+	}
+}
+
+func TestS3ObjectURL(t *testing.T) {
+	tests := []struct {
+		cfg      S3Config
+		expected string
+	}{
+		{S3Config{Region: "us-west-2"}, "https://bucket.s3.us-west-2.amazonaws.com/path/a%20b%2Bc.csv"},
+		{S3Config{Region: "us-west-2", PathStyle: true}, "https://s3.us-west-2.amazonaws.com/bucket/path/a%20b%2Bc.csv"},
+		{S3Config{Endpoint: "http://localhost:9000/", PathStyle: true}, "http://localhost:9000/bucket/path/a%20b%2Bc.csv"},
+	}
+	for i, test := range tests {
+		cfg := test.cfg
+		o := &s3Object{cfg: &cfg, bucket: "bucket", key: "path/a b+c.csv"}
+		if o.url(nil) != test.expected {
+			t.Errorf("%d: expected %q, got %q", i, test.expected, o.url(nil))
+		}
+	}
+}
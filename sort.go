@@ -0,0 +1,491 @@
+package transmogrifier
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Sort orders the rows of a table by one or more keys. A key is a column,
+// referenced as in a Projection, followed by its options:
+//
+//	asc, desc                 the order; asc is the default
+//	nulls first, nulls last   where empty values go, in either order; last
+//	                          is the default
+//	auto, string, text, number, currency, date, natural
+//	                          how the values are compared; see SortType
+//
+// e.g. 'priority desc, due date nulls first, version natural'. Rows with
+// equal keys keep their order.
+type Sort struct {
+	keys     []SortKey
+	collator Collator
+}
+
+// SortKey is a key of a Sort.
+type SortKey struct {
+	// Column is a column name, or a '#' position, as in a Projection.
+	Column string
+	Desc   bool
+	Type   SortType
+	// NullsFirst: empty values go before the other values, instead of
+	// after them.
+	NullsFirst bool
+}
+
+// SortType is how the values of a sort key are compared. Values that can't
+// be parsed as the type go after those that can, in either order, and are
+// compared as strings.
+type SortType int
+
+// The sort types.
+const (
+	// SortAuto compares values using the column's inferred type: numbers,
+	// dates, and datetimes are compared as such; currency amounts, e.g.
+	// '$1,200.00', as numbers; version-like values, e.g. '1.10.2',
+	// naturally; and anything else as text.
+	SortAuto SortType = iota
+	// SortString compares values byte by byte.
+	SortString
+	// SortText compares values with the Sort's Collator.
+	SortText
+	SortNumber
+	// SortCurrency compares amounts, e.g. '$1,200.00' or '(5.00)', as
+	// numbers.
+	SortCurrency
+	// SortDate compares dates and datetimes.
+	SortDate
+	// SortNatural compares runs of digits as numbers, e.g. 'v1.9' is
+	// before 'v1.10'.
+	SortNatural
+)
+
+var sortTypeNames = map[string]SortType{
+	"auto":     SortAuto,
+	"string":   SortString,
+	"text":     SortText,
+	"number":   SortNumber,
+	"currency": SortCurrency,
+	"date":     SortDate,
+	"natural":  SortNatural,
+}
+
+// Collator compares strings, e.g. for a language: -1, 0, or 1. The
+// *collate.Collator of golang.org/x/text/collate is a Collator.
+type Collator interface {
+	CompareString(a, b string) int
+}
+
+// NewSort returns a Sort by the keys.
+func NewSort(keys ...SortKey) *Sort {
+	return &Sort{keys: keys}
+}
+
+// ParseSort parses a comma separated list of sort keys, e.g.
+// 'priority desc, due nulls first'.
+func ParseSort(s string) (*Sort, error) {
+	items, err := splitUnquoted(s)
+	if err != nil {
+		return nil, fmt.Errorf("sort %q: %s", s, err)
+	}
+	return parseSortKeys(items)
+}
+
+// parseSortKeys parses the keys of a sort, e.g. the values of a format
+// file's 'sort' directive. Empty keys are ignored.
+func parseSortKeys(items []string) (*Sort, error) {
+	srt := &Sort{}
+	for _, s := range items {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		key, err := parseSortKey(s)
+		if err != nil {
+			return nil, fmt.Errorf("sort key %q: %s", s, err)
+		}
+		srt.keys = append(srt.keys, key)
+	}
+	if len(srt.keys) == 0 {
+		return nil, fmt.Errorf("sort: no keys")
+	}
+	return srt, nil
+}
+
+// parseSortKey parses a column and its options. The options are the words
+// at the end of the key, so unquoted names can have spaces, e.g.
+// 'Unit Price desc'.
+func parseSortKey(s string) (SortKey, error) {
+	var key SortKey
+	var words []string
+	quoted := strings.HasPrefix(s, `"`)
+	if quoted {
+		i := strings.Index(s[1:], `"`)
+		if i < 0 {
+			return key, fmt.Errorf("unterminated quote")
+		}
+		key.Column, words = s[:i+2], strings.Fields(s[i+2:])
+	} else {
+		words = strings.Fields(s)
+	}
+	var order, nulls, typ bool
+	for len(words) > 0 {
+		w := strings.ToLower(words[len(words)-1])
+		t, isType := sortTypeNames[w]
+		// n is the number of words of the option.
+		n := 0
+		switch {
+		case w == "asc" || w == "desc" || isType:
+			n = 1
+		case (w == "first" || w == "last") && len(words) > 1 && strings.EqualFold(words[len(words)-2], "nulls"):
+			n = 2
+		}
+		// an unquoted key's first word is always its column.
+		if !quoted && n >= len(words) {
+			break
+		}
+		if n == 0 {
+			if quoted {
+				return key, fmt.Errorf("unknown option %q", words[len(words)-1])
+			}
+			break
+		}
+		switch {
+		case n == 2:
+			if nulls {
+				return key, fmt.Errorf("more than one null placement")
+			}
+			nulls, key.NullsFirst = true, w == "first"
+		case isType:
+			if typ {
+				return key, fmt.Errorf("more than one type")
+			}
+			typ, key.Type = true, t
+		default:
+			if order {
+				return key, fmt.Errorf("more than one order")
+			}
+			order, key.Desc = true, w == "desc"
+		}
+		words = words[:len(words)-n]
+	}
+	if !quoted {
+		key.Column = strings.Join(words, " ")
+	}
+	if _, err := parseColumnRef(key.Column); err != nil {
+		return key, err
+	}
+	return key, nil
+}
+
+// SetCollator sets the Collator of SortText keys. By default, text is
+// compared ignoring case and the accents of Latin letters; values that are
+// equal are then compared byte by byte.
+func (s *Sort) SetCollator(c Collator) {
+	s.collator = c
+}
+
+// Apply returns the rows sorted by the keys. The types of SortAuto keys are
+// inferred from the rows.
+func (s *Sort) Apply(header []string, rows [][]string) ([][]string, error) {
+	n := tableWidth(rows)
+	if len(header) > n {
+		n = len(header)
+	}
+	// values are the parsed values of each key, for each row.
+	values := make([][]sortValue, len(s.keys))
+	types := make([]SortType, len(s.keys))
+	for i, key := range s.keys {
+		ref, err := parseColumnRef(key.Column)
+		if err != nil {
+			return nil, fmt.Errorf("sort key %q: %s", key.Column, err)
+		}
+		col, err := ref.resolve(header, n)
+		if err != nil {
+			return nil, err
+		}
+		types[i] = key.Type
+		if types[i] == SortAuto {
+			types[i] = inferSortType(rows, col)
+		}
+		values[i] = make([]sortValue, len(rows))
+		for j, row := range rows {
+			var v string
+			if col < len(row) {
+				v = row[col]
+			}
+			values[i][j] = parseSortValue(v, types[i])
+		}
+	}
+	collator := s.collator
+	if collator == nil {
+		collator = foldCollator{}
+	}
+	order := make([]int, len(rows))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		for i, key := range s.keys {
+			c := compareSortValues(values[i][order[a]], values[i][order[b]], types[i], key, collator)
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	out := make([][]string, len(rows))
+	for i, j := range order {
+		out[i] = rows[j]
+	}
+	return out, nil
+}
+
+// Sort returns the rows sorted by the Sort.
+func (c *CSV) Sort(s *Sort) ([][]string, error) {
+	return s.Apply(c.headerRow, c.rows)
+}
+
+// sortValue is a value of a sort key. ok is whether it was parsed as the
+// key's type.
+type sortValue struct {
+	s    string
+	null bool
+	ok   bool
+	n    float64
+	t    time.Time
+}
+
+// parseSortValue parses v as the sort type.
+func parseSortValue(v string, typ SortType) sortValue {
+	sv := sortValue{s: v, ok: true}
+	t := strings.TrimSpace(v)
+	if t == "" {
+		sv.null = true
+		return sv
+	}
+	var err error
+	switch typ {
+	case SortNumber:
+		sv.n, err = strconv.ParseFloat(t, 64)
+		sv.ok = err == nil
+	case SortCurrency:
+		sv.n, sv.ok = parseCurrency(t)
+	case SortDate:
+		sv.t, sv.ok = parseLayouts(t, dateLayouts)
+		if !sv.ok {
+			sv.t, sv.ok = parseLayouts(t, dateTimeLayouts)
+		}
+	}
+	return sv
+}
+
+// compareSortValues compares a and b for the key: -1, 0, or 1.
+func compareSortValues(a, b sortValue, typ SortType, key SortKey, collator Collator) int {
+	if a.null || b.null {
+		switch {
+		case a.null == b.null:
+			return 0
+		case a.null == key.NullsFirst:
+			return -1
+		}
+		return 1
+	}
+	// values that can't be parsed as the type follow those that can, in
+	// either order.
+	if a.ok != b.ok {
+		if a.ok {
+			return -1
+		}
+		return 1
+	}
+	var c int
+	switch {
+	case !a.ok:
+		c = strings.Compare(a.s, b.s)
+	default:
+		switch typ {
+		case SortNumber, SortCurrency:
+			c = compareFloats(a.n, b.n)
+		case SortDate:
+			c = compareFloats(float64(a.t.Sub(b.t)), 0)
+		case SortText:
+			c = collator.CompareString(a.s, b.s)
+		case SortNatural:
+			c = compareNatural(a.s, b.s)
+		default:
+			c = strings.Compare(a.s, b.s)
+		}
+	}
+	if key.Desc {
+		return -c
+	}
+	return c
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// versionRe matches version-like values, e.g. '1.2', 'v1.10.2', and
+// '2.0.0-rc1'.
+var versionRe = regexp.MustCompile(`^[vV]?\d+(\.\d+)+([-+.][0-9A-Za-z.]+)?$`)
+
+// inferSortType returns the sort type of the column.
+func inferSortType(rows [][]string, col int) SortType {
+	switch inferColumnType(rows, col, isEmpty) {
+	case TypeInt, TypeFloat:
+		return SortNumber
+	case TypeDate, TypeDateTime:
+		return SortDate
+	case TypeBool:
+		return SortString
+	}
+	currency, version, seen := true, true, false
+	for _, row := range rows {
+		if col >= len(row) {
+			continue
+		}
+		v := strings.TrimSpace(row[col])
+		if v == "" {
+			continue
+		}
+		seen = true
+		if currency {
+			_, ok := parseCurrency(v)
+			// plain numbers, e.g. ids with leading zeros, aren't amounts.
+			currency = ok && strings.ContainsAny(v, currencySymbols+",(")
+		}
+		version = version && versionRe.MatchString(v)
+	}
+	switch {
+	case !seen:
+		return SortString
+	case currency:
+		return SortCurrency
+	case version:
+		return SortNatural
+	}
+	return SortText
+}
+
+// currencySymbols are the currency symbols that amounts can have.
+const currencySymbols = "$€£¥₹"
+
+// parseCurrency parses an amount, e.g. '$1,200.50', '-€5', or '(5.00)', a
+// negative amount.
+func parseCurrency(s string) (float64, bool) {
+	var neg bool
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		neg, s = true, strings.TrimSpace(s[1:len(s)-1])
+	}
+	if strings.HasPrefix(s, "-") {
+		neg, s = !neg, s[1:]
+	}
+	s = strings.TrimLeft(s, currencySymbols)
+	if strings.HasPrefix(s, "-") {
+		neg, s = !neg, s[1:]
+	}
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(strings.Replace(s, ",", "", -1), 64)
+	if err != nil {
+		return 0, false
+	}
+	if neg {
+		n = -n
+	}
+	return n, true
+}
+
+// compareNatural compares a and b, comparing runs of digits as numbers.
+func compareNatural(a, b string) int {
+	for a != "" && b != "" {
+		da, db := isDigit(a[0]), isDigit(b[0])
+		if da && db {
+			na, nb := digitRun(a), digitRun(b)
+			// without leading zeros, the longer number is larger.
+			ta, tb := strings.TrimLeft(a[:na], "0"), strings.TrimLeft(b[:nb], "0")
+			if c := compareFloats(float64(len(ta)), float64(len(tb))); c != 0 {
+				return c
+			}
+			if c := strings.Compare(ta, tb); c != 0 {
+				return c
+			}
+			a, b = a[na:], b[nb:]
+			continue
+		}
+		if a[0] != b[0] {
+			return strings.Compare(a[:1], b[:1])
+		}
+		a, b = a[1:], b[1:]
+	}
+	return compareFloats(float64(len(a)), float64(len(b)))
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// digitRun returns the length of the run of digits that s starts with.
+func digitRun(s string) int {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return i
+}
+
+// foldCollator compares strings ignoring case and the accents of Latin
+// letters; strings that are equal are then compared byte by byte, so the
+// order is deterministic.
+type foldCollator struct{}
+
+func (foldCollator) CompareString(a, b string) int {
+	if c := strings.Compare(foldText(a), foldText(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+// foldAccents maps accented Latin letters to their base letter.
+var foldAccents = map[rune]string{}
+
+func init() {
+	for base, accented := range map[string]string{
+		"a": "àáâãäåāăą", "c": "çćĉċč", "d": "ďđ", "e": "èéêëēĕėęě",
+		"g": "ĝğġģ", "h": "ĥħ", "i": "ìíîïĩīĭįı", "j": "ĵ", "k": "ķ",
+		"l": "ĺļľŀł", "n": "ñńņňŉ", "o": "òóôõöøōŏő", "r": "ŕŗř",
+		"s": "śŝşš", "t": "ţťŧ", "u": "ùúûüũūŭůűų", "w": "ŵ", "y": "ýÿŷ",
+		"z": "źżž", "ae": "æ", "oe": "œ", "ss": "ß", "th": "þ",
+	} {
+		for _, r := range accented {
+			foldAccents[r] = base
+		}
+	}
+}
+
+// foldText returns s in lower case, without the accents of Latin letters.
+func foldText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		r = unicode.ToLower(r)
+		if base, ok := foldAccents[r]; ok {
+			b.WriteString(base)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
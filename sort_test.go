@@ -0,0 +1,121 @@
+package transmogrifier
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSortApply(t *testing.T) {
+	header := []string{"id", "name", "priority", "due", "price", "version", "Unit Price", "ref", "code"}
+	rows := [][]string{
+		[]string{"1", "émile", "2", "2024-07-15", "$1,200.00", "1.10.0", "10", "5", "a10"},
+		[]string{"2", "Bob", "10", "", "$95.50", "1.9.2", "9.5", "n/a", "a9"},
+		[]string{"3", "alice", "2", "2024-05-01", "(5.00)", "v2.0.0", "", "10", "A1"},
+		[]string{"4", "eve", "", "2023-12-31", "", "", "100", "", "b2"},
+	}
+	tests := []struct {
+		spec        string
+		expected    []string
+		expectedErr string
+	}{
+		{"priority", []string{"1", "3", "2", "4"}, ""},
+		{"id desc", []string{"4", "3", "2", "1"}, ""},
+		{"priority, id desc", []string{"3", "1", "2", "4"}, ""},
+		{"priority desc nulls first", []string{"4", "2", "1", "3"}, ""},
+		{"due", []string{"4", "3", "1", "2"}, ""},
+		{"due desc", []string{"1", "3", "4", "2"}, ""},
+		{"price", []string{"3", "2", "1", "4"}, ""},
+		{"price desc nulls first", []string{"4", "1", "2", "3"}, ""},
+		{"version", []string{"2", "1", "3", "4"}, ""},
+		{"name", []string{"3", "2", "1", "4"}, ""},
+		{"name string", []string{"2", "3", "4", "1"}, ""},
+		{"Unit Price desc", []string{"4", "1", "2", "3"}, ""},
+		{`"Unit Price" NUMBER ASC`, []string{"2", "1", "4", "3"}, ""},
+		{"code", []string{"3", "1", "2", "4"}, ""},
+		{"code natural", []string{"3", "2", "1", "4"}, ""},
+		// values that aren't numbers are compared as strings.
+		{"name number", []string{"2", "3", "4", "1"}, ""},
+		// and follow the numbers, in either order.
+		{"ref number", []string{"1", "3", "2", "4"}, ""},
+		{"ref number desc", []string{"3", "1", "2", "4"}, ""},
+		{"#3 desc, #-1", []string{"2", "3", "1", "4"}, ""},
+		{"status", nil, `unknown column "status"`},
+		{"id desc asc", nil, `sort key "id desc asc": more than one order`},
+		{"id number date", nil, `sort key "id number date": more than one type`},
+		{`"id" sideways`, nil, `sort key "\"id\" sideways": unknown option "sideways"`},
+		{"#0", nil, `sort key "#0": invalid column position: "#0"`},
+		{" , ", nil, "sort: no keys"},
+		{`"id`, nil, `sort "\"id": unterminated quote`},
+	}
+	for i, test := range tests {
+		s, err := ParseSort(test.spec)
+		var r [][]string
+		if err == nil {
+			r, err = s.Apply(header, rows)
+		}
+		if err != nil {
+			if err.Error() != test.expectedErr {
+				t.Errorf("%d: expected error %q, got %q", i, test.expectedErr, err)
+			}
+			continue
+		}
+		if test.expectedErr != "" {
+			t.Errorf("%d: expected error %q, got none", i, test.expectedErr)
+			continue
+		}
+		var ids []string
+		for _, row := range r {
+			ids = append(ids, row[0])
+		}
+		if !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("%d: %s: expected %q, got %q", i, test.spec, test.expected, ids)
+		}
+	}
+}
+
+func TestCompareNatural(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"v1.9", "v1.10", -1},
+		{"file2", "file10", -1},
+		{"file010", "file9", 1},
+		{"a", "a1", -1},
+		{"1.2.3", "1.2.3", 0},
+		{"b1", "a2", 1},
+	}
+	for i, test := range tests {
+		c := compareNatural(test.a, test.b)
+		if c != test.expected {
+			t.Errorf("%d: %s, %s: expected %d, got %d", i, test.a, test.b, test.expected, c)
+		}
+	}
+}
+
+// reverseCollator orders strings in reverse.
+type reverseCollator struct{}
+
+func (reverseCollator) CompareString(a, b string) int {
+	return strings.Compare(b, a)
+}
+
+func TestCSVSort(t *testing.T) {
+	c := NewCSV()
+	c.SetHasHeader(true)
+	err := c.Read(strings.NewReader("name,n\nb,1\na,2\nc,1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSort(SortKey{Column: "n", Desc: true}, SortKey{Column: "name", Type: SortText})
+	s.SetCollator(reverseCollator{})
+	rows, err := c.Sort(s)
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	expected := [][]string{{"a", "2"}, {"c", "1"}, {"b", "1"}}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("expected %q, got %q", expected, rows)
+	}
+}
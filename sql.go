@@ -0,0 +1,327 @@
+package transmogrifier
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// SQLDialect is the SQL dialect that statements are generated for.
+type SQLDialect int
+
+const (
+	PostgreSQL SQLDialect = iota
+	MySQL
+	SQLite
+)
+
+func (d SQLDialect) String() string { return sqlDialects[d] }
+
+var sqlDialects = [...]string{
+	"postgresql",
+	"mysql",
+	"sqlite",
+}
+
+// SQLDialectFromString returns the SQLDialect constant. PostgreSQL is returned
+// for anything that isn't recognized.
+func SQLDialectFromString(s string) SQLDialect {
+	s = strings.ToLower(s)
+	switch s {
+	case "mysql", "mariadb":
+		return MySQL
+	case "sqlite", "sqlite3":
+		return SQLite
+	}
+	return PostgreSQL
+}
+
+// sqlColumnTypes are the column definitions for each ColumnType, by dialect.
+var sqlColumnTypes = map[SQLDialect][]string{
+	PostgreSQL: {"TEXT", "BOOLEAN", "BIGINT", "DOUBLE PRECISION", "DATE", "TIMESTAMP"},
+	MySQL:      {"TEXT", "BOOLEAN", "BIGINT", "DOUBLE", "DATE", "DATETIME"},
+	SQLite:     {"TEXT", "INTEGER", "INTEGER", "REAL", "TEXT", "TEXT"},
+}
+
+// SQLTable is a struct for generating SQL statements, a CREATE TABLE statement
+// and INSERT statements, from table data.
+type SQLTable struct {
+	// data source, if applicable. The table name defaults to the source
+	// name without its extension.
+	source resource
+	// sink, if applicable
+	dest resource
+	// dialect is the SQL dialect to generate.
+	dialect SQLDialect
+	// tableName is the name of the table. If it isn't set, the source's
+	// name is used.
+	tableName string
+	// createTable: whether the CREATE TABLE statement is generated.
+	createTable bool
+	// batchSize is the number of rows per INSERT statement.
+	batchSize int
+	// nullValues are the values that are inserted as NULL.
+	nullValues []string
+	// hasColumnNames: whether the first row of the table is the column names.
+	hasColumnNames bool
+	// columnNames contains the name of each column
+	columnNames []string
+	// columnTypes contains the type of each column. If it isn't set, the
+	// types are inferred from the data.
+	columnTypes []ColumnType
+	// sql is the generated sql, in bytes
+	sql []byte
+}
+
+// NewSQLTable returns a SQLTable that generates PostgreSQL, including the
+// CREATE TABLE statement, with 100 rows per INSERT. Empty values are NULL.
+func NewSQLTable() *SQLTable {
+	return &SQLTable{
+		dialect:     PostgreSQL,
+		createTable: true,
+		batchSize:   100,
+		nullValues:  []string{""},
+		columnNames: []string{},
+		sql:         []byte{},
+	}
+}
+
+func (s SQLTable) String() string {
+	return string(s.sql)
+}
+
+func (s SQLTable) Bytes() []byte {
+	return s.sql
+}
+
+// SetSource sets the source; its name is the default table name.
+func (s *SQLTable) SetSource(src string) {
+	s.source = NewResource(src, FmtCSV, File)
+}
+
+// SetDialect sets the SQL dialect.
+func (s *SQLTable) SetDialect(d SQLDialect) {
+	s.dialect = d
+}
+
+// SetTableName sets the name of the table.
+func (s *SQLTable) SetTableName(n string) {
+	s.tableName = n
+}
+
+// SetCreateTable: whether or not the CREATE TABLE statement is generated.
+func (s *SQLTable) SetCreateTable(b bool) {
+	s.createTable = b
+}
+
+// SetBatchSize sets the number of rows per INSERT statement. Anything less
+// than 1 results in 1 row per INSERT.
+func (s *SQLTable) SetBatchSize(i int) {
+	s.batchSize = i
+}
+
+// SetNullValues sets the values that are inserted as NULL.
+func (s *SQLTable) SetNullValues(vals []string) {
+	s.nullValues = make([]string, len(vals))
+	copy(s.nullValues, vals)
+}
+
+// SetHasColumnNames
+func (s *SQLTable) SetHasColumnNames(b bool) {
+	s.hasColumnNames = b
+}
+
+// SetColumnNames
+func (s *SQLTable) SetColumnNames(cols []string) {
+	s.columnNames = make([]string, len(cols))
+	copy(s.columnNames, cols)
+}
+
+// SetColumnAlignment is a no-op: alignment doesn't apply to SQL.
+func (s *SQLTable) SetColumnAlignment(cols []string) {}
+
+// SetColumnTypes sets the column types; this overrides type inference.
+func (s *SQLTable) SetColumnTypes(types []ColumnType) {
+	s.columnTypes = make([]ColumnType, len(types))
+	copy(s.columnTypes, types)
+}
+
+// TableName returns the table name: the set name, if there is one, otherwise
+// the source name without its extension.
+func (s *SQLTable) TableName() string {
+	if s.tableName != "" {
+		return s.tableName
+	}
+	n := s.source.Name
+	return strings.TrimSuffix(n, path.Ext(n))
+}
+
+// TransmogrifyCSV generates the SQL for the CSV's header row and rows. If the
+// SQLTable doesn't have a source, the CSV's source is used.
+func (s *SQLTable) TransmogrifyCSV(c *CSV) error {
+	if s.source.Name == "" {
+		s.source = c.source
+	}
+	if len(c.HeaderRow()) > 0 {
+		s.SetColumnNames(c.HeaderRow())
+	}
+	hasColumnNames := s.hasColumnNames
+	s.hasColumnNames = false
+	defer func() { s.hasColumnNames = hasColumnNames }()
+	return s.TransmogrifyStringTable(c.Rows())
+}
+
+// TransmogrifyStringTable generates the SQL for the table. The result is held
+// in sql and can be obtained by s.String() or s.Bytes().
+func (s *SQLTable) TransmogrifyStringTable(t [][]string) error {
+	if t == nil {
+		return fmt.Errorf("unable to tranmogrify string table: received nil")
+	}
+	if s.hasColumnNames && len(t) > 0 {
+		s.SetColumnNames(t[0])
+		t = t[1:]
+	}
+	if len(s.columnNames) == 0 {
+		return fmt.Errorf("unable to generate sql: no column names")
+	}
+	name := s.TableName()
+	if name == "" {
+		return fmt.Errorf("unable to generate sql: no table name")
+	}
+	types := s.columnTypes
+	if len(types) == 0 {
+		types = inferColumnTypes(t, s.isNull)
+	}
+	// rows may be shorter than the header; those columns are strings.
+	for len(types) < len(s.columnNames) {
+		types = append(types, TypeString)
+	}
+	if s.createTable {
+		s.appendCreateTable(name, types)
+	}
+	batch := s.batchSize
+	if batch < 1 {
+		batch = 1
+	}
+	for i := 0; i < len(t); i += batch {
+		end := i + batch
+		if end > len(t) {
+			end = len(t)
+		}
+		err := s.appendInsert(name, types, t[i:end], i)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendCreateTable appends the CREATE TABLE statement.
+func (s *SQLTable) appendCreateTable(name string, types []ColumnType) {
+	s.sql = append(s.sql, "CREATE TABLE "+s.quoteIdentifier(name)+" (\n"...)
+	for i, col := range s.columnNames {
+		s.sql = append(s.sql, "\t"+s.quoteIdentifier(col)+" "+sqlColumnTypes[s.dialect][types[i]]...)
+		if i < len(s.columnNames)-1 {
+			s.sql = append(s.sql, ',')
+		}
+		s.sql = append(s.sql, '\n')
+	}
+	s.sql = append(s.sql, ");\n"...)
+}
+
+// appendInsert appends an INSERT statement for the rows. offset is the index
+// of the first row, for error reporting.
+func (s *SQLTable) appendInsert(name string, types []ColumnType, rows [][]string, offset int) error {
+	cols := make([]string, len(s.columnNames))
+	for i, col := range s.columnNames {
+		cols[i] = s.quoteIdentifier(col)
+	}
+	s.sql = append(s.sql, "INSERT INTO "+s.quoteIdentifier(name)+" ("+strings.Join(cols, ", ")+") VALUES\n"...)
+	for i, row := range rows {
+		if len(row) > len(s.columnNames) {
+			return fmt.Errorf("row %d: expected at most %d columns, got %d", offset+i, len(s.columnNames), len(row))
+		}
+		vals := make([]string, len(s.columnNames))
+		for j := range vals {
+			if j >= len(row) || s.isNull(row[j]) {
+				vals[j] = "NULL"
+				continue
+			}
+			vals[j] = s.literal(row[j], types[j])
+		}
+		s.sql = append(s.sql, "\t("+strings.Join(vals, ", ")+")"...)
+		if i < len(rows)-1 {
+			s.sql = append(s.sql, ",\n"...)
+		}
+	}
+	s.sql = append(s.sql, ";\n"...)
+	return nil
+}
+
+// isNull returns whether v is one of the null values.
+func (s *SQLTable) isNull(v string) bool {
+	for _, n := range s.nullValues {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteIdentifier quotes a table or column name for the dialect.
+func (s *SQLTable) quoteIdentifier(id string) string {
+	if s.dialect == MySQL {
+		return "`" + strings.Replace(id, "`", "``", -1) + "`"
+	}
+	return `"` + strings.Replace(id, `"`, `""`, -1) + `"`
+}
+
+// literal returns v as a literal of the type for the dialect.
+func (s *SQLTable) literal(v string, typ ColumnType) string {
+	switch typ {
+	case TypeInt, TypeFloat:
+		// values that aren't decimal numbers, e.g. NaN, aren't valid
+		// numeric literals, so they are quoted.
+		if n := strings.TrimSpace(v); isDecimal(n) {
+			return n
+		}
+	case TypeBool:
+		b := strings.ToLower(strings.TrimSpace(v)) == "true"
+		if s.dialect == SQLite {
+			if b {
+				return "1"
+			}
+			return "0"
+		}
+		if b {
+			return "TRUE"
+		}
+		return "FALSE"
+	case TypeDate, TypeDateTime:
+		v = strings.TrimSpace(v)
+	}
+	v = strings.Replace(v, "'", "''", -1)
+	// MySQL treats backslashes in string literals as escapes.
+	if s.dialect == MySQL {
+		v = strings.Replace(v, `\`, `\\`, -1)
+	}
+	return "'" + v + "'"
+}
+
+// SetDest sets the destination of the Write operation.
+func (s *SQLTable) SetDest(d string) {
+	dest := s.dest
+	s.dest = NewResource(d, FmtSQL, File)
+	s.dest.copyConfig(dest)
+}
+
+// SetWriteOptions sets how the dest is written, when it is a local file.
+func (s *SQLTable) SetWriteOptions(opts *WriteOptions) {
+	s.dest.write = opts
+}
+
+// WriteToFile saves the sql to the destination.
+func (s *SQLTable) WriteToFile() (name string, n int, err error) {
+	n, err = writeResource(s.dest, s.sql)
+	return s.dest.String(), n, err
+}
@@ -0,0 +1,165 @@
+package transmogrifier
+
+import "testing"
+
+func TestSQLTableTransmogrifyStringTable(t *testing.T) {
+	rows := [][]string{
+		[]string{"Item", "Qty", "Price", "In stock", "Note"},
+		[]string{"towel", "42", "19.99", "true", "don't panic"},
+		[]string{"string", "", "9.99", "false", `a\b`},
+		[]string{"blaster", "3", "10", "TRUE", ""},
+	}
+	tests := []struct {
+		dialect     SQLDialect
+		tableName   string
+		batchSize   int
+		createTable bool
+		expected    string
+	}{
+		{PostgreSQL, "", 2, true, `CREATE TABLE "test" (
+	"Item" TEXT,
+	"Qty" BIGINT,
+	"Price" DOUBLE PRECISION,
+	"In stock" BOOLEAN,
+	"Note" TEXT
+);
+INSERT INTO "test" ("Item", "Qty", "Price", "In stock", "Note") VALUES
+	('towel', 42, 19.99, TRUE, 'don''t panic'),
+	('string', NULL, 9.99, FALSE, 'a\b');
+INSERT INTO "test" ("Item", "Qty", "Price", "In stock", "Note") VALUES
+	('blaster', 3, 10, TRUE, NULL);
+`},
+		{MySQL, "items", 0, false, "INSERT INTO `items` (`Item`, `Qty`, `Price`, `In stock`, `Note`) VALUES\n" +
+			"\t('towel', 42, 19.99, TRUE, 'don''t panic');\n" +
+			"INSERT INTO `items` (`Item`, `Qty`, `Price`, `In stock`, `Note`) VALUES\n" +
+			"\t('string', NULL, 9.99, FALSE, 'a\\\\b');\n" +
+			"INSERT INTO `items` (`Item`, `Qty`, `Price`, `In stock`, `Note`) VALUES\n" +
+			"\t('blaster', 3, 10, TRUE, NULL);\n"},
+		{SQLite, "items", 100, true, `CREATE TABLE "items" (
+	"Item" TEXT,
+	"Qty" INTEGER,
+	"Price" REAL,
+	"In stock" INTEGER,
+	"Note" TEXT
+);
+INSERT INTO "items" ("Item", "Qty", "Price", "In stock", "Note") VALUES
+	('towel', 42, 19.99, 1, 'don''t panic'),
+	('string', NULL, 9.99, 0, 'a\b'),
+	('blaster', 3, 10, 1, NULL);
+`},
+	}
+	for i, test := range tests {
+		s := NewSQLTable()
+		s.SetSource("path/test.csv")
+		s.SetHasColumnNames(true)
+		s.SetDialect(test.dialect)
+		s.SetTableName(test.tableName)
+		s.SetBatchSize(test.batchSize)
+		s.SetCreateTable(test.createTable)
+		err := s.TransmogrifyStringTable(rows)
+		if err != nil {
+			t.Errorf("%d: expected no error, got %q", i, err)
+			continue
+		}
+		if s.String() != test.expected {
+			t.Errorf("%d: expected\n%s\ngot\n%s", i, test.expected, s.String())
+		}
+	}
+}
+
+func TestSQLTableTransmogrifyCSV(t *testing.T) {
+	c := NewCSVSource("test_files/test.csv")
+	err := c.ReadSource()
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	s := NewSQLTable()
+	s.SetDialect(SQLite)
+	s.SetNullValues([]string{"NULL"})
+	err = s.TransmogrifyCSV(c)
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	expected := `CREATE TABLE "test" (
+	"Item" TEXT,
+	"Id" TEXT,
+	"Description" TEXT,
+	"Price" TEXT
+);
+INSERT INTO "test" ("Item", "Id", "Description", "Price") VALUES
+	('string', '00042', 'a string of indeterminate length', '$9.99'),
+	('towel', '10042', 'an intergalactic traveller''s essential', '$42.00');
+`
+	if s.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, s.String())
+	}
+}
+
+func TestSQLTableErrors(t *testing.T) {
+	tests := []struct {
+		source      string
+		table       [][]string
+		expectedErr string
+	}{
+		{"test.csv", nil, "unable to tranmogrify string table: received nil"},
+		{"test.csv", [][]string{}, "unable to generate sql: no column names"},
+		{"", [][]string{[]string{"a"}}, "unable to generate sql: no table name"},
+		{"test.csv", [][]string{[]string{"a"}, []string{"1", "2"}}, "row 0: expected at most 1 columns, got 2"},
+	}
+	for i, test := range tests {
+		s := NewSQLTable()
+		s.SetSource(test.source)
+		s.SetHasColumnNames(true)
+		err := s.TransmogrifyStringTable(test.table)
+		if err == nil {
+			t.Errorf("%d: expected %q, got no error", i, test.expectedErr)
+			continue
+		}
+		if err.Error() != test.expectedErr {
+			t.Errorf("%d: expected %q, got %q", i, test.expectedErr, err)
+		}
+	}
+}
+
+func TestSQLTableNonDecimalNumbers(t *testing.T) {
+	rows := [][]string{
+		[]string{"a", "b"},
+		[]string{"NaN", "-0x1p3"},
+		[]string{"Inf", "1"},
+	}
+	s := NewSQLTable()
+	s.SetSource("test.csv")
+	s.SetHasColumnNames(true)
+	err := s.TransmogrifyStringTable(rows)
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	expected := `CREATE TABLE "test" (
+	"a" TEXT,
+	"b" TEXT
+);
+INSERT INTO "test" ("a", "b") VALUES
+	('NaN', '-0x1p3'),
+	('Inf', '1');
+`
+	if s.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, s.String())
+	}
+	// a declared numeric type doesn't make them numeric literals.
+	s = NewSQLTable()
+	s.SetSource("test.csv")
+	s.SetHasColumnNames(true)
+	s.SetCreateTable(false)
+	s.SetColumnTypes([]ColumnType{TypeFloat, TypeFloat})
+	err = s.TransmogrifyStringTable(rows)
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	expected = `INSERT INTO "test" ("a", "b") VALUES
+	('NaN', '-0x1p3'),
+	('Inf', 1);
+`
+	if s.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, s.String())
+	}
+}
@@ -0,0 +1,190 @@
+package transmogrifier
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// numericDatabaseTypes are the database type names that are numeric.
+// Numeric columns are right aligned.
+var numericDatabaseTypes = map[string]bool{
+	"INT": true, "TINYINT": true, "SMALLINT": true, "MEDIUMINT": true,
+	"BIGINT": true, "INTEGER": true, "SERIAL": true, "BIGSERIAL": true,
+	"DECIMAL": true, "NUMERIC": true, "NUMBER": true, "REAL": true,
+	"FLOAT": true, "DOUBLE": true, "MONEY": true,
+}
+
+// SQLRows adapts the results of a database/sql query so that they can be
+// transmogrified by an Encoder.
+type SQLRows struct {
+	rows *sql.Rows
+	// nullPlaceholder is used for NULL values.
+	nullPlaceholder string
+	// tableName is the table name of encoders that need one, e.g. SQL's.
+	tableName string
+}
+
+// NewSQLRows returns a SQLRows for rows. NULL values are rendered as empty
+// strings.
+func NewSQLRows(rows *sql.Rows) *SQLRows {
+	return &SQLRows{rows: rows}
+}
+
+// SetNullPlaceholder sets the string that NULL values are rendered as.
+func (s *SQLRows) SetNullPlaceholder(p string) {
+	s.nullPlaceholder = p
+}
+
+// SetTableName sets the table name used by encoders that need one, e.g. the
+// SQL encoder; the query's table can't be derived from its rows.
+func (s *SQLRows) SetTableName(n string) {
+	s.tableName = n
+}
+
+// TransmogrifyTo reads the rows and encodes them using enc. The column names
+// come from the query's columns; numeric columns are right aligned. If enc is
+// a RowEncoder, each row is encoded as it is read; otherwise the rows are
+// collected and encoded once they have all been read. The rows are closed
+// once they have been read.
+func (s *SQLRows) TransmogrifyTo(enc Encoder) error {
+	defer s.rows.Close()
+	names, alignment, err := s.columns()
+	if err != nil {
+		return err
+	}
+	enc.SetColumnNames(names)
+	if t, ok := enc.(interface{ SetTableName(string) }); ok && s.tableName != "" {
+		t.SetTableName(s.tableName)
+	}
+	// the alignment is only used by an md table that uses its format.
+	if f, ok := enc.(interface{ setUseFormat(bool) }); ok {
+		f.setUseFormat(true)
+	}
+	enc.SetColumnAlignment(alignment)
+	rowEnc, stream := enc.(RowEncoder)
+	if stream {
+		err = rowEnc.EncodeHeader()
+		if err != nil {
+			return err
+		}
+	}
+	vals := make([]interface{}, len(names))
+	ptrs := make([]interface{}, len(names))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	table := [][]string{}
+	for s.rows.Next() {
+		err = s.rows.Scan(ptrs...)
+		if err != nil {
+			return err
+		}
+		row := make([]string, len(vals))
+		for i, v := range vals {
+			row[i] = s.format(v)
+		}
+		if stream {
+			err = rowEnc.EncodeRow(row)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		table = append(table, row)
+	}
+	err = s.rows.Err()
+	if err != nil {
+		return err
+	}
+	if stream {
+		return nil
+	}
+	return enc.TransmogrifyStringTable(table)
+}
+
+// TransmogrifyFormat reads the rows and encodes them using a new Encoder for
+// the format. The Encoder is returned. FmtSQL needs a table name; see
+// SetTableName.
+func (s *SQLRows) TransmogrifyFormat(f FormatType) (Encoder, error) {
+	enc, err := NewEncoder(f)
+	if err != nil {
+		s.rows.Close()
+		return nil, err
+	}
+	return enc, s.TransmogrifyTo(enc)
+}
+
+// TransmogrifySQLRows transmogrifies the results of a database/sql query into
+// a MD table. NULL values are rendered as empty strings; use SQLRows to
+// configure a placeholder.
+func (m *MDTable) TransmogrifySQLRows(rows *sql.Rows) error {
+	return NewSQLRows(rows).TransmogrifyTo(m)
+}
+
+// columns returns the column names and the alignment of each column.
+func (s *SQLRows) columns() (names, alignment []string, err error) {
+	types, err := s.rows.ColumnTypes()
+	if err != nil {
+		return nil, nil, err
+	}
+	names = make([]string, len(types))
+	alignment = make([]string, len(types))
+	for i, typ := range types {
+		names[i] = typ.Name()
+		if isNumericColumn(typ) {
+			alignment[i] = "right"
+		}
+	}
+	return names, alignment, nil
+}
+
+// isNumericColumn returns whether the column holds numbers, using its scan
+// type if the driver provides one, otherwise its database type name.
+func isNumericColumn(typ *sql.ColumnType) bool {
+	if st := typ.ScanType(); st != nil {
+		for st.Kind() == reflect.Ptr {
+			st = st.Elem()
+		}
+		switch st.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return true
+		}
+		switch st {
+		case reflect.TypeOf(sql.NullInt64{}), reflect.TypeOf(sql.NullFloat64{}):
+			return true
+		}
+	}
+	// only the base name matters, e.g. DECIMAL for DECIMAL(10,2), INT for
+	// INT UNSIGNED or INT4.
+	name := strings.ToUpper(typ.DatabaseTypeName())
+	if i := strings.IndexAny(name, "( "); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.TrimRight(name, "0123456789")
+	return numericDatabaseTypes[name]
+}
+
+// format returns the string representation of a scanned value.
+func (s *SQLRows) format(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return s.nullPlaceholder
+	case []byte:
+		return string(x)
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(x), 'f', -1, 32)
+	case time.Time:
+		return x.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v)
+}
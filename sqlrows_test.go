@@ -0,0 +1,155 @@
+package transmogrifier
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeDriver is a database/sql driver whose queries all return the same
+// result set: fakeColumns and fakeRows.
+type fakeDriver struct{}
+
+type fakeConn struct{}
+
+type fakeStmt struct{}
+
+type fakeRows struct {
+	i int
+}
+
+type fakeColumn struct {
+	name     string
+	dbType   string
+	scanType reflect.Type
+}
+
+var fakeColumns = []fakeColumn{
+	{"name", "VARCHAR(64)", reflect.TypeOf("")},
+	{"qty", "INT UNSIGNED", reflect.TypeOf(new(interface{})).Elem()},
+	{"price", "DECIMAL(10,2)", reflect.TypeOf(float64(0))},
+	{"added", "TIMESTAMP", reflect.TypeOf(time.Time{})},
+}
+
+var fakeRowValues = [][]driver.Value{
+	{"towel", int64(42), 19.99, time.Date(2015, 10, 16, 0, 0, 0, 0, time.UTC)},
+	{[]byte("string"), nil, 9.5, nil},
+}
+
+func init() {
+	sql.Register("mogfake", fakeDriver{})
+}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{}, nil }
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+func (fakeStmt) Close() error  { return nil }
+func (fakeStmt) NumInput() int { return 0 }
+func (fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (fakeStmt) Query(args []driver.Value) (driver.Rows, error) { return &fakeRows{}, nil }
+
+func (r *fakeRows) Columns() []string {
+	cols := make([]string, len(fakeColumns))
+	for i, c := range fakeColumns {
+		cols[i] = c.name
+	}
+	return cols
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i >= len(fakeRowValues) {
+		return io.EOF
+	}
+	copy(dest, fakeRowValues[r.i])
+	r.i++
+	return nil
+}
+
+func (r *fakeRows) ColumnTypeDatabaseTypeName(i int) string { return fakeColumns[i].dbType }
+func (r *fakeRows) ColumnTypeScanType(i int) reflect.Type   { return fakeColumns[i].scanType }
+
+func fakeQuery(t *testing.T) *sql.Rows {
+	db, err := sql.Open("mogfake", "")
+	if err != nil {
+		t.Fatalf("open: expected no error, got %q", err)
+	}
+	rows, err := db.Query("SELECT * FROM items")
+	if err != nil {
+		t.Fatalf("query: expected no error, got %q", err)
+	}
+	return rows
+}
+
+func TestTransmogrifySQLRows(t *testing.T) {
+	md := NewMDTable()
+	err := md.TransmogrifySQLRows(fakeQuery(t))
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	expected := "|name|qty|price|added|  \n" +
+		"|---|---:|---:|---|  \n" +
+		"|towel|42|19.99|2015-10-16T00:00:00Z|  \n" +
+		"|string||9.5||  \n"
+	if md.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, md.String())
+	}
+}
+
+func TestSQLRowsTransmogrifyFormat(t *testing.T) {
+	tests := []struct {
+		format      FormatType
+		placeholder string
+		table       string
+		expected    string
+		expectedErr string
+	}{
+		{FmtMDTable, "NULL", "", "|name|qty|price|added|  \n" +
+			"|---|---:|---:|---|  \n" +
+			"|towel|42|19.99|2015-10-16T00:00:00Z|  \n" +
+			"|string|NULL|9.5|NULL|  \n", ""},
+		{FmtCSV, "", "", "name,qty,price,added\n" +
+			"towel,42,19.99,2015-10-16T00:00:00Z\n" +
+			"string,,9.5,\n", ""},
+		{FmtSQL, "", "items", "CREATE TABLE \"items\" (\n" +
+			"\t\"name\" TEXT,\n" +
+			"\t\"qty\" BIGINT,\n" +
+			"\t\"price\" DOUBLE PRECISION,\n" +
+			"\t\"added\" TIMESTAMP\n" +
+			");\n" +
+			"INSERT INTO \"items\" (\"name\", \"qty\", \"price\", \"added\") VALUES\n" +
+			"\t('towel', 42, 19.99, '2015-10-16T00:00:00Z'),\n" +
+			"\t('string', NULL, 9.5, NULL);\n", ""},
+		{FmtSQL, "", "", "", "unable to generate sql: no table name"},
+		{FmtUnsupported, "", "", "", "no encoder registered for format \"unsupported\""},
+	}
+	for i, test := range tests {
+		rows := NewSQLRows(fakeQuery(t))
+		rows.SetNullPlaceholder(test.placeholder)
+		rows.SetTableName(test.table)
+		enc, err := rows.TransmogrifyFormat(test.format)
+		if err != nil {
+			if err.Error() != test.expectedErr {
+				t.Errorf("%d: expected %q, got %q", i, test.expectedErr, err)
+			}
+			continue
+		}
+		if test.expectedErr != "" {
+			t.Errorf("%d: expected %q, got no error", i, test.expectedErr)
+			continue
+		}
+		if string(enc.Bytes()) != test.expected {
+			t.Errorf("%d: expected\n%s\ngot\n%s", i, test.expected, enc.Bytes())
+		}
+	}
+}
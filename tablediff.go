@@ -0,0 +1,320 @@
+package transmogrifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DiffStatus is how a row of a TableDiff changed.
+type DiffStatus int
+
+const (
+	DiffUnchanged DiffStatus = iota
+	DiffAdded
+	DiffRemoved
+	DiffChanged
+)
+
+var diffStatusNames = [...]string{"unchanged", "added", "removed", "changed"}
+
+func (s DiffStatus) String() string {
+	if s < 0 || int(s) >= len(diffStatusNames) {
+		return "unknown"
+	}
+	return diffStatusNames[s]
+}
+
+// MarshalText returns the status's name.
+func (s DiffStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// DiffStyle is how a TableDiff is rendered as a table.
+type DiffStyle int
+
+const (
+	// DiffInline marks the changes with Markdown: a changed cell is
+	// '~~old~~ **new**', the cells of added rows are bold, and those of
+	// removed rows are struck through.
+	DiffInline DiffStyle = iota
+	// DiffStatusColumn adds a first column, 'status', with each row's
+	// DiffStatus; the cells are the new values, or, for removed rows, the
+	// old.
+	DiffStatusColumn
+)
+
+var diffStyleNames = [...]string{"inline", "status"}
+
+func (s DiffStyle) String() string {
+	if s < 0 || int(s) >= len(diffStyleNames) {
+		return "unknown"
+	}
+	return diffStyleNames[s]
+}
+
+// ParseDiffStyle parses a DiffStyle: inline or status.
+func ParseDiffStyle(s string) (DiffStyle, error) {
+	for i, n := range diffStyleNames {
+		if strings.EqualFold(strings.TrimSpace(s), n) {
+			return DiffStyle(i), nil
+		}
+	}
+	return DiffInline, fmt.Errorf("unknown diff style: %q", s)
+}
+
+// TableDiff is the difference between an old and a new version of a table.
+// Rows are matched by their keys, the values of the key columns: a row
+// whose key is only in the new table was added, one only in the old table
+// was removed, and one whose values, of the columns both tables have,
+// differ was changed. Columns are matched by name, or, if the tables don't
+// have headers, by position.
+//
+// A TableDiff can be marshaled to JSON, for a machine readable diff.
+type TableDiff struct {
+	// Header is the diff's columns: the new table's, then those of the
+	// old table that the new one doesn't have.
+	Header []string `json:"header"`
+	// Key is the names of the key columns.
+	Key []string `json:"key"`
+	// AddedColumns and RemovedColumns are the columns that only the new,
+	// and only the old, table has.
+	AddedColumns   []string `json:"added_columns,omitempty"`
+	RemovedColumns []string `json:"removed_columns,omitempty"`
+	// Rows are the rows, in the new table's order; removed rows follow
+	// the row that preceded them in the old table.
+	Rows []DiffRow `json:"rows"`
+	// cols are the columns of the new table that the diff's columns are.
+	cols []int
+}
+
+// DiffRow is a row of a TableDiff.
+type DiffRow struct {
+	Status DiffStatus `json:"status"`
+	Key    []string   `json:"key"`
+	// Old and New are the row's values, in the diff's columns, in the old
+	// and new tables; Old is nil for added rows, and New for removed ones.
+	// The values of the columns a table doesn't have are empty.
+	Old []string `json:"old,omitempty"`
+	New []string `json:"new,omitempty"`
+	// Changed are the names of the columns whose values changed.
+	Changed []string `json:"changed,omitempty"`
+}
+
+// DiffTables returns the diff of the old and new tables by their key
+// columns, names or '#' positions. Both tables, or neither, must have
+// headers, and their keys must be unique.
+func DiffTables(key []string, oldHeader []string, oldRows [][]string, newHeader []string, newRows [][]string) (*TableDiff, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("diff: no key columns")
+	}
+	if (len(oldHeader) == 0) != (len(newHeader) == 0) {
+		return nil, fmt.Errorf("diff: only one of the tables has a header")
+	}
+	oldKeys, err := resolveColumns(key, oldHeader, oldRows)
+	if err != nil {
+		return nil, err
+	}
+	newKeys, err := resolveColumns(key, newHeader, newRows)
+	if err != nil {
+		return nil, err
+	}
+	d := &TableDiff{Key: columnNames(newHeader, newKeys)}
+	// oldCols and d.cols are the columns of the old and new tables of each
+	// of the diff's columns; -1 is none.
+	var oldCols []int
+	nOld, nNew := tableWidthOf(oldHeader, oldRows), tableWidthOf(newHeader, newRows)
+	if len(newHeader) > 0 {
+		index := map[string]int{}
+		for i, k := range columnKeys(oldHeader) {
+			index[k] = i
+		}
+		d.Header = append(d.Header, newHeader...)
+		for i, k := range columnKeys(newHeader) {
+			c, ok := index[k]
+			if !ok {
+				c = -1
+				d.AddedColumns = append(d.AddedColumns, newHeader[i])
+			}
+			delete(index, k)
+			oldCols, d.cols = append(oldCols, c), append(d.cols, i)
+		}
+		for i, k := range columnKeys(oldHeader) {
+			if _, ok := index[k]; ok {
+				d.Header = append(d.Header, oldHeader[i])
+				d.RemovedColumns = append(d.RemovedColumns, oldHeader[i])
+				oldCols, d.cols = append(oldCols, i), append(d.cols, -1)
+			}
+		}
+	} else {
+		for i := 0; i < nOld || i < nNew; i++ {
+			o, n := i, i
+			if i >= nOld {
+				o = -1
+				d.AddedColumns = append(d.AddedColumns, columnNames(nil, []int{i})[0])
+			}
+			if i >= nNew {
+				n = -1
+				d.RemovedColumns = append(d.RemovedColumns, columnNames(nil, []int{i})[0])
+			}
+			oldCols, d.cols = append(oldCols, o), append(d.cols, n)
+		}
+	}
+	names := d.Header
+	if len(names) == 0 {
+		names = columnNames(nil, seq(len(d.cols)))
+	}
+	oldIndex := map[string]int{}
+	for i, row := range oldRows {
+		k := groupKey(row, oldKeys)
+		if _, ok := oldIndex[k]; ok {
+			return nil, fmt.Errorf("diff: the old table has more than one row with the key %q", projectRow(row, oldKeys))
+		}
+		oldIndex[k] = i
+	}
+	newIndex := map[string]bool{}
+	for _, row := range newRows {
+		k := groupKey(row, newKeys)
+		if newIndex[k] {
+			return nil, fmt.Errorf("diff: the new table has more than one row with the key %q", projectRow(row, newKeys))
+		}
+		newIndex[k] = true
+	}
+	// removed adds the removed rows from the old row i, until one that
+	// isn't removed.
+	removed := func(i int) {
+		for ; i < len(oldRows); i++ {
+			row := oldRows[i]
+			if newIndex[groupKey(row, oldKeys)] {
+				return
+			}
+			d.Rows = append(d.Rows, DiffRow{Status: DiffRemoved, Key: projectRow(row, oldKeys), Old: projectRow(row, oldCols)})
+		}
+	}
+	removed(0)
+	for _, row := range newRows {
+		k := groupKey(row, newKeys)
+		r := DiffRow{Status: DiffAdded, Key: projectRow(row, newKeys), New: projectRow(row, d.cols)}
+		i, ok := oldIndex[k]
+		if !ok {
+			d.Rows = append(d.Rows, r)
+			continue
+		}
+		r.Status, r.Old = DiffUnchanged, projectRow(oldRows[i], oldCols)
+		for c := range d.cols {
+			if d.cols[c] >= 0 && oldCols[c] >= 0 && r.Old[c] != r.New[c] {
+				r.Changed = append(r.Changed, names[c])
+			}
+		}
+		if len(r.Changed) > 0 {
+			r.Status = DiffChanged
+		}
+		d.Rows = append(d.Rows, r)
+		removed(i + 1)
+	}
+	return d, nil
+}
+
+// Diff returns the diff of the CSV, the old table, and newer, by the key
+// columns; see DiffTables.
+func (c *CSV) Diff(newer *CSV, key ...string) (*TableDiff, error) {
+	return DiffTables(key, c.headerRow, c.rows, newer.headerRow, newer.rows)
+}
+
+// Count returns the number of rows with the status.
+func (d *TableDiff) Count(s DiffStatus) int {
+	var n int
+	for _, r := range d.Rows {
+		if r.Status == s {
+			n++
+		}
+	}
+	return n
+}
+
+// JSON returns the diff as indented JSON.
+func (d *TableDiff) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// Table returns the diff rendered as a table, in the style. Unchanged rows
+// are only included if unchanged is set.
+func (d *TableDiff) Table(style DiffStyle, unchanged bool) (header []string, rows [][]string) {
+	header, rows, _ = d.table(style, unchanged)
+	return header, rows
+}
+
+// MDTable returns the diff rendered as an md table, in the style. Unchanged
+// rows are only included if unchanged is set.
+func (d *TableDiff) MDTable(style DiffStyle, unchanged bool) (*MDTable, error) {
+	header, rows := d.Table(style, unchanged)
+	if len(header) == 0 {
+		header = make([]string, tableWidth(rows))
+	}
+	md := NewMDTable()
+	md.SetHasColumnNames(true)
+	err := md.TransmogrifyStringTable(append([][]string{header}, rows...))
+	if err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+// table renders the diff. cols are the columns of the new table that the
+// rendered columns are; -1 is none.
+func (d *TableDiff) table(style DiffStyle, unchanged bool) (header []string, rows [][]string, cols []int) {
+	cols = d.cols
+	if style == DiffStatusColumn {
+		cols = append([]int{-1}, cols...)
+		if len(d.Header) > 0 {
+			header = append([]string{"status"}, d.Header...)
+		}
+	} else {
+		header = d.Header
+	}
+	names := d.Header
+	if len(names) == 0 {
+		names = columnNames(nil, seq(len(d.cols)))
+	}
+	for _, r := range d.Rows {
+		if r.Status == DiffUnchanged && !unchanged {
+			continue
+		}
+		vals := r.New
+		if r.Status == DiffRemoved {
+			vals = r.Old
+		}
+		if style == DiffStatusColumn {
+			rows = append(rows, append([]string{r.Status.String()}, vals...))
+			continue
+		}
+		row := make([]string, len(vals))
+		changed := map[string]bool{}
+		for _, n := range r.Changed {
+			changed[n] = true
+		}
+		for i, v := range vals {
+			switch {
+			case r.Status == DiffAdded:
+				row[i] = mdMark(v, "**")
+			case r.Status == DiffRemoved:
+				row[i] = mdMark(v, "~~")
+			case changed[names[i]]:
+				row[i] = strings.TrimSpace(mdMark(r.Old[i], "~~") + " " + mdMark(v, "**"))
+			default:
+				row[i] = v
+			}
+		}
+		rows = append(rows, row)
+	}
+	return header, rows, cols
+}
+
+// mdMark returns s marked up with mark, e.g. '**' for bold; an empty s isn't
+// marked up.
+func mdMark(s, mark string) string {
+	if s == "" {
+		return ""
+	}
+	return mark + s + mark
+}
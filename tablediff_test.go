@@ -0,0 +1,120 @@
+package transmogrifier
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffTables(t *testing.T) {
+	oldHeader := []string{"id", "name", "price"}
+	oldRows := [][]string{
+		[]string{"1", "towel", "42"},
+		[]string{"2", "mug", "3"},
+		[]string{"3", "pen", "1"},
+	}
+	newHeader := []string{"id", "price", "name", "stock"}
+	newRows := [][]string{
+		[]string{"1", "42", "towel", "5"},
+		[]string{"3", "2", "pen", "1"},
+		[]string{"4", "9", "cup", ""},
+	}
+	d, err := DiffTables([]string{"id"}, oldHeader, oldRows, newHeader, newRows)
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	if !reflect.DeepEqual(d.AddedColumns, []string{"stock"}) || d.RemovedColumns != nil {
+		t.Errorf("expected the added column stock, got %q and %q", d.AddedColumns, d.RemovedColumns)
+	}
+	tests := []struct {
+		style          DiffStyle
+		unchanged      bool
+		expectedHeader []string
+		expectedRows   [][]string
+	}{
+		{
+			DiffInline, false,
+			[]string{"id", "price", "name", "stock"},
+			[][]string{{"~~2~~", "~~3~~", "~~mug~~", ""}, {"3", "~~1~~ **2**", "pen", "1"}, {"**4**", "**9**", "**cup**", ""}},
+		},
+		{
+			DiffStatusColumn, true,
+			[]string{"status", "id", "price", "name", "stock"},
+			[][]string{{"unchanged", "1", "42", "towel", "5"}, {"removed", "2", "3", "mug", ""}, {"changed", "3", "2", "pen", "1"}, {"added", "4", "9", "cup", ""}},
+		},
+	}
+	for i, test := range tests {
+		h, rows := d.Table(test.style, test.unchanged)
+		if !reflect.DeepEqual(h, test.expectedHeader) {
+			t.Errorf("%d: expected header %q, got %q", i, test.expectedHeader, h)
+		}
+		if !reflect.DeepEqual(rows, test.expectedRows) {
+			t.Errorf("%d: expected rows %q, got %q", i, test.expectedRows, rows)
+		}
+	}
+	for s, n := range map[DiffStatus]int{DiffUnchanged: 1, DiffAdded: 1, DiffRemoved: 1, DiffChanged: 1} {
+		if d.Count(s) != n {
+			t.Errorf("expected %d %s rows, got %d", n, s, d.Count(s))
+		}
+	}
+	b, err := d.JSON()
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	if !strings.Contains(string(b), `"status": "changed"`) || !strings.Contains(string(b), `"changed": [`+"\n        \"price\"") {
+		t.Errorf("expected the JSON to have the changed row, got %s", b)
+	}
+	md, err := d.MDTable(DiffInline, false)
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	expected := "|id|price|name|stock|  \n|---|---|---|---|  \n|~~2~~|~~3~~|~~mug~~||  \n|3|~~1~~ **2**|pen|1|  \n|**4**|**9**|**cup**||  \n"
+	if md.String() != expected {
+		t.Errorf("expected %q, got %q", expected, md.String())
+	}
+}
+
+func TestDiffTablesErrors(t *testing.T) {
+	header := []string{"id", "v"}
+	tests := []struct {
+		key         []string
+		oldHeader   []string
+		oldRows     [][]string
+		expectedErr string
+	}{
+		{nil, header, nil, "diff: no key columns"},
+		{[]string{"sku"}, header, nil, `unknown column "sku"`},
+		{[]string{"#1"}, nil, nil, "diff: only one of the tables has a header"},
+		{[]string{"id"}, header, [][]string{{"1", "a"}, {"1", "b"}}, `diff: the old table has more than one row with the key ["1"]`},
+	}
+	for i, test := range tests {
+		_, err := DiffTables(test.key, test.oldHeader, test.oldRows, header, [][]string{{"1", "a"}})
+		if err == nil || err.Error() != test.expectedErr {
+			t.Errorf("%d: expected error %q, got %v", i, test.expectedErr, err)
+		}
+	}
+}
+
+func TestCSVDiff(t *testing.T) {
+	read := func(s string) *CSV {
+		c := NewCSV()
+		c.SetHasHeader(false)
+		err := c.Read(strings.NewReader(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	d, err := read("a,1\nb,2\n").Diff(read("b,3\nc,4\n"), "#1")
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	h, rows := d.Table(DiffStatusColumn, false)
+	expected := [][]string{{"removed", "a", "1"}, {"changed", "b", "3"}, {"added", "c", "4"}}
+	if h != nil || !reflect.DeepEqual(rows, expected) {
+		t.Errorf("expected %q, got %q and %q", expected, h, rows)
+	}
+	if !reflect.DeepEqual(d.Rows[1].Changed, []string{"#2"}) {
+		t.Errorf("expected #2 to have changed, got %q", d.Rows[1].Changed)
+	}
+}
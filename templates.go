@@ -0,0 +1,277 @@
+package transmogrifier
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// Templates are the text/template templates that render the cells of an md
+// table's columns: the cell of a column with a template is the output of the
+// template, executed with the cell's TemplateData, e.g. '{{link .Value
+// .Row.url}}' or '{{.Value | number 2}}'. The column's emphasis is applied to
+// the output. Besides text/template's builtins, the templates have the funcs:
+//
+//	link TEXT URL        a link, [TEXT](URL)
+//	image ALT URL        an image, ![ALT](URL)
+//	code S               inline code, `S`
+//	upper S, lower S     S in upper or lower case
+//	truncate N S         S, cut to N characters, ending in '…', if it is
+//	                     longer
+//	number DECIMALS S    the number S, e.g. 1234.5 or $1,234.5, with
+//	                     DECIMALS decimals and thousands separators, e.g.
+//	                     1,234.50; S is returned if it isn't a number
+//
+// Referencing a column the row doesn't have, e.g. .Row.nope, is an error.
+// Summary rows, e.g. totals, aren't rendered by the templates.
+type Templates struct {
+	funcs   template.FuncMap
+	columns []columnTemplate
+}
+
+type columnTemplate struct {
+	// column is the column, a name or a '#' position.
+	column string
+	tmpl   *template.Template
+}
+
+// TemplateData is the data a column's template is executed with.
+type TemplateData struct {
+	// Value is the cell's value.
+	Value string
+	// Column is the cell's column name; it is its '#' position if the
+	// table doesn't have column names.
+	Column string
+	// Index is the row's index, from 0, in the table's data rows.
+	Index int
+	// Row is the row's values by column name and '#' position, e.g.
+	// .Row.url or index .Row "#2". Columns that aren't output can be used.
+	Row map[string]string
+}
+
+// templateFuncs are the funcs of every template.
+var templateFuncs = template.FuncMap{
+	"link":     templateLink,
+	"image":    templateImage,
+	"code":     templateCode,
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"truncate": templateTruncate,
+	"number":   templateNumber,
+}
+
+// NewTemplates returns an empty set of column templates.
+func NewTemplates() *Templates {
+	return &Templates{}
+}
+
+// Funcs adds the funcs to those of the templates that are added after it is
+// called; a func with the name of one of the builtin funcs replaces it.
+func (t *Templates) Funcs(funcs template.FuncMap) {
+	if t.funcs == nil {
+		t.funcs = template.FuncMap{}
+	}
+	for k, v := range funcs {
+		t.funcs[k] = v
+	}
+}
+
+// Add parses the template of the column, a name or a '#' position. A column
+// can only have one template; a later template replaces an earlier one.
+func (t *Templates) Add(column, text string) error {
+	column = strings.TrimSpace(column)
+	if _, err := parseColumnRef(column); err != nil {
+		return fmt.Errorf("template of column %q: %s", column, err)
+	}
+	tmpl, err := template.New(column).Option("missingkey=error").Funcs(templateFuncs).Funcs(t.funcs).Parse(text)
+	if err != nil {
+		return err
+	}
+	t.AddTemplate(column, tmpl)
+	return nil
+}
+
+// AddTemplate adds the parsed template of the column, a name or a '#'
+// position. The template is executed with a TemplateData; the builtin funcs
+// are only available if it was parsed with them.
+func (t *Templates) AddTemplate(column string, tmpl *template.Template) {
+	t.columns = append(t.columns, columnTemplate{column: strings.TrimSpace(column), tmpl: tmpl})
+}
+
+// Columns returns the columns that have templates.
+func (t *Templates) Columns() []string {
+	var cols []string
+	for _, c := range t.columns {
+		if indexOf(cols, c.column) < 0 {
+			cols = append(cols, c.column)
+		}
+	}
+	return cols
+}
+
+// Apply returns the rows with the cells of the columns with templates
+// rendered by them. The rows aren't modified.
+func (t *Templates) Apply(header []string, rows [][]string) ([][]string, error) {
+	return t.apply(header, rows, nil, 0)
+}
+
+// ApplyTemplates returns the rows of the CSV with the cells of the columns
+// with templates rendered by them.
+func (c *CSV) ApplyTemplates(t *Templates) ([][]string, error) {
+	return t.Apply(c.headerRow, c.rows)
+}
+
+// apply returns the rows with the cells of the columns with templates
+// rendered by them; the rows that summary is true for aren't. index is the
+// index, in the table's data rows, of the first data row of rows.
+func (t *Templates) apply(header []string, rows [][]string, summary []bool, index int) ([][]string, error) {
+	tmpls, err := t.resolve(header, tableWidthOf(header, rows))
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]string, len(rows))
+	for i, row := range rows {
+		if i < len(summary) && summary[i] {
+			out[i] = row
+			continue
+		}
+		out[i] = append([]string{}, row...)
+		for c, tmpl := range tmpls {
+			if tmpl == nil || c >= len(row) {
+				continue
+			}
+			out[i][c], err = executeTemplate(tmpl, header, row, c, index)
+			if err != nil {
+				return nil, err
+			}
+		}
+		index++
+	}
+	return out, nil
+}
+
+// merge returns the templates of t followed by those of o, which replace
+// t's for the same columns; either can be nil.
+func (t *Templates) merge(o *Templates) *Templates {
+	switch {
+	case t == nil:
+		return o
+	case o == nil:
+		return t
+	}
+	return &Templates{columns: append(append([]columnTemplate{}, t.columns...), o.columns...)}
+}
+
+// resolve returns the template of each column, or nil, for a table with the
+// header and n columns.
+func (t *Templates) resolve(header []string, n int) ([]*template.Template, error) {
+	tmpls := make([]*template.Template, n)
+	for _, ct := range t.columns {
+		ref, err := parseColumnRef(ct.column)
+		if err != nil {
+			return nil, err
+		}
+		c, err := ref.resolve(header, n)
+		if err != nil {
+			return nil, fmt.Errorf("template of column %q: %s", ct.column, err)
+		}
+		tmpls[c] = ct.tmpl
+	}
+	return tmpls, nil
+}
+
+// executeTemplate returns the output of the template for the cell c of the
+// row, which is the data row index.
+func executeTemplate(tmpl *template.Template, header, row []string, c, index int) (string, error) {
+	data := TemplateData{Value: cell(row, c), Index: index, Row: map[string]string{}}
+	n := len(row)
+	if len(header) > n {
+		n = len(header)
+	}
+	for i := n - 1; i >= 0; i-- {
+		data.Row["#"+strconv.Itoa(i+1)] = cell(row, i)
+		// the first of columns with the same name is the one by name.
+		if i < len(header) {
+			data.Row[header[i]] = cell(row, i)
+		}
+	}
+	data.Column = columnNames(header, []int{c})[0]
+	var buf strings.Builder
+	err := tmpl.Execute(&buf, data)
+	if err != nil {
+		return "", fmt.Errorf("row %d: %s", index+1, err)
+	}
+	return buf.String(), nil
+}
+
+// templateLink returns the md link to url.
+func templateLink(text, url string) string {
+	return "[" + text + "](" + url + ")"
+}
+
+// templateImage returns the md image of url.
+func templateImage(alt, url string) string {
+	return "![" + alt + "](" + url + ")"
+}
+
+// templateCode returns s as md inline code; s is delimited by enough
+// backticks that any it has are kept.
+func templateCode(s string) string {
+	delim, run := "`", 0
+	for _, r := range s {
+		if r != '`' {
+			run = 0
+			continue
+		}
+		run++
+		if run >= len(delim) {
+			delim += "`"
+		}
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return delim + s + delim
+}
+
+// templateTruncate returns s, cut to n characters, the last of which is '…',
+// if it is longer.
+func templateTruncate(n int, s string) string {
+	if n < 1 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n-1]) + "…"
+}
+
+// templateNumber returns the number s with the decimals and thousands
+// separators; s is returned if it isn't a number.
+func templateNumber(decimals int, s string) string {
+	n, ok := parseCurrency(strings.TrimSpace(s))
+	if !ok || math.IsInf(n, 0) || math.IsNaN(n) {
+		return s
+	}
+	if decimals < 0 {
+		decimals = 0
+	}
+	f := strconv.FormatFloat(math.Abs(n), 'f', decimals, 64)
+	whole, frac := f, ""
+	if i := strings.IndexByte(f, '.'); i >= 0 {
+		whole, frac = f[:i], f[i:]
+	}
+	var buf strings.Builder
+	if n < 0 && strings.Trim(f, "0.") != "" {
+		buf.WriteByte('-')
+	}
+	for i := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte(whole[i])
+	}
+	buf.WriteString(frac)
+	return buf.String()
+}
@@ -0,0 +1,157 @@
+package transmogrifier
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestTemplatesApply(t *testing.T) {
+	header := []string{"name", "url", "price"}
+	rows := [][]string{
+		{"mog", "https://example.com/mog", "1234.5"},
+		{"fmt", "https://example.com/fmt", "n/a"},
+	}
+	tests := []struct {
+		column      string
+		text        string
+		header      []string
+		rows        [][]string
+		expected    []string
+		expectedErr string
+	}{
+		{"name", "{{link .Value .Row.url}}", header, rows, []string{"[mog](https://example.com/mog)", "[fmt](https://example.com/fmt)"}, ""},
+		{"#1", "{{image .Value (index .Row \"#2\")}}", header, rows, []string{"![mog](https://example.com/mog)", "![fmt](https://example.com/fmt)"}, ""},
+		{"price", "{{.Value | number 2}}", header, rows, []string{"1,234.50", "n/a"}, ""},
+		{"name", "{{.Index}}: {{upper .Value | code}} {{.Column}}", header, rows, []string{"0: `MOG` name", "1: `FMT` name"}, ""},
+		{"#2", "{{.Value | truncate 12}}", nil, rows, []string{"https://exa…", "https://exa…"}, ""},
+		{"name", "{{if eq .Row.price \"n/a\"}}{{lower \"N/A\"}}{{else}}{{.Value}}{{end}}", header, rows, []string{"mog", "n/a"}, ""},
+		{"name", "{{.Row.nope}}", header, rows, nil, `row 1: template: name:1:6: executing "name" at <.Row.nope>: map has no entry for key "nope"`},
+		{"sku", "{{.Value}}", header, rows, nil, `template of column "sku": unknown column "sku"`},
+		{"name", "{{link .Value}}", header, rows, nil, `row 1: template: name:1:2: executing "name" at <link>: wrong number of args for link: want 2 got 1`},
+		{"name", "{{nope .Value}}", header, rows, nil, `template: name:1: function "nope" not defined`},
+	}
+	for i, test := range tests {
+		tm := NewTemplates()
+		err := tm.Add(test.column, test.text)
+		var out [][]string
+		if err == nil {
+			out, err = tm.Apply(test.header, test.rows)
+		}
+		if err != nil {
+			if err.Error() != test.expectedErr {
+				t.Errorf("%d: expected error %q, got %q", i, test.expectedErr, err)
+			}
+			continue
+		}
+		if test.expectedErr != "" {
+			t.Errorf("%d: expected error %q, got none", i, test.expectedErr)
+			continue
+		}
+		c, _ := parseColumnRef(test.column)
+		col, _ := c.resolve(test.header, 3)
+		var got []string
+		for _, row := range out {
+			got = append(got, row[col])
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%d: expected %q, got %q", i, test.expected, got)
+		}
+		if !reflect.DeepEqual(test.rows, rows) {
+			t.Errorf("%d: the rows were modified: %q", i, test.rows)
+		}
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{templateNumber(0, "1234567.89"), "1,234,568"},
+		{templateNumber(2, "$-1,200.5"), "-1,200.50"},
+		{templateNumber(1, "-0.01"), "0.0"},
+		{templateNumber(2, "12"), "12.00"},
+		{templateNumber(2, ""), ""},
+		{templateTruncate(5, "héllo wörld"), "héll…"},
+		{templateTruncate(5, "héllo"), "héllo"},
+		{templateCode("a`b"), "``a`b``"},
+		{templateCode("`a"), "`` `a ``"},
+		{templateLink("mog", "http://x"), "[mog](http://x)"},
+	}
+	for i, test := range tests {
+		if test.value != test.expected {
+			t.Errorf("%d: expected %q, got %q", i, test.expected, test.value)
+		}
+	}
+}
+
+func TestTemplatesFuncs(t *testing.T) {
+	tm := NewTemplates()
+	tm.Funcs(template.FuncMap{"badge": func(s string) string {
+		if s == "pass" {
+			return "✅"
+		}
+		return "❌"
+	}})
+	err := tm.Add("status", "{{badge .Value}} {{.Value}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm.AddTemplate("id", template.Must(template.New("id").Parse("#{{.Value}}")))
+	out, err := tm.Apply([]string{"id", "status"}, [][]string{{"1", "pass"}, {"2", "fail"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	expected := [][]string{{"#1", "✅ pass"}, {"#2", "❌ fail"}}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+	if cols := tm.Columns(); !reflect.DeepEqual(cols, []string{"status", "id"}) {
+		t.Errorf("expected the columns %q, got %q", []string{"status", "id"}, cols)
+	}
+}
+
+func TestMDTableTemplates(t *testing.T) {
+	tm := NewTemplates()
+	err := tm.Add("name", "{{link .Value .Row.url}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tm.Add("qty", "{{.Value | number 1}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	totals, err := ParseTotals("sum(qty)", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ParseProjection("name, qty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := NewMDTable()
+	md.SetHasColumnNames(true)
+	md.SetUseFormat(true)
+	md.SetColumnEmphasis([]string{"b"})
+	md.SetTemplates(tm)
+	md.SetTotals(totals)
+	md.SetProjection(p)
+	err = md.TransmogrifyStringTable([][]string{{"name", "url", "qty"}, {"mog", "http://m", "1200"}, {"fmt", "http://f", "3"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	expected := "|name|qty|  \n|---|---|  \n|__[mog](http://m)__|1,200.0|  \n|__[fmt](http://f)__|3.0|  \n|__Total__|1203|  \n"
+	if md.String() != expected {
+		t.Errorf("expected %q, got %q", expected, md.String())
+	}
+
+	md = NewMDTable()
+	md.SetTemplates(tm)
+	md.SetColumnNames([]string{"name", "qty"})
+	err = md.TransmogrifyStringTable([][]string{{"mog", "1"}})
+	if err == nil || !strings.Contains(err.Error(), `map has no entry for key "url"`) {
+		t.Errorf("expected a missing key error, got %v", err)
+	}
+}
@@ -0,0 +1,412 @@
+package transmogrifier
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// formatExts are the file extensions used for output in each format.
+var formatExts = map[FormatType]string{
+	FmtCSV:        ".csv",
+	FmtMD:         ".md",
+	FmtMDTable:    ".md",
+	FmtFixedWidth: ".fwf",
+	FmtSQL:        ".sql",
+}
+
+// filenameFor returns the name with its extension, and any compression
+// extension, replaced by the extension of the format.
+func filenameFor(name string, f FormatType) string {
+	_, name = compressionFromName(name)
+	ext, ok := formatExts[f]
+	if !ok {
+		ext = "." + f.String()
+	}
+	return strings.TrimSuffix(name, path.Ext(name)) + ext
+}
+
+// formatFileFor returns the name of the format file for the source: the
+// source's name with its extension, and any compression extension, replaced
+// by '.fmt'.
+func formatFileFor(name string) string {
+	_, name = compressionFromName(name)
+	return strings.TrimSuffix(name, path.Ext(name)) + ".fmt"
+}
+
+// isDecodable returns whether table data in the format can be read.
+func isDecodable(f FormatType) bool {
+	return f == FmtCSV || f == FmtFixedWidth
+}
+
+// SourceError is an error reading a source: it couldn't be opened, or its
+// table data couldn't be decoded. Its message is that of Err.
+type SourceError struct {
+	Source string // Source is the source that couldn't be read.
+	Err    error
+}
+
+func (e *SourceError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// FormatError is an error with a format: the format file couldn't be read,
+// or the source, or output, format isn't supported. Its message is that of
+// Err.
+type FormatError struct {
+	Name string // Name is the format file, or the format.
+	Err  error
+}
+
+func (e *FormatError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
+
+// OptionError is an error with an option of a Job, e.g. a Filter that
+// doesn't parse; Job.Run returns it as the Err of a *FormatError. Its message
+// is that of Err.
+type OptionError struct {
+	Option string // Option is the Job's field, e.g. "Filter".
+	Err    error
+}
+
+func (e *OptionError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *OptionError) Unwrap() error {
+	return e.Err
+}
+
+// decodeOptions are the options used to read table data, and to select its
+// rows and columns.
+type decodeOptions struct {
+	// format is the format of the source; if it is FmtUnsupported, it is
+	// determined by the source.
+	format FormatType
+	// formatSource is the format file; if it is empty, the source's format
+	// file is used, if it has one.
+	formatSource string
+	dialect      CSVDialect
+	// noHeader: the first row isn't the column names.
+	noHeader bool
+	// projection selects the columns; if it is nil, the format file's
+	// projection, if any, is used.
+	projection *Projection
+	// filter selects the rows; if it is nil, the format file's filter, if
+	// any, is used.
+	filter *Filter
+	// sort orders the rows; if it is nil, the format file's sort, if any,
+	// is used.
+	sort *Sort
+	// grouping groups the rows, and totals adds summary rows; if they are
+	// nil, the format file's, if any, are used.
+	grouping *Grouping
+	totals   *Totals
+	// computed adds computed columns, before anything else is applied,
+	// after the format file's, if any.
+	computed *Computed
+	// templates render the cells of their columns of md tables, after the
+	// format file's, if any, which they replace for the same columns.
+	templates *Templates
+	// rules style the cells of md tables; if it is nil, the format file's
+	// rules, if any, are used.
+	rules *CellRules
+	// reshape reshapes the table, after the computed columns are added; if
+	// it is nil, the format file's, if any, is used.
+	reshape Reshape
+	// union are the tables whose rows are appended to the table's; with
+	// unionAll, their columns are unioned. See CSV.Union.
+	union    []resource
+	unionAll bool
+	// join, if it isn't nil, joins the table, after the union, with the
+	// joinSource table. unmatched, if it isn't nil, is called with the keys
+	// of each table that didn't match.
+	join       *Join
+	joinSource resource
+	unmatched  func(source string, keys [][]string)
+	// diffSource, if it isn't nil, is the old version of the table; the
+	// table, after the union and join, is replaced by the diff of the two,
+	// by the diffKey columns, rendered in diffStyle. Unchanged rows are
+	// only included with diffUnchanged.
+	diffSource    *resource
+	diffKey       []string
+	diffStyle     DiffStyle
+	diffUnchanged bool
+}
+
+// decodeTable reads the table data in r, which is in the format f. Unless
+// opts.noHeader is set, the first row is the column names. fm is the table's
+// format, if it has one; for fixed-width data, it supplies the column
+// boundaries. name is the source of fm, for errors.
+func decodeTable(r io.Reader, f FormatType, fm *format, name string, opts decodeOptions) (header []string, rows [][]string, err error) {
+	switch f {
+	case FmtCSV:
+		c := NewCSV()
+		c.SetDialect(opts.dialect)
+		c.SetHasHeader(!opts.noHeader)
+		err = c.Read(r)
+		return c.HeaderRow(), c.Rows(), err
+	case FmtFixedWidth:
+		fw := NewFixedWidth()
+		fw.SetHasHeader(!opts.noHeader)
+		// without boundary directives, the boundaries are inferred.
+		if fm != nil && (fm.directives["start"] != nil || fm.directives["width"] != nil) {
+			err = fw.boundariesFrom(fm, name)
+			if err != nil {
+				return nil, nil, &FormatError{Name: name, Err: err}
+			}
+		}
+		err = fw.Read(r)
+		return fw.HeaderRow(), fw.Rows(), err
+	}
+	return nil, nil, &FormatError{Name: f.String(), Err: fmt.Errorf("unsupported source format: %q", f)}
+}
+
+// encodeTable encodes the table using a new Encoder for the format to. If fm
+// isn't nil, its column names, alignment, and emphasis are applied. The
+// pipeline of opts is applied to the table; fm's directives are used for
+// those that opts doesn't set. name is the table's source; SQL uses it for
+// the table name.
+func encodeTable(header []string, rows [][]string, fm *format, opts decodeOptions, to FormatType, name string) ([]byte, error) {
+	if to == FmtMD {
+		to = FmtMDTable
+	}
+	enc, err := NewEncoder(to)
+	if err != nil {
+		return nil, &FormatError{Name: to.String(), Err: err}
+	}
+	if hc, ok := enc.(interface{ SetHasColumnNames(bool) }); ok {
+		hc.SetHasColumnNames(false)
+	}
+	if tn, ok := enc.(interface{ SetTableName(string) }); ok {
+		_, n := compressionFromName(path.Base(name))
+		tn.SetTableName(strings.TrimSuffix(n, path.Ext(n)))
+	}
+	p := pipeline{
+		computed:   opts.computed,
+		reshape:    opts.reshape,
+		filter:     opts.filter,
+		sort:       opts.sort,
+		grouping:   opts.grouping,
+		totals:     opts.totals,
+		rules:      opts.rules,
+		templates:  opts.templates,
+		projection: opts.projection,
+	}
+	t := &pipelineTable{header: header, rows: rows}
+	if fm != nil {
+		if len(fm.columnNames) > 0 {
+			t.header = fm.columnNames
+		}
+		t.alignment, t.emphasis = fm.columnAlignment, fm.columnEmphasis
+		p, err = p.withFormat(fm)
+		if err != nil {
+			return nil, &FormatError{Name: name, Err: err}
+		}
+	}
+	err = p.apply(t, to == FmtMDTable)
+	if err != nil {
+		return nil, &FormatError{Name: name, Err: err}
+	}
+	header, rows, styles, summary := t.header, t.rows, t.styles, t.summary
+	if s, ok := enc.(interface{ setCellStyles([][]cellStyle) }); ok && styles != nil {
+		s.setCellStyles(styles)
+	}
+	if s, ok := enc.(interface{ setSummary([]bool, []string) }); ok && summary != nil {
+		s.setSummary(summary, t.summaryEmphasis)
+	}
+	if fm != nil {
+		if f, ok := enc.(interface{ setUseFormat(bool) }); ok {
+			f.setUseFormat(true)
+		}
+		enc.SetColumnAlignment(t.alignment)
+		if e, ok := enc.(interface{ SetColumnEmphasis([]string) }); ok {
+			e.SetColumnEmphasis(t.emphasis)
+		}
+	}
+	// an md table must have a header row, even if it is blank.
+	if len(header) == 0 && to == FmtMDTable {
+		for _, row := range rows {
+			if len(row) > len(header) {
+				header = make([]string, len(row))
+			}
+		}
+	}
+	enc.SetColumnNames(header)
+	if rows == nil {
+		rows = [][]string{}
+	}
+	err = enc.TransmogrifyStringTable(rows)
+	if err != nil {
+		return nil, err
+	}
+	return enc.Bytes(), nil
+}
+
+// discoverFormat reads the source's format file, if it has one. Format files
+// are only discovered for local files, including the members of local
+// archives. The name of the format file is returned.
+func discoverFormat(src resource) (*format, string, error) {
+	if src.Type != File {
+		return nil, "", nil
+	}
+	name := formatFileFor(src.String())
+	fm, err := readFormatFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", &FormatError{Name: name, Err: fmt.Errorf("%s: %s", name, err)}
+	}
+	return fm, name, nil
+}
+
+// sourceFormat reads the format file in opts, or, if there isn't one, the
+// source's format file, if it has one.
+func sourceFormat(src resource, opts decodeOptions) (*format, string, error) {
+	if opts.formatSource == "" {
+		return discoverFormat(src)
+	}
+	fm, err := readFormatFile(opts.formatSource)
+	if err != nil {
+		return nil, "", &FormatError{Name: opts.formatSource, Err: fmt.Errorf("%s: %s", opts.formatSource, err)}
+	}
+	return fm, opts.formatSource, nil
+}
+
+// readTable reads the table in src, using its format file if it has one.
+// The format file's column names, if it has them, are the header. Errors
+// reading the source are *SourceErrors; errors with the formats are
+// *FormatErrors.
+func readTable(src resource, opts decodeOptions) (header []string, rows [][]string, fm *format, fmtName string, err error) {
+	f, ext := opts.format, opts.format.String()
+	if f == FmtUnsupported {
+		f, ext = formatFromResource(src)
+	}
+	r, err := src.Open()
+	if err != nil {
+		return nil, nil, nil, "", &SourceError{Source: src.String(), Err: err}
+	}
+	defer r.Close()
+	if !isDecodable(f) {
+		return nil, nil, nil, "", &FormatError{Name: ext, Err: fmt.Errorf("unsupported source format: %q", ext)}
+	}
+	fm, fmtName, err = sourceFormat(src, opts)
+	if err != nil {
+		return nil, nil, nil, "", err
+	}
+	header, rows, err = decodeTable(r, f, fm, fmtName, opts)
+	if err != nil {
+		if errors.As(err, new(*FormatError)) {
+			return nil, nil, nil, "", err
+		}
+		return nil, nil, nil, "", &SourceError{Source: src.String(), Err: err}
+	}
+	if fm != nil && len(fm.columnNames) > 0 {
+		header = fm.columnNames
+	}
+	return header, rows, fm, fmtName, nil
+}
+
+// transmogrifyResource reads the table in src, using its format file if it
+// has one, and returns it encoded in the format to. Errors reading the source
+// are *SourceErrors; errors with the formats are *FormatErrors.
+func transmogrifyResource(src resource, to FormatType, opts decodeOptions) ([]byte, error) {
+	header, rows, fm, _, err := readTable(src, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.union) > 0 || opts.join != nil {
+		header, rows, fm, err = combineTables(src, header, rows, fm, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.diffSource != nil {
+		header, rows, fm, err = diffTable(src, header, rows, fm, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return encodeTable(header, rows, fm, opts, to, src.Name)
+}
+
+// combineTables appends the rows of the union's tables to the table of src,
+// and joins it with the join's table. The other tables are read with their
+// own format files, if they have them, and the source format of their
+// extensions. The returned format has the alignment and emphasis of the
+// combined table's columns, from the formats of the tables they come from.
+func combineTables(src resource, header []string, rows [][]string, fm *format, opts decodeOptions) ([]string, [][]string, *format, error) {
+	o := opts
+	o.format, o.formatSource = FmtUnsupported, ""
+	if len(opts.union) > 0 {
+		names := []string{src.String()}
+		headers, tables := [][]string{header}, [][][]string{rows}
+		for _, u := range opts.union {
+			h, r, _, _, err := readTable(u, o)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			names, headers, tables = append(names, u.String()), append(headers, h), append(tables, r)
+		}
+		var cols []int
+		var err error
+		header, rows, cols, err = union(opts.unionAll, names, headers, tables)
+		if err != nil {
+			return nil, nil, nil, &FormatError{Name: src.String(), Err: err}
+		}
+		fm = fm.withColumns(cols, nil, nil)
+	}
+	if opts.join != nil {
+		h, r, rfm, _, err := readTable(opts.joinSource, o)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		res, leftCols, rightCols, err := opts.join.apply(header, rows, h, r)
+		if err != nil {
+			return nil, nil, nil, &FormatError{Name: src.String(), Err: err}
+		}
+		if opts.unmatched != nil {
+			if len(res.UnmatchedLeft) > 0 {
+				opts.unmatched(src.String(), res.UnmatchedLeft)
+			}
+			if len(res.UnmatchedRight) > 0 {
+				opts.unmatched(opts.joinSource.String(), res.UnmatchedRight)
+			}
+		}
+		header, rows = res.Header, res.Rows
+		fm = fm.withColumns(leftCols, rfm, rightCols)
+	}
+	return header, rows, fm, nil
+}
+
+// diffTable returns the diff of the old table, in opts, and the table of src,
+// rendered in the diff's style. The old table is read with its own format
+// file, if it has one. The returned format has the alignment and emphasis of
+// the diff's columns.
+func diffTable(src resource, header []string, rows [][]string, fm *format, opts decodeOptions) ([]string, [][]string, *format, error) {
+	o := opts
+	o.format, o.formatSource = FmtUnsupported, ""
+	h, r, _, _, err := readTable(*opts.diffSource, o)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	d, err := DiffTables(opts.diffKey, h, r, header, rows)
+	if err != nil {
+		return nil, nil, nil, &FormatError{Name: src.String(), Err: err}
+	}
+	header, rows, cols := d.table(opts.diffStyle, opts.diffUnchanged)
+	return header, rows, fm.withColumns(cols, nil, nil), nil
+}
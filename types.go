@@ -0,0 +1,199 @@
+package transmogrifier
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnType is the type of the data in a column.
+type ColumnType int
+
+const (
+	TypeString ColumnType = iota
+	TypeBool
+	TypeInt
+	TypeFloat
+	TypeDate
+	TypeDateTime
+)
+
+func (c ColumnType) String() string { return columnTypes[c] }
+
+var columnTypes = [...]string{
+	"string",
+	"bool",
+	"int",
+	"float",
+	"date",
+	"datetime",
+}
+
+// ColumnTypeFromString returns the ColumnType constant. Anything that isn't a
+// known type is a TypeString.
+func ColumnTypeFromString(s string) ColumnType {
+	s = strings.ToLower(s)
+	switch s {
+	case "bool", "boolean":
+		return TypeBool
+	case "int", "integer":
+		return TypeInt
+	case "float", "number", "numeric":
+		return TypeFloat
+	case "date":
+		return TypeDate
+	case "datetime", "timestamp", "time":
+		return TypeDateTime
+	}
+	return TypeString
+}
+
+// dateLayouts are the layouts that are recognized as TypeDate.
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006/01/02",
+}
+
+// dateTimeLayouts are the layouts that are recognized as TypeDateTime.
+var dateTimeLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+}
+
+// InferColumnTypes returns the type of each column in rows. Empty values are
+// treated as nulls and don't affect the inferred type. A column that has only
+// nulls is a TypeString.
+func InferColumnTypes(rows [][]string) []ColumnType {
+	return inferColumnTypes(rows, isEmpty)
+}
+
+func isEmpty(s string) bool { return s == "" }
+
+// inferColumnTypes returns the type of each column in rows; values for which
+// isNull returns true are skipped.
+func inferColumnTypes(rows [][]string, isNull func(string) bool) []ColumnType {
+	var n int
+	for _, row := range rows {
+		if len(row) > n {
+			n = len(row)
+		}
+	}
+	types := make([]ColumnType, n)
+	for i := range types {
+		types[i] = inferColumnType(rows, i, isNull)
+	}
+	return types
+}
+
+// inferColumnType returns the narrowest type that every non-null value in
+// column i parses as.
+func inferColumnType(rows [][]string, i int, isNull func(string) bool) ColumnType {
+	candidates := []ColumnType{TypeInt, TypeFloat, TypeBool, TypeDate, TypeDateTime}
+	var seen bool
+	for _, row := range rows {
+		if i >= len(row) || isNull(row[i]) {
+			continue
+		}
+		seen = true
+		v := strings.TrimSpace(row[i])
+		var keep []ColumnType
+		for _, typ := range candidates {
+			if isType(v, typ) {
+				keep = append(keep, typ)
+			}
+		}
+		candidates = keep
+		if len(candidates) == 0 {
+			return TypeString
+		}
+	}
+	if !seen {
+		return TypeString
+	}
+	return candidates[0]
+}
+
+// isDecimal returns whether v is a number in decimal notation, e.g. -1.5 or
+// 2e10. Unlike strconv.ParseFloat, NaN, Inf, and hex floats aren't.
+func isDecimal(v string) bool {
+	i := 0
+	if i < len(v) && (v[i] == '+' || v[i] == '-') {
+		i++
+	}
+	var digits int
+	for ; i < len(v) && isDigit(v[i]); i++ {
+		digits++
+	}
+	if i < len(v) && v[i] == '.' {
+		for i++; i < len(v) && isDigit(v[i]); i++ {
+			digits++
+		}
+	}
+	if digits == 0 {
+		return false
+	}
+	if i < len(v) && (v[i] == 'e' || v[i] == 'E') {
+		i++
+		if i < len(v) && (v[i] == '+' || v[i] == '-') {
+			i++
+		}
+		start := i
+		for i < len(v) && isDigit(v[i]) {
+			i++
+		}
+		if i == start {
+			return false
+		}
+	}
+	return i == len(v)
+}
+
+// isType returns whether v can be parsed as the type.
+func isType(v string, typ ColumnType) bool {
+	switch typ {
+	case TypeInt:
+		// values with leading zeros, e.g. ids and zip codes, lose
+		// information as numbers.
+		if len(v) > 1 && v[0] == '0' {
+			return false
+		}
+		_, err := strconv.ParseInt(v, 10, 64)
+		return err == nil
+	case TypeFloat:
+		if len(v) > 1 && v[0] == '0' && v[1] != '.' {
+			return false
+		}
+		if !isDecimal(v) {
+			return false
+		}
+		_, err := strconv.ParseFloat(v, 64)
+		return err == nil
+	case TypeBool:
+		switch strings.ToLower(v) {
+		case "true", "false":
+			return true
+		}
+		return false
+	case TypeDate:
+		_, ok := parseLayouts(v, dateLayouts)
+		return ok
+	case TypeDateTime:
+		_, ok := parseLayouts(v, dateTimeLayouts)
+		return ok
+	}
+	return true
+}
+
+// parseLayouts parses v using the first layout that works.
+func parseLayouts(v string, layouts []string) (time.Time, bool) {
+	for _, layout := range layouts {
+		t, err := time.Parse(layout, v)
+		if err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
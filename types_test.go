@@ -0,0 +1,54 @@
+package transmogrifier
+
+import "testing"
+
+func TestInferColumnTypes(t *testing.T) {
+	tests := []struct {
+		rows     [][]string
+		expected []ColumnType
+	}{
+		{[][]string{}, []ColumnType{}},
+		{[][]string{[]string{"a", "1", "1.5", "true", "2015-10-16", "2015-10-16 12:00:00"}},
+			[]ColumnType{TypeString, TypeInt, TypeFloat, TypeBool, TypeDate, TypeDateTime}},
+		{[][]string{[]string{"1", "1", "00042", ""}, []string{"2", "2.5", "10042", ""}, []string{"", "3", "1", ""}},
+			[]ColumnType{TypeInt, TypeFloat, TypeString, TypeString}},
+		{[][]string{[]string{"false", "2015-10-16"}, []string{"TRUE", "2015-10-16T12:00:00Z"}},
+			[]ColumnType{TypeBool, TypeString}},
+		{[][]string{[]string{"$9.99"}, []string{"0.5"}}, []ColumnType{TypeString}},
+		{[][]string{[]string{"NaN", "-0x1p3", "1.5e3", "Infinity"}, []string{"1", "1", "-.5", "Inf"}},
+			[]ColumnType{TypeString, TypeString, TypeFloat, TypeString}},
+	}
+	for i, test := range tests {
+		types := InferColumnTypes(test.rows)
+		if len(types) != len(test.expected) {
+			t.Errorf("%d: expected %v, got %v", i, test.expected, types)
+			continue
+		}
+		for j, typ := range types {
+			if typ != test.expected[j] {
+				t.Errorf("%d-%d: expected %s, got %s", i, j, test.expected[j], typ)
+			}
+		}
+	}
+}
+
+func TestColumnTypeFromString(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected ColumnType
+	}{
+		{"", TypeString},
+		{"text", TypeString},
+		{"Boolean", TypeBool},
+		{"int", TypeInt},
+		{"numeric", TypeFloat},
+		{"date", TypeDate},
+		{"timestamp", TypeDateTime},
+	}
+	for i, test := range tests {
+		typ := ColumnTypeFromString(test.value)
+		if typ != test.expected {
+			t.Errorf("%d: expected %s, got %s", i, test.expected, typ)
+		}
+	}
+}
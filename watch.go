@@ -0,0 +1,251 @@
+package transmogrifier
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Default Watcher timings.
+const (
+	DefaultWatchInterval = 500 * time.Millisecond
+	DefaultWatchDebounce = 200 * time.Millisecond
+)
+
+// WatchResult is the result of a conversion run by a Watcher.
+type WatchResult struct {
+	// Source is the source that was transmogrified.
+	Source string
+	// Dest is the destination the output was written to.
+	Dest string
+	// Err is the error, if any, that occurred.
+	Err error
+}
+
+// notifier wakes a Watcher when a watched directory changes, so that it
+// doesn't have to wait for the next poll. Notifiers are platform specific;
+// see newNotifier.
+type notifier interface {
+	Events() <-chan struct{}
+	Close() error
+}
+
+// watchJob is a conversion run by a Watcher.
+type watchJob struct {
+	job Job
+	// dest is the job's destination, reported if the job fails.
+	dest string
+	// files are the files that trigger the conversion: the source and its
+	// format file.
+	files []string
+	// state is the last seen state of each file.
+	state []fileState
+	// due is when the conversion is to run; zero if it isn't pending.
+	due time.Time
+}
+
+// fileState is what a Watcher compares to detect changes to a file.
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+	mode    os.FileMode
+}
+
+func statFile(name string) fileState {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{exists: true, size: fi.Size(), modTime: fi.ModTime(), mode: fi.Mode()}
+}
+
+// Watcher reruns conversions when their source, or the source's format file,
+// changes. The files are polled, which works everywhere; where the platform
+// supports it, e.g. inotify on Linux, changes are also noticed without
+// waiting for the next poll. A burst of writes results in one conversion:
+// a conversion runs once its files haven't changed for the debounce period.
+type Watcher struct {
+	jobs     []*watchJob
+	interval time.Duration
+	debounce time.Duration
+	reporter func(WatchResult)
+	// write is how the dests are written.
+	write *WriteOptions
+	// stderr is where results are reported when there isn't a reporter.
+	stderr io.Writer
+}
+
+// NewWatcher returns a Watcher that polls every DefaultWatchInterval, with a
+// debounce period of DefaultWatchDebounce. Failed conversions are written to
+// stderr, use SetReporter to handle the results instead.
+func NewWatcher() *Watcher {
+	return &Watcher{interval: DefaultWatchInterval, debounce: DefaultWatchDebounce, stderr: os.Stderr}
+}
+
+// SetInterval sets how often the files are polled.
+func (w *Watcher) SetInterval(d time.Duration) {
+	w.interval = d
+}
+
+// SetDebounce sets how long the files of a conversion must be unchanged
+// before it runs.
+func (w *Watcher) SetDebounce(d time.Duration) {
+	w.debounce = d
+}
+
+// SetReporter sets the func that the result of every conversion is passed
+// to. It is called from the goroutine that is running Run.
+func (w *Watcher) SetReporter(fn func(WatchResult)) {
+	w.reporter = fn
+}
+
+// SetWriteOptions sets how the dests of the conversions are written, for the
+// jobs that don't have their own.
+func (w *Watcher) SetWriteOptions(opts *WriteOptions) {
+	w.write = opts
+}
+
+// Add adds the job, whose source must be a local file; it is rerun when the
+// source, or its format file, changes. The format file is the job's
+// FormatSource or, if it is empty, the source's format file, e.g.
+// 'data.fmt'; it doesn't need to exist yet. The rest of the job, e.g. its
+// Dialect or Filter, is used as it is by Job.Run.
+func (w *Watcher) Add(j Job) error {
+	s := NewResource(j.Source, FmtUnsupported, File)
+	if s.Type != File || s.Archive != "" {
+		return fmt.Errorf("%s: only local files can be watched", j.Source)
+	}
+	if j.SourceFormat == FmtUnsupported {
+		if ff, ext := formatFromResource(s); !isDecodable(ff) {
+			return fmt.Errorf("%s: unsupported source format: %q", j.Source, ext)
+		}
+	}
+	to := j.Format
+	if to == FmtUnsupported {
+		to = FmtMDTable
+	}
+	d, err := j.dest(s, to)
+	if err != nil {
+		return err
+	}
+	formatSource := j.FormatSource
+	if formatSource == "" {
+		formatSource = formatFileFor(s.String())
+	}
+	files := []string{s.String(), formatSource}
+	w.jobs = append(w.jobs, &watchJob{job: j, dest: d.String(), files: files, state: make([]fileState, len(files))})
+	return nil
+}
+
+// Run runs every conversion, then watches for changes until ctx is done.
+// Conversions that fail are reported; they don't stop the Watcher.
+func (w *Watcher) Run(ctx context.Context) error {
+	if len(w.jobs) == 0 {
+		return fmt.Errorf("nothing to watch")
+	}
+	for _, j := range w.jobs {
+		for i, f := range j.files {
+			j.state[i] = statFile(f)
+		}
+		w.run(j)
+	}
+	var events <-chan struct{}
+	if n, err := newNotifier(w.dirs()); err == nil {
+		defer n.Close()
+		events = n.Events()
+	}
+	interval := w.interval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	// timer fires when the next pending conversion is due.
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-events:
+		case <-timer.C:
+		}
+		now := time.Now()
+		var next time.Time
+		for _, j := range w.jobs {
+			if w.changed(j) {
+				j.due = now.Add(w.debounce)
+			}
+			if j.due.IsZero() {
+				continue
+			}
+			if !now.Before(j.due) {
+				j.due = time.Time{}
+				w.run(j)
+				continue
+			}
+			if next.IsZero() || j.due.Before(next) {
+				next = j.due
+			}
+		}
+		if !next.IsZero() {
+			timer.Reset(next.Sub(now))
+		}
+	}
+}
+
+// changed returns whether any of the job's files changed since they were
+// last checked.
+func (w *Watcher) changed(j *watchJob) bool {
+	var changed bool
+	for i, f := range j.files {
+		st := statFile(f)
+		if st != j.state[i] {
+			j.state[i] = st
+			changed = true
+		}
+	}
+	return changed
+}
+
+// run runs the job's conversion and reports the result.
+func (w *Watcher) run(j *watchJob) {
+	job := j.job
+	if job.Write == nil {
+		job.Write = w.write
+	}
+	dest, err := job.Run()
+	if dest == "" {
+		dest = j.dest
+	}
+	res := WatchResult{Source: job.Source, Dest: dest, Err: err}
+	if w.reporter != nil {
+		w.reporter(res)
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(w.stderr, "%s: %s\n", res.Source, err)
+	}
+}
+
+// dirs returns the directories of the watched files.
+func (w *Watcher) dirs() []string {
+	seen := map[string]bool{}
+	var dirs []string
+	for _, j := range w.jobs {
+		for _, f := range j.files {
+			d := filepath.Dir(f)
+			if !seen[d] {
+				seen[d] = true
+				dirs = append(dirs, d)
+			}
+		}
+	}
+	return dirs
+}
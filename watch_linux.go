@@ -0,0 +1,59 @@
+//go:build linux
+
+package transmogrifier
+
+import (
+	"os"
+	"syscall"
+)
+
+// inotifyMask are the events that wake a Watcher.
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// inotify is the notifier for Linux.
+type inotify struct {
+	f      *os.File
+	events chan struct{}
+}
+
+// newNotifier returns an inotify notifier for the directories. Directories
+// are watched, rather than files, so that files that are replaced, e.g. by
+// editors that write a new file and rename it, are still noticed.
+func newNotifier(dirs []string) (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	for _, d := range dirs {
+		_, err = syscall.InotifyAddWatch(fd, d, inotifyMask)
+		if err != nil {
+			syscall.Close(fd)
+			return nil, os.NewSyscallError("inotify_add_watch", err)
+		}
+	}
+	// the non-blocking fd is handled by the runtime poller, so closing the
+	// file unblocks the read.
+	n := &inotify{f: os.NewFile(uintptr(fd), "inotify"), events: make(chan struct{}, 1)}
+	go n.read()
+	return n, nil
+}
+
+func (n *inotify) read() {
+	buf := make([]byte, 4096)
+	for {
+		_, err := n.f.Read(buf)
+		if err != nil {
+			return
+		}
+		// the events themselves don't matter; the Watcher checks its files.
+		select {
+		case n.events <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (n *inotify) Events() <-chan struct{} { return n.events }
+
+func (n *inotify) Close() error { return n.f.Close() }
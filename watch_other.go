@@ -0,0 +1,10 @@
+//go:build !linux
+
+package transmogrifier
+
+import "errors"
+
+// newNotifier returns an error; changes are only noticed by polling.
+func newNotifier(dirs []string) (notifier, error) {
+	return nil, errors.New("file change notifications aren't supported")
+}
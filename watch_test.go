@@ -0,0 +1,184 @@
+package transmogrifier
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatcherAdd(t *testing.T) {
+	tests := []struct {
+		job          Job
+		dest         string
+		formatSource string
+		expectedErr  string
+	}{
+		{Job{Source: "data/test.csv"}, "data/test.md", "data/test.fmt", ""},
+		{Job{Source: "data/test.fwf"}, "data/test.md", "data/test.fmt", ""},
+		{Job{Source: "data/test.csv", Dest: "out.sql", Format: FmtSQL, FormatSource: "fmt/test.fmt"}, "out.sql", "fmt/test.fmt", ""},
+		{Job{Source: "data/test.txt", SourceFormat: FmtCSV}, "data/test.md", "data/test.fmt", ""},
+		{Job{Source: "https://example.com/test.csv"}, "", "", "https://example.com/test.csv: only local files can be watched"},
+		{Job{Source: "bundle.zip!/test.csv"}, "", "", "bundle.zip!/test.csv: only local files can be watched"},
+		{Job{Source: "data/test.txt"}, "", "", `data/test.txt: unsupported source format: "txt"`},
+	}
+	for i, test := range tests {
+		w := NewWatcher()
+		err := w.Add(test.job)
+		if err != nil {
+			if err.Error() != test.expectedErr {
+				t.Errorf("%d: expected %q, got %q", i, test.expectedErr, err)
+			}
+			continue
+		}
+		if test.expectedErr != "" {
+			t.Errorf("%d: expected %q, got no error", i, test.expectedErr)
+			continue
+		}
+		j := w.jobs[0]
+		if j.dest != test.dest || j.files[1] != test.formatSource {
+			t.Errorf("%d: expected %q and %q, got %q and %q", i, test.dest, test.formatSource, j.dest, j.files[1])
+		}
+	}
+}
+
+func TestWatcherRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "data.csv")
+	dest := filepath.Join(dir, "out.md")
+	ioutil.WriteFile(src, []byte("a,b\n1,2\n"), 0644)
+
+	results := make(chan WatchResult, 10)
+	w := NewWatcher()
+	w.SetInterval(10 * time.Millisecond)
+	w.SetDebounce(50 * time.Millisecond)
+	w.SetReporter(func(r WatchResult) { results <- r })
+	err = w.Add(Job{Source: src, Dest: dest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	next := func(step string) WatchResult {
+		select {
+		case r := <-results:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: no result", step)
+		}
+		return WatchResult{}
+	}
+	expectMD := func(step, expected string) {
+		r := next(step)
+		if r.Err != nil {
+			t.Fatalf("%s: expected no error, got %q", step, r.Err)
+		}
+		b, _ := ioutil.ReadFile(dest)
+		if string(b) != expected {
+			t.Errorf("%s: expected %q, got %q", step, expected, b)
+		}
+	}
+	expectMD("initial", "|a|b|  \n|---|---|  \n|1|2|  \n")
+
+	// a burst of writes is one conversion.
+	for i := 0; i < 5; i++ {
+		ioutil.WriteFile(src, []byte("a,b\n1,2\n"+strings.Repeat("3,4\n", i+1)), 0644)
+		time.Sleep(5 * time.Millisecond)
+	}
+	expectMD("burst", "|a|b|  \n|---|---|  \n|1|2|  \n"+strings.Repeat("|3|4|  \n", 5))
+
+	ioutil.WriteFile(filepath.Join(dir, "data.fmt"), []byte("A,B\nleft,right\n,\n"), 0644)
+	expectMD("format", "|A|B|  \n|:---|---:|  \n|1|2|  \n"+strings.Repeat("|3|4|  \n", 5))
+
+	ioutil.WriteFile(src, []byte("a,b\n1,2,3\n"), 0644)
+	r := next("bad")
+	if r.Err == nil || r.Source != src {
+		t.Errorf("bad: expected an error for %s, got %+v", src, r)
+	}
+
+	// the watcher keeps running after an error.
+	ioutil.WriteFile(src, []byte("a,b\n5,6\n"), 0644)
+	expectMD("recovered", "|A|B|  \n|:---|---:|  \n|5|6|  \n")
+
+	select {
+	case r := <-results:
+		t.Errorf("expected no more results, got %+v", r)
+	case <-time.After(100 * time.Millisecond):
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("expected no error, got %q", err)
+	}
+}
+
+func TestWatcherStderr(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWatcher()
+	w.stderr = &buf
+	w.Add(Job{Source: "test_files/missing.csv", Dest: os.DevNull})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := w.Run(ctx)
+	if err != nil {
+		t.Errorf("expected no error, got %q", err)
+	}
+	if !strings.HasPrefix(buf.String(), "test_files/missing.csv: open test_files/missing.csv:") {
+		t.Errorf("expected the error on stderr, got %q", buf.String())
+	}
+	err = NewWatcher().Run(ctx)
+	if err == nil || err.Error() != "nothing to watch" {
+		t.Errorf("expected nothing to watch, got %v", err)
+	}
+}
+
+func TestWatcherJob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "data.txt")
+	dest := filepath.Join(dir, "out.md")
+	ioutil.WriteFile(src, []byte("1;2\n3;4\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "layout.fmt"), []byte("A,B\nleft,right\n,\n"), 0644)
+
+	var results []WatchResult
+	w := NewWatcher()
+	w.SetReporter(func(r WatchResult) { results = append(results, r) })
+	err = w.Add(Job{
+		Source:       src,
+		Dest:         dest,
+		SourceFormat: FmtCSV,
+		FormatSource: filepath.Join(dir, "layout.fmt"),
+		Dialect:      CSVDialect{Comma: ';'},
+		NoHeader:     true,
+		Filter:       "A > 1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = w.Run(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err)
+	}
+	if len(results) != 1 || results[0].Err != nil || results[0].Dest != dest {
+		t.Fatalf("expected a result for %s, got %+v", dest, results)
+	}
+	expected := "|A|B|  \n|:---|---:|  \n|3|4|  \n"
+	b, _ := ioutil.ReadFile(dest)
+	if string(b) != expected {
+		t.Errorf("expected %q, got %q", expected, b)
+	}
+}
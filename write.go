@@ -0,0 +1,171 @@
+package transmogrifier
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// DefaultFileMode is the mode of new local files, unless WriteOptions sets
+// another.
+const DefaultFileMode os.FileMode = 0640
+
+// WriteOptions configures how local files are written. Files are always
+// written to a temporary file in the same directory, which replaces the
+// destination once it has been completely written, so the destination is
+// never left partially written.
+type WriteOptions struct {
+	// NoClobber: if the destination exists, it isn't replaced; an error
+	// satisfying errors.Is(err, os.ErrExist) is returned instead.
+	NoClobber bool
+	// Backup: if the destination exists, it is kept as the destination
+	// plus '.bak', replacing any previous backup.
+	Backup bool
+	// Mode is the mode of new files. If it is 0, DefaultFileMode is used.
+	// Files that are replaced keep their mode.
+	Mode os.FileMode
+}
+
+func (o *WriteOptions) mode() os.FileMode {
+	if o == nil || o.Mode == 0 {
+		return DefaultFileMode
+	}
+	return o.Mode
+}
+
+// atomicWriter writes to a temporary file that replaces the destination when
+// it is closed. If a write fails, the temporary file is removed on Close and
+// the destination is left as it was.
+type atomicWriter struct {
+	name string
+	tmp  *os.File
+	opts WriteOptions
+	mode os.FileMode
+	err  error
+}
+
+// createAtomic returns an atomicWriter for the file. If the file is a
+// symlink, the file it links to is replaced. Files that exist but aren't
+// regular files, e.g. devices and named pipes, can't be replaced, so they
+// are written to directly.
+func createAtomic(name string, opts *WriteOptions) (io.WriteCloser, error) {
+	w := &atomicWriter{name: name, mode: opts.mode()}
+	if opts != nil {
+		w.opts = *opts
+	}
+	if target, err := filepath.EvalSymlinks(name); err == nil {
+		w.name = target
+	}
+	fi, err := os.Stat(w.name)
+	switch {
+	case err == nil && w.opts.NoClobber:
+		return nil, &os.PathError{Op: "create", Path: name, Err: os.ErrExist}
+	case err == nil && !fi.Mode().IsRegular():
+		return os.OpenFile(w.name, os.O_WRONLY|os.O_TRUNC, 0)
+	case err == nil:
+		w.mode = fi.Mode().Perm()
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	w.tmp, err = ioutil.TempFile(filepath.Dir(w.name), "."+filepath.Base(w.name)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *atomicWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.tmp.Write(p)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// Close replaces the destination with the temporary file.
+func (w *atomicWriter) Close() error {
+	err := w.err
+	if err == nil {
+		err = w.tmp.Sync()
+	}
+	if err == nil {
+		err = w.tmp.Chmod(w.mode)
+	}
+	cerr := w.tmp.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = w.replace()
+	}
+	if err != nil {
+		os.Remove(w.tmp.Name())
+	}
+	return err
+}
+
+// replace renames the temporary file to the destination, backing the
+// destination up first, if that was requested.
+func (w *atomicWriter) replace() error {
+	if w.opts.NoClobber {
+		// linking fails if the destination was created since the writer
+		// was, unlike a rename, which would replace it.
+		err := os.Link(w.tmp.Name(), w.name)
+		if err == nil {
+			return os.Remove(w.tmp.Name())
+		}
+		if os.IsExist(err) {
+			return &os.PathError{Op: "create", Path: w.name, Err: os.ErrExist}
+		}
+		// the file system may not support links.
+		if _, serr := os.Lstat(w.name); serr == nil {
+			return &os.PathError{Op: "create", Path: w.name, Err: os.ErrExist}
+		}
+	}
+	if w.opts.Backup {
+		err := backupFile(w.name)
+		if err != nil {
+			return err
+		}
+	}
+	return os.Rename(w.tmp.Name(), w.name)
+}
+
+// backupFile keeps the file, if it exists, as the file plus '.bak'. The file
+// is linked if possible, otherwise it is copied.
+func backupFile(name string) error {
+	fi, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	bak := name + ".bak"
+	err = os.Remove(bak)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if os.Link(name, bak) == nil {
+		return nil
+	}
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(bak, os.O_CREATE|os.O_EXCL|os.O_WRONLY, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	cerr := dst.Close()
+	if err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,132 @@
+package transmogrifier
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, s string, opts *WriteOptions) error {
+		w, err := createAtomic(filepath.Join(dir, name), opts)
+		if err != nil {
+			return err
+		}
+		w.Write([]byte(s))
+		return w.Close()
+	}
+	read := func(name string) string {
+		b, _ := ioutil.ReadFile(filepath.Join(dir, name))
+		return string(b)
+	}
+	mode := func(name string) os.FileMode {
+		fi, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			return 0
+		}
+		return fi.Mode().Perm()
+	}
+
+	// new files get the default, or configured, mode.
+	write("a.md", "a", nil)
+	if read("a.md") != "a" || mode("a.md") != DefaultFileMode {
+		t.Errorf("new: expected %q %v, got %q %v", "a", DefaultFileMode, read("a.md"), mode("a.md"))
+	}
+	write("b.md", "b", &WriteOptions{Mode: 0600})
+	if mode("b.md") != 0600 {
+		t.Errorf("mode: expected %v, got %v", os.FileMode(0600), mode("b.md"))
+	}
+
+	// replaced files keep their mode.
+	os.Chmod(filepath.Join(dir, "a.md"), 0604)
+	write("a.md", "aa", &WriteOptions{Mode: 0600})
+	if read("a.md") != "aa" || mode("a.md") != 0604 {
+		t.Errorf("preserve: expected %q %v, got %q %v", "aa", os.FileMode(0604), read("a.md"), mode("a.md"))
+	}
+
+	// no clobber
+	err = write("a.md", "clobbered", &WriteOptions{NoClobber: true})
+	if !errors.Is(err, os.ErrExist) || read("a.md") != "aa" {
+		t.Errorf("no clobber: expected an exist error and %q, got %v and %q", "aa", err, read("a.md"))
+	}
+	err = write("c.md", "c", &WriteOptions{NoClobber: true})
+	if err != nil || read("c.md") != "c" {
+		t.Errorf("no clobber: expected no error and %q, got %v and %q", "c", err, read("c.md"))
+	}
+	w, _ := createAtomic(filepath.Join(dir, "d.md"), &WriteOptions{NoClobber: true})
+	ioutil.WriteFile(filepath.Join(dir, "d.md"), []byte("hand written"), 0644)
+	w.Write([]byte("d"))
+	err = w.Close()
+	if !errors.Is(err, os.ErrExist) || read("d.md") != "hand written" {
+		t.Errorf("no clobber race: expected an exist error and %q, got %v and %q", "hand written", err, read("d.md"))
+	}
+
+	// backups
+	write("a.md", "aaa", &WriteOptions{Backup: true})
+	write("a.md", "aaaa", &WriteOptions{Backup: true})
+	if read("a.md") != "aaaa" || read("a.md.bak") != "aaa" || mode("a.md.bak") != 0604 {
+		t.Errorf("backup: expected %q and %q, got %q and %q", "aaaa", "aaa", read("a.md"), read("a.md.bak"))
+	}
+	write("e.md", "e", &WriteOptions{Backup: true})
+	if _, err := os.Stat(filepath.Join(dir, "e.md.bak")); !os.IsNotExist(err) {
+		t.Errorf("backup: expected no backup of a new file, got %v", err)
+	}
+
+	// a failed write leaves the destination as it was.
+	w, _ = createAtomic(filepath.Join(dir, "a.md"), nil)
+	w.Write([]byte("partial"))
+	w.(*atomicWriter).err = errors.New("disk full")
+	err = w.Close()
+	if err == nil || err.Error() != "disk full" || read("a.md") != "aaaa" {
+		t.Errorf("failed: expected disk full and %q, got %v and %q", "aaaa", err, read("a.md"))
+	}
+
+	// symlinks are followed.
+	os.Symlink("a.md", filepath.Join(dir, "link.md"))
+	write("link.md", "linked", nil)
+	fi, _ := os.Lstat(filepath.Join(dir, "link.md"))
+	if fi.Mode()&os.ModeSymlink == 0 || read("a.md") != "linked" {
+		t.Errorf("symlink: expected the link to be kept and %q, got %v and %q", "linked", fi.Mode(), read("a.md"))
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	for _, fi := range files {
+		if filepath.Ext(fi.Name()) == ".tmp" {
+			t.Errorf("expected no temporary files, got %s", fi.Name())
+		}
+	}
+}
+
+func TestMDTableWriteOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "test.md")
+	ioutil.WriteFile(dest, []byte("hand written"), 0644)
+	md := NewMDTable()
+	md.TransmogrifyStringTable([][]string{[]string{"a"}})
+	md.SetWriteOptions(&WriteOptions{NoClobber: true})
+	md.SetDest(dest)
+	_, _, err = md.WriteToFile()
+	if !errors.Is(err, os.ErrExist) {
+		t.Errorf("expected an exist error, got %v", err)
+	}
+	md.SetWriteOptions(&WriteOptions{Backup: true})
+	_, _, err = md.WriteToFile()
+	if err != nil {
+		t.Errorf("expected no error, got %q", err)
+	}
+	b, _ := ioutil.ReadFile(dest + ".bak")
+	if string(b) != "hand written" {
+		t.Errorf("expected %q, got %q", "hand written", b)
+	}
+}